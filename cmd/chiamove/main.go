@@ -0,0 +1,7 @@
+package main
+
+import "chiaMove/pkg/chiamove"
+
+func main() {
+	chiamove.Main()
+}
@@ -2,11 +2,12 @@ module chiaMove
 
 go 1.21.6
 
-require gopkg.in/yaml.v2 v2.4.0
+require (
+	golang.org/x/sys v0.19.0
+	gopkg.in/yaml.v2 v2.4.0
+)
 
 require (
 	github.com/otiai10/copy v1.14.0 // indirect
-	github.com/thoas/go-funk v0.9.3 // indirect
 	golang.org/x/sync v0.3.0 // indirect
-	golang.org/x/sys v0.19.0 // indirect
 )
@@ -0,0 +1,289 @@
+package chiamove
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// AgentConfig 推送到 agent://host:port/path 目标时使用的参数
+type AgentConfig struct {
+	Token string `yaml:"token"` // 与agent的 --token 相同
+	// agents:// 目标的TLS参数：ca 为信任的CA证书，agent使用自签名证书时指定该证书；
+	// cert/key 为客户端证书，agent设置了 --client-ca 时需要
+	CA   string `yaml:"ca"`
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+// agentTLSConfig 按 agent 配置创建TLS参数，都没有设置时使用系统的CA
+func agentTLSConfig(c AgentConfig) (*tls.Config, error) {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CA != "" {
+		pool, err := loadCertPool(c.CA)
+		if err != nil {
+			return nil, fmt.Errorf(T("读取 agent.ca 失败: %w"), err)
+		}
+		tc.RootCAs = pool
+	}
+	if c.Cert != "" || c.Key != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, fmt.Errorf(T("读取 agent.cert/agent.key 失败: %w"), err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(buf) {
+		return nil, fmt.Errorf(T("%s 中没有PEM格式的证书"), file)
+	}
+	return pool, nil
+}
+
+// setAgentClient 按配置替换请求agent使用的客户端，配置已由 Validate 检查过
+func setAgentClient(c AgentConfig) {
+	tc, err := agentTLSConfig(c)
+	if err != nil {
+		slog.Error("agent的TLS配置无效", "err", err)
+		return
+	}
+	agentClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tc, ForceAttemptHTTP2: true}}
+}
+
+// agentTarget 对应 agent://host:port/mnt/disk1（HTTP）或 agents://host:port/mnt/disk1（HTTPS）形式的目标路径
+type agentTarget struct {
+	scheme string
+	host   string
+	path   string
+	token  string
+}
+
+func parseAgent(dest string) (agentTarget, bool) {
+	scheme := "http"
+	rest, ok := strings.CutPrefix(dest, "agent://")
+	if !ok {
+		scheme = "https"
+		if rest, ok = strings.CutPrefix(dest, "agents://"); !ok {
+			return agentTarget{}, false
+		}
+	}
+	host, p, _ := strings.Cut(rest, "/")
+	return agentTarget{scheme: scheme, host: host, path: "/" + p}, true
+}
+
+// agentFor 解析 agent:// 路径，请求时使用 c 中的 agent.token
+func agentFor(c *Config, dest string) (agentTarget, bool) {
+	a, ok := parseAgent(dest)
+	a.token = c.Agent.Token
+	return a, ok
+}
+
+// dest 返回agent上另一个路径对应的目标写法
+func (a agentTarget) dest(p string) string {
+	prefix := "agent://"
+	if a.scheme == "https" {
+		prefix = "agents://"
+	}
+	return prefix + a.host + p
+}
+
+// 上传不设置超时，由任务的 ctx 控制；其他请求使用 agentRequestTimeout
+var agentClient = &http.Client{}
+
+const agentRequestTimeout = 30 * time.Second
+
+// call 请求agent，out 不为nil时解析JSON响应
+func (a agentTarget) call(ctx context.Context, method, endpoint string, query url.Values, body io.Reader, size int64, out any) error {
+	u := url.URL{Scheme: a.scheme, Host: a.host, Path: "/agent/" + endpoint, RawQuery: query.Encode()}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+	resp, err := agentClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("agent %s %s: %s", a.host, resp.Status, strings.TrimSpace(string(msg)))
+		if resp.StatusCode == http.StatusNotFound {
+			err = fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+		}
+		return err
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+func (a agentTarget) get(endpoint string, query url.Values, out any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), agentRequestTimeout)
+	defer cancel()
+	return a.call(ctx, http.MethodGet, endpoint, query, nil, 0, out)
+}
+
+func (a agentTarget) post(endpoint string, query url.Values) error {
+	ctx, cancel := context.WithTimeout(context.Background(), agentRequestTimeout)
+	defer cancel()
+	return a.call(ctx, http.MethodPost, endpoint, query, nil, 0, nil)
+}
+
+func (a agentTarget) diskUsage() (DiskUsage, error) {
+	var usage DiskUsage
+	err := a.get("usage", url.Values{"path": {a.path}}, &usage)
+	return usage, err
+}
+
+func (a agentTarget) ready() error {
+	return a.get("ready", url.Values{"path": {a.path}}, nil)
+}
+
+func (a agentTarget) list() ([]string, error) {
+	var names []string
+	err := a.get("list", url.Values{"path": {a.path}}, &names)
+	return names, err
+}
+
+func (a agentTarget) rename(from, to string) error {
+	return a.post("rename", url.Values{"from": {from}, "to": {to}})
+}
+
+// agentTransport 推送到 agent:// 目标，先写入临时名称，完成后由agent改名
+type agentTransport struct{ cfg *Config }
+
+func (agentTransport) Name() string { return "agent" }
+
+func (agentTransport) Resume(src, dst string, interrupted bool) error { return nil }
+
+func (t agentTransport) Copy(ctx context.Context, src, dst string) error {
+	name := filepath.Base(src)
+	if err := agentCopy(ctx, t.cfg, src, destPath(dst, name+partialSuffix)); err != nil {
+		return err
+	}
+	a, _ := agentFor(t.cfg, dst)
+	if err := a.rename(path.Join(a.path, name+partialSuffix), path.Join(a.path, name)); err != nil {
+		return fmt.Errorf(T("agent目标改名失败: %w"), err)
+	}
+	return nil
+}
+
+// Verify uploadFile 已比较了每个文件的大小，agent不支持读取内容
+func (t agentTransport) Verify(ctx context.Context, src, dst string) error {
+	if t.cfg.Verify != "none" {
+		slog.Warn("agent目标不支持校验，跳过", "dst", dst)
+	}
+	return nil
+}
+
+func (t agentTransport) FreeSpace(dst string) (DiskUsage, error) {
+	a, _ := agentFor(t.cfg, dst)
+	return a.diskUsage()
+}
+
+// agentCopy 把 src（文件或文件夹）推送到agent上的 target，
+// agent上已有的文件比源文件小时从已写入的位置继续
+func agentCopy(ctx context.Context, c *Config, src, target string) error {
+	a, _ := agentFor(c, target)
+	limiters := []*rateLimiter{newRateLimiter(uint64(currentThrottle(c).PerTransfer)), globalLimiter}
+	copied := new(atomic.Uint64)
+	nativeProgress.Store(src, copied)
+	defer nativeProgress.Delete(src)
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		out := path.Join(a.path, filepath.ToSlash(rel))
+		switch {
+		case d.IsDir():
+			return a.post("mkdir", url.Values{"path": {out}})
+		case d.Type().IsRegular():
+			w := &throttledWriter{ctx: ctx, limiters: limiters, copied: copied}
+			return a.uploadFile(ctx, p, out, w)
+		default:
+			return fmt.Errorf(T("agent目标不支持的文件类型: %s"), p)
+		}
+	})
+}
+
+// uploadFile 上传单个文件，w 只提供限速、取消和进度统计
+func (a agentTarget) uploadFile(ctx context.Context, src, dst string, w *throttledWriter) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	var remote agentFileInfo
+	if err := a.get("stat", url.Values{"path": {dst}}, &remote); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	offset := remote.Size
+	if offset > info.Size() {
+		// 目标比源文件还大，说明不是同一个文件，重新上传
+		offset = 0
+	}
+	w.copied.Add(uint64(offset))
+	if _, err := in.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	w.w = pw
+	go func() {
+		_, err := io.Copy(w, in)
+		pw.CloseWithError(err)
+	}()
+	query := url.Values{
+		"path":   {dst},
+		"offset": {strconv.FormatInt(offset, 10)},
+		"mode":   {strconv.FormatUint(uint64(info.Mode().Perm()), 8)},
+		"mtime":  {strconv.FormatInt(info.ModTime().Unix(), 10)},
+	}
+	var result agentFileInfo
+	err = a.call(ctx, http.MethodPut, "file", query, pr, info.Size()-offset, &result)
+	pr.Close()
+	if err != nil {
+		return err
+	}
+	if result.Size != info.Size() {
+		return fmt.Errorf(T("agent上的文件大小 %d 与源文件 %d 不一致: %s"), result.Size, info.Size(), dst)
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package chiamove
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// agentServer 运行在harvester上，接收plotter推送的文件并报告剩余空间，不需要NFS或ssh
+type agentServer struct {
+	roots []string
+	token string
+}
+
+// runAgent 实现 agent 子命令
+func runAgent(args []string) int {
+	fs := flag.NewFlagSet("chiamove agent", flag.ContinueOnError)
+	listen := fs.String("listen", ":8444", T("监听地址"))
+	token := fs.String("token", os.Getenv("CHIAMOVE_AGENT_TOKEN"), T("客户端需要在配置 agent.token 中提供的令牌，也可以用环境变量 CHIAMOVE_AGENT_TOKEN"))
+	certFile := fs.String("cert", "", T("TLS证书，设置后使用HTTPS（HTTP/2），客户端目标写为 agents://"))
+	keyFile := fs.String("key", "", T("TLS私钥"))
+	clientCA := fs.String("client-ca", "", T("客户端证书的CA，设置后只接受持有该CA签发的证书的客户端（mTLS），需要同时设置 --cert"))
+	requireMount := fs.Bool("require-mount", false, T("要求目标不在系统盘上，避免硬盘没挂载时写进根分区"))
+	var roots []string
+	fs.Func("root", T("允许写入的目录，可以指定多次"), func(s string) error {
+		abs, err := filepath.Abs(s)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, abs)
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	SetupLogger(LoggingConfig{}, os.Stderr)
+	if len(roots) == 0 {
+		fmt.Fprintln(os.Stderr, T("至少需要用 --root 指定一个允许写入的目录"))
+		return exitConfigError
+	}
+	if *token == "" {
+		slog.Warn("没有设置 --token，任何能访问该端口的客户端都可以写入")
+	}
+	// checkDestinationReady 读取全局配置
+	config = &Config{RequireMount: *requireMount}
+	s := &agentServer{roots: roots, token: *token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/agent/usage", getOnly(s.handleUsage))
+	mux.HandleFunc("/agent/ready", getOnly(s.handleReady))
+	mux.HandleFunc("/agent/list", getOnly(s.handleList))
+	mux.HandleFunc("/agent/stat", getOnly(s.handleStat))
+	mux.HandleFunc("/agent/mkdir", postOnly(s.handleMkdir))
+	mux.HandleFunc("/agent/file", methodOnly(http.MethodPut, s.handleFile))
+	mux.HandleFunc("/agent/rename", postOnly(s.handleRename))
+	server := &http.Server{Addr: *listen, Handler: s.auth(mux), ReadHeaderTimeout: 30 * time.Second}
+	if *clientCA != "" {
+		if *certFile == "" {
+			fmt.Fprintln(os.Stderr, T("--client-ca 需要同时设置 --cert 和 --key"))
+			return exitConfigError
+		}
+		pool, err := loadCertPool(*clientCA)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, T("读取 --client-ca 失败: %v\n"), err)
+			return exitConfigError
+		}
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	}
+	slog.Info("agent已启动", "listen", *listen, "roots", roots, "tls", *certFile != "", "mtls", *clientCA != "")
+	var err error
+	if *certFile != "" {
+		err = server.ListenAndServeTLS(*certFile, *keyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	slog.Error("agent退出", "err", err)
+	return exitError
+}
+
+func (s *agentServer) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+			http.Error(w, T("令牌无效"), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// resolve 把请求中的路径转换为本地路径，只允许 --root 指定的目录及其子目录
+func (s *agentServer) resolve(r *http.Request, key string) (string, error) {
+	p := filepath.Clean(filepath.FromSlash(r.URL.Query().Get(key)))
+	for _, root := range s.roots {
+		if rel, err := filepath.Rel(root, p); err == nil && filepath.IsAbs(p) && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf(T("路径不在允许写入的目录中: %s"), p)
+}
+
+// agentError 把错误写入响应，路径不存在返回404，目标已存在返回409
+func agentError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, fs.ErrExist):
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func (s *agentServer) handleUsage(w http.ResponseWriter, r *http.Request) {
+	p, err := s.resolve(r, "path")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	usage, err := GetDiskUsage(p)
+	if err != nil {
+		agentError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+func (s *agentServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	p, err := s.resolve(r, "path")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := checkDestinationReady(config, p); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *agentServer) handleList(w http.ResponseWriter, r *http.Request) {
+	p, err := s.resolve(r, "path")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		agentError(w, err)
+		return
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+type agentFileInfo struct {
+	Size int64 `json:"size"`
+}
+
+func (s *agentServer) handleStat(w http.ResponseWriter, r *http.Request) {
+	p, err := s.resolve(r, "path")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		agentError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, agentFileInfo{Size: info.Size()})
+}
+
+func (s *agentServer) handleMkdir(w http.ResponseWriter, r *http.Request) {
+	p, err := s.resolve(r, "path")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := os.MkdirAll(p, 0755); err != nil {
+		agentError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleFile 从 offset 开始写入请求体，已有的文件先截断到 offset，用于续传；
+// 写入完成后同步到磁盘并设置修改时间，返回文件大小
+func (s *agentServer) handleFile(w http.ResponseWriter, r *http.Request) {
+	p, err := s.resolve(r, "path")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	offset, _ := strconv.ParseInt(q.Get("offset"), 10, 64)
+	mode, err := strconv.ParseUint(q.Get("mode"), 8, 32)
+	if err != nil {
+		mode = 0644
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY, os.FileMode(mode).Perm())
+	if err != nil {
+		agentError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		agentError(w, err)
+		return
+	}
+	if info.Size() < offset {
+		http.Error(w, fmt.Sprintf(T("文件只有 %d 字节，不能从 %d 续传"), info.Size(), offset), http.StatusConflict)
+		return
+	}
+	if err := f.Truncate(offset); err != nil {
+		agentError(w, err)
+		return
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		agentError(w, err)
+		return
+	}
+	if _, err := io.Copy(f, r.Body); err != nil {
+		agentError(w, err)
+		return
+	}
+	if err := f.Sync(); err != nil {
+		agentError(w, err)
+		return
+	}
+	if info, err = f.Stat(); err != nil {
+		agentError(w, err)
+		return
+	}
+	if err := f.Close(); err != nil {
+		agentError(w, err)
+		return
+	}
+	if sec, err := strconv.ParseInt(q.Get("mtime"), 10, 64); err == nil {
+		mtime := time.Unix(sec, 0)
+		os.Chtimes(p, mtime, mtime)
+	}
+	writeJSON(w, http.StatusOK, agentFileInfo{Size: info.Size()})
+}
+
+// handleRename 把临时名称改为最终名称，最终名称已存在时返回409
+func (s *agentServer) handleRename(w http.ResponseWriter, r *http.Request) {
+	from, err := s.resolve(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	to, err := s.resolve(r, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if _, err := os.Lstat(to); err == nil {
+		agentError(w, fmt.Errorf(T("目标已存在: %s: %w"), to, fs.ErrExist))
+		return
+	}
+	if err := os.Rename(from, to); err != nil {
+		agentError(w, err)
+		return
+	}
+	slog.Info("已接收", "path", to)
+	w.WriteHeader(http.StatusNoContent)
+}
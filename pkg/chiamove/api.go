@@ -0,0 +1,222 @@
+package chiamove
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type APIConfig struct {
+	Listen string `yaml:"listen"` // 如 127.0.0.1:8080，为空时不启动
+	Token  string `yaml:"token"`  // 暂停、取消、增删目标等控制请求需要带 Authorization: Bearer <token>；为空时只能监听本机地址
+}
+
+func StartAPIServer(listen, token string) {
+	handler := apiHandler(token)
+	go func() {
+		slog.Info("API服务已启动", "listen", listen)
+		if err := http.ListenAndServe(listen, handler); err != nil {
+			slog.Error("API服务退出", "err", err)
+		}
+	}()
+}
+
+func apiHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		status := currentStatus()
+		// 统计plot数量需要列出目标上的文件，只在请求时计算
+		if r.URL.Query().Get("disks") != "" {
+			status.Disks = diskStatuses()
+		}
+		writeJSON(w, http.StatusOK, status)
+	}))
+	mux.HandleFunc("/api/queue", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, tracker.Queued())
+	}))
+	mux.HandleFunc("/api/transfers", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, tracker.Active())
+	}))
+	mux.HandleFunc("/api/history", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, tracker.History())
+	}))
+	mux.HandleFunc("/api/pause", postOnly(func(w http.ResponseWriter, r *http.Request) {
+		tracker.Pause()
+		slog.Info("调度已暂停", "by", "api")
+		writeJSON(w, http.StatusOK, map[string]bool{"paused": true})
+	}))
+	mux.HandleFunc("/api/resume", postOnly(func(w http.ResponseWriter, r *http.Request) {
+		tracker.Resume()
+		wake()
+		slog.Info("调度已恢复", "by", "api")
+		writeJSON(w, http.StatusOK, map[string]bool{"paused": false})
+	}))
+	mux.HandleFunc("/api/cancel", postOnly(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Src string `json:"src"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Src == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": T("请求体应为 {\"src\": \"...\"}")})
+			return
+		}
+		if !tracker.Cancel(body.Src) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": T("没有找到排队或进行中的任务")})
+			return
+		}
+		slog.Info("取消任务", "src", body.Src, "by", "api")
+		writeJSON(w, http.StatusOK, map[string]bool{"canceled": true})
+	}))
+	mux.HandleFunc("/api/failed", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, journal.Entries(StateFailed))
+	}))
+	mux.HandleFunc("/api/failed/retry", postOnly(func(w http.ResponseWriter, r *http.Request) {
+		// 请求体为空或 srcs 为空时重试全部失败的任务
+		var body struct {
+			Srcs []string `json:"srcs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": T("请求体应为 {\"srcs\": [...]}")})
+			return
+		}
+		cleared := retryFailed(body.Srcs)
+		slog.Info("重试失败的任务", "count", len(cleared), "by", "api")
+		writeJSON(w, http.StatusOK, cleared)
+	}))
+	mux.HandleFunc("/api/destinations", handleDestinations)
+	return apiAuth(token, mux)
+}
+
+// apiAuth 要求除 GET、HEAD 以外的请求带上令牌，查询接口不需要
+func apiAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && token != "" &&
+			subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, T("令牌无效"), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loopbackListen 判断监听地址是否只在本机可以访问，只写端口时监听所有网卡
+func loopbackListen(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Status 调度器的整体状态，供 chiamove status 查询
+type Status struct {
+	Paused       bool                `json:"paused"`
+	Queued       []Transfer          `json:"queued"`
+	Transfers    []Transfer          `json:"transfers"`
+	Destinations []DestinationStatus `json:"destinations"`
+	Disks        []DiskStatus        `json:"disks,omitempty"`
+}
+
+func currentStatus() Status {
+	return Status{Paused: tracker.Paused(), Queued: tracker.Queued(), Transfers: tracker.Active(), Destinations: destinationStatuses()}
+}
+
+// handleDestinations GET 列出目标路径，POST / DELETE 以 {"path": "..."} 增加或移除目标路径
+func handleDestinations(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, destinations())
+		return
+	}
+	var body struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Path == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": T("请求体应为 {\"path\": \"...\"}")})
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		addDestination(body.Path)
+		slog.Info("已添加目标路径", "path", body.Path)
+	case http.MethodDelete:
+		removeDestination(body.Path)
+		slog.Info("已移除目标路径", "path", body.Path)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, destinations())
+}
+
+// destinations 返回配置中的目标路径以及按 toPathsGlob、hotplug 找到的目标路径
+func destinations() []string {
+	configMu.Lock()
+	defer configMu.Unlock()
+	return configDestinations(config)
+}
+
+// destinations 按调度使用的配置返回目标路径
+func (s *Scheduler) destinations() []string {
+	configMu.Lock()
+	defer configMu.Unlock()
+	return configDestinations(s.cfg)
+}
+
+// configDestinations 返回 c 中的目标路径以及找到的目标路径，调用时需要持有 configMu
+func configDestinations(c *Config) []string {
+	dests := slices.Clone(c.ToPaths)
+	for _, p := range append(slices.Clone(discovered), hotplugged...) {
+		if !slices.Contains(dests, p) {
+			dests = append(dests, p)
+		}
+	}
+	return dests
+}
+
+func addDestination(path string) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	if !slices.Contains(config.ToPaths, path) {
+		config.ToPaths = append(config.ToPaths, path)
+	}
+}
+
+func removeDestination(path string) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.ToPaths = slices.DeleteFunc(config.ToPaths, func(p string) bool { return p == path })
+}
+
+func getOnly(h http.HandlerFunc) http.HandlerFunc {
+	return methodOnly(http.MethodGet, h)
+}
+
+func postOnly(h http.HandlerFunc) http.HandlerFunc {
+	return methodOnly(http.MethodPost, h)
+}
+
+func methodOnly(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,53 @@
+package chiamove
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIAuth(t *testing.T) {
+	h := apiHandler("secret")
+	for _, tc := range []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodGet, "/api/queue", "", http.StatusOK},
+		{http.MethodPost, "/api/cancel", "", http.StatusUnauthorized},
+		{http.MethodPost, "/api/cancel", "wrong", http.StatusUnauthorized},
+		{http.MethodDelete, "/api/destinations", "", http.StatusUnauthorized},
+		{http.MethodPost, "/api/cancel", "secret", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"src": "/nonexistent.plot"}`))
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s with token %q: got %d, want %d", tc.method, tc.path, tc.token, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestValidateAPIListen(t *testing.T) {
+	for _, tc := range []struct {
+		listen, token string
+		ok            bool
+	}{
+		{"127.0.0.1:8080", "", true},
+		{"localhost:8080", "", true},
+		{"[::1]:8080", "", true},
+		{":8080", "", false},
+		{"0.0.0.0:8080", "", false},
+		{"192.168.1.10:8080", "", false},
+		{"0.0.0.0:8080", "secret", true},
+	} {
+		c := newTestConfig(t, t.TempDir(), t.TempDir())
+		c.API.Listen, c.API.Token = tc.listen, tc.token
+		if err := c.Validate(); (err == nil) != tc.ok {
+			t.Errorf("listen %q token %q: got err %v, want ok=%v", tc.listen, tc.token, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package chiamove
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var (
+	errShutdown        = sentinelError("进程退出")
+	errCanceledByUser  = sentinelError("通过API取消")
+	errTransferTimeout = sentinelError("超过 transferTimeout")
+)
+
+// shutdownContext 收到SIGINT/SIGTERM时取消返回的context，正在进行的任务被终止，下次启动时续传；
+// 再次收到信号时直接退出
+func shutdownContext() context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		slog.Info("收到退出信号，正在停止正在进行的任务", "signal", s)
+		cancel(errShutdown)
+		<-sig
+		os.Exit(exitError)
+	}()
+	return ctx
+}
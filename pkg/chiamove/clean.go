@@ -0,0 +1,139 @@
+package chiamove
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// rsync复制过程中的临时文件名为 .原文件名.XXXXXX
+var rsyncTempPattern = regexp.MustCompile(`^\.(.+)\.[A-Za-z0-9]{6}$`)
+
+// movedSource 判断目标上名为 name 的文件或文件夹是否是迁移的源：.plot 文件或源路径中仍有的同名源
+func movedSource(fromPaths []string, name string) bool {
+	return strings.HasSuffix(name, ".plot") || sourceNamed(fromPaths, name) != ""
+}
+
+// isRsyncTemp 判断 name 是否是复制名为 source 的源时rsync的临时文件，source 为plot文件夹时是其中的文件
+func isRsyncTemp(fromPaths []string, name, source string) bool {
+	m := rsyncTempPattern.FindStringSubmatch(name)
+	if m == nil {
+		return false
+	}
+	if source == "" {
+		source = m[1]
+	}
+	return movedSource(fromPaths, strings.TrimSuffix(source, partialSuffix))
+}
+
+// stalePartials 返回目标上残留的未完成文件：超过 olderThan 没有修改的、迁移 fromPaths 中的源时留下的rsync临时文件、
+// 内置多路复制的临时文件，以及不属于任务日志中待续传任务的 .chiamove.partial。远程目标不处理
+func stalePartials(dests, fromPaths []string, j *Journal, olderThan time.Duration) []string {
+	cutoff := time.Now().Add(-olderThan)
+	pending := map[string]bool{}
+	for _, e := range j.Pending() {
+		pending[filepath.Join(e.Dst, sourceName(e.Src)+partialSuffix)] = true
+	}
+	var stale []string
+	for _, dest := range dests {
+		if isRemoteDest(dest) {
+			continue
+		}
+		// 目标路径本身可能是符号链接，WalkDir不会跟随
+		root, err := filepath.EvalSymlinks(dest)
+		if err != nil {
+			continue
+		}
+		// plot文件夹里的临时文件在第二层，不需要再往下找
+		filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, p)
+			if rel == "." {
+				return nil
+			}
+			path := filepath.Join(dest, rel)
+			name := d.Name()
+			topLevel := !strings.Contains(rel, string(filepath.Separator))
+			var match bool
+			switch {
+			case topLevel && strings.HasSuffix(name, partialSuffix):
+				match = !pending[path]
+			case d.IsDir():
+				if !topLevel {
+					return filepath.SkipDir
+				}
+				return nil
+			default:
+				var source string
+				if !topLevel {
+					source, _, _ = strings.Cut(rel, string(filepath.Separator))
+				}
+				match = isRsyncTemp(fromPaths, name, source) || strings.HasPrefix(name, ".") && strings.HasSuffix(name, parallelTempSuffix)
+			}
+			if !match {
+				return nil
+			}
+			if info, err := d.Info(); err == nil && !info.ModTime().After(cutoff) {
+				stale = append(stale, path)
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		})
+	}
+	return stale
+}
+
+// runClean 实现 clean 子命令，删除目标上残留的未完成文件，--resume 时源还在的 .chiamove.partial 写入任务日志，下次启动时续传
+func runClean(args []string) int {
+	fs := flag.NewFlagSet("chiamove clean", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", T("配置文件路径"))
+	olderThan := fs.Duration("older-than", time.Hour, T("只删除超过该时长没有修改的文件，避免删除正在写入的文件"))
+	dryRun := fs.Bool("dry-run", false, T("只列出要删除的文件"))
+	resume := fs.Bool("resume", false, T("源还在源路径中的 .chiamove.partial 不删除，下次启动时续传"))
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	c, err := ReadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("读取配置失败: %v\n"), err)
+		return exitConfigError
+	}
+	SetLanguage(c.Language)
+	j, err := OpenJournal(c.JournalFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("读取任务日志失败: %v\n"), err)
+		return exitError
+	}
+	code := exitOK
+	for _, path := range stalePartials(c.ToPaths, expandFromPaths(c.FromPaths), j, *olderThan) {
+		if src := resumableSource(expandFromPaths(c.FromPaths), path); *resume && src != "" {
+			if *dryRun {
+				fmt.Println(T("将续传"), path)
+				continue
+			}
+			j.Set(src, filepath.Dir(path), StateQueued, nil)
+			fmt.Println(T("下次启动时续传"), path)
+			continue
+		}
+		if *dryRun {
+			fmt.Println(T("将删除"), path)
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			fmt.Fprintf(os.Stderr, T("删除失败 %s: %v\n"), path, err)
+			code = exitError
+			continue
+		}
+		fmt.Println(T("已删除"), path)
+	}
+	return code
+}
@@ -0,0 +1,59 @@
+package chiamove
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStalePartials(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	writePlot(t, src, "folder", 1, time.Time{})
+	if err := os.Mkdir(filepath.Join(dst, "folder.chiamove.partial"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dst, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		".plot-a.plot.AbC123",
+		".plot-b.plot.XyZ789",
+		".foo.backup",
+		"plot-c.plot" + partialSuffix,
+		"plot-d.plot" + partialSuffix,
+		"folder.chiamove.partial/.data.Qw3rty",
+		"other/.data.Qw3rty",
+	} {
+		writePlot(t, dst, name, 1, old)
+	}
+	// 正在写入的文件
+	writePlot(t, dst, ".plot-b.plot.XyZ789", 1, time.Now())
+
+	j, err := OpenJournal(filepath.Join(t.TempDir(), "journal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Set(filepath.Join(src, "plot-d.plot"), dst, StateRunning, nil)
+
+	got := stalePartials([]string{dst}, []string{src}, j, time.Hour)
+	slices.Sort(got)
+	want := []string{
+		filepath.Join(dst, ".plot-a.plot.AbC123"),
+		filepath.Join(dst, "folder.chiamove.partial", ".data.Qw3rty"),
+		filepath.Join(dst, "plot-c.plot"+partialSuffix),
+	}
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("stalePartials = %v, want %v", got, want)
+	}
+}
+
+func TestPartialsOlderThanDefault(t *testing.T) {
+	c := newTestConfig(t, t.TempDir(), t.TempDir())
+	if c.Partials.OlderThan != time.Hour {
+		t.Errorf("partials.olderThan = %s, want 1h", c.Partials.OlderThan)
+	}
+}
@@ -0,0 +1,84 @@
+package chiamove
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runStatus 实现 status 子命令，通过HTTP API查询正在运行的迁移进程
+func runStatus(args []string) int {
+	fs := flag.NewFlagSet("chiamove status", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", T("配置文件路径，用于确定API地址"))
+	addr := fs.String("addr", "", T("API地址，如 127.0.0.1:8080，默认使用配置中的 api.listen"))
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	if *addr == "" {
+		if c, err := ReadConfig(*configPath); err == nil {
+			*addr = c.API.Listen
+			SetLanguage(c.Language)
+		}
+	}
+	if *addr == "" {
+		fmt.Fprintln(os.Stderr, T("没有配置 api.listen，请用 --addr 指定API地址"))
+		return exitConfigError
+	}
+	if !strings.Contains(*addr, "://") {
+		*addr = "http://" + *addr
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.TrimRight(*addr, "/") + "/api/status?disks=1")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("连接迁移进程失败: %v\n"), err)
+		return exitError
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, T("查询状态失败: %s\n"), resp.Status)
+		return exitError
+	}
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		fmt.Fprintf(os.Stderr, T("解析状态失败: %v\n"), err)
+		return exitError
+	}
+	state := T("运行中")
+	if status.Paused {
+		state = T("已暂停")
+	}
+	fmt.Printf(T("调度: %s  进行中 %d  排队 %d\n"), state, len(status.Transfers), len(status.Queued))
+	for _, tr := range status.Transfers {
+		var ratio float64
+		if tr.Size > 0 {
+			ratio = float64(tr.Copied) / float64(tr.Size)
+		}
+		fmt.Printf("  %s -> %s  %s %s/%s\n", filepath.Base(tr.Src), tr.Dst,
+			progressBar(ratio, 20), formatBytes(tr.Copied), formatBytes(tr.Size))
+	}
+	for _, tr := range status.Queued {
+		fmt.Printf(T("  %s -> %s  排队中\n"), filepath.Base(tr.Src), tr.Dst)
+	}
+	fmt.Println(T("目标:"))
+	for _, d := range status.Destinations {
+		speed := T("未测量")
+		if d.Speed > 0 {
+			speed = formatBytes(uint64(d.Speed)) + "/s"
+		}
+		if d.Disabled {
+			fmt.Printf(T("  %s  速度 %s  权重 %.2f  已暂停使用\n"), d.Path, speed, d.Weight)
+			continue
+		}
+		fmt.Printf(T("  %s  速度 %s  权重 %.2f\n"), d.Path, speed, d.Weight)
+	}
+	if len(status.Disks) > 0 {
+		fmt.Println(T("空间（# 已用  + 进行中的任务  - 剩余）:"))
+		printDiskStatus(status.Disks)
+	}
+	return exitOK
+}
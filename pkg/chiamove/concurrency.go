@@ -0,0 +1,127 @@
+package chiamove
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// ConcurrencyConfig 按观察到的吞吐量自动调整每轮同时进行的任务数：总吞吐量随任务数增加时继续增加，
+// 不再增加时退回，单个任务的速度骤降（磁盘或网络已饱和）时减半。每轮最多为每个源路径选择一个任务，
+// 实际的任务数还受源路径数量和各目标 maxConcurrent 的限制
+type ConcurrencyConfig struct {
+	Adaptive bool `yaml:"adaptive"`
+	Min      int  `yaml:"min"` // 默认1
+	Max      int  `yaml:"max"` // 默认4
+	// 单个任务的速度低于观察到的最高速度的该百分比时认为已饱和，默认25
+	CollapsePercent float64 `yaml:"collapsePercent"`
+}
+
+const (
+	// 增加一个任务后总吞吐量至少要提高的比例，否则退回
+	concurrencyScaleGain = 0.1
+	// 退回后保持多少轮再尝试增加
+	concurrencyProbeRounds = 10
+)
+
+func (c *ConcurrencyConfig) Validate() error {
+	if !c.Adaptive {
+		return nil
+	}
+	if c.Min < 1 || c.Max < c.Min {
+		return fmt.Errorf(T("concurrency 无效: 需要 1 <= min(%d) <= max(%d)"), c.Min, c.Max)
+	}
+	if c.CollapsePercent <= 0 || c.CollapsePercent >= 100 {
+		return errors.New(T("concurrency.collapsePercent 需要在0到100之间"))
+	}
+	return nil
+}
+
+// ConcurrencyTuner 记录每轮任务的吞吐量，决定下一轮的任务数上限
+type ConcurrencyTuner struct {
+	mu              sync.Mutex
+	limit           int     // 为0时还没有开始调整
+	prevThroughput  float64 // 上一轮的总吞吐量，字节/秒
+	peakPerTransfer float64 // 观察到的单个任务最高速度
+	probing         bool    // 刚增加了任务数，等待确认总吞吐量是否随之提高
+	steady          int     // 保持当前任务数的轮数
+}
+
+var concurrency = &ConcurrencyTuner{}
+
+// Limit 返回下一轮最多开始的任务数，没有打开 concurrency.adaptive 时不限制
+func (t *ConcurrencyTuner) Limit(cfg ConcurrencyConfig) int {
+	if !cfg.Adaptive {
+		return math.MaxInt
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.limit == 0 {
+		t.limit = cfg.Min
+	}
+	// 配置重新加载后范围可能变化
+	t.limit = min(max(t.limit, cfg.Min), cfg.Max)
+	return t.limit
+}
+
+// Observe 根据一轮结束的任务调整任务数上限，只统计成功且不是瞬间完成的任务
+func (t *ConcurrencyTuner) Observe(cfg ConcurrencyConfig, round []Transfer) {
+	if !cfg.Adaptive {
+		return
+	}
+	var copied uint64
+	var perTransfer float64
+	var start, end time.Time
+	n := 0
+	for _, tr := range round {
+		elapsed := tr.Elapsed().Seconds()
+		if tr.Error != "" || tr.Copied == 0 || elapsed < minSpeedSampleSeconds {
+			continue
+		}
+		if n == 0 || tr.StartedAt.Before(start) {
+			start = tr.StartedAt
+		}
+		if tr.FinishedAt.After(end) {
+			end = tr.FinishedAt
+		}
+		copied += tr.Copied
+		perTransfer += float64(tr.Copied) / elapsed
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	throughput := float64(copied) / end.Sub(start).Seconds()
+	perTransfer /= float64(n)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	old := t.limit
+	t.peakPerTransfer = max(t.peakPerTransfer, perTransfer)
+	switch {
+	case t.limit > cfg.Min && perTransfer < t.peakPerTransfer*cfg.CollapsePercent/100:
+		t.limit = max(t.limit/2, cfg.Min)
+		t.probing, t.steady = false, 0
+		slog.Info("单个任务的速度骤降，减少并发任务数", "from", old, "to", t.limit,
+			"perTransfer", formatBytes(uint64(perTransfer))+"/s", "peak", formatBytes(uint64(t.peakPerTransfer))+"/s")
+	case n < t.limit:
+		// 这一轮的任务数没有达到上限，无法判断增加任务数的效果
+		return
+	case t.probing && throughput < t.prevThroughput*(1+concurrencyScaleGain):
+		t.limit--
+		t.probing, t.steady = false, 0
+		slog.Info("总吞吐量没有随任务数增加，退回", "from", old, "to", t.limit,
+			"throughput", formatBytes(uint64(throughput))+"/s", "previous", formatBytes(uint64(t.prevThroughput))+"/s")
+	case t.limit < cfg.Max && (t.probing || t.prevThroughput == 0 || t.steady >= concurrencyProbeRounds):
+		t.limit++
+		t.probing, t.steady = true, 0
+		slog.Info("尝试增加并发任务数", "from", old, "to", t.limit, "throughput", formatBytes(uint64(throughput))+"/s")
+	default:
+		t.probing = false
+		t.steady++
+	}
+	t.prevThroughput = throughput
+}
@@ -0,0 +1,280 @@
+package chiamove
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// NativeConfig 内置复制的参数
+type NativeConfig struct {
+	// 单个大文件拆成多段并发复制的路数，万兆网络或NVMe上单路复制跑不满时可以调大，默认1
+	Streams int `yaml:"streams"`
+	// 文件不小于该大小时才拆分，默认 1GiB
+	MinParallelSize ByteSize `yaml:"minParallelSize"`
+	// Linux上复制前用 fallocate 预留整个文件的空间，减少快满的硬盘上的碎片，空间不足时立即失败，默认 true
+	Preallocate *bool `yaml:"preallocate"`
+	// Linux上用 copy_file_range（不支持时用 sendfile）在内核中复制，不经过用户态缓冲，默认 true
+	ZeroCopy *bool `yaml:"zeroCopy"`
+	// 每次读写的大小，普通读写时为缓冲区大小，zeroCopy 时为每次系统调用复制的大小，默认 8MiB
+	BufferSize ByteSize `yaml:"bufferSize"`
+	// Linux上把已复制的部分从页缓存中丢弃（posix_fadvise DONTNEED），避免复制上百GB的plot挤掉harvester查找证明时用到的缓存，默认 true
+	DropCache *bool `yaml:"dropCache"`
+}
+
+// 每复制这么多字节丢弃一次页缓存
+const dropCacheInterval = 64 << 20
+
+// cacheDropper 跟在复制的后面丢弃源和目标文件的页缓存：目标上刚写完的一段先开始写回，
+// 下一段写完时再等待上一段写回完成并丢弃，不会每次都等待磁盘
+type cacheDropper struct {
+	in, out       *os.File
+	offset        int64 // 当前一段的开始位置
+	pending       int64 // 当前一段已写入的字节数
+	prev, prevLen int64 // 已开始写回、还没丢弃的上一段
+}
+
+func newCacheDropper(c NativeConfig, in, out *os.File, offset int64) *cacheDropper {
+	if !*c.DropCache {
+		return nil
+	}
+	adviseSequential(in)
+	return &cacheDropper{in: in, out: out, offset: offset}
+}
+
+func (c *cacheDropper) advance(n int64) {
+	if c == nil {
+		return
+	}
+	if c.pending += n; c.pending < dropCacheInterval {
+		return
+	}
+	startWriteback(c.out, c.offset, c.pending)
+	c.drop()
+	c.prev, c.prevLen = c.offset, c.pending
+	c.offset += c.pending
+	c.pending = 0
+}
+
+// drop 丢弃上一段的页缓存
+func (c *cacheDropper) drop() {
+	if c.prevLen > 0 {
+		dropCache(c.out, c.prev, c.prevLen, true)
+		dropCache(c.in, c.prev, c.prevLen, false)
+	}
+}
+
+// finish 目标文件同步到磁盘后丢弃剩下的页缓存
+func (c *cacheDropper) finish() {
+	if c == nil {
+		return
+	}
+	dropCache(c.out, c.prev, 0, false)
+	dropCache(c.in, c.prev, 0, false)
+}
+
+// 多路复制时先写入该后缀的临时文件，全部完成后再改名，避免中断后稀疏文件被当成已复制完成
+const parallelTempSuffix = ".parallel"
+
+// nativeProgress 源路径 -> 内置复制已写入的字节数；多路复制的目标是稀疏文件，统计文件大小不准确
+var nativeProgress sync.Map
+
+// nativeCopy 不依赖rsync，按 c 中的 native 配置把 src（文件或文件夹）复制为 target，
+// 目标文件已存在且比源文件小时从已写入的位置继续，效果等同 rsync --partial --append；
+// ctx 取消后在下一次写入前停止
+func nativeCopy(ctx context.Context, c *Config, src, target string) error {
+	limiters := []*rateLimiter{newRateLimiter(uint64(currentThrottle(c).PerTransfer)), globalLimiter}
+	copied := new(atomic.Uint64)
+	nativeProgress.Store(src, copied)
+	defer nativeProgress.Delete(src)
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		out := filepath.Join(target, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir() && otherFilesystem(c.DirSize, src, path):
+			return filepath.SkipDir
+		case d.IsDir():
+			return os.MkdirAll(out, info.Mode().Perm()|0700)
+		case d.Type().IsRegular():
+			w := &throttledWriter{ctx: ctx, limiters: limiters, copied: copied}
+			if n := c.Native.Streams; n > 1 && info.Size() >= int64(c.Native.MinParallelSize) {
+				if _, err := os.Stat(out); os.IsNotExist(err) {
+					return copyFileParallel(c.Native, path, out, info, w, n)
+				}
+			}
+			return copyFile(c.Native, path, out, info, w)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			os.Remove(out)
+			return os.Symlink(link, out)
+		default:
+			return fmt.Errorf(T("不支持的文件类型: %s"), path)
+		}
+	})
+}
+
+// copyFile 单路复制，w 只提供限速、取消和进度统计，写入前会替换为目标文件
+func copyFile(c NativeConfig, src, dst string, info fs.FileInfo, w *throttledWriter) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	stat, err := out.Stat()
+	if err != nil {
+		return err
+	}
+	offset := stat.Size()
+	if offset > info.Size() {
+		// 目标比源文件还大，说明不是同一个文件，重新复制
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		offset = 0
+	}
+	w.copied.Add(uint64(offset))
+	if offset < info.Size() {
+		if err := preallocateFile(c, out, info.Size()); err != nil {
+			return err
+		}
+		dropper := newCacheDropper(c, in, out, offset)
+		w.onWrite = dropper.advance
+		if _, err := in.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := out.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if err := copyRange(c, w, out, in, offset, info.Size()-offset); err != nil {
+			return err
+		}
+		if err := out.Sync(); err != nil {
+			return err
+		}
+		dropper.finish()
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+func preallocateFile(c NativeConfig, out *os.File, size int64) error {
+	if !*c.Preallocate {
+		return nil
+	}
+	if err := preallocate(out, size); err != nil {
+		return fmt.Errorf(T("预分配 %s 失败: %w"), formatBytes(uint64(size)), err)
+	}
+	return nil
+}
+
+// copyRange 把 in 从 offset 开始的 length 字节复制到 out 的当前位置（与 offset 相同），
+// 依次尝试 copy_file_range、sendfile，都不支持时经过用户态读写
+func copyRange(c NativeConfig, w *throttledWriter, out, in *os.File, offset, length int64) error {
+	if *c.ZeroCopy {
+		err := copyFileRange(w, out, in, offset, length, int64(c.BufferSize))
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+		slog.Debug("copy_file_range 不可用，改为 sendfile", "src", in.Name(), "dst", out.Name())
+		if err = sendFile(w, out, in, offset, length, int64(c.BufferSize)); !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+	}
+	w.w = out
+	// 隐藏 *os.File 的 WriteTo，否则不会使用指定大小的缓冲区
+	_, err := io.CopyBuffer(w, struct{ io.Reader }{in}, make([]byte, c.BufferSize))
+	return err
+}
+
+// copyFileParallel 把文件分成 streams 段并发复制到临时文件，全部完成后改名为 dst；
+// 任意一段失败时停止其余各段并删除临时文件，中断后临时文件无法续传，下次重新复制
+func copyFileParallel(c NativeConfig, src, dst string, info fs.FileInfo, w *throttledWriter, streams int) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+parallelTempSuffix)
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(tmp)
+		}
+	}()
+	size := info.Size()
+	if err := preallocateFile(c, out, size); err != nil {
+		return err
+	}
+	part := (size + int64(streams) - 1) / int64(streams)
+	ctx, cancel := context.WithCancel(w.ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, streams)
+	for start := int64(0); start < size; start += part {
+		wg.Add(1)
+		go func(start, length int64) {
+			defer wg.Done()
+			sw := &throttledWriter{ctx: ctx, w: io.NewOffsetWriter(out, start), limiters: w.limiters, copied: w.copied}
+			sw.onWrite = newCacheDropper(c, in, out, start).advance
+			err := errors.ErrUnsupported
+			if *c.ZeroCopy {
+				err = copyFileRange(sw, out, in, start, length, int64(c.BufferSize))
+			}
+			if errors.Is(err, errors.ErrUnsupported) {
+				_, err = io.CopyBuffer(sw, io.NewSectionReader(in, start, length), make([]byte, c.BufferSize))
+			}
+			if err != nil {
+				errs <- err
+				cancel()
+			}
+		}(start, min(part, size-start))
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	newCacheDropper(c, in, out, 0).finish()
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
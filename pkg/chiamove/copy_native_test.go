@@ -0,0 +1,58 @@
+package chiamove
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCopyFileParallel(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	c := newTestConfig(t, src, dst).Native
+	c.BufferSize = 4 << 10
+	data := make([]byte, 1<<20+123)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	in := filepath.Join(src, "a.plot")
+	if err := os.WriteFile(in, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dst, "a.plot")
+	tmp := filepath.Join(dst, ".a.plot"+parallelTempSuffix)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := &throttledWriter{ctx: ctx, copied: new(atomic.Uint64)}
+	if err := copyFileParallel(c, in, out, info, w, 4); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled copy: got %v, want context.Canceled", err)
+	}
+	for _, p := range []string{tmp, out} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s should not exist after a failed copy: %v", p, err)
+		}
+	}
+
+	w = &throttledWriter{ctx: context.Background(), copied: new(atomic.Uint64)}
+	if err := copyFileParallel(c, in, out, info, w, 4); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("copied content differs from source")
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind: %v", err)
+	}
+}
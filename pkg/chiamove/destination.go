@@ -0,0 +1,305 @@
+package chiamove
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DestinationConfig 单个目标路径的设置，未设置的项使用全局配置
+type DestinationConfig struct {
+	Path           string    `yaml:"path"`
+	MinFreeReserve *ByteSize `yaml:"minFreeReserve"`
+	// 同时写入该目标的最大任务数，机械硬盘建议为1，SSD可以更大，默认1
+	MaxConcurrent int `yaml:"maxConcurrent"`
+	// 目标盘已使用空间的上限，按字节或占总容量的百分比，不管实际剩余空间，目标盘同时存放其他程序的文件时使用
+	MaxUsed        ByteSize `yaml:"maxUsed"`
+	MaxUsedPercent float64  `yaml:"maxUsedPercent"`
+	// 目标上最多存放的plot数量，包括其他程序放入的plot
+	MaxPlots int `yaml:"maxPlots"`
+	// rsync:// 目标不能直接查询剩余空间，usageAgent 为该硬盘所在主机上的agent（agent://host:port/mnt/disk1），
+	// 由其报告容量；没有agent时设置 capacity，剩余空间按其减去目标下已有文件的总大小计算
+	UsageAgent string   `yaml:"usageAgent"`
+	Capacity   ByteSize `yaml:"capacity"`
+}
+
+// Route 源到目标分组的映射，按顺序第一条匹配的生效；from 和plot头中的密钥条件都可以为空，为空的条件不参与匹配
+type Route struct {
+	From  string `yaml:"from"`
+	Group string `yaml:"group"`
+	// 矿池合约地址 xch1... 或其puzzle hash，只匹配该plotNFT的plot
+	PoolContract string `yaml:"poolContract"`
+	// farmer公钥（十六进制）
+	FarmerKey string `yaml:"farmerKey"`
+	// 只匹配使用pool公钥（不是矿池合约）的plot，即solo plot
+	Solo bool `yaml:"solo"`
+
+	poolContract, farmerKey []byte
+}
+
+func (r *Route) Validate() error {
+	var err error
+	if r.PoolContract != "" {
+		if r.poolContract, err = parsePuzzleHash(r.PoolContract); err != nil {
+			return fmt.Errorf(T("routes 的 poolContract 无效: %w"), err)
+		}
+	}
+	if r.FarmerKey != "" {
+		if r.farmerKey, err = parseHexKey(r.FarmerKey, 48); err != nil {
+			return fmt.Errorf(T("routes 的 farmerKey 无效: %w"), err)
+		}
+	}
+	if r.From == "" && !r.usesMemo() {
+		return fmt.Errorf(T("routes 中目标分组 %q 的路由需要设置 from、poolContract、farmerKey 或 solo"), r.Group)
+	}
+	return nil
+}
+
+func (r *Route) usesMemo() bool {
+	return r.poolContract != nil || r.farmerKey != nil || r.Solo
+}
+
+// Match 判断迁移单位 src 是否符合该路由，需要时读取plot头中的memo，读取失败时不符合
+func (r *Route) Match(src string) bool {
+	if r.From != "" && !matchSourcePath(r.From, filepath.Dir(src)) {
+		return false
+	}
+	if !r.usesMemo() {
+		return true
+	}
+	memo, err := sourceMemo(src)
+	if err != nil {
+		slog.Debug("读取plot头失败，不按密钥路由", "path", src, "err", err)
+		return false
+	}
+	if r.poolContract != nil && !bytes.Equal(r.poolContract, memo.PoolContract) {
+		return false
+	}
+	if r.farmerKey != nil && !bytes.Equal(r.farmerKey, memo.FarmerKey) {
+		return false
+	}
+	return !r.Solo || memo.PoolKey != nil
+}
+
+// patternList 可以写成单个字符串或字符串列表
+type patternList []string
+
+func (l *patternList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*l = patternList{single}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// discovered 上一次按 toPathsGlob 找到的目标路径
+var discovered []string
+
+// discoverDestinations 每轮调度前按 toPathsGlob 重新查找目标目录，记录新出现和消失的目标
+func discoverDestinations(c *Config) {
+	var found []string
+	for _, pattern := range c.ToPathsGlob {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			slog.Error("toPathsGlob 无效", "pattern", pattern, "err", err)
+			continue
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && info.IsDir() && !slices.Contains(found, m) {
+				found = append(found, m)
+			}
+		}
+	}
+	configMu.Lock()
+	old := discovered
+	discovered = found
+	configMu.Unlock()
+	for _, p := range found {
+		if !slices.Contains(old, p) {
+			slog.Info("发现目标路径", "path", p)
+		}
+	}
+	for _, p := range old {
+		if !slices.Contains(found, p) {
+			slog.Info("目标路径已消失", "path", p)
+		}
+	}
+}
+
+func destinationConfig(c *Config, path string) (DestinationConfig, bool) {
+	for _, d := range c.ToPathsConfig {
+		if d.Path == path {
+			return d, true
+		}
+	}
+	return DestinationConfig{}, false
+}
+
+// minFreeReserve 返回目标路径需要保留的最小剩余空间
+func minFreeReserve(c *Config, path string) uint64 {
+	if d, ok := destinationConfig(c, path); ok && d.MinFreeReserve != nil {
+		return uint64(*d.MinFreeReserve)
+	}
+	return uint64(c.MinFreeReserve)
+}
+
+// quotaFree 返回按 maxUsed / maxUsedPercent 还允许写入的字节数，没有设置时不限制
+func (s *Scheduler) quotaFree(path string) uint64 {
+	d, ok := destinationConfig(s.cfg, path)
+	if !ok || d.MaxUsed == 0 && d.MaxUsedPercent == 0 {
+		return math.MaxUint64
+	}
+	usage, err := s.transport(path).FreeSpace(path)
+	if err != nil {
+		slog.Error("获取目标容量失败", "path", path, "err", err)
+		return 0
+	}
+	used := usage.Total - min(usage.Free, usage.Total)
+	free := uint64(math.MaxUint64)
+	if d.MaxUsed > 0 {
+		free = uint64(d.MaxUsed) - min(used, uint64(d.MaxUsed))
+	}
+	if d.MaxUsedPercent > 0 {
+		limit := uint64(float64(usage.Total) * d.MaxUsedPercent / 100)
+		free = min(free, limit-min(used, limit))
+	}
+	return free
+}
+
+// plotQuota 返回按 maxPlots 还能放入的plot数量，正在写入的任务也计算在内；没有设置时返回 -1
+func (s *Scheduler) plotQuota(path string) int {
+	d, ok := destinationConfig(s.cfg, path)
+	if !ok || d.MaxPlots <= 0 {
+		return -1
+	}
+	count := 0
+	for name := range buildPlotIndex(s.cfg, []string{path}) {
+		if strings.HasSuffix(name, ".plot") {
+			count++
+		}
+	}
+	for _, src := range s.reservations.Sources(path) {
+		count += unitPlots(src)
+	}
+	return max(d.MaxPlots-count, 0)
+}
+
+// unitPlots 返回迁移单位中的plot数量，单个 .plot 文件为1，文件夹为其中 .plot 文件的数量
+func unitPlots(src string) int {
+	if strings.HasSuffix(src, ".plot") {
+		return 1
+	}
+	return len(plotFiles(src))
+}
+
+func maxConcurrent(c *Config, path string) int {
+	if d, ok := destinationConfig(c, path); ok && d.MaxConcurrent > 0 {
+		return d.MaxConcurrent
+	}
+	return 1
+}
+
+// destinationsFor 返回迁移单位 src 可以使用的目标，没有匹配的路由时为全部目标
+func destinationsFor(c *Config, src string, all []string) []string {
+	for i := range c.Routes {
+		if r := &c.Routes[i]; r.Match(src) {
+			return slices.DeleteFunc(slices.Clone(c.DestinationGroups[r.Group]), func(p string) bool {
+				// 通过API移除的目标不再使用
+				return !slices.Contains(all, p)
+			})
+		}
+	}
+	return all
+}
+
+// assignDestinations 按顺序为任务分配其源路径可以使用的第一个有空位的目标，每个目标最多分配 maxConcurrent 个任务，
+// 分配后剩余空间不能低于预留空间，也不能超过目标的容量和plot数量配额；exclude 中的目标不分配。
+// 已分配目标的任务移到 executors 前面，返回它们的数量
+func (s *Scheduler) assignDestinations(executors []*Executor, exclude []string) int {
+	type destState struct {
+		free, reserve uint64
+		slots         int
+		plots         int // 还能放入的plot数量，-1 为不限制
+	}
+	all := s.destinations()
+	states := map[string]*destState{}
+	for _, toPath := range all {
+		if slices.Contains(exclude, toPath) {
+			states[toPath] = &destState{}
+			continue
+		}
+		if !s.health.Available(s.cfg, toPath) {
+			slog.Debug("目标已暂停使用，跳过", "path", toPath)
+			states[toPath] = &destState{}
+			continue
+		}
+		if err := checkDestinationReady(s.cfg, toPath); err != nil {
+			slog.Warn("目标不可用，跳过", "path", toPath, "err", err)
+			states[toPath] = &destState{}
+			continue
+		}
+		if !smartHealthy(s.cfg, toPath) {
+			states[toPath] = &destState{}
+			continue
+		}
+		usage, err := s.transport(toPath).FreeSpace(toPath)
+		if err != nil {
+			slog.Error("获取目标容量失败", "path", toPath, "err", err)
+		}
+		free := usage.Free
+		// 已满的目标不会分配任务，不用测试
+		if free >= probeSize {
+			if err := s.health.Probe(s.cfg, toPath); err != nil {
+				slog.Warn("目标测试写入失败，跳过", "path", toPath, "err", err)
+				states[toPath] = &destState{}
+				continue
+			}
+		}
+		free -= min(s.reservations.Outstanding(s.cfg, toPath), free)
+		free = min(free, s.quotaFree(toPath))
+		// 换目标时同一轮中其他任务还在写入
+		slots := maxConcurrent(s.cfg, toPath) - len(s.reservations.Sources(toPath))
+		states[toPath] = &destState{free: free, reserve: minFreeReserve(s.cfg, toPath), slots: slots, plots: s.plotQuota(toPath)}
+	}
+	var assigned, unassigned []*Executor
+	for _, exe := range executors {
+		candidates := destinationsFor(s.cfg, exe.fromPath, all)
+		if isRemoteSource(exe.fromPath) {
+			candidates = slices.DeleteFunc(slices.Clone(candidates), isRemoteDest)
+		}
+		if s.cfg.PreferFasterDestinations {
+			candidates = sortBySpeed(s.speeds, candidates)
+		}
+		plots := unitPlots(exe.fromPath)
+		for _, toPath := range candidates {
+			st := states[toPath]
+			if st.slots > 0 && st.free >= exe.size+st.reserve && (st.plots < 0 || st.plots >= plots) {
+				exe.toPath = toPath
+				st.free -= exe.size
+				st.slots--
+				if st.plots >= 0 {
+					st.plots -= plots
+				}
+				break
+			}
+		}
+		if exe.toPath != "" {
+			assigned = append(assigned, exe)
+		} else {
+			unassigned = append(unassigned, exe)
+		}
+	}
+	copy(executors, append(assigned, unassigned...))
+	return len(assigned)
+}
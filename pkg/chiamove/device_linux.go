@@ -0,0 +1,39 @@
+//go:build linux
+
+package chiamove
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// deviceID 返回路径所在的物理磁盘，同一块盘的不同分区返回相同的值
+func deviceID(path string) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return "", err
+	}
+	dev := fmt.Sprintf("%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+	// /sys/dev/block/主:次 指向 /sys/devices/.../sda/sda1，分区目录下有 partition 文件，其上级目录就是整块磁盘
+	sysPath, err := filepath.EvalSymlinks(filepath.Join("/sys/dev/block", dev))
+	if err != nil {
+		return dev, nil
+	}
+	if _, err := os.Stat(filepath.Join(sysPath, "partition")); err == nil {
+		sysPath = filepath.Dir(sysPath)
+	}
+	return filepath.Base(sysPath), nil
+}
+
+// diskDevice 返回路径所在的整块磁盘的设备文件，如 /dev/sda，供 smartctl 使用
+func diskDevice(path string) string {
+	id, err := deviceID(path)
+	if err != nil || strings.Contains(id, ":") {
+		return ""
+	}
+	return "/dev/" + id
+}
@@ -0,0 +1,23 @@
+//go:build unix && !linux
+
+package chiamove
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// deviceID 返回路径所在文件系统的设备号
+func deviceID(path string) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return "", err
+	}
+	return fmt.Sprint(st.Dev), nil
+}
+
+// diskDevice 其他系统上无法从设备号确定设备文件，需要在 smart.devices 中指定
+func diskDevice(path string) string {
+	return ""
+}
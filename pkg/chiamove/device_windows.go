@@ -0,0 +1,19 @@
+//go:build windows
+
+package chiamove
+
+import "path/filepath"
+
+// deviceID 返回路径所在的卷，如 C:
+func deviceID(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.VolumeName(abs), nil
+}
+
+// diskDevice Windows上需要在 smart.devices 中指定设备
+func diskDevice(path string) string {
+	return ""
+}
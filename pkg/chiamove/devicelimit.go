@@ -0,0 +1,51 @@
+package chiamove
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// deviceLimiter 限制同一块源磁盘上同时读取的任务数，避免并发读导致磁头来回寻道
+type deviceLimiter struct {
+	mu    sync.Mutex
+	limit int
+	sems  map[string]chan struct{}
+}
+
+var sourceDevices = &deviceLimiter{sems: map[string]chan struct{}{}}
+
+// SetLimit 修改每块磁盘的并发数，只在没有迁移进行时调用
+func (d *deviceLimiter) SetLimit(limit int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if limit != d.limit {
+		d.limit = limit
+		d.sems = map[string]chan struct{}{}
+	}
+}
+
+// Acquire 阻塞直到 path 所在磁盘有空闲的读取名额，返回释放函数；ctx 取消时返回错误
+func (d *deviceLimiter) Acquire(ctx context.Context, path string) (func(), error) {
+	if d.limit <= 0 || isRemoteSource(path) {
+		return func() {}, nil
+	}
+	dev, err := deviceID(path)
+	if err != nil {
+		slog.Warn("获取源路径所在磁盘失败，不限制并发", "path", path, "err", err)
+		return func() {}, nil
+	}
+	d.mu.Lock()
+	sem, ok := d.sems[dev]
+	if !ok {
+		sem = make(chan struct{}, d.limit)
+		d.sems[dev] = sem
+	}
+	d.mu.Unlock()
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
@@ -0,0 +1,59 @@
+package chiamove
+
+import (
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+)
+
+// DirSizeConfig 统计文件夹大小时对符号链接、挂载点和读取错误的处理，默认都不特殊处理，遇到错误时跳过该源
+type DirSizeConfig struct {
+	// 不统计符号链接，默认按链接本身的大小统计，都不会跟随链接
+	SkipSymlinks bool `yaml:"skipSymlinks"`
+	// 不进入文件夹中挂载的其他文件系统，rsync和内置复制以及校验也不包含其中的内容
+	OneFileSystem bool `yaml:"oneFileSystem"`
+	// 权限不足等读取错误只记录警告，返回能读取的部分的大小
+	IgnoreErrors bool `yaml:"ignoreErrors"`
+}
+
+// dirSize 通过 fsys 按 c 返回文件或文件夹的总大小
+func dirSize(fsys FileSystem, c DirSizeConfig, path string) (uint64, error) {
+	var size uint64
+	err := walkDirSize(fsys, c, path, func(_ string, info fs.FileInfo) {
+		if !info.IsDir() {
+			size += uint64(info.Size())
+		}
+	})
+	return size, err
+}
+
+// walkDirSize 按 c 遍历 root 下的文件和文件夹
+func walkDirSize(fsys FileSystem, c DirSizeConfig, root string, fn func(p string, info fs.FileInfo)) error {
+	return walkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		var info fs.FileInfo
+		if err == nil {
+			info, err = d.Info()
+		}
+		if err != nil {
+			if c.IgnoreErrors && p != root {
+				slog.Warn("统计大小时读取失败，忽略", "path", p, "err", err)
+				return nil
+			}
+			return err
+		}
+		switch {
+		case c.SkipSymlinks && info.Mode()&fs.ModeSymlink != 0:
+			return nil
+		case info.IsDir() && otherFilesystem(c, root, p):
+			slog.Debug("不统计挂载点中的内容", "path", p)
+			return filepath.SkipDir
+		}
+		fn(p, info)
+		return nil
+	})
+}
+
+// otherFilesystem 配置了 dirSize.oneFileSystem 时，判断 root 下的文件夹 p 是否挂载了其他文件系统
+func otherFilesystem(c DirSizeConfig, root, p string) bool {
+	return c.OneFileSystem && p != root && !sameFilesystem(root, p)
+}
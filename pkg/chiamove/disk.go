@@ -0,0 +1,34 @@
+package chiamove
+
+import "log/slog"
+
+type DiskUsage struct {
+	Total uint64 `json:"total"`
+	Free  uint64 `json:"free"`
+}
+
+func GetRemindSizeByPath(path string) (uint64, error) {
+	usage, err := GetDiskUsage(path)
+	if err != nil {
+		slog.Error("获取文件系统信息失败", "path", path, "err", err)
+		return 0, err
+	}
+	return usage.Free, nil
+}
+
+// GetDestinationUsage 本地目标直接查询文件系统，ssh:// 目标在远端执行 df，agent:// 目标由agent查询，
+// s3:// 目标按 s3.quota 计算，rsync:// 目标按 toPathsConfig 中的 usageAgent 或 capacity
+func GetDestinationUsage(dest string) (DiskUsage, error) {
+	return transportFor(currentConfig(), dest).FreeSpace(dest)
+}
+
+func GetDestinationFreeSpace(dest string) (uint64, error) {
+	if isRemoteDest(dest) {
+		usage, err := GetDestinationUsage(dest)
+		if err != nil {
+			slog.Error("获取远程剩余空间失败", "path", dest, "err", err)
+		}
+		return usage.Free, err
+	}
+	return GetRemindSizeByPath(dest)
+}
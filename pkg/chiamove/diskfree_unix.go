@@ -0,0 +1,16 @@
+//go:build unix
+
+package chiamove
+
+import "golang.org/x/sys/unix"
+
+func GetDiskUsage(path string) (DiskUsage, error) {
+	fs := unix.Statfs_t{}
+	if err := unix.Statfs(path, &fs); err != nil {
+		return DiskUsage{}, err
+	}
+	return DiskUsage{
+		Total: fs.Blocks * uint64(fs.Bsize),
+		Free:  fs.Bavail * uint64(fs.Bsize),
+	}, nil
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package chiamove
+
+import "golang.org/x/sys/windows"
+
+func GetDiskUsage(path string) (DiskUsage, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return DiskUsage{}, err
+	}
+	var freeAvailable, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &freeAvailable, &total, &totalFree); err != nil {
+		return DiskUsage{}, err
+	}
+	return DiskUsage{Total: total, Free: freeAvailable}, nil
+}
@@ -0,0 +1,99 @@
+package chiamove
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// DiskSwapConfig 目标全部已满时等待换盘，而不是退出
+type DiskSwapConfig struct {
+	// 非守护模式下也等待换盘，源盘已空时仍然退出
+	Wait bool `yaml:"wait"`
+	// 在终端中运行时提示换盘，按回车后立即重新扫描
+	Prompt bool `yaml:"prompt"`
+	// 检查目标可用空间和新目标的间隔，默认 10s
+	CheckInterval time.Duration `yaml:"checkInterval"`
+}
+
+var (
+	enterOnce sync.Once
+	enterCh   = make(chan struct{})
+)
+
+// waitForSpace 目标全部已满时等待换盘：定时检查目标的可用空间和新增的目标，有目标增加的空间至少为 need（最小的待迁移任务）、
+// 按回车、被唤醒或配置重新加载后返回
+func (s *Scheduler) waitForSpace(ctx context.Context, reload <-chan struct{}, opts *Options, need uint64) {
+	before := s.freeSpaces()
+	var enter <-chan struct{}
+	if s.cfg.DiskSwap.Prompt && !opts.TUI && isTerminal(os.Stdin) {
+		fmt.Fprintln(os.Stderr, T("目标已满，请更换硬盘后按回车继续"))
+		enter = waitEnter()
+	}
+	ticker := time.NewTicker(s.cfg.DiskSwap.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-wakeCh:
+			return
+		case <-reload:
+			s.reload(opts)
+			return
+		case <-enter:
+			return
+		case <-ticker.C:
+		}
+		discoverDestinations(s.cfg)
+		for dst, free := range s.freeSpaces() {
+			if old, ok := before[dst]; !ok || free >= old+need {
+				s.log.Info("目标有新的可用空间，继续迁移", "dst", dst, "free", formatBytes(free))
+				Notify(Notification{Event: EventDestinationOnline, Message: fmt.Sprintf(T("目标有新的可用空间: %s (%s)"), dst, formatBytes(free)), Dst: dst})
+				return
+			}
+		}
+	}
+}
+
+// freeSpaces 返回各个可用目标的剩余空间
+func (s *Scheduler) freeSpaces() map[string]uint64 {
+	spaces := map[string]uint64{}
+	for _, dst := range s.destinations() {
+		if s.health.Disabled(dst) || checkDestinationReady(s.cfg, dst) != nil {
+			continue
+		}
+		usage, err := s.transport(dst).FreeSpace(dst)
+		if err != nil {
+			slog.Debug("获取目标容量失败", "path", dst, "err", err)
+			continue
+		}
+		spaces[dst] = usage.Free
+	}
+	return spaces
+}
+
+// waitEnter 在后台读取标准输入，每读到一行发送一次通知
+func waitEnter() <-chan struct{} {
+	enterOnce.Do(func() {
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				select {
+				case enterCh <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	})
+	return enterCh
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
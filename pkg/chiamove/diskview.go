@@ -0,0 +1,102 @@
+package chiamove
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiskStatus 目标盘的空间使用情况，供 chiamove status 画出每块盘的占用
+type DiskStatus struct {
+	Path  string `json:"path"`
+	Total uint64 `json:"total"`
+	Free  uint64 `json:"free"`
+	// 进行中的任务还需要写入的字节数
+	Reserved uint64 `json:"reserved"`
+	// 配置的 minFreeReserve，不会写入
+	MinFree uint64 `json:"minFree"`
+	Plots   int    `json:"plots"`
+	// 按已有plot的估算大小还能放入的数量，-1 为无法估算
+	Fits  int    `json:"fits"`
+	Error string `json:"error,omitempty"`
+}
+
+func diskStatuses() []DiskStatus {
+	var statuses []DiskStatus
+	for _, dest := range destinations() {
+		d := DiskStatus{Path: dest, Reserved: reservations.Outstanding(config, dest), MinFree: minFreeReserve(config, dest), Fits: -1}
+		usage, err := GetDestinationUsage(dest)
+		if err != nil {
+			d.Error = err.Error()
+			statuses = append(statuses, d)
+			continue
+		}
+		d.Total, d.Free = usage.Total, usage.Free
+		var expected uint64
+		var known int
+		for name := range buildPlotIndex(config, []string{dest}) {
+			if !strings.HasSuffix(name, ".plot") {
+				continue
+			}
+			d.Plots++
+			if info, ok := ParsePlotName(name); ok {
+				if size, ok := config.PlotSize.expectedPlotSize(info); ok {
+					expected += size
+					known++
+				}
+			}
+		}
+		if known > 0 {
+			d.Fits = int(d.available() / (expected / uint64(known)))
+		}
+		statuses = append(statuses, d)
+	}
+	return statuses
+}
+
+// available 扣除进行中的任务和预留空间后还能写入的字节数
+func (d DiskStatus) available() uint64 {
+	return d.Free - min(d.Reserved+d.MinFree, d.Free)
+}
+
+// diskBar 画出已用（#）、进行中的任务将要占用（+）和剩余（-）的比例
+func diskBar(d DiskStatus, width int) string {
+	if d.Total == 0 {
+		return "[" + strings.Repeat("?", width) + "]"
+	}
+	used := int(float64(d.Total-d.Free) / float64(d.Total) * float64(width))
+	reserved := min(int(float64(min(d.Reserved, d.Free))/float64(d.Total)*float64(width)+0.5), width-used)
+	if d.Reserved > 0 && used < width {
+		reserved = max(reserved, 1)
+	}
+	return "[" + strings.Repeat("#", used) + strings.Repeat("+", reserved) + strings.Repeat("-", width-used-reserved) + "]"
+}
+
+// printDiskStatus 每块目标盘一行占用条，空间最紧张的盘在输出中标出
+func printDiskStatus(disks []DiskStatus) {
+	width := 0
+	for _, d := range disks {
+		width = max(width, len(d.Path))
+	}
+	for _, d := range disks {
+		if d.Error != "" {
+			fmt.Printf(T("  %-*s  获取容量失败: %s\n"), width, d.Path, d.Error)
+			continue
+		}
+		var ratio float64
+		if d.Total > 0 {
+			ratio = float64(d.Total-d.Free) / float64(d.Total)
+		}
+		fmt.Printf(T("  %-*s  %s %5.1f%%  已用 %s / %s  进行中 %s  预留 %s  plot %d 个"), width, d.Path, diskBar(d, 30), ratio*100,
+			formatBytes(d.Total-d.Free), formatBytes(d.Total), formatBytes(d.Reserved), formatBytes(d.MinFree), d.Plots)
+		switch {
+		case d.Fits < 0:
+		case d.Fits == 0:
+			fmt.Print(T("  已满"))
+		case d.Fits <= 3:
+			fmt.Printf(T("  即将写满，约可再放 %d 个"), d.Fits)
+		default:
+			fmt.Printf(T("  约可再放 %d 个"), d.Fits)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,162 @@
+package chiamove
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type DuplicatesConfig struct {
+	Action        string `yaml:"action"`        // skip: 跳过重复的源 / quarantine: 把源移到 quarantineDir / off: 不检查
+	QuarantineDir string `yaml:"quarantineDir"` // 建议放在源盘上，这样移动只是rename
+}
+
+var errDuplicate = sentinelError("目标上已有完整的同名副本")
+
+// plotIndex 目标盘上已有的文件名 -> 所在目标路径，包括目标根目录下已完成的 .plot 文件和plot文件夹，以及其中文件夹里的 .plot 文件
+type plotIndex map[string]string
+
+// completedName 排除复制到一半的 .chiamove.partial、rsync的临时文件和 .chiamove-* 等隐藏的临时文件夹
+func completedName(name string) bool {
+	return name != "" && !strings.HasSuffix(name, partialSuffix) && !strings.HasPrefix(name, ".")
+}
+
+// indexable 判断目标根目录下的条目是否为已完成的plot：.plot 文件或plot文件夹
+func indexable(name string, isDir bool) bool {
+	return completedName(name) && (isDir || strings.HasSuffix(name, ".plot"))
+}
+
+func buildPlotIndex(c *Config, dests []string) plotIndex {
+	index := plotIndex{}
+	for _, dest := range dests {
+		if r, ok := remoteFor(c, dest); ok {
+			// -p 在文件夹名称后加 /
+			out, err := r.run("ls -1p -- " + shellQuote(r.path))
+			if err != nil {
+				slog.Warn("读取远程目标文件列表失败", "path", dest, "err", err)
+				continue
+			}
+			for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+				name, isDir := strings.CutSuffix(line, "/")
+				if indexable(name, isDir) {
+					index[name] = dest
+				}
+			}
+			continue
+		}
+		if t, ok := rsyncDaemonFor(c, dest); ok {
+			names, err := t.names()
+			if err != nil {
+				slog.Warn("读取rsync目标文件列表失败", "path", dest, "err", err)
+				continue
+			}
+			for _, name := range names {
+				index[name] = dest
+			}
+			continue
+		}
+		if a, ok := agentFor(c, dest); ok {
+			names, err := a.list()
+			if err != nil {
+				slog.Warn("读取agent目标文件列表失败", "path", dest, "err", err)
+				continue
+			}
+			// agent只返回名称，无法区分文件和文件夹
+			for _, name := range names {
+				if completedName(name) {
+					index[name] = dest
+				}
+			}
+			continue
+		}
+		if isSimulated(dest) {
+			for _, name := range simulatedNames(dest) {
+				index[name] = dest
+			}
+			continue
+		}
+		if t, ok := s3For(c, dest); ok {
+			names, err := t.list()
+			if err != nil {
+				slog.Warn("读取s3目标文件列表失败", "path", dest, "err", err)
+				continue
+			}
+			for _, name := range names {
+				index[name] = dest
+			}
+			continue
+		}
+		entries, err := os.ReadDir(dest)
+		if err != nil {
+			slog.Warn("读取目标文件列表失败", "path", dest, "err", err)
+			continue
+		}
+		for _, entry := range entries {
+			if !indexable(entry.Name(), entry.IsDir()) {
+				continue
+			}
+			index[entry.Name()] = dest
+			if entry.IsDir() {
+				for _, name := range plotFiles(filepath.Join(dest, entry.Name())) {
+					index[name] = dest
+				}
+			}
+		}
+	}
+	return index
+}
+
+// Lookup 判断源路径（或源文件夹中的 .plot 文件）是否已经存在于某个目标上
+func (idx plotIndex) Lookup(src string, isDir bool) (string, string, bool) {
+	names := []string{filepath.Base(src)}
+	if isDir {
+		names = append(names, plotFiles(src)...)
+	}
+	for _, name := range names {
+		if dest, ok := idx[name]; ok {
+			return name, dest, true
+		}
+	}
+	return "", "", false
+}
+
+func plotFiles(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".plot") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// handleDuplicate 源已经存在于目标上时按配置跳过或隔离，返回 true 表示不要迁移该源
+func handleDuplicate(c *Config, index plotIndex, src string, isDir bool) bool {
+	if c.Duplicates.Action == "off" {
+		return false
+	}
+	name, dest, ok := index.Lookup(src, isDir)
+	if !ok {
+		return false
+	}
+	if c.Duplicates.Action == "quarantine" && c.Duplicates.QuarantineDir != "" {
+		target := filepath.Join(c.Duplicates.QuarantineDir, filepath.Base(src))
+		err := os.MkdirAll(c.Duplicates.QuarantineDir, 0755)
+		if err == nil {
+			err = os.Rename(src, target)
+		}
+		if err == nil {
+			slog.Warn("目标上已存在同名plot，已隔离源", "path", src, "name", name, "dest", dest, "quarantine", target)
+			return true
+		}
+		slog.Error("隔离重复的源失败，改为跳过", "path", src, "err", err)
+	} else {
+		slog.Warn("目标上已存在同名plot，跳过", "path", src, "name", name, "dest", dest)
+	}
+	return true
+}
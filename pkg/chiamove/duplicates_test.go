@@ -0,0 +1,55 @@
+package chiamove
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBuildPlotIndexCompletedOnly(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for _, dir := range []string{"folder", "folder-b" + partialSuffix, ".chiamove-tmp"} {
+		if err := os.Mkdir(filepath.Join(dst, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{
+		"plot-a.plot",
+		"plot-b.plot" + partialSuffix,
+		".plot-c.plot.AbC123",
+		"notes.txt",
+		"folder/a.plot",
+		"folder-b" + partialSuffix + "/b.plot",
+		".chiamove-tmp/c.plot",
+	} {
+		writePlot(t, dst, name, 10, time.Time{})
+	}
+	c := newTestConfig(t, src, dst)
+
+	index := buildPlotIndex(c, []string{dst})
+	var got []string
+	for name := range index {
+		got = append(got, name)
+	}
+	slices.Sort(got)
+	if want := []string{"a.plot", "folder", "plot-a.plot"}; !slices.Equal(got, want) {
+		t.Errorf("index = %v, want %v", got, want)
+	}
+	for _, tc := range []struct {
+		name string
+		want bool
+	}{
+		{"plot-a.plot", true},
+		{"plot-b.plot", false},
+		{"plot-c.plot", false},
+		{"b.plot", false},
+		{"notes.txt", false},
+	} {
+		p := writePlot(t, src, tc.name, 10, time.Time{})
+		if got := handleDuplicate(c, index, p, false); got != tc.want {
+			t.Errorf("handleDuplicate(%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package chiamove
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EmailConfig 通过SMTP定期发送迁移汇总，interval 为 0 时只在运行结束时发送
+type EmailConfig struct {
+	Host     string        `yaml:"host"`
+	Port     int           `yaml:"port"` // 465 使用TLS直连，其他端口在服务器支持时使用STARTTLS
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	From     string        `yaml:"from"`
+	To       []string      `yaml:"to"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Digest 两次发送汇总之间结束的任务
+type Digest struct {
+	mu       sync.Mutex
+	since    time.Time
+	moved    int
+	bytes    uint64
+	failures []string
+}
+
+var digest = &Digest{since: time.Now()}
+
+func (d *Digest) Add(tr Transfer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if tr.Error != "" {
+		d.failures = append(d.failures, fmt.Sprintf("%s -> %s: %s", tr.Src, tr.Dst, tr.Error))
+		return
+	}
+	d.moved++
+	d.bytes += tr.Size
+}
+
+// Report 生成汇总内容并清空计数
+func (d *Digest) Report() string {
+	d.mu.Lock()
+	since, moved, bytes, failures := d.since, d.moved, d.bytes, d.failures
+	d.since, d.moved, d.bytes, d.failures = time.Now(), 0, 0, nil
+	d.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, T("统计时间: %s ~ %s\n\n"), since.Format(time.DateTime), time.Now().Format(time.DateTime))
+	fmt.Fprintf(&b, T("迁移成功: %d 个，共 %s\n"), moved, formatBytes(bytes))
+	fmt.Fprintf(&b, T("迁移失败: %d 个\n"), len(failures))
+	for _, f := range failures {
+		fmt.Fprintf(&b, "  %s\n", f)
+	}
+	configMu.Lock()
+	fromPaths := config.FromPaths
+	configMu.Unlock()
+	b.WriteString(T("\n源盘使用情况:\n"))
+	for _, p := range expandFromPaths(fromPaths) {
+		if isRemoteSource(p) {
+			continue
+		}
+		usage, err := GetDiskUsage(p)
+		if err != nil {
+			fmt.Fprintf(&b, "  %s: %v\n", p, err)
+			continue
+		}
+		fmt.Fprintf(&b, T("  %s: 已用 %s / %s\n"), p, formatBytes(usage.Total-usage.Free), formatBytes(usage.Total))
+	}
+	b.WriteString(T("\n目标盘使用情况:\n"))
+	for _, p := range destinations() {
+		usage, err := GetDestinationUsage(p)
+		if err != nil || usage.Total == 0 {
+			fmt.Fprintf(&b, "  %s: %v\n", p, err)
+			continue
+		}
+		used := usage.Total - usage.Free
+		fmt.Fprintf(&b, T("  %s: %.1f%%，剩余 %s\n"), p, float64(used)*100/float64(usage.Total), formatBytes(usage.Free))
+	}
+	return b.String()
+}
+
+// StartEmailDigest 按 notify.email.interval 定期发送汇总
+func StartEmailDigest() {
+	cfg := config.Notify.Email
+	if cfg == nil || cfg.Interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(cfg.Interval) {
+			SendDigest()
+		}
+	}()
+}
+
+// SendDigest 配置了邮件时发送一次汇总，发送失败只记录日志
+func SendDigest() {
+	configMu.Lock()
+	cfg := config.Notify.Email
+	configMu.Unlock()
+	if cfg == nil || cfg.Host == "" {
+		return
+	}
+	host, _ := os.Hostname()
+	if err := sendMail(cfg, T("chiaMove 迁移汇总 ")+host, digest.Report()); err != nil {
+		slog.Warn("发送汇总邮件失败", "host", cfg.Host, "err", err)
+		return
+	}
+	slog.Info("已发送汇总邮件", "to", cfg.To)
+}
+
+func sendMail(cfg *EmailConfig, subject, body string) error {
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+	msg := "From: " + cfg.From + "\r\n" +
+		"To: " + strings.Join(cfg.To, ", ") + "\r\n" +
+		"Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n\r\n" +
+		strings.ReplaceAll(body, "\n", "\r\n")
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	if port != 465 {
+		return smtp.SendMail(addr, auth, cfg.From, cfg.To, []byte(msg))
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, &tls.Config{ServerName: cfg.Host})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, to := range cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,130 @@
+package chiamove
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransferEvent --json-events 输出的一行JSON，供外部编排工具读取
+type TransferEvent struct {
+	Type   string    `json:"type"` // queued / started / rerouted / progress / verified / completed / failed
+	Time   time.Time `json:"time"`
+	Src    string    `json:"src"`
+	Dst    string    `json:"dst,omitempty"`
+	Size   uint64    `json:"size,omitempty"`
+	Copied uint64    `json:"copied,omitempty"` // progress、completed: 已写入的字节数
+	Speed  uint64    `json:"speed,omitempty"`  // progress: 每秒字节数
+	Method string    `json:"method,omitempty"` // verified: sample / full / plotcheck
+	Error  string    `json:"error,omitempty"`
+}
+
+// EventStream 把事件写到标准输出或连接到Unix socket的所有客户端，nil 时不输出
+type EventStream struct {
+	mu      sync.Mutex
+	writers []io.Writer
+}
+
+var events *EventStream
+
+// 客户端超过该时间没有读取时断开，避免拖慢迁移
+const eventWriteTimeout = 5 * time.Second
+
+// StartEventStream target 为 stdout 或 unix:/path/to.sock，后者监听该socket，客户端连接后开始接收事件
+func StartEventStream(target string) error {
+	s := &EventStream{}
+	if target == "stdout" {
+		s.writers = []io.Writer{os.Stdout}
+		events = s
+		StartEventProgress()
+		return nil
+	}
+	path, ok := strings.CutPrefix(target, "unix:")
+	if !ok {
+		return fmt.Errorf(T("jsonEvents 无效 %q，可选 stdout 或 unix:/path/to.sock"), target)
+	}
+	// 上次退出时留下的socket文件
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				slog.Error("事件socket接受连接失败", "path", path, "err", err)
+				return
+			}
+			s.mu.Lock()
+			s.writers = append(s.writers, conn)
+			s.mu.Unlock()
+		}
+	}()
+	events = s
+	StartEventProgress()
+	return nil
+}
+
+func (s *EventStream) Emit(ev TransferEvent) {
+	ev.Time = time.Now()
+	mqttClient.publishEvent(ev)
+	if s == nil {
+		return
+	}
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writers := s.writers[:0]
+	for _, w := range s.writers {
+		if conn, ok := w.(net.Conn); ok {
+			conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			if _, err := conn.Write(line); err != nil {
+				conn.Close()
+				continue
+			}
+		} else {
+			w.Write(line)
+		}
+		writers = append(writers, w)
+	}
+	s.writers = writers
+}
+
+// StartEventProgress 每隔 progressInterval（未设置时10秒）输出进行中任务的 progress 事件
+func StartEventProgress() {
+	interval := *config.ProgressInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	go func() {
+		last := map[string]progressSample{}
+		for range time.Tick(interval) {
+			now := time.Now()
+			samples := map[string]progressSample{}
+			for _, tr := range tracker.Active() {
+				prev, ok := last[tr.Src]
+				if !ok {
+					prev = progressSample{at: tr.StartedAt}
+				}
+				var speed uint64
+				if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 && tr.Copied >= prev.copied {
+					speed = uint64(float64(tr.Copied-prev.copied) / elapsed)
+				}
+				samples[tr.Src] = progressSample{copied: tr.Copied, at: now}
+				events.Emit(TransferEvent{Type: "progress", Src: tr.Src, Dst: tr.Dst, Size: tr.Size, Copied: tr.Copied, Speed: speed})
+			}
+			last = samples
+		}
+	}()
+}
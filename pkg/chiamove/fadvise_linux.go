@@ -0,0 +1,28 @@
+//go:build linux
+
+package chiamove
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// adviseSequential 告诉内核 f 会被顺序读取，加大预读
+func adviseSequential(f *os.File) {
+	unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+}
+
+// startWriteback 开始把 f 中 [offset, offset+length) 的脏页写回磁盘，不等待完成
+func startWriteback(f *os.File, offset, length int64) {
+	unix.SyncFileRange(int(f.Fd()), offset, length, unix.SYNC_FILE_RANGE_WRITE)
+}
+
+// dropCache 丢弃 f 中 [offset, offset+length) 的页缓存，length 为0时到文件末尾；
+// written 为true时先等待这一段写回磁盘，脏页不会被丢弃
+func dropCache(f *os.File, offset, length int64, written bool) {
+	if written {
+		unix.SyncFileRange(int(f.Fd()), offset, length, unix.SYNC_FILE_RANGE_WAIT_BEFORE|unix.SYNC_FILE_RANGE_WRITE|unix.SYNC_FILE_RANGE_WAIT_AFTER)
+	}
+	unix.Fadvise(int(f.Fd()), offset, length, unix.FADV_DONTNEED)
+}
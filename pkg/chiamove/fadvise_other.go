@@ -0,0 +1,11 @@
+//go:build !linux
+
+package chiamove
+
+import "os"
+
+func adviseSequential(f *os.File) {}
+
+func startWriteback(f *os.File, offset, length int64) {}
+
+func dropCache(f *os.File, offset, length int64, written bool) {}
@@ -0,0 +1,188 @@
+package chiamove
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+const failedSuffix = ".failed"
+
+type FailedConfig struct {
+	Action        string `yaml:"action"`        // skip: 跳过，重启后也不再选择 / quarantine: 把源移到 quarantineDir / rename: 源改名加 .failed 后缀
+	QuarantineDir string `yaml:"quarantineDir"` // 建议放在源盘上，这样移动只是rename
+}
+
+// handleFailed 迁移失败后按配置隔离或改名源，返回源现在的路径，与原来不同时由调度在本次运行中跳过
+func handleFailed(c *Config, src string) string {
+	if isRemoteSource(src) {
+		return src
+	}
+	var target string
+	switch c.Failed.Action {
+	case "quarantine":
+		target = filepath.Join(c.Failed.QuarantineDir, filepath.Base(src))
+		if err := os.MkdirAll(c.Failed.QuarantineDir, 0755); err != nil {
+			slog.Error("创建隔离目录失败，改为跳过", "path", src, "err", err)
+			target = ""
+		}
+	case "rename":
+		target = src + failedSuffix
+	}
+	if target != "" {
+		if err := os.Rename(src, target); err != nil {
+			slog.Error("隔离失败的源出错，改为跳过", "path", src, "target", target, "err", err)
+		} else {
+			slog.Warn("已隔离迁移失败的源", "path", src, "target", target)
+			src = target
+		}
+	}
+	return src
+}
+
+func isFailedPath(path string) bool {
+	return strings.HasSuffix(path, failedSuffix)
+}
+
+// restoreFailed 把被 quarantine 或 rename 的失败源移回原来的位置，源还在原处时不处理
+func restoreFailed(src string) error {
+	if isRemoteSource(src) {
+		return nil
+	}
+	if _, err := os.Lstat(src); err == nil {
+		return nil
+	}
+	candidates := []string{src + failedSuffix}
+	if config.Failed.QuarantineDir != "" {
+		candidates = append(candidates, filepath.Join(config.Failed.QuarantineDir, filepath.Base(src)))
+	}
+	for _, moved := range candidates {
+		if _, err := os.Lstat(moved); err == nil {
+			return os.Rename(moved, src)
+		}
+	}
+	return fmt.Errorf(T("源不存在: %s"), src)
+}
+
+// retryFailed 清除失败记录并把隔离的源移回原处，下一轮调度重新迁移；srcs 为空时重试全部失败的任务
+func retryFailed(srcs []string) []*JournalEntry {
+	cleared := journal.ClearFailed(srcs)
+	for _, e := range cleared {
+		if err := restoreFailed(e.Src); err != nil {
+			slog.Warn("恢复失败的源出错", "path", e.Src, "err", err)
+			continue
+		}
+		slog.Info("重新排队失败的任务", "path", e.Src, "lastError", e.Error)
+	}
+	if len(cleared) > 0 {
+		wake()
+	}
+	return cleared
+}
+
+// runRetryFailed 实现 retry-failed 子命令：列出失败的任务及原因，或清除失败记录让它们重新迁移。
+// 迁移进程配置了 api.listen 时通过API操作，否则直接修改任务日志
+func runRetryFailed(args []string) int {
+	fs := flag.NewFlagSet("chiamove retry-failed", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", T("配置文件路径"))
+	addr := fs.String("addr", "", T("API地址，如 127.0.0.1:8080，默认使用配置中的 api.listen"))
+	list := fs.Bool("list", false, T("只列出失败的任务及原因，不重试"))
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	c, err := ReadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("读取配置失败: %v\n"), err)
+		return exitConfigError
+	}
+	SetLanguage(c.Language)
+	if *addr == "" {
+		*addr = c.API.Listen
+	}
+	srcs := fs.Args()
+	var entries []*JournalEntry
+	if *addr != "" {
+		entries, err = retryFailedAPI(*addr, c.API.Token, srcs, *list)
+		if err == nil {
+			printFailed(entries, *list)
+			return exitOK
+		}
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			fmt.Fprintf(os.Stderr, T("连接迁移进程失败: %v\n"), err)
+			return exitError
+		}
+	}
+	// 迁移进程没有运行，直接修改任务日志，下次启动时生效
+	config = c
+	j, err := OpenJournal(c.JournalFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("读取任务日志失败: %v\n"), err)
+		return exitError
+	}
+	if *list {
+		printFailed(j.Entries(StateFailed), true)
+		return exitOK
+	}
+	journal = j
+	printFailed(retryFailed(srcs), false)
+	return exitOK
+}
+
+func retryFailedAPI(addr, token string, srcs []string, list bool) ([]*JournalEntry, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	url := strings.TrimRight(addr, "/") + "/api/failed"
+	client := http.Client{Timeout: 10 * time.Second}
+	var resp *http.Response
+	var err error
+	if list {
+		resp, err = client.Get(url)
+	} else {
+		body, _ := json.Marshal(map[string][]string{"srcs": srcs})
+		req, err := http.NewRequest(http.MethodPost, url+"/retry", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err = client.Do(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	var entries []*JournalEntry
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	return entries, err
+}
+
+func printFailed(entries []*JournalEntry, list bool) {
+	if len(entries) == 0 {
+		fmt.Println(T("没有失败的任务"))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", e.Src, e.UpdatedAt.Local().Format("2006-01-02 15:04"), e.Error)
+	}
+	w.Flush()
+	if !list {
+		fmt.Printf(T("已重新排队 %d 个任务\n"), len(entries))
+	}
+}
@@ -0,0 +1,139 @@
+package chiamove
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var errInjected = sentinelError("故障注入")
+
+// faultInjector 用隐藏参数 --inject-faults 启用，在复制过程中按概率制造磁盘已满、中途中断、目标变慢和数据损坏，
+// 用于验证重试、续传、校验和目标暂停等逻辑。如 enospc=0.2,interrupt=0.3,interruptAfter=2s,slow=10s,corrupt=0.1,seed=1
+type faultInjector struct {
+	mu             sync.Mutex
+	rand           *rand.Rand
+	enospc         float64
+	interrupt      float64
+	interruptAfter time.Duration
+	slow           time.Duration
+	corrupt        float64
+}
+
+// faults 为nil时不注入故障
+var faults *faultInjector
+
+func parseFaults(spec string) (*faultInjector, error) {
+	f := &faultInjector{interruptAfter: time.Second}
+	seed := time.Now().UnixNano()
+	for _, kv := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		var err error
+		switch key {
+		case "enospc":
+			f.enospc, err = strconv.ParseFloat(value, 64)
+		case "interrupt":
+			f.interrupt, err = strconv.ParseFloat(value, 64)
+		case "interruptAfter":
+			f.interruptAfter, err = time.ParseDuration(value)
+		case "slow":
+			f.slow, err = time.ParseDuration(value)
+		case "corrupt":
+			f.corrupt, err = strconv.ParseFloat(value, 64)
+		case "seed":
+			seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return nil, fmt.Errorf(T("未知的故障类型 %q，可选 enospc / interrupt / interruptAfter / slow / corrupt / seed"), key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf(T("故障注入参数 %s 无效: %w"), key, err)
+		}
+	}
+	f.rand = rand.New(rand.NewSource(seed))
+	return f, nil
+}
+
+func (f *faultInjector) hit(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rand.Float64() < p
+}
+
+// faultTransport 在真正的后端外面按 faults 注入故障
+type faultTransport struct {
+	Transport
+	faults *faultInjector
+}
+
+func (t faultTransport) Copy(ctx context.Context, src, dst string) error {
+	f := t.faults
+	if f.slow > 0 {
+		slog.Warn("故障注入: 目标变慢", "src", src, "dst", dst, "delay", f.slow)
+		select {
+		case <-time.After(f.slow):
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+	if f.hit(f.enospc) {
+		slog.Warn("故障注入: 磁盘已满", "src", src, "dst", dst)
+		return fmt.Errorf("%w: %s: %w", errInjected, dst, syscall.ENOSPC)
+	}
+	if f.hit(f.interrupt) {
+		slog.Warn("故障注入: 复制中途中断", "src", src, "dst", dst, "after", f.interruptAfter)
+		copyCtx, cancel := context.WithTimeout(ctx, f.interruptAfter)
+		err := t.Transport.Copy(copyCtx, src, dst)
+		cancel()
+		// 在中断之前已经复制完成时按成功处理
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %v", errInjected, err)
+	}
+	if err := t.Transport.Copy(ctx, src, dst); err != nil {
+		return err
+	}
+	if f.hit(f.corrupt) && !isRemoteDest(dst) {
+		slog.Warn("故障注入: 损坏目标上的副本", "src", src, "dst", dst)
+		return corruptCopy(filepath.Join(dst, filepath.Base(src)))
+	}
+	return nil
+}
+
+// corruptCopy 翻转目标副本（文件夹时为其中第一个文件）开头的一个字节，校验时应当发现
+func corruptCopy(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil || len(entries) == 0 {
+			return err
+		}
+		return corruptCopy(filepath.Join(path, entries[0].Name()))
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, 0); err != nil {
+		return err
+	}
+	b[0] ^= 0xff
+	_, err = f.WriteAt(b, 0)
+	return err
+}
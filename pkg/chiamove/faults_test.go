@@ -0,0 +1,213 @@
+package chiamove
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// mustParseFaults 按 spec 创建故障注入，测试都指定 seed 保证结果可复现
+func mustParseFaults(t *testing.T, spec string) *faultInjector {
+	t.Helper()
+	f, err := parseFaults(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestParseFaults(t *testing.T) {
+	f := mustParseFaults(t, "enospc=0.2, interrupt=0.3,interruptAfter=2s,slow=10s,corrupt=0.1,seed=1")
+	if f.enospc != 0.2 || f.interrupt != 0.3 || f.interruptAfter != 2*time.Second || f.slow != 10*time.Second || f.corrupt != 0.1 {
+		t.Errorf("parseFaults = %+v", f)
+	}
+	for _, spec := range []string{"unknown=1", "enospc=x", "interruptAfter=2", "seed=1.5"} {
+		if _, err := parseFaults(spec); err == nil {
+			t.Errorf("parseFaults(%q) returned nil error", spec)
+		}
+	}
+}
+
+func TestFaultInjectorHit(t *testing.T) {
+	f := mustParseFaults(t, "seed=1")
+	for i := 0; i < 100; i++ {
+		if f.hit(0) {
+			t.Fatal("hit(0) = true")
+		}
+		if !f.hit(1) {
+			t.Fatal("hit(1) = false")
+		}
+	}
+}
+
+func TestFaultTransportNoSpace(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	p := writePlot(t, src, "plot-a.plot", 100, time.Time{})
+	transport := &fakeTransport{}
+	ft := faultTransport{transport, mustParseFaults(t, "enospc=1,seed=1")}
+
+	err := ft.Copy(context.Background(), p, dst)
+	if !errors.Is(err, errInjected) || !isNoSpace(err) || classifyError(err) != errPermanent {
+		t.Errorf("Copy = %v, want injected no-space permanent error", err)
+	}
+	if len(transport.copied) != 0 {
+		t.Errorf("copied = %v, want nothing", transport.copied)
+	}
+}
+
+func TestFaultTransportInterrupt(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	slow := writePlot(t, src, "plot-slow.plot", 100, time.Time{})
+	fast := writePlot(t, src, "plot-fast.plot", 100, time.Time{})
+	transport := &fakeTransport{copy: func(src, dst string) error {
+		if src == slow {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return nil
+	}}
+	ft := faultTransport{transport, mustParseFaults(t, "interrupt=1,interruptAfter=20ms,seed=1")}
+
+	err := ft.Copy(context.Background(), slow, dst)
+	if !errors.Is(err, errInjected) || classifyError(err) != errTransient {
+		t.Errorf("interrupted Copy = %v, want injected transient error", err)
+	}
+	// 在中断之前已经复制完成时按成功处理
+	if err := ft.Copy(context.Background(), fast, dst); err != nil {
+		t.Errorf("Copy finished before interrupt = %v", err)
+	}
+}
+
+func TestCorruptCopy(t *testing.T) {
+	dir := t.TempDir()
+	p := writePlot(t, dir, "plot-a.plot", 10, time.Time{})
+	if err := corruptCopy(p); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[0] != 0xff || len(b) != 10 {
+		t.Errorf("corrupted file = %v", b)
+	}
+
+	// 文件夹时损坏其中第一个文件
+	folder := filepath.Join(dir, "folder")
+	if err := os.Mkdir(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	inner := writePlot(t, folder, "a.plot", 10, time.Time{})
+	if err := corruptCopy(folder); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(inner); b[0] != 0xff {
+		t.Errorf("first file in folder not corrupted: %v", b)
+	}
+}
+
+func TestCopyWithRetryAfterInjectedInterrupt(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	p := writePlot(t, src, "plot-a.plot", 100, time.Time{})
+	attempts := 0
+	transport := &fakeTransport{copy: func(src, dst string) error {
+		// 只有第一次复制慢到被中断
+		if attempts++; attempts == 1 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return nil
+	}}
+	c := newTestConfig(t, src, dst)
+	c.Retry = RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	s := newTestScheduler(t, c, transport)
+	s.faults = mustParseFaults(t, "interrupt=1,interruptAfter=20ms,seed=1")
+
+	s.Run(context.Background(), []*Executor{{fromPath: p, toPath: dst, size: 100}})
+	if !s.journal.Completed(p) {
+		t.Fatalf("journal entry for %s not done after retry", p)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+	if h := s.tracker.History(); len(h) != 1 || h[0].Retries != 1 {
+		t.Errorf("tracker history = %+v, want one transfer with 1 retry", h)
+	}
+}
+
+func TestCopyWithRetryNoSpaceNotRetried(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	p := writePlot(t, src, "plot-a.plot", 100, time.Time{})
+	c := newTestConfig(t, src, dst)
+	c.Retry = RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	s := newTestScheduler(t, c, &fakeTransport{})
+	s.faults = mustParseFaults(t, "enospc=1,seed=1")
+
+	err := s.copyWithRetry(context.Background(), p, dst)
+	if !errors.Is(err, syscall.ENOSPC) || !errors.Is(err, errInjected) {
+		t.Fatalf("copyWithRetry = %v, want injected ENOSPC", err)
+	}
+	if s.tracker.Running() != 0 {
+		t.Error("permanent error recorded as running transfer")
+	}
+}
+
+func TestCopySourceStalled(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stall detection checks at most once per second")
+	}
+	src, dst := t.TempDir(), t.TempDir()
+	p := writePlot(t, src, "plot-a.plot", 100, time.Time{})
+	transport := &fakeTransport{}
+	c := newTestConfig(t, src, dst)
+	c.StallTimeout = time.Second
+	s := newTestScheduler(t, c, transport)
+	// 目标变慢期间没有写入任何数据，超过 stallTimeout 后被终止
+	s.faults = mustParseFaults(t, "slow=1m,seed=1")
+
+	start := time.Now()
+	err := s.copyWithRetry(context.Background(), p, dst)
+	if !errors.Is(err, errStalled) {
+		t.Fatalf("copyWithRetry = %v, want %v", err, errStalled)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("stalled copy took %s", elapsed)
+	}
+	if len(transport.copied) != 0 {
+		t.Errorf("copied = %v, want nothing", transport.copied)
+	}
+}
+
+func TestRunPartialFailureWithInjectedInterrupt(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	slow := writePlot(t, src, "plot-slow.plot", 100, time.Time{})
+	fast := writePlot(t, src, "plot-fast.plot", 100, time.Time{})
+	transport := &fakeTransport{copy: func(src, dst string) error {
+		if src == slow {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return nil
+	}}
+	c := newTestConfig(t, src, dst)
+	s := newTestScheduler(t, c, transport)
+	s.faults = mustParseFaults(t, "interrupt=1,interruptAfter=50ms,seed=1")
+
+	s.Run(context.Background(), []*Executor{
+		{fromPath: slow, toPath: dst, size: 100},
+		{fromPath: fast, toPath: dst, size: 100},
+	})
+	if !s.journal.Failed(slow) {
+		t.Errorf("journal entry for interrupted %s not failed", slow)
+	}
+	if !s.journal.Completed(fast) {
+		t.Errorf("journal entry for %s not done", fast)
+	}
+	if moved, _ := s.stats.Totals(); moved != 1 {
+		t.Errorf("moved = %d, want 1", moved)
+	}
+	if code := s.stats.ExitCode(exitOK); code != exitPartialFailure {
+		t.Errorf("exit code = %d, want %d", code, exitPartialFailure)
+	}
+}
@@ -0,0 +1,114 @@
+package chiamove
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SourceConfig 需要单独设置过滤条件的源路径，如不同plotter输出到各自临时目录的文件名称不同，其中的路径会合并到 fromPaths；
+// filter 或 rules 代替 fromPathFilter 中的规则，exclude 仍然使用 fromPathFilter 的
+type SourceConfig struct {
+	Path   string      `yaml:"path"`
+	Filter *FilterRule `yaml:"filter"`
+	// 按顺序匹配的多条规则，配置后忽略 filter
+	Rules []FilterRule `yaml:"rules"`
+}
+
+// FilterRule 一条源路径过滤规则，名称、类型、plot信息和大小都符合时才迁移
+type FilterRule struct {
+	Name    string   `yaml:"name"`
+	MinSize ByteSize `yaml:"minSize"`
+	MaxSize ByteSize `yaml:"maxSize"`
+	Prefix  string   `yaml:"prefix"`
+	// 名称还需要符合该正则
+	Regex string `yaml:"regex"`
+	// 不为空时，符合前缀和扩展名的单个文件（如 .plot）也作为迁移单位
+	Extension string `yaml:"extension"`
+	// 按plot文件名中的k值、压缩等级、创建日期过滤
+	Plot PlotFilter `yaml:"plot"`
+	// 按文件名中的k值和压缩等级估算的大小判断，代替 minSize/maxSize；名称不是plot或无法估算时仍按 minSize/maxSize
+	ExpectedSize bool `yaml:"expectedSize"`
+	// 修改时间距今超过该分钟数才迁移，避免选中plotter刚写完或还在收尾的文件/文件夹；0 为不限制
+	MinAgeMinutes int `yaml:"minAgeMinutes"`
+	regex         *regexp.Regexp
+}
+
+func (r *FilterRule) compile() error {
+	if r.Regex == "" {
+		return nil
+	}
+	re, err := regexp.Compile(r.Regex)
+	if err != nil {
+		return fmt.Errorf(T("过滤规则 %s 的 regex 无效 %q: %w"), r.Name, r.Regex, err)
+	}
+	r.regex = re
+	return nil
+}
+
+// matchEntry 按名称和类型判断，不读取内容
+func (r *FilterRule) matchEntry(entry fs.DirEntry) bool {
+	name := entry.Name()
+	if !strings.HasPrefix(name, r.Prefix) || r.regex != nil && !r.regex.MatchString(name) {
+		return false
+	}
+	return entry.IsDir() || r.Extension != "" && entry.Type().IsRegular() && strings.HasSuffix(name, r.Extension)
+}
+
+// matchAge 按文件/文件夹本身的修改时间判断，无法获取修改时间（如HTTP源）时不限制
+func (r *FilterRule) matchAge(entry fs.DirEntry) bool {
+	if r.MinAgeMinutes <= 0 {
+		return true
+	}
+	info, err := entry.Info()
+	if errors.Is(err, errors.ErrUnsupported) {
+		return true
+	}
+	return err == nil && time.Since(info.ModTime()) >= time.Duration(r.MinAgeMinutes)*time.Minute
+}
+
+func (r *FilterRule) matchSize(sizes PlotSizeConfig, path string, isDir bool, size uint64) bool {
+	if r.ExpectedSize {
+		if expected, ok := sizes.expectedUnitSize(path, isDir); ok {
+			return sizes.matchExpectedSize(size, expected)
+		}
+	}
+	return uint64(r.MinSize) <= size && size < uint64(r.MaxSize)
+}
+
+// filterRules 返回源路径 fromPath 使用的规则：fromPathsConfig 中单独配置的规则，或者 fromPathFilter.rules，
+// 都没有配置时使用 fromPathFilter 本身作为唯一的规则
+func (c *Config) filterRules(fromPath string) []FilterRule {
+	for i := range c.FromPathsConfig {
+		s := &c.FromPathsConfig[i]
+		if !matchSourcePath(s.Path, fromPath) {
+			continue
+		}
+		if len(s.Rules) > 0 {
+			return s.Rules
+		}
+		if s.Filter != nil {
+			return []FilterRule{*s.Filter}
+		}
+	}
+	if len(c.FromPathFilter.Rules) > 0 {
+		return c.FromPathFilter.Rules
+	}
+	return []FilterRule{c.FromPathFilter.FilterRule}
+}
+
+// matchingRules 返回按名称、类型、修改时间和plot信息符合的规则，保持配置中的顺序
+func matchingRules(c *Config, path string, entry fs.DirEntry) []*FilterRule {
+	var matched []*FilterRule
+	rules := c.filterRules(filepath.Dir(path))
+	for i := range rules {
+		if rules[i].matchEntry(entry) && rules[i].matchAge(entry) && rules[i].Plot.MatchPath(path, entry.IsDir()) {
+			matched = append(matched, &rules[i])
+		}
+	}
+	return matched
+}
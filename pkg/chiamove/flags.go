@@ -0,0 +1,139 @@
+package chiamove
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Options 命令行参数，优先级: 命令行 > 环境变量 > 配置文件
+type Options struct {
+	ConfigPath string
+	From       stringList
+	To         stringList
+	DryRun     bool
+	LogLevel   string
+	TUI        bool
+	Daemon     bool
+	JSONEvents eventsFlag
+	// 多级迁移时由主进程指定子进程运行的一级
+	Stage string
+	// 只运行 profiles 中的一个，不指定时由主进程为每个profile启动子进程
+	Profile string
+	// 测试重试、校验和目标暂停时使用的故障注入，不在帮助中显示
+	Faults string
+}
+
+// eventsFlag 单独的 --json-events 表示输出到标准输出，也可以写成 --json-events=unix:/path/to.sock
+type eventsFlag string
+
+func (f *eventsFlag) String() string { return string(*f) }
+
+func (f *eventsFlag) IsBoolFlag() bool { return true }
+
+func (f *eventsFlag) Set(value string) error {
+	switch value {
+	case "true":
+		value = "stdout"
+	case "false":
+		value = ""
+	}
+	*f = eventsFlag(value)
+	return nil
+}
+
+// stringList 可以多次指定，也可以用逗号分隔多个值
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func ParseOptions(args []string) (*Options, error) {
+	opts := &Options{ConfigPath: "config.yaml"}
+	if v := os.Getenv("CHIAMOVE_CONFIG"); v != "" {
+		opts.ConfigPath = v
+	}
+	opts.From.Set(os.Getenv("CHIAMOVE_FROM"))
+	opts.To.Set(os.Getenv("CHIAMOVE_TO"))
+	if v := os.Getenv("CHIAMOVE_DRY_RUN"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf(T("环境变量 CHIAMOVE_DRY_RUN 无效: %w"), err)
+		}
+		opts.DryRun = dryRun
+	}
+	opts.LogLevel = os.Getenv("CHIAMOVE_LOG_LEVEL")
+
+	fs := flag.NewFlagSet("chiamove", flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigPath, "config", opts.ConfigPath, T("配置文件路径 (环境变量 CHIAMOVE_CONFIG)"))
+	var from, to stringList
+	fs.Var(&from, "from", T("源路径，可多次指定或用逗号分隔，覆盖配置中的 fromPaths (环境变量 CHIAMOVE_FROM)"))
+	fs.Var(&to, "to", T("目标路径，可多次指定或用逗号分隔，覆盖配置中的 toPaths (环境变量 CHIAMOVE_TO)"))
+	fs.BoolVar(&opts.DryRun, "dry-run", opts.DryRun, T("只打印迁移计划，不实际复制 (环境变量 CHIAMOVE_DRY_RUN)"))
+	fs.StringVar(&opts.LogLevel, "log-level", opts.LogLevel, T("日志级别 debug/info/warn/error (环境变量 CHIAMOVE_LOG_LEVEL)"))
+	fs.BoolVar(&opts.TUI, "tui", false, T("在终端显示实时界面代替滚动的日志输出"))
+	fs.BoolVar(&opts.Daemon, "daemon", false, T("源盘已空或目标已满时不退出，定时重新扫描"))
+	fs.Var(&opts.JSONEvents, "json-events", T("以JSON lines输出任务事件到标准输出，或用 --json-events=unix:/path/to.sock 输出到Unix socket"))
+	fs.StringVar(&opts.Profile, "profile", os.Getenv("CHIAMOVE_PROFILE"), T("只运行配置中 profiles 的指定一个，不指定时同时运行所有profile (环境变量 CHIAMOVE_PROFILE)"))
+	fs.StringVar(&opts.Stage, "stage", "", T("只运行配置中 stages 的指定一级，配置了 stages 时由主进程自动使用"))
+	fs.StringVar(&opts.Faults, "inject-faults", "", "")
+	fs.Usage = func() { printVisibleDefaults(fs) }
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	// 命令行指定了就完全替换环境变量中的列表
+	if len(from) > 0 {
+		opts.From = from
+	}
+	if len(to) > 0 {
+		opts.To = to
+	}
+	return opts, nil
+}
+
+// printVisibleDefaults 与默认的帮助输出相同，但跳过没有说明的隐藏参数
+func printVisibleDefaults(fs *flag.FlagSet) {
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(fs.Output())
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Usage != "" {
+			visible.Var(f.Value, f.Name, f.Usage)
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	fmt.Fprintf(fs.Output(), "Usage of %s:\n", fs.Name())
+	visible.PrintDefaults()
+}
+
+func (o *Options) Apply(c *Config) {
+	if len(o.From) > 0 {
+		c.FromPaths = o.From
+	}
+	if len(o.To) > 0 {
+		c.ToPaths = o.To
+	}
+	if o.DryRun {
+		c.DryRun = true
+	}
+	if o.Daemon {
+		c.Daemon = true
+	}
+	if o.JSONEvents != "" {
+		c.JSONEvents = string(o.JSONEvents)
+	}
+	if o.LogLevel != "" {
+		c.Logging.Level = o.LogLevel
+	}
+}
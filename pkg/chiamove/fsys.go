@@ -0,0 +1,105 @@
+package chiamove
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileSystem 扫描源、计算大小、过滤和校验时读取本地文件的接口。默认为操作系统的文件系统，
+// 替换为 mapFS 等内存文件系统后，选择源和过滤的逻辑不需要真实的磁盘就能运行
+type FileSystem interface {
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	Open(name string) (File, error)
+}
+
+// File 校验时按偏移读取文件
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Closer
+}
+
+type osFS struct{}
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (osFS) Open(name string) (File, error)             { return os.Open(name) }
+
+// mapFS 把 io/fs.FS（如 testing/fstest.MapFS）当作根目录挂载的文件系统，绝对路径去掉开头的 / 后在其中查找
+type mapFS struct {
+	fs.FS
+}
+
+func (m mapFS) name(name string) string {
+	name = strings.TrimLeft(filepath.ToSlash(filepath.Clean(name)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (m mapFS) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(m.FS, m.name(name)) }
+func (m mapFS) Stat(name string) (fs.FileInfo, error)      { return fs.Stat(m.FS, m.name(name)) }
+
+// Lstat io/fs.FS 不区分符号链接
+func (m mapFS) Lstat(name string) (fs.FileInfo, error) { return m.Stat(name) }
+
+func (m mapFS) Open(name string) (File, error) {
+	f, err := m.FS.Open(m.name(name))
+	if err != nil {
+		return nil, err
+	}
+	if file, ok := f.(File); ok {
+		return file, nil
+	}
+	f.Close()
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+}
+
+// walkDir 与 filepath.WalkDir 相同，但通过 fsys 读取
+func walkDir(fsys FileSystem, root string, fn fs.WalkDirFunc) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDirEntry(fsys, root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkDirEntry(fsys FileSystem, path string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	entries, err := fsys.ReadDir(path)
+	if err != nil {
+		// 读取失败时再调用一次 fn，让其决定是否继续
+		if err = fn(path, d, err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if err := walkDirEntry(fsys, filepath.Join(path, entry.Name()), entry, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
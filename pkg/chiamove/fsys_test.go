@@ -0,0 +1,143 @@
+package chiamove
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// newTestFS 返回内存中的源和目标，都挂在不存在的临时路径 root 下；
+// 校验未通过时会删除真实文件系统上的副本，这样不会误删其他文件
+func newTestFS(t *testing.T) (mapFS, string) {
+	root := filepath.Join(t.TempDir(), "mapfs")
+	old := time.Now().Add(-2 * time.Hour)
+	files := map[string]*fstest.MapFile{
+		"src/plot-a.plot":          {Data: make([]byte, 100), ModTime: old},
+		"src/plot-b.plot":          {Data: make([]byte, 200), ModTime: old.Add(time.Hour)},
+		"src/skip-c.plot":          {Data: make([]byte, 100), ModTime: old},
+		"src/notes.txt":            {Data: make([]byte, 100), ModTime: old},
+		"folder/a.plot":            {Data: make([]byte, 10)},
+		"folder/sub/b.plot":        {Data: make([]byte, 20)},
+		"dst/plot-a.plot":          {Data: make([]byte, 100)},
+		"dst/plot-b.plot":          {Data: append(make([]byte, 199), 1)},
+		"dst/short/plot-a.plot":    {Data: make([]byte, 99)},
+		"dst/folder/a.plot":        {Data: make([]byte, 10)},
+		"dst/folder/sub/b.plot":    {Data: make([]byte, 20)},
+		"dst/corrupt/a.plot":       {Data: make([]byte, 10)},
+		"dst/corrupt/sub/b.plot":   {Data: append([]byte{1}, make([]byte, 19)...)},
+		"dst/truncated/a.plot":     {Data: make([]byte, 10)},
+		"dst/truncated/sub/b.plot": {Data: make([]byte, 2)},
+	}
+	m := fstest.MapFS{}
+	for name, f := range files {
+		m[mapFS{}.name(filepath.Join(root, filepath.FromSlash(name)))] = f
+	}
+	return mapFS{m}, root
+}
+
+// at 返回 root 下以 / 分隔的路径 rel
+func at(root, rel string) string {
+	return filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(rel, "/")))
+}
+
+func TestGetCanMovePathMapFS(t *testing.T) {
+	m, root := newTestFS(t)
+	src := at(root, "src")
+	c := newTestConfig(t, src, at(root, "dst"))
+	c.FromPathFilter.ExcludeRegex = []string{`^skip-`}
+	c.SourceOrder = "largest"
+	if err := c.compile(); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestScheduler(t, c, &fakeTransport{})
+	s.fsys = m
+
+	want := at(root, "src/plot-b.plot")
+	got, size, err := s.getCanMovePath(src, noSkip)
+	if err != nil || got != want || size != 200 {
+		t.Fatalf("getCanMovePath = %q, %d, %v; want %q, 200, nil", got, size, err, want)
+	}
+	skipB := func(path string, isDir bool) bool { return path == want }
+	if got, _, _ := s.getCanMovePath(src, skipB); got != at(root, "src/plot-a.plot") {
+		t.Errorf("with %s skipped: got %q", want, got)
+	}
+	if _, _, err := s.getCanMovePath(at(root, "missing"), noSkip); err == nil {
+		t.Error("getCanMovePath on missing source returned nil error")
+	}
+}
+
+func TestDirSizeMapFS(t *testing.T) {
+	m, root := newTestFS(t)
+	for rel, want := range map[string]uint64{"src/plot-a.plot": 100, "folder": 30, "src": 500} {
+		got, err := dirSize(m, DirSizeConfig{}, at(root, rel))
+		if err != nil || got != want {
+			t.Errorf("dirSize(%s) = %d, %v; want %d", rel, got, err, want)
+		}
+	}
+	if _, err := dirSize(m, DirSizeConfig{}, at(root, "missing")); err == nil {
+		t.Error("dirSize on missing path returned nil error")
+	}
+}
+
+func TestCheckCopiedSizeMapFS(t *testing.T) {
+	m, root := newTestFS(t)
+	s := newTestScheduler(t, newTestConfig(t, at(root, "src"), at(root, "dst")), &fakeTransport{})
+	s.fsys = m
+
+	if err := s.checkCopiedSize(at(root, "src/plot-a.plot"), at(root, "dst")); err != nil {
+		t.Errorf("checkCopiedSize = %v", err)
+	}
+	if err := s.checkCopiedSize(at(root, "src/plot-a.plot"), at(root, "dst/short")); !errors.Is(err, errSizeMismatch) {
+		t.Errorf("checkCopiedSize on truncated copy = %v, want %v", err, errSizeMismatch)
+	}
+}
+
+func TestVerifyCopyMapFS(t *testing.T) {
+	m, root := newTestFS(t)
+	c := newTestConfig(t, at(root, "src"), at(root, "dst"))
+	c.Verify = "full"
+	ctx := context.Background()
+
+	for _, tc := range []struct{ src, dst string }{
+		{"src/plot-a.plot", "dst/plot-a.plot"},
+		{"folder", "dst/folder"},
+	} {
+		if err := verifyCopy(ctx, c, m, at(root, tc.src), at(root, tc.dst), localFiles{m}); err != nil {
+			t.Errorf("verifyCopy(%s, %s) = %v", tc.src, tc.dst, err)
+		}
+	}
+	for _, tc := range []struct{ src, dst string }{
+		{"src/plot-b.plot", "dst/plot-b.plot"},
+		{"src/plot-a.plot", "dst/short/plot-a.plot"},
+		{"folder", "dst/corrupt"},
+		{"folder", "dst/truncated"},
+	} {
+		if err := verifyCopy(ctx, c, m, at(root, tc.src), at(root, tc.dst), localFiles{m}); !errors.Is(err, errVerifyFailed) {
+			t.Errorf("verifyCopy(%s, %s) = %v, want %v", tc.src, tc.dst, err, errVerifyFailed)
+		}
+	}
+	c.Verify = "none"
+	if err := verifyCopy(ctx, c, m, at(root, "src/plot-b.plot"), at(root, "dst/plot-b.plot"), localFiles{m}); err != nil {
+		t.Errorf("verifyCopy with verify none = %v", err)
+	}
+}
+
+func TestVerifyFileSampleMapFS(t *testing.T) {
+	m, root := newTestFS(t)
+	c := newTestConfig(t, at(root, "src"), at(root, "dst"))
+	c.Verify = "sample"
+	c.VerifySample = VerifySampleConfig{HeadTail: 16, Blocks: 4, BlockSize: 8}
+	ctx := context.Background()
+
+	if err := verifyFile(ctx, c, m, at(root, "src/plot-a.plot"), at(root, "dst/plot-a.plot"), localFiles{m}); err != nil {
+		t.Errorf("sample verify of identical file = %v", err)
+	}
+	// 只有最后一个字节不同，结尾的范围应当发现
+	if err := verifyFile(ctx, c, m, at(root, "src/plot-b.plot"), at(root, "dst/plot-b.plot"), localFiles{m}); !errors.Is(err, errVerifyFailed) {
+		t.Errorf("sample verify of different tail = %v, want %v", err, errVerifyFailed)
+	}
+}
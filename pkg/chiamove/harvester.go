@@ -0,0 +1,179 @@
+package chiamove
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HarvesterConfig 迁移成功后通知chia harvester刷新plot列表，新plot立即开始耕种，不用等harvester定期扫描目录
+type HarvesterConfig struct {
+	// off: 不通知 / rpc: 调用harvester的RPC接口 refresh_plots / command: 执行 chia rpc harvester refresh_plots，
+	// ssh:// 目标在远端执行
+	Refresh string `yaml:"refresh"`
+	URL     string `yaml:"url"`    // rpc: 默认 https://localhost:8560
+	Cert    string `yaml:"cert"`   // rpc: 默认 ~/.chia/mainnet/config/ssl/harvester/private_harvester.crt
+	Key     string `yaml:"key"`    // rpc: 默认 ~/.chia/mainnet/config/ssl/harvester/private_harvester.key
+	Binary  string `yaml:"binary"` // command: 默认 chia
+}
+
+func (h *HarvesterConfig) Validate() error {
+	switch h.Refresh {
+	case "off", "rpc", "command":
+		return nil
+	}
+	return fmt.Errorf(T("harvester.refresh 无效 %q，可选 off / rpc / command"), h.Refresh)
+}
+
+const harvesterRefreshTimeout = time.Minute
+
+// refreshPending 等待刷新的目标 -> 请求次数；刷新进行中完成的任务合并到下一次刷新
+var (
+	refreshMu      sync.Mutex
+	refreshPending = map[string]int{}
+	refreshCh      = make(chan struct{}, 1)
+	refreshOnce    sync.Once
+	refreshWG      sync.WaitGroup
+)
+
+// RequestHarvesterRefresh 在后台通知harvester刷新 dst 上的plot，短时间内多次请求只刷新一次
+func RequestHarvesterRefresh(c *Config, dst string) {
+	if c.Harvester.Refresh == "off" {
+		return
+	}
+	refreshOnce.Do(func() { go refreshLoop() })
+	refreshWG.Add(1)
+	refreshMu.Lock()
+	refreshPending[dst]++
+	refreshMu.Unlock()
+	select {
+	case refreshCh <- struct{}{}:
+	default:
+	}
+}
+
+func refreshLoop() {
+	for range refreshCh {
+		refreshMu.Lock()
+		pending := refreshPending
+		refreshPending = map[string]int{}
+		refreshMu.Unlock()
+		// 本地和agent目标都由同一个harvester负责，只刷新一次；ssh:// 目标在各自的主机上执行
+		c := currentConfig()
+		hosts := map[string]bool{}
+		for dst := range pending {
+			key := ""
+			if r, ok := parseRemote(dst); ok && c.Harvester.Refresh == "command" {
+				key = r.userHost
+			}
+			if hosts[key] {
+				continue
+			}
+			hosts[key] = true
+			if err := refreshHarvester(dst); err != nil {
+				slog.Warn("通知harvester刷新plot失败", "dst", dst, "err", err)
+				continue
+			}
+			slog.Info("已通知harvester刷新plot", "dst", dst)
+		}
+		for _, n := range pending {
+			refreshWG.Add(-n)
+		}
+	}
+}
+
+// WaitHarvesterRefresh 退出前等待还没有完成的刷新，最多等 harvesterRefreshTimeout
+func WaitHarvesterRefresh() {
+	done := make(chan struct{})
+	go func() {
+		refreshWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(harvesterRefreshTimeout):
+	}
+}
+
+func refreshHarvester(dst string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), harvesterRefreshTimeout)
+	defer cancel()
+	return harvesterCall(ctx, dst, "refresh_plots", nil)
+}
+
+// harvesterCall 按 harvester.refresh 的方式调用harvester的RPC接口 endpoint，out 不为nil时解析JSON响应；
+// command 方式下 ssh:// 目标在远端执行
+func harvesterCall(ctx context.Context, dst, endpoint string, out any) error {
+	c := currentConfig()
+	cfg := c.Harvester
+	var body []byte
+	if cfg.Refresh == "command" {
+		args := []string{"rpc", "harvester", endpoint}
+		if r, ok := remoteFor(c, dst); ok {
+			res, err := r.runContext(ctx, shellQuote(cfg.Binary)+" "+strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+			body = res
+		} else {
+			cmd := exec.CommandContext(ctx, cfg.Binary, args...)
+			setProcessGroup(cmd)
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("%w: %s", err, bytes.TrimSpace(append(stdout.Bytes(), stderr.Bytes()...)))
+			}
+			body = stdout.Bytes()
+		}
+		if out == nil {
+			return nil
+		}
+		return json.Unmarshal(body, out)
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+	if err != nil {
+		return err
+	}
+	// harvester的RPC证书由chia自己的CA签发，只能靠客户端证书认证
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		InsecureSkipVerify: true,
+	}}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(cfg.URL, "/")+"/"+endpoint, strings.NewReader("{}"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if body, err = io.ReadAll(resp.Body); err != nil {
+		return err
+	}
+	var result struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if !result.Success {
+		return errors.New(result.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,164 @@
+package chiamove
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// DestinationHealthConfig 目标连续失败 maxFailures 次后暂停使用，每隔 probeInterval 测试写入，成功后恢复
+type DestinationHealthConfig struct {
+	MaxFailures   *int          `yaml:"maxFailures"`   // 默认3，0 为不暂停
+	ProbeInterval time.Duration `yaml:"probeInterval"` // 默认5m
+}
+
+type destHealthState struct {
+	failures  int
+	disabled  bool
+	nextProbe time.Time
+	probed    bool // 本次运行中已测试写入，失败一次后重新测试
+}
+
+// DestinationHealth 记录每个目标连续失败的次数
+type DestinationHealth struct {
+	mu    sync.Mutex
+	dests map[string]*destHealthState
+}
+
+var destHealth = &DestinationHealth{dests: map[string]*destHealthState{}}
+
+func (h *DestinationHealth) state(dst string) *destHealthState {
+	s := h.dests[dst]
+	if s == nil {
+		s = &destHealthState{}
+		h.dests[dst] = s
+	}
+	return s
+}
+
+func (h *DestinationHealth) Succeeded(dst string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state(dst).failures = 0
+}
+
+// destinationFault 判断迁移 src 的失败是否由目标引起：写入出错、空间不足、连接中断或校验不一致；
+// 钩子、读取源、超时和plot校验的失败与目标无关，不计入目标的连续失败次数
+func destinationFault(src string, err error) bool {
+	switch {
+	case errors.Is(err, errVerifyFailed), errors.Is(err, errSizeMismatch), isNoSpace(err):
+		return true
+	case errors.Is(err, errHookFailed), errors.Is(err, errTransferTimeout), errors.Is(err, errStalled),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled),
+		errors.Is(err, errPlotInvalid), errors.Is(err, errPlotCheckFailed):
+		return false
+	}
+	var pathErr *fs.PathError
+	return !errors.As(err, &pathErr) || isRemoteSource(src) || !isWithin(src, pathErr.Path)
+}
+
+func (h *DestinationHealth) Failed(c *Config, dst string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.state(dst)
+	s.failures++
+	s.probed = false
+	limit := *c.DestinationHealth.MaxFailures
+	if limit <= 0 || s.failures < limit || s.disabled {
+		return
+	}
+	s.disabled = true
+	s.nextProbe = time.Now().Add(c.DestinationHealth.ProbeInterval)
+	slog.Warn("目标连续失败，暂停使用", "dst", dst, "failures", s.failures, "probeAt", s.nextProbe.Format(time.DateTime), "err", err)
+	Notify(Notification{
+		Event:   EventDestinationDisabled,
+		Message: fmt.Sprintf(T("目标连续失败 %d 次，暂停使用: %s"), s.failures, dst),
+		Dst:     dst, Error: err.Error(),
+	})
+}
+
+// Available 目标没有被暂停时返回 true；已暂停且到了测试时间时测试写入，成功后恢复使用
+func (h *DestinationHealth) Available(c *Config, dst string) bool {
+	h.mu.Lock()
+	s := h.state(dst)
+	if !s.disabled {
+		h.mu.Unlock()
+		return true
+	}
+	if time.Now().Before(s.nextProbe) {
+		h.mu.Unlock()
+		return false
+	}
+	s.nextProbe = time.Now().Add(c.DestinationHealth.ProbeInterval)
+	h.mu.Unlock()
+	if err := probeDestination(c, dst); err != nil {
+		slog.Info("暂停的目标仍不可用", "dst", dst, "err", err)
+		return false
+	}
+	h.mu.Lock()
+	s.disabled, s.failures, s.probed = false, 0, true
+	h.mu.Unlock()
+	slog.Info("暂停的目标测试写入成功，恢复使用", "dst", dst)
+	Notify(Notification{Event: EventDestinationOnline, Message: fmt.Sprintf(T("暂停的目标已恢复: %s"), dst), Dst: dst})
+	return true
+}
+
+// Probe 目标第一次分配任务前测试写入，提前发现被重新挂载为只读、硬盘盒掉线或inode用完的目标，
+// 而不是在复制了几十GB之后才失败；成功后本次运行不再测试，直到该目标的任务失败
+func (h *DestinationHealth) Probe(c *Config, dst string) error {
+	h.mu.Lock()
+	probed := h.state(dst).probed
+	h.mu.Unlock()
+	if probed {
+		return nil
+	}
+	if err := probeDestination(c, dst); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	h.state(dst).probed = true
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *DestinationHealth) Disabled(dst string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.dests[dst]
+	return s != nil && s.disabled
+}
+
+// probeSize 本地目标测试写入的大小，空间已满时会失败
+const probeSize = 1 << 20
+
+// probeDestination 本地和ssh目标写入并同步 probeSize 字节后删除，其他远程目标只检查是否可用
+func probeDestination(c *Config, dst string) error {
+	if err := checkDestinationReady(c, dst); err != nil {
+		return err
+	}
+	if r, ok := remoteFor(c, dst); ok {
+		_, err := r.run(fmt.Sprintf(`f=$(mktemp %s/.chiamove-probe-XXXXXX) || exit 1; dd if=/dev/zero of="$f" bs=%d count=1 conv=fsync; s=$?; rm -f "$f"; exit $s`, shellQuote(r.path), probeSize))
+		return err
+	}
+	if isRemoteDest(dst) || isSimulated(dst) {
+		return nil
+	}
+	f, err := os.CreateTemp(dst, ".chiamove-probe-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(make([]byte, probeSize))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
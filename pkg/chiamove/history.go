@@ -0,0 +1,277 @@
+package chiamove
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// HistoryConfig 每个结束的迁移任务追加一行JSON到 file，供 history 子命令统计
+type HistoryConfig struct {
+	File string `yaml:"file"` // 默认 chiamove-history.jsonl
+	// 迁移成功后重新读取目标计算SHA-256，会多读一遍目标盘，远程目标不计算
+	Checksum bool `yaml:"checksum"`
+	// 另外把每个成功的任务追加到CSV文件，便于用表格软件分析迁移速度，为空时不导出
+	CSV string `yaml:"csv"`
+}
+
+type HistoryRecord struct {
+	Src        string    `json:"src"`
+	Dst        string    `json:"dst"`
+	Size       uint64    `json:"size"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Duration   float64   `json:"duration"`   // 秒
+	Throughput float64   `json:"throughput"` // 字节/秒
+	Retries    int       `json:"retries,omitempty"`
+	Checksum   string    `json:"checksum,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+var historyMu sync.Mutex
+
+// recordHistory 把结束的任务追加到历史文件，失败只记录日志
+func (s *Scheduler) recordHistory(tr Transfer) {
+	rec := HistoryRecord{
+		Src: tr.Src, Dst: tr.Dst, Size: tr.Size,
+		StartedAt: tr.StartedAt, FinishedAt: tr.FinishedAt,
+		Duration: tr.FinishedAt.Sub(tr.StartedAt).Seconds(),
+		Retries:  tr.Retries,
+		Error:    tr.Error,
+	}
+	if rec.Duration > 0 && tr.Error == "" {
+		rec.Throughput = float64(tr.Size) / rec.Duration
+		s.speeds.Observe(tr.Dst, rec.Duration, rec.Throughput)
+	}
+	if s.cfg.History.Checksum && tr.Error == "" && !isRemoteDest(tr.Dst) {
+		sum, err := checksumPath(copiedPath(tr.Src, tr.Dst))
+		if err != nil {
+			slog.Warn("计算校验和失败", "dst", tr.Dst, "err", err)
+		}
+		rec.Checksum = sum
+	}
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	f, err := os.OpenFile(s.cfg.History.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		slog.Error("写入迁移历史失败", "file", s.cfg.History.File, "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(buf, '\n')); err != nil {
+		slog.Error("写入迁移历史失败", "file", s.cfg.History.File, "err", err)
+	}
+	if s.cfg.History.CSV != "" && rec.Error == "" {
+		if err := appendHistoryCSV(s.cfg.History.CSV, rec); err != nil {
+			slog.Error("导出迁移记录到CSV失败", "file", s.cfg.History.CSV, "err", err)
+		}
+	}
+}
+
+var historyCSVHeader = []string{"timestamp", "src", "dst", "bytes", "duration", "speed", "retries"}
+
+// appendHistoryCSV 追加一行到CSV文件，文件为空时先写表头；duration 为秒，speed 为字节/秒
+func appendHistoryCSV(file string, rec HistoryRecord) error {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if info.Size() == 0 {
+		w.Write(historyCSVHeader)
+	}
+	w.Write([]string{
+		rec.FinishedAt.Format(time.RFC3339),
+		rec.Src,
+		rec.Dst,
+		strconv.FormatUint(rec.Size, 10),
+		strconv.FormatFloat(rec.Duration, 'f', 3, 64),
+		strconv.FormatFloat(rec.Throughput, 'f', 0, 64),
+		strconv.Itoa(rec.Retries),
+	})
+	w.Flush()
+	return w.Error()
+}
+
+// checksumPath 计算文件的SHA-256；文件夹按相对路径排序后对每个文件的 "路径 校验和" 行再计算一次
+func checksumPath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return checksumFile(path)
+	}
+	var files []string
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+	h := sha256.New()
+	for _, f := range files {
+		sum, err := checksumFile(f)
+		if err != nil {
+			return "", err
+		}
+		rel, _ := filepath.Rel(path, f)
+		fmt.Fprintf(h, "%s %s\n", filepath.ToSlash(rel), sum)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func checksumFile(path string) (string, error) {
+	f, err := osFS{}.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func readHistory(file string) ([]HistoryRecord, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []HistoryRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec HistoryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// 进程被杀时最后一行可能不完整
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+type historySummary struct {
+	key      string
+	done     int
+	failed   int
+	bytes    uint64
+	duration float64
+}
+
+// runHistory 实现 history 子命令，按天或目标路径汇总迁移历史
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("chiamove history", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", T("配置文件路径，用于确定历史文件位置"))
+	by := fs.String("by", "day", T("汇总方式 day / destination"))
+	since := fs.String("since", "", T("只统计该日期(2006-01-02)及之后的记录"))
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	file := "chiamove-history.jsonl"
+	if c, err := ReadConfig(*configPath); err == nil {
+		file = c.History.File
+		SetLanguage(c.Language)
+	}
+	var from time.Time
+	if *since != "" {
+		t, err := time.ParseInLocation("2006-01-02", *since, time.Local)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, T("--since 日期无效: %v\n"), err)
+			return exitConfigError
+		}
+		from = t
+	}
+	records, err := readHistory(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("读取迁移历史失败: %v\n"), err)
+		return exitError
+	}
+	summaries := map[string]*historySummary{}
+	for _, rec := range records {
+		if rec.FinishedAt.Before(from) {
+			continue
+		}
+		var key string
+		switch *by {
+		case "day":
+			key = rec.FinishedAt.Local().Format("2006-01-02")
+		case "destination":
+			key = rec.Dst
+		default:
+			fmt.Fprintf(os.Stderr, T("--by 无效 %q，可选 day / destination\n"), *by)
+			return exitConfigError
+		}
+		s, ok := summaries[key]
+		if !ok {
+			s = &historySummary{key: key}
+			summaries[key] = s
+		}
+		if rec.Error != "" {
+			s.failed++
+			continue
+		}
+		s.done++
+		s.bytes += rec.Size
+		s.duration += rec.Duration
+	}
+	keys := make([]string, 0, len(summaries))
+	for k := range summaries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, T("\t成功\t失败\t总大小\t平均速度"))
+	var total historySummary
+	for _, k := range keys {
+		s := summaries[k]
+		printSummary(w, s)
+		total.done += s.done
+		total.failed += s.failed
+		total.bytes += s.bytes
+		total.duration += s.duration
+	}
+	total.key = T("合计")
+	printSummary(w, &total)
+	w.Flush()
+	return exitOK
+}
+
+func printSummary(w io.Writer, s *historySummary) {
+	var speed uint64
+	if s.duration > 0 {
+		speed = uint64(float64(s.bytes) / s.duration)
+	}
+	fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s/s\n", s.key, s.done, s.failed, formatBytes(s.bytes), formatBytes(speed))
+}
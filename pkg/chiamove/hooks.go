@@ -0,0 +1,86 @@
+package chiamove
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// HooksConfig 迁移各阶段执行的外部命令，Linux/macOS 上用 sh -c、Windows 上用 cmd /C 执行；
+// 环境变量 CHIAMOVE_HOOK 为钩子名称，SRC、DST、BYTES、DURATION（秒）、ERROR 描述任务
+type HooksConfig struct {
+	// 开始复制前执行，退出码不为0时该任务按失败处理
+	PreTransfer string `yaml:"preTransfer"`
+	// 复制成功并删除源之后执行
+	PostTransfer string `yaml:"postTransfer"`
+	// 任务失败后执行
+	OnFailure string `yaml:"onFailure"`
+	// 源盘已空、目标已满或达到单次运行上限时执行，REASON 为原因，MOVED、BYTES、DURATION 为本次运行的合计
+	OnAllDone string `yaml:"onAllDone"`
+	// 源盘剩余空间低于 sourceSpace.minFree 和恢复到 resumeFree 时执行，SRC 为源路径，FREE 为剩余字节数
+	OnSourceSpaceLow       string `yaml:"onSourceSpaceLow"`
+	OnSourceSpaceRecovered string `yaml:"onSourceSpaceRecovered"`
+	// 单个命令的最长运行时间，默认 5m
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+var errHookFailed = sentinelError("钩子命令执行失败")
+
+// run 执行钩子命令 command，输出写入日志
+func (h HooksConfig) run(ctx context.Context, name, command string, env map[string]string) error {
+	if command == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	setProcessGroup(cmd)
+	cmd.WaitDelay = 5 * time.Second
+	cmd.Env = append(os.Environ(), "CHIAMOVE_HOOK="+name)
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	out := newLogWriter(slog.LevelInfo, "hook", name)
+	cmd.Stdout, cmd.Stderr = out, out
+	err := cmd.Run()
+	out.Flush()
+	if err != nil {
+		slog.Warn("钩子命令执行失败", "hook", name, "err", err)
+		return fmt.Errorf("%w(%s): %v", errHookFailed, name, err)
+	}
+	return nil
+}
+
+func transferHookEnv(src, dst string, size uint64, elapsed time.Duration, err error) map[string]string {
+	env := map[string]string{
+		"SRC":      src,
+		"DST":      dst,
+		"BYTES":    strconv.FormatUint(size, 10),
+		"DURATION": strconv.Itoa(int(elapsed.Seconds())),
+	}
+	if err != nil {
+		env["ERROR"] = err.Error()
+	}
+	return env
+}
+
+// allDone 执行 onAllDone 钩子
+func (s *Scheduler) allDone(ctx context.Context, reason string) {
+	moved, bytes := s.stats.Totals()
+	s.cfg.Hooks.run(ctx, "onAllDone", s.cfg.Hooks.OnAllDone, map[string]string{
+		"REASON":   reason,
+		"MOVED":    strconv.Itoa(moved),
+		"BYTES":    strconv.FormatUint(bytes, 10),
+		"DURATION": strconv.Itoa(int(time.Since(s.stats.start).Seconds())),
+	})
+}
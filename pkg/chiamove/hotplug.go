@@ -0,0 +1,63 @@
+package chiamove
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// HotplugConfig 守护模式下监视新挂载的文件系统，挂载点符合 pattern 的自动加入目标
+type HotplugConfig struct {
+	Pattern  string        `yaml:"pattern"`  // 如 /mnt/farm/*，为空时不启用
+	Interval time.Duration `yaml:"interval"` // 检查间隔，默认5s
+}
+
+// hotplugged 当前已挂载且符合 hotplug.pattern 的目标路径
+var hotplugged []string
+
+// StartHotplugWatcher 定时检查挂载点，新硬盘挂载后加入目标、发送通知并唤醒空闲中的调度，卸载后移除
+func StartHotplugWatcher() {
+	go func() {
+		var known []string
+		first := true
+		for {
+			configMu.Lock()
+			cfg := config.Hotplug
+			configMu.Unlock()
+			if cfg.Pattern != "" {
+				mounts, err := mountPoints()
+				if err != nil {
+					slog.Warn("无法检测新挂载的硬盘", "err", err)
+					return
+				}
+				var matched []string
+				for _, m := range mounts {
+					if ok, _ := filepath.Match(cfg.Pattern, m); ok && !slices.Contains(matched, m) {
+						matched = append(matched, m)
+					}
+				}
+				configMu.Lock()
+				hotplugged = matched
+				configMu.Unlock()
+				for _, m := range matched {
+					// 启动时已经挂载的硬盘直接加入，不通知
+					if !first && !slices.Contains(known, m) {
+						slog.Info("检测到新挂载的目标硬盘", "path", m)
+						Notify(Notification{Event: EventDestinationOnline, Message: fmt.Sprintf(T("新的目标硬盘已挂载: %s"), m), Dst: m})
+						wake()
+					}
+				}
+				for _, m := range known {
+					if !slices.Contains(matched, m) {
+						slog.Info("目标硬盘已卸载", "path", m)
+					}
+				}
+				known = matched
+				first = false
+			}
+			time.Sleep(cfg.Interval)
+		}
+	}()
+}
@@ -0,0 +1,277 @@
+package chiamove
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// HTTPSourceConfig fromPaths 中以 http:// 或 https:// 开头的源：代P服务提供的目录索引页面或JSON清单，
+// plot下载到本地目标，中断后按 Range 续传；远程的plot不会被删除，已下载的记录在任务日志中
+type HTTPSourceConfig struct {
+	// 每个请求附加的请求头，如 Authorization: Bearer xxx
+	Headers map[string]string `yaml:"headers"`
+	// 下载完成后向文件地址发送DELETE请求，让服务端删除已下载的plot
+	Delete bool `yaml:"delete"`
+}
+
+// 下载不设置超时，由任务的 ctx 和 stallTimeout 控制；列表和HEAD请求使用 agentRequestTimeout
+var httpSourceClient = &http.Client{}
+
+var hrefPattern = regexp.MustCompile(`(?i)href\s*=\s*["']([^"'#]+)["']`)
+
+func isHTTPSource(p string) bool {
+	return strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://")
+}
+
+// sourceName 返回源对应的目标名称，HTTP源为地址路径的最后一段
+func sourceName(src string) string {
+	if isHTTPSource(src) {
+		if u, err := url.Parse(src); err == nil {
+			return path.Base(u.Path)
+		}
+	}
+	if r, ok := parseRemote(src); ok {
+		return path.Base(r.path)
+	}
+	return filepath.Base(src)
+}
+
+// remotePlot JSON清单中的一个文件，url 可以是相对清单的地址；size 为0时用HEAD请求获取
+type remotePlot struct {
+	URL  string `json:"url"`
+	Size uint64 `json:"size"`
+}
+
+// httpEntry 让远程文件可以使用和本地文件相同的过滤规则
+type httpEntry string
+
+func (e httpEntry) Name() string               { return string(e) }
+func (e httpEntry) IsDir() bool                { return false }
+func (e httpEntry) Type() fs.FileMode          { return 0 }
+func (e httpEntry) Info() (fs.FileInfo, error) { return nil, errors.ErrUnsupported }
+
+// httpDo 发送带有 c.HTTPSource.Headers 的请求，from 大于0时只请求从该位置开始的数据；状态码不是2xx时返回错误
+func httpDo(ctx context.Context, c *Config, method, rawURL string, from int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.HTTPSource.Headers {
+		req.Header.Set(k, v)
+	}
+	if from > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", from))
+	}
+	resp, err := httpSourceClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, rawURL, resp.Status)
+	}
+	return resp, nil
+}
+
+// listHTTPSource 返回源地址中的文件：响应为JSON时按清单解析，否则取页面中的链接，跳过子目录和查询参数不同的重复链接
+func listHTTPSource(ctx context.Context, c *Config, base string) ([]remotePlot, error) {
+	ctx, cancel := context.WithTimeout(ctx, agentRequestTimeout)
+	defer cancel()
+	resp, err := httpDo(ctx, c, http.MethodGet, base, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	baseURL := resp.Request.URL
+	var plots []remotePlot
+	if strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		if err := json.NewDecoder(resp.Body).Decode(&plots); err != nil {
+			return nil, fmt.Errorf(T("解析HTTP源清单 %s 失败: %w"), base, err)
+		}
+	} else {
+		page, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range hrefPattern.FindAllStringSubmatch(string(page), -1) {
+			plots = append(plots, remotePlot{URL: m[1]})
+		}
+	}
+	seen := map[string]bool{}
+	var files []remotePlot
+	for _, p := range plots {
+		ref, err := url.Parse(p.URL)
+		if err != nil || ref.Path == "" || strings.HasSuffix(ref.Path, "/") {
+			continue
+		}
+		u := baseURL.ResolveReference(ref)
+		name := path.Base(u.Path)
+		if name == "." || name == "/" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		p.URL = u.String()
+		files = append(files, p)
+	}
+	sort.Slice(files, func(a, b int) bool { return sourceName(files[a].URL) < sourceName(files[b].URL) })
+	return files, nil
+}
+
+// httpSourceSize 用HEAD请求获取远程文件的大小
+func httpSourceSize(ctx context.Context, c *Config, src string) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, agentRequestTimeout)
+	defer cancel()
+	resp, err := httpDo(ctx, c, http.MethodHead, src, 0)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.ContentLength < 0 {
+		return 0, fmt.Errorf(T("HTTP源没有返回文件大小: %s"), src)
+	}
+	return uint64(resp.ContentLength), nil
+}
+
+// getHTTPCandidate 与 getCanMovePath 相同，从HTTP源的文件列表中选择第一个符合过滤条件的文件
+func getHTTPCandidate(c *Config, fromPath string, skip func(path string, isDir bool) bool) (string, uint64, error) {
+	plots, err := listHTTPSource(context.Background(), c, fromPath)
+	if err != nil {
+		slog.Warn("获取HTTP源文件列表失败", "path", fromPath, "err", err)
+		return "", 0, err
+	}
+	for _, p := range plots {
+		name := sourceName(p.URL)
+		if isExcluded(c, name) {
+			continue
+		}
+		// 过滤规则按源路径下的同名文件匹配，fromPathsConfig 中的设置同样适用
+		rulePath := filepath.Join(fromPath, name)
+		rules := matchingRules(c, rulePath, httpEntry(name))
+		if len(rules) == 0 || skip(p.URL, false) {
+			continue
+		}
+		size := p.Size
+		if size == 0 {
+			if size, err = httpSourceSize(context.Background(), c, p.URL); err != nil {
+				slog.Error("获取路径大小失败", "path", p.URL, "err", err)
+				continue
+			}
+		}
+		for _, r := range rules {
+			if r.matchSize(c.PlotSize, rulePath, false, size) {
+				slog.Debug("符合过滤规则", "path", p.URL, "rule", r.Name, "size", size)
+				return p.URL, size, nil
+			}
+		}
+	}
+	return "", 0, errNoCandidate
+}
+
+// downloadHTTPSource 把远程文件下载到本地目标 dst，先写入 .chiamove.partial，
+// 已有的部分按 Range 续传（服务端不支持时从头下载），大小与远程一致后改为最终名称
+func downloadHTTPSource(ctx context.Context, c *Config, src, dst string) error {
+	if isRemoteDest(dst) {
+		return fmt.Errorf(T("HTTP源只能下载到本地目标: %s"), dst)
+	}
+	size, err := httpSourceSize(ctx, c, src)
+	if err != nil {
+		return err
+	}
+	final := filepath.Join(dst, sourceName(src))
+	if _, err := os.Lstat(final); err == nil {
+		return fmt.Errorf(T("目标已存在: %s"), final)
+	}
+	partial := final + partialSuffix
+	f, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	offset := info.Size()
+	if offset > int64(size) {
+		offset = 0
+	}
+	copied := new(atomic.Uint64)
+	copied.Store(uint64(offset))
+	nativeProgress.Store(src, copied)
+	defer nativeProgress.Delete(src)
+	if offset < int64(size) {
+		copyCtx, cancel := context.WithCancel(ctx)
+		stalled := watchStall(c, src, dst, cancel)
+		err := httpFetch(copyCtx, c, src, f, offset, copied)
+		cancel()
+		if stalled() {
+			return fmt.Errorf("%w(%s): %v", errStalled, c.StallTimeout, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if info, err = f.Stat(); err != nil {
+		return err
+	}
+	if info.Size() != int64(size) {
+		return fmt.Errorf(T("下载不完整: %s 为 %d 字节，远程为 %d 字节"), partial, info.Size(), size)
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(partial, final); err != nil {
+		return err
+	}
+	if c.HTTPSource.Delete {
+		deleteCtx, cancel := context.WithTimeout(ctx, agentRequestTimeout)
+		defer cancel()
+		if resp, err := httpDo(deleteCtx, c, http.MethodDelete, src, 0); err != nil {
+			slog.Warn("删除HTTP源上已下载的文件失败", "path", src, "err", err)
+		} else {
+			resp.Body.Close()
+		}
+	}
+	return nil
+}
+
+// httpFetch 从 offset 开始下载 src 写入 f，服务端忽略 Range 返回整个文件时清空 f 从头写入
+func httpFetch(ctx context.Context, c *Config, src string, f *os.File, offset int64, copied *atomic.Uint64) error {
+	resp, err := httpDo(ctx, c, http.MethodGet, src, offset)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		slog.Info("HTTP源不支持续传，重新下载", "path", src)
+		offset = 0
+		copied.Store(0)
+	} else if offset > 0 && !strings.HasPrefix(resp.Header.Get("Content-Range"), "bytes "+strconv.FormatInt(offset, 10)+"-") {
+		return fmt.Errorf(T("HTTP源返回的范围与请求不一致: %s"), resp.Header.Get("Content-Range"))
+	}
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	limiters := []*rateLimiter{newRateLimiter(uint64(currentThrottle(c).PerTransfer)), globalLimiter}
+	w := &throttledWriter{ctx: ctx, w: io.NewOffsetWriter(f, offset), limiters: limiters, copied: copied}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
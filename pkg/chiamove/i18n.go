@@ -0,0 +1,544 @@
+package chiamove
+
+import (
+	"os"
+	"strings"
+)
+
+// language 输出语言: zh / en，配置中没有指定时按 LC_ALL、LC_MESSAGES、LANG 环境变量判断
+var language = detectLanguage()
+
+func detectLanguage() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+		// 没有设置语言环境（C/POSIX）时保持以前的中文输出
+		if strings.HasPrefix(v, "zh") || v == "C" || v == "POSIX" || strings.HasPrefix(v, "C.") {
+			return "zh"
+		}
+		return "en"
+	}
+	return "zh"
+}
+
+// SetLanguage 应用配置中的 language，为空时使用环境变量判断的结果
+func SetLanguage(lang string) {
+	if lang == "" {
+		lang = detectLanguage()
+	}
+	language = lang
+}
+
+// T 返回当前语言的文本，程序中的文本以中文为准，其他语言没有翻译时原样返回；
+// 日志消息由日志handler统一翻译，不需要调用T
+func T(s string) string {
+	if language == "en" {
+		if t, ok := catalogEN[s]; ok {
+			return t
+		}
+	}
+	return s
+}
+
+// sentinelError 包级别的错误，在读取配置之前创建，输出时才按当前的 language 翻译
+type sentinelError string
+
+func (e sentinelError) Error() string { return T(string(e)) }
+
+var catalogEN = map[string]string{
+	"\t成功\t失败\t总大小\t平均速度":     "\tdone\tfailed\ttotal size\tavg speed",
+	"\n\033[1m最近的错误\033[0m\n": "\n\033[1mRecent errors\033[0m\n",
+	"\n\033[1m目标路径\033[0m\n":  "\n\033[1mDestinations\033[0m\n",
+	"\n\033[1m进行中\033[0m\n":   "\n\033[1mIn progress\033[0m\n",
+	"\n源盘使用情况:\n":             "\nSource disk usage:\n",
+	"\n目标盘使用情况:\n":            "\nDestination disk usage:\n",
+	"\033[1m源路径\033[0m\n":     "\033[1mSources\033[0m\n",
+	"  %-40s %s 剩余 %s\n":      "  %-40s %s free %s\n",
+	"  %-40s 无法获取容量\n":        "  %-40s capacity unavailable\n",
+	"  %-50s 待迁移 %d\n":        "  %-50s pending %d\n",
+	"  %s  速度 %s  权重 %.2f\n":  "  %s  speed %s  weight %.2f\n",
+	"  %s -> %s  排队中\n":       "  %s -> %s  queued\n",
+	"  %s: %.1f%%，剩余 %s\n":    "  %s: %.1f%% used, %s free\n",
+	"  %s: 已用 %s / %s\n":      "  %s: used %s / %s\n",
+	"  无\n":                   "  none\n",
+	"chia plots check 执行失败":   "chia plots check failed",
+	"%w: 未找到有效plot，请确认目标目录已加入chia的plot_directories": "%w: no valid plot found, make sure the destination is in chia's plot_directories",
+	"--by 无效 %q，可选 day / destination\n":             "invalid --by %q, expected day / destination\n",
+	"--since 日期无效: %v\n":                            "invalid --since date: %v\n",
+	"API地址，如 127.0.0.1:8080，默认使用配置中的 api.listen":    "API address such as 127.0.0.1:8080, defaults to api.listen from the config",
+	"API服务已启动":   "API server started",
+	"API服务退出":    "API server exited",
+	"A盘已空，请换盘！":  "Source disks are empty, please swap disks!",
+	"B盘已满，任务完成！": "Destinations are full, done!",
+	"TLS私钥":      "TLS private key",
+	"TLS证书，设置后使用HTTPS（HTTP/2），客户端目标写为 agents://": "TLS certificate; enables HTTPS (HTTP/2), clients use agents:// destinations",
+	"Windows不支持": "not supported on Windows",
+	"agent上的文件大小 %d 与源文件 %d 不一致: %s": "file size on agent %d does not match source %d: %s",
+	"agent已启动":                "agent started",
+	"agent目标不可用: %w":          "agent destination unavailable: %w",
+	"agent目标不支持plot校验，跳过":     "plot check is not supported on agent destinations, skipping",
+	"agent目标不支持的文件类型: %s":     "unsupported file type for agent destination: %s",
+	"agent目标改名失败: %w":         "renaming on agent destination failed: %w",
+	"agent退出":                 "agent exited",
+	"chiaMove 迁移汇总 ":          "chiaMove transfer digest ",
+	"copyMethod 无效 %q":        "invalid copyMethod %q",
+	"dry-run: 将续传未完成的任务":      "dry-run: would resume unfinished transfer",
+	"dry-run: 将要迁移":           "dry-run: would move",
+	"duplicates.action 无效 %q": "invalid duplicates.action %q",
+	"failed.action 为 quarantine 时需要设置 failed.quarantineDir": "failed.quarantineDir is required when failed.action is quarantine",
+	"failed.action 无效 %q":                          "invalid failed.action %q",
+	"fromPathFilter.exclude 无效 %q: %w":             "invalid fromPathFilter.exclude %q: %w",
+	"fromPathFilter.excludeRegex 无效 %q: %w":        "invalid fromPathFilter.excludeRegex %q: %w",
+	"fromPaths 不能为空":                               "fromPaths must not be empty",
+	"hotplug.pattern 无效 %q: %w":                    "invalid hotplug.pattern %q: %w",
+	"language 无效 %q，可选 zh / en":                    "invalid language %q, expected zh / en",
+	"notify.email 需要设置 from 和 to":                  "notify.email requires from and to",
+	"plot校验未通过":                                    "plot check failed",
+	"plot校验未通过，保留源文件":                              "plot check failed, keeping source",
+	"plot校验通过":                                     "plot check passed",
+	"priority.ioClass 无效 %q":                       "invalid priority.ioClass %q",
+	"priority.ioLevel 必须在 0-7 之间: %d":              "priority.ioLevel must be between 0 and 7: %d",
+	"priority.nice 必须在 0-19 之间: %d":                "priority.nice must be between 0 and 19: %d",
+	"verify 无效 %q，可选 none / sample / full":         "invalid verify %q, expected none / sample / full",
+	"agent目标不支持校验，跳过":                              "verification is not supported for agent destinations, skipping",
+	"校验未通过":                                        "verification failed",
+	"校验未通过，删除目标上的副本并保留源文件":                         "verification failed, removing the destination copy and keeping source",
+	"删除校验未通过的目标失败":                                 "failed to remove destination that failed verification",
+	"%w: %s 大小 %d 与源文件 %d 不一致":                     "%w: %s size %d does not match source %d",
+	"%w: %s 在偏移 %d 处的内容与源文件不一致":                    "%w: %s content at offset %d does not match source",
+	"s3.partSize 不能小于 5MiB: %s":                    "s3.partSize must be at least 5MiB: %s",
+	"s3目标不可用: %w":                                  "s3 destination unavailable: %w",
+	"s3目标不支持plot校验，跳过":                             "plot check is not supported for s3 destinations, skipping",
+	"s3目标不支持的文件类型: %s":                             "file type not supported for s3 destinations: %s",
+	"读取s3目标文件列表失败":                                 "failed to list s3 destination",
+	"目标 %s 的 maxUsedPercent 必须在 0-100 之间: %v":      "maxUsedPercent of destination %s must be between 0 and 100: %v",
+	"获取目标容量失败":                                     "failed to get destination capacity",
+	"sourceOrder 无效 %q，可选 name / oldest / largest": "invalid sourceOrder %q, expected name / oldest / largest",
+	"sourcePriority 无效 %q，可选 config / fullest":     "invalid sourcePriority %q, expected config / fullest",
+	"获取源盘容量失败":                                     "failed to get source disk capacity",
+	"lock 无效 %q，可选 config / source / off":          "invalid lock %q, expected config / source / off",
+	"已被其他进程锁定":                                     "locked by another process",
+	"另一个chiaMove进程正在使用 %s，同一份配置或同一个源路径只能运行一个实例": "another chiaMove process is using %s; only one instance may run per config or source path",
+	"加锁失败 %s: %w": "failed to lock %s: %w",
+	"无法启动":        "cannot start",
+	"jsonEvents 无效 %q，可选 stdout 或 unix:/path/to.sock":                           "invalid jsonEvents %q, expected stdout or unix:/path/to.sock",
+	"以JSON lines输出任务事件到标准输出，或用 --json-events=unix:/path/to.sock 输出到Unix socket": "emit transfer events as JSON lines to stdout, or to a Unix socket with --json-events=unix:/path/to.sock",
+	"--tui 和输出到标准输出的 --json-events 不能同时使用":                                      "--tui cannot be combined with --json-events on stdout",
+	"事件socket接受连接失败":                                                            "event socket accept failed",
+	"partials.action 无效 %q，可选 remove / resume / off":                            "invalid partials.action %q, expected remove / resume / off",
+	"残留的临时文件对应的源仍在，续传":                                                          "source of stale partial still exists, resuming",
+	"源还在源路径中的 .chiamove.partial 不删除，下次启动时续传":                                    "keep .chiamove.partial files whose source still exists and resume them on next start",
+	"将续传":     "would resume",
+	"下次启动时续传": "will resume on next start",
+	"harvester.refresh 无效 %q，可选 off / rpc / command":                           "invalid harvester.refresh %q, expected off / rpc / command",
+	"通知harvester刷新plot失败":                                                      "failed to ask harvester to refresh plots",
+	"已通知harvester刷新plot":                                                       "asked harvester to refresh plots",
+	"limits.maxPlotsPerRun 不能小于0: %d":                                          "limits.maxPlotsPerRun must not be negative: %d",
+	"已达到本次运行的迁移上限":                                                             "per-run transfer limit reached",
+	"schedule.windows 的 start 和 end 不能相同: %s":                                  "schedule.windows start and end must differ: %s",
+	"schedule.windows 的 days 无效 %q，可选 mon / tue / wed / thu / fri / sat / sun": "invalid schedule.windows days %q, expected mon / tue / wed / thu / fri / sat / sun",
+	"时间 %q 无效，格式为 HH:MM":                                                       "invalid time %q, expected HH:MM",
+	"不在允许迁移的时间段内，退出":                                                           "outside the scheduled transfer windows, exiting",
+	"不在允许迁移的时间段内，等待":                                                           "outside the scheduled transfer windows, waiting",
+	"目标连续失败，暂停使用":                                                              "destination failed repeatedly, disabling it",
+	"目标连续失败 %d 次，暂停使用: %s":                                                     "destination failed %d times in a row, disabled: %s",
+	"暂停的目标仍不可用":                                                                "disabled destination is still unavailable",
+	"暂停的目标测试写入成功，恢复使用":                                                         "disabled destination passed the write test, re-enabling it",
+	"暂停的目标已恢复: %s":                                                             "disabled destination recovered: %s",
+	"目标已暂停使用，跳过":                                                               "destination is disabled, skipping",
+	"  %s  速度 %s  权重 %.2f  已暂停使用\n":                                            "  %s  speed %s  weight %.2f  disabled\n",
+	"copy_file_range 不可用，改为 sendfile":                                          "copy_file_range unavailable, using sendfile",
+	"预分配 %s 失败: %w":                                                            "failed to preallocate %s: %w",
+	"  %s  迁入 %d 个  剩余 %s / %s\n":                                              "  %s  received %d  free %s / %s\n",
+	"创建临时目录失败: %v\n":                                                           "failed to create temporary directory: %v\n",
+	"创建虚拟plot失败: %v\n":                                                         "failed to create simulated plot: %v\n",
+	"初始化日志失败: %v\n":                                                            "failed to set up logging: %v\n",
+	"同时输出调度日志":                                                                 "also print scheduler logs",
+	"未迁移: %d 个\n":                                                              "not moved: %d\n",
+	"模拟迁移: %d 个源路径，%d 个plot，%d 个目标\n":                                          "simulation: %d source paths, %d plots, %d destinations\n",
+	"没有 fixture 时每个源路径生成的plot数量":                                               "number of plots generated per source path without a fixture",
+	"没有 fixture 时每个目标的剩余空间":                                                    "free space of each destination without a fixture",
+	"没有可模拟的目标，toPathsGlob 和 hotplug 找到的目标需要在 fixture 中列出":                      "no destinations to simulate; destinations found by toPathsGlob or hotplug must be listed in the fixture",
+	"生成的plot大小，默认k32":                                                          "size of generated plots, k32 by default",
+	"虚拟源和目标的定义文件，为空时按配置中的 fromPaths 和 toPaths 生成":                              "file defining simulated sources and destinations; generated from fromPaths and toPaths when empty",
+	"读取 fixture 失败: %v\n":                                                      "failed to read fixture: %v\n",
+	"退出码: %d\n":                                                                "exit code: %d\n",
+	"无法识别的plot头":                                                               "unrecognized plot header",
+	"%w: memo长度 %d":                                                            "%w: memo length %d",
+	"%q 不是 %d 字节的十六进制":                                                         "%q is not %d bytes of hex",
+	"地址 %q 无效":                                                                 "invalid address %q",
+	"地址 %q 校验和错误":                                                              "address %q has a bad checksum",
+	"routes 的 poolContract 无效: %w":                                             "invalid routes poolContract: %w",
+	"routes 的 farmerKey 无效: %w":                                                "invalid routes farmerKey: %w",
+	"routes 中目标分组 %q 的路由需要设置 from、poolContract、farmerKey 或 solo":               "route for destination group %q needs from, poolContract, farmerKey or solo",
+	"读取plot头失败，不按密钥路由":                                                         "failed to read plot header, not routing by key",
+	"stages 中没有名为 %q 的一级":                                                      "stages has no stage named %q",
+	"stages 中 %s 无效: %w":                                                       "invalid stage %s: %w",
+	"stages 中每一级都需要 name":                                                      "every stage in stages needs a name",
+	"stages 中的名称 %q 重复":                                                        "duplicate stage name %q in stages",
+	"配置了 stages 时不能使用 --from、--to 和 --tui":                                     "--from, --to and --tui cannot be used with stages",
+	"迁移阶段异常退出":                                                                 "stage exited abnormally",
+	"启动迁移阶段":                                                                   "starting stage",
+	"迁移阶段运行失败":                                                                 "stage failed to run",
+	"只运行配置中 stages 的指定一级，配置了 stages 时由主进程自动使用":                                 "run only the named stage from stages; used automatically by the parent process",
+	"配置有效: %d 级迁移\n":                                                           "config is valid: %d stages\n",
+	"正在被复制 ":                                                                   "being copied ",
+	"stages 中 %s 格式有误: %v":                                                     "stage %s is malformed: %v",
+	"检查字段名的拼写、缩进和取值类型，可以参考示例 config.yaml":                                      "check field spelling, indentation and value types; see the example config.yaml",
+	"源路径 %s 和目标路径 %s 在同一块磁盘 %s 上":                                              "source %s and destination %s are on the same disk %s",
+	"源路径 %s 和目标路径 %s 重叠":                                                       "source %s and destination %s overlap",
+	"源路径不存在或不是目录: %s":                                                          "source does not exist or is not a directory: %s",
+	"目标路径不存在或不是目录: %s":                                                         "destination does not exist or is not a directory: %s",
+	"确认硬盘已挂载并创建该目录，或从 toPaths 中删除该路径":                                          "make sure the disk is mounted and the directory exists, or remove it from toPaths",
+	"确认硬盘已挂载，或从 fromPaths 中删除该路径":                                              "make sure the disk is mounted, or remove it from fromPaths",
+	"警告": "warning",
+	"迁移不会释放这块磁盘的空间，确认是否配置错了路径":    "moving will not free space on that disk; check the paths are correct",
+	"迁移过去的plot会被再次当作源，请使用互不包含的目录": "moved plots would be picked up as sources again; use directories that do not contain each other",
+	"配置格式有误: %v": "malformed config: %v",
+	"错误":         "error",
+	"目标大小与源不一致":  "destination size does not match the source",
+	"目标大小与源不一致，保留源文件":                                          "destination size does not match the source, keeping the source",
+	"%w: %s 为 %d 字节，源为 %d 字节":                                  "%w: %s is %d bytes, the source is %d bytes",
+	"目标在网络文件系统上，使用 networkFS 中的参数":                             "destination is on a network filesystem, using the networkFS settings",
+	"钩子命令执行失败":                                                 "hook command failed",
+	"目标已满，请更换硬盘后按回车继续":                                         "destinations are full, swap a disk and press Enter to continue",
+	"目标有新的可用空间，继续迁移":                                           "destination has new free space, resuming",
+	"目标有新的可用空间: %s (%s)":                                       "destination has new free space: %s (%s)",
+	"读取SMART状态失败":                                              "failed to read SMART status",
+	"硬盘SMART状态异常，不再写入该目标":                                      "disk SMART status is bad, no longer writing to this destination",
+	"硬盘SMART状态已恢复正常":                                           "disk SMART status is back to normal",
+	"SMART整体状态为失败":                                             "SMART overall health is FAILED",
+	"重映射扇区 %d 个，超过上限 %d":                                       "%d reallocated sectors, above the limit of %d",
+	"待映射或无法修复的扇区 %d 个，超过上限 %d":                                 "%d pending or uncorrectable sectors, above the limit of %d",
+	"HTTP源不支持续传，重新下载":                                          "HTTP source does not support resuming, downloading again",
+	"HTTP源只能下载到本地目标: %s":                                       "HTTP sources can only be downloaded to local destinations: %s",
+	"HTTP源没有返回文件大小: %s":                                        "HTTP source did not return a file size: %s",
+	"HTTP源返回的范围与请求不一致: %s":                                     "HTTP source returned a range that does not match the request: %s",
+	"下载不完整: %s 为 %d 字节，远程为 %d 字节":                              "incomplete download: %s is %d bytes, remote is %d bytes",
+	"删除HTTP源上已下载的文件失败":                                         "failed to delete downloaded file from HTTP source",
+	"获取HTTP源文件列表失败":                                            "failed to list HTTP source",
+	"解析HTTP源清单 %s 失败: %w":                                      "failed to parse HTTP source manifest %s: %w",
+	"trash.untilFarmed 需要设置 harvester.refresh 为 rpc 或 command": "trash.untilFarmed requires harvester.refresh to be rpc or command",
+	"写入回收站记录失败":                                                "failed to write trash index",
+	"删除回收站中的源失败":                                               "failed to delete source from trash",
+	"已删除回收站中的源":                                                "deleted source from trash",
+	"源已移到回收站":                                                  "moved source to trash",
+	"移到回收站失败，直接删除源":                                            "failed to move to trash, deleting source directly",
+	"获取harvester的plot列表失败":                                     "failed to get plot list from harvester",
+	"解析回收站记录 %s 失败: %w":                                        "failed to parse trash index %s: %w",
+	"读取回收站记录失败":                                                "failed to read trash index",
+	"任务开始":                                                     "transfer started",
+	"任务结束":                                                     "transfer finished",
+	"创建任务日志文件失败":                                               "failed to create transfer log file",
+	"校验通过":                                                     "verification passed",
+	"  %-*s  %s %5.1f%%  已用 %s / %s  进行中 %s  预留 %s  plot %d 个": "  %-*s  %s %5.1f%%  used %s / %s  in flight %s  reserve %s  %d plots",
+	"  %-*s  获取容量失败: %s\n":                                     "  %-*s  failed to get capacity: %s\n",
+	"  即将写满，约可再放 %d 个":                                         "  almost full, room for about %d more",
+	"  已满":                                                     "  full",
+	"  约可再放 %d 个":                                              "  room for about %d more",
+	"空间（# 已用  + 进行中的任务  - 剩余）:":                                "Space (# used  + in-flight transfers  - free):",
+	"deletePolicy 为 afterVerify 时需要设置 verify 或打开 plotCheck":    "deletePolicy afterVerify requires verify or plotCheck to be enabled",
+	"deletePolicy 无效 %q，可选 always / afterVerify / never":       "invalid deletePolicy %q, expected always / afterVerify / never",
+	"按 deletePolicy 保留源":                                       "keeping source per deletePolicy",
+	"目标上的副本没有经过校验，按 deletePolicy 保留源":                          "copy on destination was not verified, keeping source per deletePolicy",
+	"fromPaths 中的通配符无效":                                        "invalid glob in fromPaths",
+	"fromPaths 中的通配符无效 %q: %w":                                 "invalid glob in fromPaths %q: %w",
+	"每轮调度会重新查找，临时盘挂载后自动加入":                                     "it is re-evaluated every scheduling cycle, temp disks are picked up once mounted",
+	"源路径通配符没有匹配到目录: %s":                                        "source glob matches no directories: %s",
+	"故障注入": "fault injection",
+	"未知的故障类型 %q，可选 enospc / interrupt / interruptAfter / slow / corrupt / seed": "unknown fault type %q, expected enospc / interrupt / interruptAfter / slow / corrupt / seed",
+	"故障注入参数 %s 无效: %w":                                              "invalid fault injection parameter %s: %w",
+	"故障注入: 目标变慢":                                                    "fault injection: slow destination",
+	"故障注入: 磁盘已满":                                                    "fault injection: disk full",
+	"故障注入: 复制中途中断":                                                  "fault injection: interrupting copy",
+	"故障注入: 损坏目标上的副本":                                                "fault injection: corrupting copy on destination",
+	"已启用故障注入，仅用于测试":                                                 "fault injection enabled, for testing only",
+	"过滤规则 %s 的 minAgeMinutes 不能为负数":                                 "filter rule %s: minAgeMinutes must not be negative",
+	"有迁移失败的任务":                                                      "some transfers failed",
+	"没有可用的目标":                                                       "no destination available",
+	"读取任务日志失败: %w":                                                  "failed to read journal: %w",
+	"启动事件输出失败: %w":                                                  "failed to start event output: %w",
+	"maxScanInterval(%s) 不能小于 scanInterval(%s)":                     "maxScanInterval (%s) must not be less than scanInterval (%s)",
+	"没有可迁移的源，等待后重新扫描":                                               "nothing to move, rescanning after a delay",
+	"源和目标重叠":                                                        "source and destination overlap",
+	"源和目标重叠，拒绝迁移":                                                   "source and destination overlap, refusing to move",
+	"notify.mqtt.broker 无效 %q，应为 tcp://host:1883 或 ssl://host:8883": "invalid notify.mqtt.broker %q, expected tcp://host:1883 or ssl://host:8883",
+	"MQTT服务器拒绝连接(返回码 %d)":                                           "MQTT broker refused the connection (return code %d)",
+	"MQTT发送队列已满，丢弃消息":                                               "MQTT send queue full, dropping message",
+	"连接MQTT服务器失败":                                                   "failed to connect to MQTT broker",
+	"已连接MQTT服务器":                                                    "connected to MQTT broker",
+	"MQTT连接已断开":                                                     "MQTT connection lost",
+	"profiles 中没有名为 %q 的配置":                                         "no profile named %q in profiles",
+	"profiles 中 %s 无效: %w":                                          "invalid profile %s: %w",
+	"profiles 中每个配置都需要 name":                                        "every profile needs a name",
+	"profiles 中的名称 %q 重复":                                           "duplicate profile name %q",
+	"配置了 profiles 时不能使用 --from、--to 和 --tui，可以用 --profile 只运行其中一个": "--from, --to and --tui cannot be used with profiles; use --profile to run just one",
+	"profile异常退出": "profile exited abnormally",
+	"启动profile":   "starting profile",
+	"profile运行失败": "profile failed to run",
+	"只运行配置中 profiles 的指定一个，不指定时同时运行所有profile (环境变量 CHIAMOVE_PROFILE)": "run only the named profile from profiles; all profiles run concurrently when omitted (env CHIAMOVE_PROFILE)",
+	"配置有效: %d 个profile\n":           "config is valid: %d profiles\n",
+	"profiles 中 %s 格式有误: %v":        "profile %s is malformed: %v",
+	"目标上的副本比源小，续传":                  "copy on destination is smaller than the source, resuming",
+	"destinationLayout 得到的目录不在目标盘内": "destinationLayout resolves to a directory outside the destination",
+	"destinationLayout 无效: %w":      "invalid destinationLayout: %w",
+	"%s: %d 个文件正常，%d 个损坏，%d 个缺失\n":  "%s: %d ok, %d corrupted, %d missing\n",
+	"%s: 没有清单\n":                    "%s: no manifest\n",
+	"从清单中删除已不存在的文件，如手动删除或替换的plot；会重写清单，不要在迁移进行中使用": "remove files that no longer exist from the manifest, such as plots deleted or replaced by hand; rewrites the manifest, do not use while moves are running",
+	"只比较大小，不计算SHA-256":       "only compare sizes, skip SHA-256",
+	"大小不一致 %s: %d，清单中为 %d\n": "size mismatch %s: %d, manifest has %d\n",
+	"无法读取 %s: %v\n":          "cannot read %s: %v\n",
+	"更新清单失败 %s: %v\n":        "failed to update manifest %s: %v\n",
+	"更新目标清单失败":               "failed to update destination manifest",
+	"校验和不一致 %s\n":            "checksum mismatch %s\n",
+	"缺失 %s\n":                "missing %s\n",
+	"读取清单失败 %s: %v\n":        "failed to read manifest %s: %v\n",
+	"配置文件路径，没有指定目标时检查其中的 toPaths":                                "config file path; its toPaths are checked when no destination is given",
+	"ssh源只能拉取到本地目标: %s":                                          "ssh sources can only be pulled to local destinations: %s",
+	"获取远程源文件列表失败":                                                "failed to list remote source",
+	"远程源不存在: %s":                                                 "remote source does not exist: %s",
+	"concurrency 无效: 需要 1 <= min(%d) <= max(%d)":                 "invalid concurrency: need 1 <= min(%d) <= max(%d)",
+	"concurrency.collapsePercent 需要在0到100之间":                     "concurrency.collapsePercent must be between 0 and 100",
+	"单个任务的速度骤降，减少并发任务数":                                          "per-transfer speed collapsed, reducing concurrency",
+	"尝试增加并发任务数":                                                  "trying higher concurrency",
+	"总吞吐量没有随任务数增加，退回":                                            "aggregate throughput did not scale, backing off",
+	"只列出失败的任务及原因，不重试":                                            "only list failed transfers and their errors, do not retry",
+	"已重新排队 %d 个任务\n":                                             "requeued %d transfers\n",
+	"恢复失败的源出错":                                                   "failed to restore failed source",
+	"没有失败的任务":                                                    "no failed transfers",
+	"源不存在: %s":                                                   "source does not exist: %s",
+	"请求体应为 {\"srcs\": [...]}":                                    "request body should be {\"srcs\": [...]}",
+	"重新排队失败的任务":                                                  "requeued failed transfer",
+	"重试失败的任务":                                                    "retrying failed transfers",
+	"%w: %s 中的 %s 与源文件不一致":                                       "%w: %s in %s differs from the source",
+	"rsync:// 目标 %s 需要在 toPathsConfig 中设置 usageAgent 或 capacity": "rsync:// destination %s needs usageAgent or capacity in toPathsConfig",
+	"rsync目标不可用: %w":                                             "rsync destination unavailable: %w",
+	"rsync目标不支持plot校验，跳过":                                        "rsync destinations do not support plot checks, skipping",
+	"目标 %s 的 usageAgent 需要是 agent:// 或 agents:// 形式: %s":         "usageAgent of destination %s must be an agent:// or agents:// URL: %s",
+	"读取rsync目标文件列表失败":                                            "Failed to list rsync destination files",
+	"删除未完成的副本失败":                                                 "Failed to remove the unfinished copy",
+	"目标空间不足，换到下一个目标":                                             "Destination out of space, switching to the next destination",
+	"目标空间不足，没有其他可用的目标，下一轮重新分配":                                   "Destination out of space and no other destination available, reassigning in the next cycle",
+	"%w: k值 %d 无效":                                               "%w: invalid k value %d",
+	"%w: 文件头不完整":                                                 "%w: incomplete header",
+	"%w: 文件头中的k值 %d 与文件名中的 k%d 不一致":                              "%w: k value %d in the header does not match k%d in the file name",
+	"headerCheck.action 无效 %q，可选 skip / fail":                    "invalid headerCheck.action %q, choose skip / fail",
+	"plot头无效 %s: %v":                                             "Invalid plot header %s: %v",
+	"plot头无效，按失败处理":                                              "Invalid plot header, treating as failed",
+	"plot头无效，跳过":                                                 "Invalid plot header, skipping",
+	"文件已截断: 大小 %d 小于文件头中表的位置 %d":                                 "file truncated: size %d is less than table position %d in the header",
+	"文件已截断: 大小 %s，估算大小 %s":                                       "file truncated: size %s, expected %s",
+	"keepOnSource 不能小于0: %d":                                     "keepOnSource must not be negative: %d",
+	"按 keepOnSource 保留在源上":                                       "Keeping on source per keepOnSource",
+	"%s 中 include %s 失败: %w":                                     "include %[2]s in %[1]s failed: %[3]w",
+	"include 应为文件路径或文件路径列表":                                      "include must be a file path or a list of file paths",
+	"环境变量没有设置: %s，可以用 ${VAR:-默认值} 指定默认值":                         "environment variables not set: %s; use ${VAR:-default} to give a default",
+	"配置文件 %s 被循环 include":                                        "config file %s is included recursively",
+	"导出迁移记录到CSV失败":                                               "failed to export transfer record to CSV",
+	"不统计挂载点中的内容":                                                 "not counting contents of mount point",
+	"统计大小时读取失败，忽略":                                               "read failed while measuring size, ignoring",
+	"目标测试写入失败，跳过":                                                "destination write test failed, skipping",
+	"%s  已使用 %.1f%%，剩余 %s\n":                                     "%s  %.1f%% used, %s free\n",
+	"deletePolicy 为 never 时复制后不会删除原来的plot，不能用于 rebalance":        "deletePolicy never keeps the original plot after copying and cannot be used with rebalance",
+	"使用比例最高和最低的盘相差不超过该百分比时停止":                                    "stop when the fullest and emptiest disks differ by no more than this percentage",
+	"只列出计划的迁移":                                                   "only list the planned moves",
+	"平衡迁移失败":                                                     "rebalance move failed",
+	"按 deletePolicy 保留了源，停止平衡":                                   "source kept by deletePolicy, stopping rebalance",
+	"无法启动: %v\n":                                                 "cannot start: %v\n",
+	"最多迁移的plot数量，0 为不限制":                                         "maximum number of plots to move, 0 for no limit",
+	"没有可以平衡的plot":                                                "no plot can be moved to rebalance",
+	"至少需要两块不在同一个文件系统上的本地目标盘":                                     "need at least two local destination disks on different filesystems",
+	"%s 中没有PEM格式的证书":                                             "no PEM certificate in %s",
+	"--client-ca 需要同时设置 --cert 和 --key":                          "--client-ca requires --cert and --key",
+	"agent的TLS配置无效":                                              "invalid agent TLS config",
+	"客户端证书的CA，设置后只接受持有该CA签发的证书的客户端（mTLS），需要同时设置 --cert": "CA for client certificates; when set only clients presenting a certificate signed by it are accepted (mTLS); requires --cert",
+	"读取 --client-ca 失败: %v\n":             "failed to read --client-ca: %v\n",
+	"读取 agent.ca 失败: %w":                  "failed to read agent.ca: %w",
+	"读取 agent.cert/agent.key 失败: %w":      "failed to read agent.cert/agent.key: %w",
+	"扫描时读取失败":                             "read failed while scanning",
+	"扫描时读取失败，已跳过 %s: %v":                  "read failed while scanning, skipped %s: %v",
+	"扫描时读取失败，跳过":                          "read failed while scanning, skipping",
+	"扫描时读取恢复正常":                           "scanning can read the path again",
+	"sourceSpace.resumeFree 不能小于 minFree": "sourceSpace.resumeFree must not be less than minFree",
+	"源盘剩余空间不足":                            "source disk is low on free space",
+	"源盘剩余空间不足: %s (%s)":                   "source disk is low on free space: %s (%s)",
+	"源盘剩余空间已恢复":                           "source disk free space recovered",
+	"源盘剩余空间已恢复: %s (%s)":                  "source disk free space recovered: %s (%s)",
+	"退出时源盘剩余空间仍然不足，onSourceSpaceLow 的操作没有恢复": "source disk is still low on free space at exit, the onSourceSpaceLow action was not undone",
+	"无法访问源，暂不续传":                                  "cannot access the source, not resuming for now",
+	"已有 Mover 正在运行":                               "another Mover is already running",
+	"目标上已有完整的同名副本":                                "a complete copy with the same name already exists on the destination",
+	"目标上已有完整的同名副本，跳过该源":                           "a complete copy already exists on the destination, skipping the source",
+	"挂载点 %s 没有挂载，硬盘可能掉线":                          "mount point %s is not mounted, the disk may be offline",
+	"api.listen %s 不是本机地址，需要设置 api.token":         "api.listen %s is not a loopback address, api.token is required",
+	"调度长时间没有进展，停止发送watchdog保活消息":                  "scheduler has made no progress for too long, stopping watchdog keep-alives",
+	"生成服务文件失败: %v\n":                              "failed to generate service file: %v\n",
+	"rename失败，改为复制":                               "rename failed, copying instead",
+	"routes 中源路径 %s 对应的目标分组 %q 不存在":               "destination group %[2]q for route source %[1]s does not exist",
+	"rsync命令执行出错(退出码 %d): %v":                     "rsync failed (exit code %d): %v",
+	"ssh %s 执行 %q 失败: %w: %s":                     "ssh %s running %q failed: %w: %s",
+	"toPathsGlob 无效":                              "invalid toPathsGlob",
+	"toPathsGlob 无效 %q: %w":                       "invalid toPathsGlob %q: %w",
+	"toPaths、toPathsGlob 和 hotplug.pattern 不能都为空": "at least one of toPaths, toPathsGlob and hotplug.pattern must be set",
+	"不可写: %w":      "not writable: %w",
+	"不支持的文件类型: %s": "unsupported file type: %s",
+	"不是目录":         "not a directory",
+	"与系统盘 %s 在同一个文件系统上，硬盘可能没有挂载": "on the same filesystem as the system disk %s, the disk may not be mounted",
+	"令牌无效":  "invalid token",
+	"任务已取消": "transfer canceled",
+	"允许写入的目录，可以指定多次": "directory clients may write to, can be repeated",
+	"写入任务日志失败":       "failed to write journal",
+	"写入服务文件失败: %v\n": "failed to write unit file: %v\n",
+	"写入迁移历史失败":       "failed to write history",
+	"创建隔离目录失败，改为跳过":  "failed to create quarantine directory, skipping instead",
+	"初始化日志失败":        "failed to set up logging",
+	"删除失败 %s: %v\n":  "failed to remove %s: %v\n",
+	"删除残留的临时文件失败":    "failed to remove stale partial file",
+	"删除源目录出错: %w":    "failed to remove source: %w",
+	"发现目标路径":         "destination discovered",
+	"发送systemd通知失败":  "failed to send systemd notification",
+	"发送汇总邮件失败":       "failed to send digest email",
+	"发送通知失败":         "failed to send notification",
+	"取消任务":           "transfer canceled",
+	"只列出要删除的文件":      "only list the files that would be removed",
+	"只删除超过该时长没有修改的文件，避免删除正在写入的文件":           "only remove files not modified for this long, to avoid removing files still being written",
+	"只打印迁移计划，不实际复制 (环境变量 CHIAMOVE_DRY_RUN)": "only print the plan without copying (env CHIAMOVE_DRY_RUN)",
+	"只统计该日期(2006-01-02)及之后的记录":              "only include records on or after this date (2006-01-02)",
+	"合计": "total",
+	"在终端显示实时界面代替滚动的日志输出": "show a live terminal UI instead of scrolling log output",
+	"复制失败":               "copy failed",
+	"复制失败 %s -> %s: %v":  "copy failed %s -> %s: %v",
+	"复制失败，稍后重试":          "copy failed, retrying later",
+	"复制成功":               "copy succeeded",
+	"复制成功 %s -> %s (%s)": "copy succeeded %s -> %s (%s)",
+	"大小 %q 的单位 %q 无法识别":  "size %q has unknown unit %q",
+	"大小 %q 的数值无效":        "size %q has an invalid number",
+	"大小 %q 缺少数值":         "size %q is missing a number",
+	"大小 %q 超出范围":         "size %q is out of range",
+	"存在临时文件 ":            "temporary file present ",
+	"客户端需要在配置 agent.token 中提供的令牌，也可以用环境变量 CHIAMOVE_AGENT_TOKEN": "token clients must provide in agent.token, can also be set with env CHIAMOVE_AGENT_TOKEN",
+	"将删除": "would remove",
+	"已停止，未完成的任务下次启动时续传":                                                          "stopped, unfinished transfers will resume on next start",
+	"已写入 %s，执行以下命令启用:\n  systemctl daemon-reload\n  systemctl enable --now %s\n": "wrote %s, enable it with:\n  systemctl daemon-reload\n  systemctl enable --now %s\n",
+	"已删除":         "removed",
+	"已删除残留的临时文件":  "removed stale partial file",
+	"已发送汇总邮件":     "digest email sent",
+	"已接收":         "received",
+	"已暂停":         "paused",
+	"已添加目标路径":     "destination added",
+	"已移除目标路径":     "destination removed",
+	"已终止(%w): %v": "aborted (%w): %v",
+	"已设置进程优先级":    "process priority set",
+	"已隔离迁移失败的源":   "quarantined failed source",
+	"开始迁移":        "transfer started",
+	"当前系统不支持检测新挂载的硬盘":        "detecting newly mounted disks is not supported on this system",
+	"当前系统不支持设置IO优先级，只设置nice": "IO priority is not supported on this system, only setting nice",
+	"总体进度":                                                 "overall progress",
+	"打开日志文件失败: %w":                                         "failed to open log file: %w",
+	"收到SIGHUP，将重新加载配置":                                     "received SIGHUP, reloading config",
+	"收到退出信号，正在停止正在进行的任务":                                   "received exit signal, stopping running transfers",
+	"改名已有的目标失败":                                            "failed to rename existing destination entry",
+	"文件只有 %d 字节，不能从 %d 续传":                                 "file has only %d bytes, cannot resume from %d",
+	"新的目标硬盘已挂载: %s":                                        "new destination disk mounted: %s",
+	"无法执行 chia plots check: %w":                            "cannot run chia plots check: %w",
+	"无法检测新挂载的硬盘":                                           "cannot detect newly mounted disks",
+	"无法解析df输出: %q":                                         "cannot parse df output: %q",
+	"日志格式无效 %q":                                            "invalid log format %q",
+	"日志级别 debug/info/warn/error (环境变量 CHIAMOVE_LOG_LEVEL)": "log level debug/info/warn/error (env CHIAMOVE_LOG_LEVEL)",
+	"日志级别无效 %q: %w":                                        "invalid log level %q: %w",
+	"最近有修改 ":                                               "recently modified ",
+	"有进程正在打开其中的文件":                                         "files are held open by a process",
+	"服务使用的配置文件路径":                                          "config file used by the service",
+	"服务文件的写入位置，为 - 时输出到标准输出":                               "where to write the unit file, - for stdout",
+	"未测量": "not measured",
+	"未知的子命令 %q，可选 move / validate / status / clean / history / systemd-install / agent / simulate / verify-manifest / retry-failed / rebalance\n": "unknown command %q, expected move / validate / status / clean / history / systemd-install / agent / simulate / verify-manifest / retry-failed / rebalance\n",
+	"未获取到符合条件的文件或文件夹":                   "no matching file or directory found",
+	"查询状态失败: %s\n":                      "status query failed: %s\n",
+	"标记无效plot失败":                        "failed to mark invalid plot",
+	"检测到新挂载的目标硬盘":                       "new destination disk detected",
+	"永久性错误，不再重试: %w":                    "permanent error, not retrying: %w",
+	"汇总方式 day / destination":            "group by day / destination",
+	"没有找到排队或进行中的任务":                     "no queued or running transfer found",
+	"没有设置 --token，任何能访问该端口的客户端都可以写入":    "--token is not set, any client that can reach this port can write",
+	"没有配置 api.listen，请用 --addr 指定API地址": "api.listen is not configured, use --addr to specify the API address",
+	"源和目标在同一文件系统，已直接rename":             "source and destination are on the same filesystem, renamed directly",
+	"源盘已空或目标已满时不退出，定时重新扫描":              "keep running and rescan periodically when sources are empty or destinations are full",
+	"源路径不存在: %w":                        "source does not exist: %w",
+	"源路径，可多次指定或用逗号分隔，覆盖配置中的 fromPaths (环境变量 CHIAMOVE_FROM)": "source path, repeatable or comma separated, overrides fromPaths (env CHIAMOVE_FROM)",
+	"环境变量 CHIAMOVE_DRY_RUN 无效: %w": "invalid CHIAMOVE_DRY_RUN: %w",
+	"监听地址": "listen address",
+	"目标:":  "Destinations:",
+	"目标上已存在同名plot，已隔离源": "plot already exists on a destination, quarantined source",
+	"目标上已存在同名plot，跳过":   "plot already exists on a destination, skipping",
+	"目标不可用，跳过":          "destination unavailable, skipping",
+	"目标已存在: %s":         "destination already exists: %s",
+	"目标已存在: %s: %w":     "destination already exists: %s: %w",
+	"目标汇总":              "destination summary",
+	"目标硬盘已卸载":           "destination disk unmounted",
+	"目标路径已消失":           "destination disappeared",
+	"目标路径，可多次指定或用逗号分隔，覆盖配置中的 toPaths (环境变量 CHIAMOVE_TO)": "destination path, repeatable or comma separated, overrides toPaths (env CHIAMOVE_TO)",
+	"符合过滤规则":                    "matched filter rule",
+	"统计时间: %s ~ %s\n\n":         "Period: %s ~ %s\n\n",
+	"续传未完成的任务":                  "resuming unfinished transfer",
+	"至少需要用 --root 指定一个允许写入的目录":  "at least one --root directory is required",
+	"获取文件系统信息失败":                "failed to get filesystem info",
+	"获取源路径所在磁盘失败，不限制并发":         "failed to get source device, not limiting concurrency",
+	"获取程序路径失败: %v\n":            "failed to get executable path: %v\n",
+	"获取路径大小失败":                  "failed to get path size",
+	"获取远程剩余空间失败":                "failed to get remote free space",
+	"获取配置文件路径失败: %v\n":          "failed to get config path: %v\n",
+	"要求目标不在系统盘上，避免硬盘没挂载时写进根分区":  "require destinations not on the system disk, to avoid filling the root filesystem when a disk is not mounted",
+	"解析任务日志 %s 失败: %w":          "failed to parse journal %s: %w",
+	"解析状态失败: %v\n":              "failed to parse status: %v\n",
+	"计算校验和失败":                   "failed to compute checksum",
+	"设置进程优先级失败":                 "failed to set process priority",
+	"请求体应为 {\"path\": \"...\"}": "request body must be {\"path\": \"...\"}",
+	"请求体应为 {\"src\": \"...\"}":  "request body must be {\"src\": \"...\"}",
+	"读取agent目标文件列表失败":           "failed to list agent destination",
+	"读取任务日志失败: %v\n":            "failed to read journal: %v\n",
+	"读取目标文件列表失败":                "failed to list destination",
+	"读取迁移历史失败: %v\n":            "failed to read history: %v\n",
+	"读取远程目标文件列表失败":              "failed to list remote destination",
+	"读取配置失败":                    "failed to read config",
+	"读取配置失败: %v\n":              "failed to read config: %v\n",
+	"调度: %s  进行中 %d  排队 %d\n":   "Scheduler: %s  running %d  queued %d\n",
+	"调度已恢复":                     "scheduling resumed",
+	"调度已暂停":                     "scheduling paused",
+	"调度已暂停，进行中的任务完成后不再开始新任务，删除该文件后恢复": "scheduling paused, running transfers will finish but no new ones start until the file is removed",
+	"超过 transferTimeout":                     "transferTimeout exceeded",
+	"路径不在允许写入的目录中: %s":                       "path is outside the allowed directories: %s",
+	"跳过仍在写入的路径":                              "skipping path still being written",
+	"迁移失败":                                   "transfer failed",
+	"迁移失败: %d 个\n":                           "Failed: %d\n",
+	"迁移成功: %d 个，共 %s\n":                      "Moved: %d, %s total\n",
+	"迁移进度":                                   "transfer progress",
+	"迁移长时间没有进展":                              "transfer stalled",
+	"迁移长时间没有进展，终止后重试":                        "transfer stalled, aborting and retrying",
+	"过滤规则 %s 的 minSize(%s) 必须小于 maxSize(%s)": "filter rule %s: minSize (%s) must be less than maxSize (%s)",
+	"过滤规则 %s 的 regex 无效 %q: %w":              "filter rule %s: invalid regex %q: %w",
+	"运行中":                           "running",
+	"运行服务的用户，默认root":                "user to run the service as, default root",
+	"运行汇总":                          "run summary",
+	"进程退出":                          "process exiting",
+	"进程退出，任务已中断":                    "process exiting, transfer interrupted",
+	"远程目标不存在或不可写: %w":               "remote destination does not exist or is not writable: %w",
+	"远程目标改名失败: %w":                  "renaming on remote destination failed: %w",
+	"连接systemd通知socket失败":           "failed to connect to systemd notify socket",
+	"连接迁移进程失败: %v\n":                "failed to connect to the mover: %v\n",
+	"通过API取消":                       "canceled via API",
+	"配置已重新加载":                       "config reloaded",
+	"配置文件已修改，将重新加载":                 "config file changed, reloading",
+	"配置文件路径":                        "config file path",
+	"配置文件路径 (环境变量 CHIAMOVE_CONFIG)": "config file path (env CHIAMOVE_CONFIG)",
+	"配置文件路径，用于确定API地址":              "config file path, used to find the API address",
+	"配置文件路径，用于确定历史文件位置":             "config file path, used to find the history file",
+	"配置无效":                          "invalid config",
+	"配置无效: %v\n":                    "invalid config: %v\n",
+	"配置有效: %d 个源路径，%d 个目标路径，%d 个目标通配符\n": "Config OK: %d sources, %d destinations, %d destination globs\n",
+	"重新加载配置失败，继续使用原来的配置":                 "failed to reload config, keeping the previous one",
+	"重试 %d 次后仍然失败: %w":                   "still failing after %d attempts: %w",
+	"隔离失败的源出错，改为跳过":                      "failed to quarantine failed source, skipping instead",
+	"隔离重复的源失败，改为跳过":                      "failed to quarantine duplicate source, skipping instead",
+}
@@ -0,0 +1,177 @@
+package chiamove
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ${VAR} 或 ${VAR:-默认值}，不处理 $VAR 形式，避免改动正则表达式中的 $
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// loadConfigFile 读取配置文件，展开其中的环境变量，再把 include 中的文件按顺序合并到配置上，
+// 后合并的覆盖前面的：对象逐个字段合并，列表和其他值整体替换；include 的相对路径相对于所在的配置文件
+func loadConfigFile(filename string) ([]byte, error) {
+	buf, doc, includes, err := readConfigDoc(filename)
+	if err != nil || len(includes) == 0 {
+		// 没有 include 时使用原文，报错时的行号与配置文件一致
+		return buf, err
+	}
+	merged, err := mergeIncludes(filename, doc, includes, map[string]bool{absPath(filename): true})
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(merged)
+}
+
+// readConfigDoc 读取并展开环境变量，返回展开后的内容、去掉 include 后的配置和 include 的文件
+func readConfigDoc(filename string) ([]byte, yaml.MapSlice, []string, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if buf, err = expandEnv(buf); err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	includes, doc, err := takeIncludes(doc)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	for i, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			includes[i] = filepath.Join(filepath.Dir(filename), inc)
+		}
+	}
+	return buf, doc, includes, nil
+}
+
+func mergeIncludes(filename string, doc yaml.MapSlice, includes []string, visiting map[string]bool) (yaml.MapSlice, error) {
+	for _, inc := range includes {
+		abs := absPath(inc)
+		if visiting[abs] {
+			return nil, fmt.Errorf(T("配置文件 %s 被循环 include"), inc)
+		}
+		_, sub, subIncludes, err := readConfigDoc(inc)
+		if err == nil {
+			visiting[abs] = true
+			sub, err = mergeIncludes(inc, sub, subIncludes, visiting)
+			delete(visiting, abs)
+		}
+		if err != nil {
+			return nil, fmt.Errorf(T("%s 中 include %s 失败: %w"), filename, inc, err)
+		}
+		doc = mergeYAML(doc, sub).(yaml.MapSlice)
+	}
+	return doc, nil
+}
+
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// expandEnv 展开 ${VAR}，没有设置且没有默认值的变量报错；整行注释中的不展开
+func expandEnv(buf []byte) ([]byte, error) {
+	var missing []string
+	lines := strings.SplitAfter(string(buf), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		lines[i] = envPattern.ReplaceAllStringFunc(line, func(m string) string {
+			sub := envPattern.FindStringSubmatch(m)
+			if v, ok := os.LookupEnv(sub[1]); ok && (v != "" || sub[2] == "") {
+				return v
+			}
+			if sub[2] != "" {
+				return sub[3]
+			}
+			missing = append(missing, sub[1])
+			return m
+		})
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf(T("环境变量没有设置: %s，可以用 ${VAR:-默认值} 指定默认值"), strings.Join(missing, ", "))
+	}
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// takeIncludes 取出顶层的 include，可以是单个路径或路径列表
+func takeIncludes(doc yaml.MapSlice) ([]string, yaml.MapSlice, error) {
+	for i, item := range doc {
+		if item.Key != "include" {
+			continue
+		}
+		rest := append(append(yaml.MapSlice{}, doc[:i]...), doc[i+1:]...)
+		switch v := item.Value.(type) {
+		case nil:
+			return nil, rest, nil
+		case string:
+			return []string{v}, rest, nil
+		case []interface{}:
+			var includes []string
+			for _, e := range v {
+				s, ok := e.(string)
+				if !ok {
+					return nil, nil, errors.New(T("include 应为文件路径或文件路径列表"))
+				}
+				includes = append(includes, s)
+			}
+			return includes, rest, nil
+		default:
+			return nil, nil, errors.New(T("include 应为文件路径或文件路径列表"))
+		}
+	}
+	return nil, doc, nil
+}
+
+// mergeYAML 把 override 合并到 base 上
+func mergeYAML(base, override interface{}) interface{} {
+	b, ok := base.(yaml.MapSlice)
+	o, ok2 := override.(yaml.MapSlice)
+	if !ok || !ok2 {
+		return override
+	}
+	merged := append(yaml.MapSlice{}, b...)
+	for _, item := range o {
+		found := false
+		for i := range merged {
+			if merged[i].Key == item.Key {
+				merged[i].Value = mergeYAML(merged[i].Value, item.Value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// configFiles 返回配置文件和其中 include 的文件，用于检测配置是否修改
+func configFiles(filename string) []string {
+	files := []string{filename}
+	seen := map[string]bool{absPath(filename): true}
+	for i := 0; i < len(files); i++ {
+		_, _, includes, _ := readConfigDoc(files[i])
+		for _, inc := range includes {
+			if !seen[absPath(inc)] {
+				seen[absPath(inc)] = true
+				files = append(files, inc)
+			}
+		}
+	}
+	return files
+}
@@ -0,0 +1,184 @@
+package chiamove
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type JournalState string
+
+const (
+	StateQueued  JournalState = "queued"
+	StateRunning JournalState = "running"
+	StateDone    JournalState = "done"
+	StateFailed  JournalState = "failed"
+)
+
+type JournalEntry struct {
+	Src       string       `json:"src"`
+	Dst       string       `json:"dst"`
+	State     JournalState `json:"state"`
+	Error     string       `json:"error,omitempty"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+// Journal 记录每个迁移任务的状态并实时落盘，进程崩溃重启后据此续传未完成的任务
+type Journal struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]*JournalEntry
+	// 打开时上次运行中排队或正在迁移、还没有结束的任务，源 -> 目标
+	interrupted map[string]string
+}
+
+func OpenJournal(path string) (*Journal, error) {
+	j := &Journal{path: path, entries: map[string]*JournalEntry{}, interrupted: map[string]string{}}
+	if path == "" {
+		return j, nil
+	}
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*JournalEntry
+	if err := json.Unmarshal(buf, &entries); err != nil {
+		return nil, fmt.Errorf(T("解析任务日志 %s 失败: %w"), path, err)
+	}
+	for _, e := range entries {
+		// 源已经不存在的已完成任务不会再被扫描到，没必要保留；HTTP和ssh源下载后可能仍在远程，需要保留记录
+		if e.State == StateDone && !isRemoteSource(e.Src) {
+			if _, err := os.Stat(e.Src); errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+		}
+		j.entries[e.Src] = e
+		if e.State == StateQueued || e.State == StateRunning {
+			j.interrupted[e.Src] = e.Dst
+		}
+	}
+	return j, nil
+}
+
+// Interrupted 上次运行结束时 src 迁移到 dst 的任务是否还没有完成
+func (j *Journal) Interrupted(src, dst string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	d, ok := j.interrupted[src]
+	return ok && d == dst
+}
+
+func (j *Journal) Set(src, dst string, state JournalState, cause error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e := &JournalEntry{Src: src, Dst: dst, State: state, UpdatedAt: time.Now()}
+	if cause != nil {
+		e.Error = cause.Error()
+	}
+	j.entries[src] = e
+	if state == StateDone || state == StateFailed {
+		delete(j.interrupted, src)
+	}
+	if err := j.save(); err != nil {
+		slog.Error("写入任务日志失败", "path", j.path, "err", err)
+	}
+}
+
+// Pending 返回上次运行中排队或正在迁移、还没有结束的任务
+func (j *Journal) Pending() []*JournalEntry {
+	return j.Entries(StateQueued, StateRunning)
+}
+
+// Entries 返回处于 states 中任一状态的任务，按源路径排序
+func (j *Journal) Entries(states ...JournalState) []*JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var entries []*JournalEntry
+	for _, e := range j.entries {
+		if slices.Contains(states, e.State) {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Src < entries[b].Src })
+	return entries
+}
+
+func (j *Journal) Completed(src string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e, ok := j.entries[src]
+	return ok && e.State == StateDone
+}
+
+// Failed 判断源的上一次迁移是否失败或被取消，这样的源在 retry-failed 之前不再选择，重启后也一样
+func (j *Journal) Failed(src string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e, ok := j.entries[src]
+	return ok && e.State == StateFailed
+}
+
+// ClearFailed 删除 srcs 中失败的任务记录，srcs 为空时删除全部失败的记录，返回被删除的记录
+func (j *Journal) ClearFailed(srcs []string) []*JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var cleared []*JournalEntry
+	for src, e := range j.entries {
+		if e.State == StateFailed && (len(srcs) == 0 || slices.Contains(srcs, src)) {
+			cleared = append(cleared, e)
+			delete(j.entries, src)
+		}
+	}
+	if len(cleared) == 0 {
+		return nil
+	}
+	if err := j.save(); err != nil {
+		slog.Error("写入任务日志失败", "path", j.path, "err", err)
+	}
+	sort.Slice(cleared, func(a, b int) bool { return cleared[a].Src < cleared[b].Src })
+	return cleared
+}
+
+// Remove 删除源的记录，下一轮扫描时重新选择
+func (j *Journal) Remove(src string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.entries[src]; !ok {
+		return
+	}
+	delete(j.entries, src)
+	delete(j.interrupted, src)
+	if err := j.save(); err != nil {
+		slog.Error("写入任务日志失败", "path", j.path, "err", err)
+	}
+}
+
+func (j *Journal) save() error {
+	if j.path == "" {
+		return nil
+	}
+	entries := make([]*JournalEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Src < entries[b].Src })
+	buf, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再rename，避免写到一半崩溃导致日志损坏
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
@@ -0,0 +1,69 @@
+package chiamove
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// keepUnit 参与 keepOnSource 计算的迁移单位
+type keepUnit struct {
+	path    string
+	modTime time.Time
+	plots   int
+}
+
+// newestUnits 按修改时间从新到旧保留迁移单位，直到保留的plot数量达到 n
+func newestUnits(units []keepUnit, n int) map[string]bool {
+	sort.SliceStable(units, func(a, b int) bool { return units[a].modTime.After(units[b].modTime) })
+	kept := map[string]bool{}
+	for _, u := range units {
+		if n <= 0 {
+			break
+		}
+		kept[u.path] = true
+		n -= u.plots
+	}
+	return kept
+}
+
+// keptOnSource 返回 fromPath 下按 keepOnSource 留在源上的最新的迁移单位，
+// 只计算符合过滤条件且已经写完的；文件夹按其中的plot数量计算
+func (s *Scheduler) keptOnSource(fromPath string, entries []fs.DirEntry) map[string]bool {
+	if s.cfg.KeepOnSource <= 0 {
+		return nil
+	}
+	var units []keepUnit
+	for _, entry := range entries {
+		p := filepath.Join(fromPath, entry.Name())
+		if isExcluded(s.cfg, entry.Name()) || len(matchingRules(s.cfg, p, entry)) == 0 {
+			continue
+		}
+		if staging, _ := s.isStaging(p); staging {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		units = append(units, keepUnit{path: p, modTime: info.ModTime(), plots: max(unitPlots(p), 1)})
+	}
+	return newestUnits(units, s.cfg.KeepOnSource)
+}
+
+// keptOnSSHSource 与 keptOnSource 相同，远端的文件夹按一个plot计算
+func keptOnSSHSource(c *Config, r remoteTarget, entries []*sshEntry) map[string]bool {
+	if c.KeepOnSource <= 0 {
+		return nil
+	}
+	var units []keepUnit
+	for _, e := range entries {
+		src := r.sourcePath(e.name)
+		if isExcluded(c, e.name) || e.staging != "" || len(matchingRules(c, src, e)) == 0 {
+			continue
+		}
+		units = append(units, keepUnit{path: src, modTime: e.modTime, plots: 1})
+	}
+	return newestUnits(units, c.KeepOnSource)
+}
@@ -0,0 +1,104 @@
+package chiamove
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// LayoutFields destinationLayout 模板中可用的字段，不是plot的源 KSize 和 Compression 为空
+type LayoutFields struct {
+	Name        string // 源的名称
+	KSize       string // 如 k32
+	Compression string // 如 c05，不压缩的plot为 c00
+	Date        string // plot名称中的创建日期，不是plot时为源的修改日期，如 2023-05-01
+	Year        string
+	Month       string
+}
+
+// 源按 destinationLayout 放入的目标子目录，源删除后仍能找到目标上的副本
+var layoutDirs sync.Map
+
+var errLayout = sentinelError("destinationLayout 得到的目录不在目标盘内")
+
+func parseLayout(layout string) (*template.Template, error) {
+	tmpl, err := template.New("destinationLayout").Parse(layout)
+	if err != nil {
+		return nil, fmt.Errorf(T("destinationLayout 无效: %w"), err)
+	}
+	return tmpl, nil
+}
+
+// layoutDestination 按 destinationLayout 返回源在目标盘上所在的子目录，并创建缺少的各级目录；
+// 同一个源每次得到的目录相同，中断后仍能续传。只对本地目标生效
+func layoutDestination(c *Config, src, dst string) (string, error) {
+	if c.DestinationLayout == "" || isRemoteDest(dst) {
+		return dst, nil
+	}
+	tmpl, err := parseLayout(c.DestinationLayout)
+	if err != nil {
+		return "", err
+	}
+	name := sourceName(src)
+	fields := LayoutFields{Name: name}
+	date := ""
+	if info, ok := ParsePlotName(name); ok {
+		fields.KSize = fmt.Sprintf("k%d", info.KSize)
+		fields.Compression = fmt.Sprintf("c%02d", info.Compression)
+		date = info.CreatedAt.Format("2006-01-02")
+	} else if fi, err := os.Stat(src); err == nil {
+		date = fi.ModTime().Format("2006-01-02")
+	}
+	if date != "" {
+		fields.Date, fields.Year, fields.Month = date, date[:4], date[5:7]
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, fields); err != nil {
+		return "", fmt.Errorf(T("destinationLayout 无效: %w"), err)
+	}
+	// 为空的字段不产生一级目录，如不是plot时 {{.KSize}}/{{.Date}} 只有日期一级
+	var parts []string
+	for _, p := range strings.FieldsFunc(sb.String(), func(r rune) bool { return r == '/' || r == '\\' }) {
+		switch p = strings.TrimSpace(p); p {
+		case "", ".":
+		case "..":
+			return "", fmt.Errorf("%w: %s", errLayout, sb.String())
+		default:
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return dst, nil
+	}
+	dir := filepath.Join(append([]string{dst}, parts...)...)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	layoutDirs.Store(src, dir)
+	return dir, nil
+}
+
+// copiedPath 返回源迁移到目标 dst 后副本的路径
+func copiedPath(src, dst string) string {
+	if dir, ok := layoutDirs.Load(src); ok {
+		dst = dir.(string)
+	}
+	return filepath.Join(dst, sourceName(src))
+}
+
+func validateLayout(layout string) error {
+	if layout == "" {
+		return nil
+	}
+	tmpl, err := parseLayout(layout)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(&strings.Builder{}, LayoutFields{}); err != nil {
+		return fmt.Errorf(T("destinationLayout 无效: %w"), err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package chiamove
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// LimitsConfig 单次运行最多迁移的数量，达到后输出汇总并正常退出，适合由cron定时启动，0 为不限制
+type LimitsConfig struct {
+	MaxPlotsPerRun int      `yaml:"maxPlotsPerRun"`
+	MaxBytesPerRun ByteSize `yaml:"maxBytesPerRun"`
+}
+
+func (l *LimitsConfig) Validate() error {
+	if l.MaxPlotsPerRun < 0 {
+		return fmt.Errorf(T("limits.maxPlotsPerRun 不能小于0: %d"), l.MaxPlotsPerRun)
+	}
+	return nil
+}
+
+// limitExecutors 按本次运行剩余的额度截取 executors，返回空时说明已达到上限
+func (s *Scheduler) limitExecutors(executors []*Executor) []*Executor {
+	limits := s.cfg.Limits
+	moved, bytes := s.stats.Totals()
+	if limits.MaxPlotsPerRun > 0 {
+		executors = executors[:min(len(executors), max(limits.MaxPlotsPerRun-moved, 0))]
+	}
+	if limits.MaxBytesPerRun > 0 {
+		remain := uint64(limits.MaxBytesPerRun) - min(bytes, uint64(limits.MaxBytesPerRun))
+		for i, exe := range executors {
+			if exe.size > remain {
+				executors = executors[:i]
+				break
+			}
+			remain -= exe.size
+		}
+	}
+	if len(executors) == 0 {
+		slog.Info("已达到本次运行的迁移上限", "moved", moved, "bytes", formatBytes(bytes),
+			"maxPlotsPerRun", limits.MaxPlotsPerRun, "maxBytesPerRun", limits.MaxBytesPerRun)
+	}
+	return executors
+}
@@ -0,0 +1,54 @@
+package chiamove
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// 源路径加锁时使用的锁文件名称
+const sourceLockName = ".chiamove.lock"
+
+var errLocked = sentinelError("已被其他进程锁定")
+
+// acquireLocks 按 lock 配置加锁，防止两个进程同时迁移同一批源导致重复复制；
+// config 锁定配置文件本身，source 锁定每个源路径下的 .chiamove.lock。返回的函数释放所有锁
+func acquireLocks(configPath string) (func(), error) {
+	var paths []string
+	switch config.Lock {
+	case "off":
+		return func() {}, nil
+	case "source":
+		for _, p := range expandFromPaths(config.FromPaths) {
+			if isRemoteSource(p) {
+				continue
+			}
+			paths = append(paths, filepath.Join(p, sourceLockName))
+		}
+	default:
+		// 嵌入其他程序时没有配置文件，只能锁定源路径
+		if configPath == "" {
+			return func() {}, nil
+		}
+		paths = []string{configPath}
+	}
+	var unlocks []func()
+	release := func() {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}
+	for _, p := range paths {
+		unlock, err := lockFile(p, config.Lock == "source")
+		if errors.Is(err, errLocked) {
+			release()
+			return nil, fmt.Errorf(T("另一个chiaMove进程正在使用 %s，同一份配置或同一个源路径只能运行一个实例"), p)
+		}
+		if err != nil {
+			release()
+			return nil, fmt.Errorf(T("加锁失败 %s: %w"), p, err)
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return release, nil
+}
@@ -0,0 +1,211 @@
+package chiamove
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+type LoggingConfig struct {
+	Level      string `yaml:"level"`  // debug / info / warn / error
+	Format     string `yaml:"format"` // text / json
+	File       string `yaml:"file"`   // 为空时输出到stderr，交给systemd journal收集
+	MaxSizeMB  int    `yaml:"maxSizeMB"`
+	MaxBackups int    `yaml:"maxBackups"`
+	// 不为空时每个任务另外写一个日志文件，包括rsync的输出、耗时和校验结果
+	TransferDir string `yaml:"transferDir"`
+}
+
+// SetupLogger console 为没有配置日志文件时的输出位置，TUI模式下传入 io.Discard 避免日志打乱界面
+func SetupLogger(cfg LoggingConfig, console io.Writer) (io.Closer, error) {
+	var level slog.Level
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, fmt.Errorf(T("日志级别无效 %q: %w"), cfg.Level, err)
+		}
+	}
+	out := console
+	var closer io.Closer = io.NopCloser(nil)
+	if cfg.File != "" {
+		w, err := newRotatingWriter(cfg.File, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out, closer = w, w
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch cfg.Format {
+	case "", "text":
+		handler = slog.NewTextHandler(out, opts)
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		closer.Close()
+		return nil, fmt.Errorf(T("日志格式无效 %q"), cfg.Format)
+	}
+	slog.SetDefault(slog.New(&recentHandler{Handler: &transferLogHandler{Handler: handler}}))
+	return closer, nil
+}
+
+const maxRecentErrors = 20
+
+var (
+	recentMu     sync.Mutex
+	recentErrors []string
+)
+
+// recentHandler 把日志消息翻译为配置的语言，并额外记录最近的警告和错误，供TUI展示
+type recentHandler struct {
+	slog.Handler
+	attrs []slog.Attr
+}
+
+func (h *recentHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.Message = T(r.Message)
+	if r.Level >= slog.LevelWarn {
+		var b strings.Builder
+		b.WriteString(r.Time.Format("15:04:05") + " " + r.Message)
+		for _, a := range h.attrs {
+			b.WriteString(" " + a.String())
+		}
+		r.Attrs(func(a slog.Attr) bool {
+			b.WriteString(" " + a.String())
+			return true
+		})
+		recentMu.Lock()
+		recentErrors = append(recentErrors, b.String())
+		if len(recentErrors) > maxRecentErrors {
+			recentErrors = recentErrors[len(recentErrors)-maxRecentErrors:]
+		}
+		recentMu.Unlock()
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *recentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &recentHandler{Handler: h.Handler.WithAttrs(attrs), attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *recentHandler) WithGroup(name string) slog.Handler {
+	return &recentHandler{Handler: h.Handler.WithGroup(name), attrs: h.attrs}
+}
+
+func RecentErrors() []string {
+	recentMu.Lock()
+	defer recentMu.Unlock()
+	return append([]string{}, recentErrors...)
+}
+
+// rotatingWriter 按大小切割日志文件，保留 file.1 ... file.N 共 maxBackups 个历史文件
+type rotatingWriter struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingWriter(path string, maxSize int64, maxBackups int) (*rotatingWriter, error) {
+	w := &rotatingWriter{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf(T("打开日志文件失败: %w"), err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size = f, info.Size()
+	return nil
+}
+
+func (w *rotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if w.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", w.path, w.maxBackups))
+		for i := w.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+		}
+		if err := os.Rename(w.path, w.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Truncate(w.path, 0); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+// logWriter 把子进程的输出按行写入日志，避免多个rsync的输出在终端上交错
+type logWriter struct {
+	level slog.Level
+	attrs []any
+	buf   bytes.Buffer
+}
+
+func newLogWriter(level slog.Level, attrs ...any) *logWriter {
+	return &logWriter{level: level, attrs: attrs}
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// 不完整的行放回缓冲区等待后续输出
+			w.buf.WriteString(line)
+			break
+		}
+		w.log(line)
+	}
+	return len(p), nil
+}
+
+func (w *logWriter) Flush() {
+	if w.buf.Len() > 0 {
+		w.log(w.buf.String())
+		w.buf.Reset()
+	}
+}
+
+func (w *logWriter) log(line string) {
+	line = strings.TrimRight(line, "\r\n")
+	if line != "" {
+		slog.Log(context.Background(), w.level, line, w.attrs...)
+	}
+}
@@ -0,0 +1,1010 @@
+package chiamove
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	yaml "gopkg.in/yaml.v2"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	FromPaths []string `yaml:"fromPaths"`
+	ToPaths   []string `yaml:"toPaths"`
+	// 输出机器可读的任务事件: stdout / unix:/path/to.sock，也可以用 --json-events 指定
+	JSONEvents string `yaml:"jsonEvents"`
+	// 启动时对目标上残留的未完成文件的处理
+	Partials PartialsConfig `yaml:"partials"`
+	// 防止多个进程同时迁移: config 锁定配置文件 / source 锁定每个源路径 / off 不加锁
+	Lock string `yaml:"lock"`
+	// 源路径下多个符合条件的条目的迁移顺序: name / oldest / largest
+	SourceOrder string `yaml:"sourceOrder"`
+	// 每个源路径下保留最新的多少个plot不迁移，如短时间在NVMe上耕种，只迁移更早的plot
+	KeepOnSource int `yaml:"keepOnSource"`
+	// 多个源路径的优先顺序: config 按 fromPaths 的顺序 / fullest 已使用比例最高的源盘优先
+	SourcePriority string `yaml:"sourcePriority"`
+	// 每轮调度前按通配符查找目标目录，如 /mnt/farm/disk*，新挂载的硬盘会自动加入
+	ToPathsGlob patternList `yaml:"toPathsGlob"`
+	// 需要单独设置参数的目标路径，其中的路径会合并到 toPaths
+	ToPathsConfig  []DestinationConfig `yaml:"toPathsConfig"`
+	MinFreeReserve ByteSize            `yaml:"minFreeReserve"`
+	// 目标分组，其中的路径会合并到 toPaths
+	DestinationGroups map[string][]string `yaml:"destinationGroups"`
+	// 源路径到目标分组的映射，没有映射的源路径可以使用全部目标
+	Routes []Route `yaml:"routes"`
+	// 要求目标不在系统盘上，避免硬盘没有挂载时写进根分区
+	RequireMount bool `yaml:"requireMount"`
+	// 有多个目标可用时优先选择历史写入速度更快的目标，否则按配置顺序
+	PreferFasterDestinations bool `yaml:"preferFasterDestinations"`
+	// agent:// 目标的访问令牌
+	Agent AgentConfig `yaml:"agent"`
+	// s3:// 目标的服务地址、密钥、分段大小和容量
+	S3 S3Config `yaml:"s3"`
+	// rsync:// 目标的密码文件
+	RsyncDaemon RsyncDaemonConfig `yaml:"rsyncDaemon"`
+	// 进程的nice和IO优先级，需要重启生效
+	Priority PriorityConfig `yaml:"priority"`
+	// 同一块源磁盘上最多同时读取的任务数，0 为不限制
+	MaxReadsPerDevice int `yaml:"maxReadsPerDevice"`
+	FromPathFilter    struct {
+		FilterRule `yaml:",inline"`
+		// 按顺序匹配的多条规则，第一条符合的规则生效，配置后忽略上面的单条规则；
+		// 如同时迁移k32不压缩的文件夹和压缩后的单个plot文件
+		Rules []FilterRule `yaml:"rules"`
+		// 名称符合这些通配符或正则的文件/文件夹不迁移，如 *.tmp、lost+found，对所有规则生效
+		Exclude      []string `yaml:"exclude"`
+		ExcludeRegex []string `yaml:"excludeRegex"`
+		excludeRegex []*regexp.Regexp
+	} `yaml:"fromPathFilter"`
+	// 需要单独设置过滤条件的源路径，其中的路径会合并到 fromPaths
+	FromPathsConfig []SourceConfig `yaml:"fromPathsConfig"`
+	// 复制方式: auto / rsync / native，auto 时优先使用rsync
+	CopyMethod string       `yaml:"copyMethod"`
+	Rsync      RsyncConfig  `yaml:"rsync"`
+	Native     NativeConfig `yaml:"native"`
+	Retry      RetryConfig  `yaml:"retry"`
+	// NFS、CIFS/SMB等网络文件系统上的目标使用的rsync参数、超时和重试次数
+	NetworkFS NetworkFSConfig `yaml:"networkFS"`
+	// 目标上已写入的字节数超过该时长没有增长时终止复制并重试，0 为不检测
+	StallTimeout time.Duration `yaml:"stallTimeout"`
+	// 单个任务（包括重试）的最长时间，超时后终止并按失败处理，0 为不限制
+	TransferTimeout time.Duration `yaml:"transferTimeout"`
+	// 任务日志文件，记录排队、迁移中、已完成的任务，重启后据此续传
+	JournalFile string `yaml:"journalFile"`
+	// 迁移历史，可以用 chiamove history 按天或目标路径统计
+	History HistoryConfig `yaml:"history"`
+	// 统计源文件夹大小时对符号链接、挂载点和读取错误的处理
+	DirSize DirSizeConfig `yaml:"dirSize"`
+	// toPaths 中 ssh://user@host:/path 形式的远程目标使用的ssh参数
+	SSH      SSHConfig      `yaml:"ssh"`
+	API      APIConfig      `yaml:"api"`
+	Throttle ThrottleConfig `yaml:"throttle"`
+	// 允许开始迁移的时间段及各时间段的限速
+	Schedule ScheduleConfig `yaml:"schedule"`
+	Staging  StagingConfig  `yaml:"staging"`
+	// 目标上已经存在同名plot时的处理方式
+	Duplicates DuplicatesConfig `yaml:"duplicates"`
+	// 连续失败的目标暂停使用，定时测试写入后恢复
+	DestinationHealth DestinationHealthConfig `yaml:"destinationHealth"`
+	// 按SMART状态拒绝写入有坏扇区的目标硬盘
+	SMART SMARTConfig `yaml:"smart"`
+	// fromPaths 中HTTP(S)源的请求头等设置
+	HTTPSource HTTPSourceConfig `yaml:"httpSource"`
+	// 迁移完成的源先移到回收站，过一段时间再删除
+	Trash TrashConfig `yaml:"trash"`
+	// 迁移失败的源的处理方式
+	Failed    FailedConfig    `yaml:"failed"`
+	Notify    NotifyConfig    `yaml:"notify"`
+	PlotCheck PlotCheckConfig `yaml:"plotCheck"`
+	// 选择源之前检查plot文件头，跳过或标记截断、无效的plot
+	HeaderCheck HeaderCheckConfig `yaml:"headerCheck"`
+	Harvester   HarvesterConfig   `yaml:"harvester"`
+	// 迁移开始前后、失败和全部完成时执行的外部命令
+	Hooks HooksConfig `yaml:"hooks"`
+	// 删除源之前比较源和目标：none 不校验，sample 比较大小和抽样块的哈希，full 比较完整文件的哈希
+	Verify       string             `yaml:"verify"`
+	VerifySample VerifySampleConfig `yaml:"verifySample"`
+	// 迁移完成后是否删除源: always / afterVerify 只在目标上的副本经过 verify 或 plotCheck 校验后删除 / never 只复制
+	DeletePolicy string `yaml:"deletePolicy"`
+	// 目标盘上存放plot的子目录模板，如 {{.KSize}}/{{.Date}}，为空时直接放在目标路径下
+	DestinationLayout string `yaml:"destinationLayout"`
+	// 在目标上维护迁入文件的清单，供 verify-manifest 检查
+	Manifest ManifestConfig `yaml:"manifest"`
+	// 单次运行最多迁移的plot数量和大小
+	Limits LimitsConfig `yaml:"limits"`
+	// 按吞吐量自动调整同时进行的任务数
+	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+	// 各压缩等级的plot大小
+	PlotSize PlotSizeConfig `yaml:"plotSize"`
+	// 只打印迁移计划，不实际复制，也可以用 --dry-run 指定
+	DryRun bool `yaml:"dryRun"`
+	// 源盘已空或目标已满时不退出，定时重新扫描，也可以用 --daemon 指定
+	Daemon bool `yaml:"daemon"`
+	// 守护模式下没有可迁移的源时重新扫描的间隔，默认30s；连续空闲时每次翻倍，最长 maxScanInterval（默认10m），
+	// 避免在大目录上反复遍历。有新任务、被唤醒或重新加载配置后恢复为 scanInterval
+	ScanInterval    time.Duration `yaml:"scanInterval"`
+	MaxScanInterval time.Duration `yaml:"maxScanInterval"`
+	// 同时扫描的源路径数，默认8，源路径在网络挂载上时可以调大
+	ScanWorkers int `yaml:"scanWorkers"`
+	// 该文件存在时暂停调度，删除后恢复，默认为工作目录下的 PAUSE
+	PauseFile string `yaml:"pauseFile"`
+	// 守护模式下新挂载的硬盘自动加入目标
+	Hotplug HotplugConfig `yaml:"hotplug"`
+	// 目标全部已满时等待换盘，有新的可用空间后自动继续
+	DiskSwap DiskSwapConfig `yaml:"diskSwap"`
+	// 源盘剩余空间不足时执行钩子（如暂停plotter），迁移走plot后恢复
+	SourceSpace SourceSpaceConfig `yaml:"sourceSpace"`
+	// 配置文件修改后自动重新加载，也可以发送SIGHUP手动触发
+	WatchConfig bool `yaml:"watchConfig"`
+	// 输出迁移进度的间隔，0 为不输出
+	ProgressInterval *time.Duration `yaml:"progressInterval"`
+	// 日志和命令输出的语言: zh / en，为空时按 LANG 环境变量判断
+	Language string `yaml:"language"`
+	// 守护模式下输出运行汇总的间隔，0 为只在退出时输出
+	SummaryInterval *time.Duration `yaml:"summaryInterval"`
+	Logging         LoggingConfig  `yaml:"logging"`
+	// 多级迁移，每一级在单独的进程中运行，上一级的目标作为下一级的源
+	Stages []Stage `yaml:"stages"`
+	// 命名的配置组合（如不同的源、目标和过滤条件），--profile 只运行其中一个，不指定时每个在单独的进程中同时运行
+	Profiles []Stage `yaml:"profiles"`
+}
+
+// move 的退出码，供包装脚本和cron判断结果
+const (
+	exitOK             = 0 // 源盘已空或收到退出信号，没有失败的任务
+	exitError          = 1 // 初始化日志、读取任务日志等运行时错误
+	exitPartialFailure = 2 // 有迁移失败的任务，优先于其他结果
+	exitConfigError    = 3 // 命令行参数或配置无效
+	exitNoDestinations = 4 // 没有可用的目标，目标全部已满或不可用
+)
+
+var config *Config
+var journal *Journal
+
+func ReadConfig(filename string) (*Config, error) {
+	return readConfig(filename, "", "")
+}
+
+// readConfig 读取配置，profile 不为空时使用 profiles 中对应的配置，stage 不为空时再使用 stages 中对应一级的配置
+func readConfig(filename, profile, stage string) (*Config, error) {
+	buf, err := loadConfigFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	err = yaml.Unmarshal(buf, &config)
+	if err != nil {
+		return nil, err
+	}
+	if profile != "" {
+		if err := config.applyProfile(profile); err != nil {
+			return nil, err
+		}
+	}
+	if stage != "" {
+		if err := config.applyStage(stage); err != nil {
+			return nil, err
+		}
+	}
+	config.applyDefaults()
+	if err := config.compile(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// compile 编译过滤规则中的正则表达式，可以重复调用
+func (c *Config) compile() error {
+	c.FromPathFilter.excludeRegex = nil
+	for _, expr := range c.FromPathFilter.ExcludeRegex {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf(T("fromPathFilter.excludeRegex 无效 %q: %w"), expr, err)
+		}
+		c.FromPathFilter.excludeRegex = append(c.FromPathFilter.excludeRegex, re)
+	}
+	if err := c.FromPathFilter.compile(); err != nil {
+		return err
+	}
+	for i := range c.FromPathFilter.Rules {
+		if err := c.FromPathFilter.Rules[i].compile(); err != nil {
+			return err
+		}
+	}
+	for i := range c.FromPathsConfig {
+		s := &c.FromPathsConfig[i]
+		if s.Filter != nil {
+			if err := s.Filter.compile(); err != nil {
+				return err
+			}
+		}
+		for j := range s.Rules {
+			if err := s.Rules[j].compile(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) applyDefaults() {
+	for i := range c.FromPathsConfig {
+		s := &c.FromPathsConfig[i]
+		if !slices.Contains(c.FromPaths, s.Path) {
+			c.FromPaths = append(c.FromPaths, s.Path)
+		}
+		if s.Filter != nil && s.Filter.Name == "" {
+			s.Filter.Name = fmt.Sprintf("fromPathsConfig[%d].filter", i)
+		}
+		for j := range s.Rules {
+			if s.Rules[j].Name == "" {
+				s.Rules[j].Name = fmt.Sprintf("fromPathsConfig[%d].rules[%d]", i, j)
+			}
+		}
+	}
+	for _, d := range c.ToPathsConfig {
+		if !slices.Contains(c.ToPaths, d.Path) {
+			c.ToPaths = append(c.ToPaths, d.Path)
+		}
+	}
+	groups := make([]string, 0, len(c.DestinationGroups))
+	for name := range c.DestinationGroups {
+		groups = append(groups, name)
+	}
+	slices.Sort(groups)
+	for _, name := range groups {
+		for _, p := range c.DestinationGroups[name] {
+			if !slices.Contains(c.ToPaths, p) {
+				c.ToPaths = append(c.ToPaths, p)
+			}
+		}
+	}
+	if c.FromPathFilter.Name == "" {
+		c.FromPathFilter.Name = "fromPathFilter"
+	}
+	for i := range c.FromPathFilter.Rules {
+		if c.FromPathFilter.Rules[i].Name == "" {
+			c.FromPathFilter.Rules[i].Name = fmt.Sprintf("rules[%d]", i)
+		}
+	}
+	if c.Rsync.Binary == "" {
+		c.Rsync.Binary = "rsync"
+	}
+	if c.Rsync.Args == nil {
+		c.Rsync.Args = defaultRsyncArgs
+	}
+	if c.Native.Streams <= 0 {
+		c.Native.Streams = 1
+	}
+	if c.Native.Preallocate == nil {
+		preallocate := true
+		c.Native.Preallocate = &preallocate
+	}
+	if c.Native.ZeroCopy == nil {
+		zeroCopy := true
+		c.Native.ZeroCopy = &zeroCopy
+	}
+	if c.Concurrency.Min == 0 {
+		c.Concurrency.Min = 1
+	}
+	if c.Concurrency.Max == 0 {
+		c.Concurrency.Max = max(4, c.Concurrency.Min)
+	}
+	if c.Concurrency.CollapsePercent == 0 {
+		c.Concurrency.CollapsePercent = 25
+	}
+	if c.Native.BufferSize <= 0 {
+		c.Native.BufferSize = 8 << 20
+	}
+	if c.Native.DropCache == nil {
+		dropCache := true
+		c.Native.DropCache = &dropCache
+	}
+	if c.Native.MinParallelSize == 0 {
+		c.Native.MinParallelSize = 1 << 30
+	}
+	if c.Retry.MaxAttempts <= 0 {
+		c.Retry.MaxAttempts = 3
+	}
+	if c.PlotSize.Tolerance <= 0 {
+		c.PlotSize.Tolerance = 2
+	}
+	if c.SMART.Binary == "" {
+		c.SMART.Binary = "smartctl"
+	}
+	if c.SMART.MaxReallocated == nil {
+		reallocated := 100
+		c.SMART.MaxReallocated = &reallocated
+	}
+	if c.SMART.MaxPending == nil {
+		pending := 0
+		c.SMART.MaxPending = &pending
+	}
+	if c.SMART.Interval <= 0 {
+		c.SMART.Interval = time.Hour
+	}
+	if c.Trash.Retention <= 0 {
+		c.Trash.Retention = 24 * time.Hour
+	}
+	if c.ScanInterval <= 0 {
+		c.ScanInterval = daemonPollInterval
+	}
+	if c.MaxScanInterval <= 0 {
+		c.MaxScanInterval = 10 * time.Minute
+	}
+	if c.ScanWorkers <= 0 {
+		c.ScanWorkers = 8
+	}
+	if c.DiskSwap.CheckInterval <= 0 {
+		c.DiskSwap.CheckInterval = 10 * time.Second
+	}
+	if c.Hooks.Timeout <= 0 {
+		c.Hooks.Timeout = 5 * time.Minute
+	}
+	if c.NetworkFS.WholeFile == nil {
+		wholeFile := true
+		c.NetworkFS.WholeFile = &wholeFile
+	}
+	if c.NetworkFS.Timeout == 0 {
+		c.NetworkFS.Timeout = 10 * time.Minute
+	}
+	if c.NetworkFS.MaxAttempts <= 0 {
+		c.NetworkFS.MaxAttempts = 10
+	}
+	if c.Retry.InitialDelay <= 0 {
+		c.Retry.InitialDelay = 30 * time.Second
+	}
+	if c.Staging.TempSuffixes == nil {
+		c.Staging.TempSuffixes = []string{".tmp"}
+	}
+	if c.ProgressInterval == nil {
+		interval := 10 * time.Second
+		c.ProgressInterval = &interval
+	}
+	if c.Duplicates.Action == "" {
+		c.Duplicates.Action = "skip"
+	}
+	if c.Failed.Action == "" {
+		c.Failed.Action = "skip"
+	}
+	if c.HeaderCheck.Action == "" {
+		c.HeaderCheck.Action = "skip"
+	}
+	if c.PlotCheck.Binary == "" {
+		c.PlotCheck.Binary = "chia"
+	}
+	if c.PlotCheck.Challenges <= 0 {
+		c.PlotCheck.Challenges = 30
+	}
+	if c.Harvester.Refresh == "" {
+		c.Harvester.Refresh = "off"
+	}
+	if c.Harvester.URL == "" {
+		c.Harvester.URL = "https://localhost:8560"
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		ssl := filepath.Join(home, ".chia", "mainnet", "config", "ssl", "harvester")
+		if c.Harvester.Cert == "" {
+			c.Harvester.Cert = filepath.Join(ssl, "private_harvester.crt")
+		}
+		if c.Harvester.Key == "" {
+			c.Harvester.Key = filepath.Join(ssl, "private_harvester.key")
+		}
+	}
+	if c.Harvester.Binary == "" {
+		c.Harvester.Binary = "chia"
+	}
+	if c.S3.Endpoint == "" {
+		c.S3.Endpoint = "https://s3.amazonaws.com"
+	}
+	if c.S3.Region == "" {
+		c.S3.Region = "us-east-1"
+	}
+	if c.S3.PartSize == 0 {
+		c.S3.PartSize = 64 << 20
+	}
+	if c.Partials.Action == "" {
+		c.Partials.Action = "resume"
+	}
+	// 其他实例或同一目标上的其他进程的任务不在本进程的任务日志中，只能按修改时间区分
+	if c.Partials.OlderThan <= 0 {
+		c.Partials.OlderThan = time.Hour
+	}
+	if c.Lock == "" {
+		c.Lock = "config"
+	}
+	if c.SourceOrder == "" {
+		c.SourceOrder = "name"
+	}
+	if c.SourcePriority == "" {
+		c.SourcePriority = "config"
+	}
+	if c.Verify == "" {
+		c.Verify = "none"
+	}
+	if c.DeletePolicy == "" {
+		c.DeletePolicy = "always"
+	}
+	if c.VerifySample.HeadTail == 0 {
+		c.VerifySample.HeadTail = 16 << 20
+	}
+	if c.VerifySample.Blocks == 0 {
+		c.VerifySample.Blocks = 16
+	}
+	if c.VerifySample.BlockSize == 0 {
+		c.VerifySample.BlockSize = 1 << 20
+	}
+	if c.DestinationHealth.MaxFailures == nil {
+		failures := 3
+		c.DestinationHealth.MaxFailures = &failures
+	}
+	if c.DestinationHealth.ProbeInterval <= 0 {
+		c.DestinationHealth.ProbeInterval = 5 * time.Minute
+	}
+	if c.JournalFile == "" {
+		c.JournalFile = "chiamove-journal.json"
+	}
+	if c.SummaryInterval == nil {
+		interval := time.Hour
+		c.SummaryInterval = &interval
+	}
+	if c.PauseFile == "" {
+		c.PauseFile = "PAUSE"
+	}
+	if c.Hotplug.Interval <= 0 {
+		c.Hotplug.Interval = 5 * time.Second
+	}
+	if c.SourceSpace.Interval <= 0 {
+		c.SourceSpace.Interval = 30 * time.Second
+	}
+	if c.SourceSpace.ResumeFree == 0 {
+		c.SourceSpace.ResumeFree = 2 * c.SourceSpace.MinFree
+	}
+	if c.History.File == "" {
+		c.History.File = "chiamove-history.jsonl"
+	}
+	if c.Retry.MaxDelay < c.Retry.InitialDelay {
+		c.Retry.MaxDelay = max(10*time.Minute, c.Retry.InitialDelay)
+	}
+}
+
+// Validate 检查启动和重新加载配置时必须满足的条件
+func (c *Config) Validate() error {
+	if len(c.FromPaths) == 0 {
+		return errors.New(T("fromPaths 不能为空"))
+	}
+	if len(c.ToPaths) == 0 && len(c.ToPathsGlob) == 0 && c.Hotplug.Pattern == "" {
+		return errors.New(T("toPaths、toPathsGlob 和 hotplug.pattern 不能都为空"))
+	}
+	if _, err := filepath.Match(c.Hotplug.Pattern, ""); err != nil {
+		return fmt.Errorf(T("hotplug.pattern 无效 %q: %w"), c.Hotplug.Pattern, err)
+	}
+	if c.SourceSpace.MinFree > 0 && c.SourceSpace.ResumeFree < c.SourceSpace.MinFree {
+		return errors.New(T("sourceSpace.resumeFree 不能小于 minFree"))
+	}
+	if c.MaxScanInterval < c.ScanInterval {
+		return fmt.Errorf(T("maxScanInterval(%s) 不能小于 scanInterval(%s)"), c.MaxScanInterval, c.ScanInterval)
+	}
+	for _, pattern := range c.FromPathFilter.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf(T("fromPathFilter.exclude 无效 %q: %w"), pattern, err)
+		}
+	}
+	for _, p := range c.FromPaths {
+		if _, err := filepath.Match(p, ""); err != nil && !isRemoteSource(p) {
+			return fmt.Errorf(T("fromPaths 中的通配符无效 %q: %w"), p, err)
+		}
+	}
+	for _, pattern := range c.ToPathsGlob {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf(T("toPathsGlob 无效 %q: %w"), pattern, err)
+		}
+	}
+	for _, p := range c.FromPaths {
+		for _, r := range c.filterRules(p) {
+			// 只按估算大小过滤时可以不设置 minSize/maxSize
+			if r.MinSize >= r.MaxSize && !(r.ExpectedSize && r.MaxSize == 0) {
+				return fmt.Errorf(T("过滤规则 %s 的 minSize(%s) 必须小于 maxSize(%s)"), r.Name, r.MinSize, r.MaxSize)
+			}
+			if r.MinAgeMinutes < 0 {
+				return fmt.Errorf(T("过滤规则 %s 的 minAgeMinutes 不能为负数"), r.Name)
+			}
+		}
+	}
+	for i := range c.Routes {
+		r := &c.Routes[i]
+		if _, ok := c.DestinationGroups[r.Group]; !ok {
+			return fmt.Errorf(T("routes 中源路径 %s 对应的目标分组 %q 不存在"), r.From, r.Group)
+		}
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	switch c.CopyMethod {
+	case "", "auto", "rsync", "native":
+	default:
+		return fmt.Errorf(T("copyMethod 无效 %q"), c.CopyMethod)
+	}
+	switch c.Duplicates.Action {
+	case "skip", "quarantine", "off":
+	default:
+		return fmt.Errorf(T("duplicates.action 无效 %q"), c.Duplicates.Action)
+	}
+	switch c.Failed.Action {
+	case "skip", "rename":
+	case "quarantine":
+		if c.Failed.QuarantineDir == "" {
+			return errors.New(T("failed.action 为 quarantine 时需要设置 failed.quarantineDir"))
+		}
+	default:
+		return fmt.Errorf(T("failed.action 无效 %q"), c.Failed.Action)
+	}
+	switch c.HeaderCheck.Action {
+	case "skip", "fail":
+	default:
+		return fmt.Errorf(T("headerCheck.action 无效 %q，可选 skip / fail"), c.HeaderCheck.Action)
+	}
+	for _, d := range c.ToPathsConfig {
+		if d.MaxUsedPercent < 0 || d.MaxUsedPercent > 100 {
+			return fmt.Errorf(T("目标 %s 的 maxUsedPercent 必须在 0-100 之间: %v"), d.Path, d.MaxUsedPercent)
+		}
+		if _, ok := parseAgent(d.UsageAgent); d.UsageAgent != "" && !ok {
+			return fmt.Errorf(T("目标 %s 的 usageAgent 需要是 agent:// 或 agents:// 形式: %s"), d.Path, d.UsageAgent)
+		}
+	}
+	for _, p := range c.ToPaths {
+		if _, ok := parseRsyncDaemon(p); ok && !slices.ContainsFunc(c.ToPathsConfig, func(d DestinationConfig) bool {
+			return d.Path == p && (d.UsageAgent != "" || d.Capacity > 0)
+		}) {
+			return fmt.Errorf(T("rsync:// 目标 %s 需要在 toPathsConfig 中设置 usageAgent 或 capacity"), p)
+		}
+	}
+	if _, err := agentTLSConfig(c.Agent); err != nil {
+		return err
+	}
+	if c.S3.PartSize < s3MinPartSize {
+		return fmt.Errorf(T("s3.partSize 不能小于 5MiB: %s"), formatBytes(uint64(c.S3.PartSize)))
+	}
+	if c.API.Listen != "" && c.API.Token == "" && !loopbackListen(c.API.Listen) {
+		return fmt.Errorf(T("api.listen %s 不是本机地址，需要设置 api.token"), c.API.Listen)
+	}
+	if c.JSONEvents != "" && c.JSONEvents != "stdout" && !strings.HasPrefix(c.JSONEvents, "unix:") {
+		return fmt.Errorf(T("jsonEvents 无效 %q，可选 stdout 或 unix:/path/to.sock"), c.JSONEvents)
+	}
+	switch c.Partials.Action {
+	case "remove", "resume", "off":
+	default:
+		return fmt.Errorf(T("partials.action 无效 %q，可选 remove / resume / off"), c.Partials.Action)
+	}
+	switch c.Lock {
+	case "config", "source", "off":
+	default:
+		return fmt.Errorf(T("lock 无效 %q，可选 config / source / off"), c.Lock)
+	}
+	if c.KeepOnSource < 0 {
+		return fmt.Errorf(T("keepOnSource 不能小于0: %d"), c.KeepOnSource)
+	}
+	switch c.SourceOrder {
+	case "name", "oldest", "largest":
+	default:
+		return fmt.Errorf(T("sourceOrder 无效 %q，可选 name / oldest / largest"), c.SourceOrder)
+	}
+	switch c.SourcePriority {
+	case "config", "fullest":
+	default:
+		return fmt.Errorf(T("sourcePriority 无效 %q，可选 config / fullest"), c.SourcePriority)
+	}
+	switch c.Verify {
+	case "none", "sample", "full":
+	default:
+		return fmt.Errorf(T("verify 无效 %q，可选 none / sample / full"), c.Verify)
+	}
+	switch c.DeletePolicy {
+	case "always", "never":
+	case "afterVerify":
+		if c.Verify == "none" && !c.PlotCheck.Enabled {
+			return errors.New(T("deletePolicy 为 afterVerify 时需要设置 verify 或打开 plotCheck"))
+		}
+	default:
+		return fmt.Errorf(T("deletePolicy 无效 %q，可选 always / afterVerify / never"), c.DeletePolicy)
+	}
+	if err := c.Concurrency.Validate(); err != nil {
+		return err
+	}
+	if err := validateLayout(c.DestinationLayout); err != nil {
+		return err
+	}
+	if err := c.Priority.Validate(); err != nil {
+		return err
+	}
+	if err := c.Schedule.Validate(); err != nil {
+		return err
+	}
+	if err := c.Limits.Validate(); err != nil {
+		return err
+	}
+	if err := c.Harvester.Validate(); err != nil {
+		return err
+	}
+	if c.Trash.UntilFarmed && c.Harvester.Refresh == "off" {
+		return errors.New(T("trash.untilFarmed 需要设置 harvester.refresh 为 rpc 或 command"))
+	}
+	switch c.Language {
+	case "", "zh", "en":
+	default:
+		return fmt.Errorf(T("language 无效 %q，可选 zh / en"), c.Language)
+	}
+	if m := c.Notify.MQTT; m != nil && m.Broker != "" {
+		if err := m.validate(); err != nil {
+			return err
+		}
+	}
+	if e := c.Notify.Email; e != nil && e.Host != "" && (e.From == "" || len(e.To) == 0) {
+		return errors.New(T("notify.email 需要设置 from 和 to"))
+	}
+	return nil
+}
+
+// isExcluded 判断源路径下的条目名称是否符合 fromPathFilter 的排除规则
+func isExcluded(c *Config, name string) bool {
+	for _, pattern := range c.FromPathFilter.Exclude {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	for _, re := range c.FromPathFilter.excludeRegex {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+type Executor struct {
+	fromPath string
+	toPath   string
+	size     uint64
+}
+
+// configMu 保护重新加载时替换的 config 以及按 toPathsGlob、hotplug、API 变化的目标列表
+var configMu sync.Mutex
+
+var errNoCandidate = sentinelError("未获取到符合条件的文件或文件夹")
+
+// getCanMovePath 按 sourceOrder 返回 fromPath 下第一个符合过滤条件且不被 skip 排除的文件或文件夹及其大小
+func (s *Scheduler) getCanMovePath(fromPath string, skip func(path string, isDir bool) bool) (string, uint64, error) {
+	if isHTTPSource(fromPath) {
+		return getHTTPCandidate(s.cfg, fromPath, skip)
+	}
+	if isSSHSource(fromPath) {
+		return getSSHCandidate(s.cfg, fromPath, skip)
+	}
+	entries, err := s.fsys.ReadDir(fromPath)
+	if err != nil {
+		return "", 0, err
+	}
+	entries = s.sortEntries(fromPath, entries)
+	kept := s.keptOnSource(fromPath, entries)
+	for _, entry := range entries {
+		filename := entry.Name()
+		relativePath := filepath.Join(fromPath, entry.Name())
+		if isExcluded(s.cfg, filename) || isTrashDir(s.cfg, fromPath, relativePath) || filename == manifestFile {
+			continue
+		}
+		if kept[relativePath] {
+			slog.Debug("按 keepOnSource 保留在源上", "path", relativePath)
+			continue
+		}
+		rules := matchingRules(s.cfg, relativePath, entry)
+		if len(rules) == 0 {
+			continue
+		}
+		if skip(relativePath, entry.IsDir()) {
+			continue
+		}
+		if staging, reason := s.isStaging(relativePath); staging {
+			slog.Debug("跳过仍在写入的路径", "path", relativePath, "reason", reason)
+			continue
+		}
+		size, err := s.queue.Measure(relativePath, entry, s.dirSize)
+		if err != nil {
+			s.stats.ScanFailed(relativePath, err)
+			continue
+		}
+		s.stats.ScanSucceeded(relativePath)
+		if !s.headerCheckPassed(relativePath, entry.IsDir()) {
+			continue
+		}
+		for _, r := range rules {
+			if r.matchSize(s.cfg.PlotSize, relativePath, entry.IsDir(), size) {
+				slog.Debug("符合过滤规则", "path", relativePath, "rule", r.Name, "size", size)
+				return relativePath, size, nil
+			}
+		}
+	}
+	return "", 0, errNoCandidate
+}
+
+// CopySourceToDestination 按已加载的配置把 src 迁移到目标 dst
+func CopySourceToDestination(ctx context.Context, src, dst string) error {
+	return NewScheduler(currentConfig(), slog.Default()).copySource(ctx, src, dst)
+}
+
+// copySource 复制一次 src 到目标 dst，按 deletePolicy 校验后移走源
+func (s *Scheduler) copySource(ctx context.Context, src, dst string) error {
+	c := s.cfg
+	disk := dst
+	dst, err := layoutDestination(c, src, dst)
+	if err != nil {
+		return err
+	}
+	if isHTTPSource(src) {
+		if err := downloadHTTPSource(ctx, c, src, dst); err != nil {
+			return err
+		}
+		recordManifest(c, disk, filepath.Join(dst, sourceName(src)))
+		return nil
+	}
+	if isSSHSource(src) {
+		if err := pullSSHSource(ctx, c, src, dst); err != nil {
+			return err
+		}
+		recordManifest(c, disk, filepath.Join(dst, sourceName(src)))
+		return nil
+	}
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return fmt.Errorf(T("源路径不存在: %w"), err)
+	}
+	if overlaps(src, dst) && !isRemoteDest(dst) {
+		return fmt.Errorf("%w: %s, %s", errOverlap, src, dst)
+	}
+	// 同一个文件系统上rename后源就不在了，保留源时只能复制；注入故障时也走复制流程
+	if c.DeletePolicy != "never" && s.faults == nil && renameToDestination(src, dst) {
+		recordManifest(c, disk, filepath.Join(dst, filepath.Base(src)))
+		return nil
+	}
+	transport := s.transport(dst)
+	if s.faults != nil {
+		transport = faultTransport{transport, s.faults}
+	}
+	if err := transport.Resume(src, dst, s.journal.Interrupted(src, disk)); err != nil {
+		return err
+	}
+	copyCtx, cancel := context.WithCancel(ctx)
+	stalled := watchStall(c, src, dst, cancel)
+	err = transport.Copy(copyCtx, src, dst)
+	cancel()
+	if stalled() {
+		return fmt.Errorf("%w(%s): %v", errStalled, c.StallTimeout, err)
+	}
+	if err != nil {
+		return err
+	}
+	if err := transport.Verify(ctx, src, dst); err != nil {
+		return err
+	}
+	if err := s.checkCopiedSize(src, dst); err != nil {
+		return err
+	}
+	verified := false
+	if c.Verify != "none" && verifiable(dst) {
+		verified = true
+		slog.Debug("校验通过", "src", src, "dst", dst, "method", c.Verify)
+		s.events.Emit(TransferEvent{Type: "verified", Src: src, Dst: dst, Method: c.Verify})
+	}
+	if c.PlotCheck.Enabled {
+		// chia只识别 .plot 文件，只能在改为最终名称后校验
+		if err := checkDestinationPlots(ctx, c, src, dst); err != nil {
+			return err
+		}
+		if verifiable(dst) {
+			verified = true
+			slog.Debug("校验通过", "src", src, "dst", dst, "method", "plotcheck")
+			s.events.Emit(TransferEvent{Type: "verified", Src: src, Dst: dst, Method: "plotcheck"})
+		}
+	}
+	recordManifest(c, disk, filepath.Join(dst, filepath.Base(src)))
+	switch {
+	case c.DeletePolicy == "never":
+		slog.Info("按 deletePolicy 保留源", "path", src, "policy", c.DeletePolicy)
+		return nil
+	case c.DeletePolicy == "afterVerify" && !verified:
+		slog.Warn("目标上的副本没有经过校验，按 deletePolicy 保留源", "path", src, "dst", dst, "policy", c.DeletePolicy)
+		return nil
+	}
+	if err := removeSource(c, src, dst); err != nil {
+		return fmt.Errorf(T("删除源目录出错: %w"), err)
+	}
+	return nil
+}
+
+// renameToDestination 源和目标在同一个文件系统上时直接rename，几乎瞬间完成；
+// 目标上已有同名文件（上次复制了一部分）或rename失败时返回false，继续走复制流程
+func renameToDestination(src, dst string) bool {
+	if isRemoteDest(dst) || !sameFilesystem(src, dst) {
+		return false
+	}
+	target := filepath.Join(dst, filepath.Base(src))
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		return false
+	}
+	if err := os.Rename(src, target); err != nil {
+		slog.Debug("rename失败，改为复制", "from", src, "to", target, "err", err)
+		return false
+	}
+	slog.Info("源和目标在同一文件系统，已直接rename", "from", src, "to", target)
+	return true
+}
+
+var wakeCh = make(chan struct{}, 1)
+
+// wake 让空闲等待中的调度立即重新扫描
+func wake() {
+	select {
+	case wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// Main 命令行入口，执行子命令后以对应的退出码结束进程
+func Main() {
+	// 没有指定子命令时为 move，兼容以前的用法
+	cmd, args := "move", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	var code int
+	switch cmd {
+	case "move":
+		code = runMove(args)
+	case "validate":
+		code = runValidate(args)
+	case "status":
+		code = runStatus(args)
+	case "clean":
+		code = runClean(args)
+	case "history":
+		code = runHistory(args)
+	case "systemd-install":
+		code = runSystemdInstall(args)
+	case "agent":
+		code = runAgent(args)
+	case "simulate":
+		code = runSimulate(args)
+	case "verify-manifest":
+		code = runVerifyManifest(args)
+	case "retry-failed":
+		code = runRetryFailed(args)
+	case "rebalance":
+		code = runRebalance(args)
+	default:
+		fmt.Fprintf(os.Stderr, T("未知的子命令 %q，可选 move / validate / status / clean / history / systemd-install / agent / simulate / verify-manifest / retry-failed / rebalance\n"), cmd)
+		code = exitConfigError
+	}
+	os.Exit(code)
+}
+
+// runMove 按配置持续迁移，直到源盘已空或目标已满（守护模式下不退出）
+func runMove(args []string) int {
+	opts, err := ParseOptions(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		return exitConfigError
+	}
+	config, err = readConfig(opts.ConfigPath, opts.Profile, opts.Stage)
+	if err != nil {
+		slog.Error("读取配置失败", "err", err)
+		return exitConfigError
+	}
+	if len(config.Profiles) > 0 {
+		return runProfiles(opts, args)
+	}
+	if len(config.Stages) > 0 {
+		return runStages(opts, args)
+	}
+	opts.Apply(config)
+	if err := config.Validate(); err != nil {
+		slog.Error("配置无效", "err", err)
+		return exitConfigError
+	}
+	if opts.Faults != "" {
+		if faults, err = parseFaults(opts.Faults); err != nil {
+			slog.Error("配置无效", "err", err)
+			return exitConfigError
+		}
+	}
+	if opts.TUI && config.JSONEvents == "stdout" {
+		slog.Error("配置无效", "err", T("--tui 和输出到标准输出的 --json-events 不能同时使用"))
+		return exitConfigError
+	}
+	var console io.Writer = os.Stderr
+	if opts.TUI {
+		console = io.Discard
+	}
+	logCloser, err := SetupLogger(config.Logging, console)
+	if err != nil {
+		slog.Error("初始化日志失败", "err", err)
+		return exitError
+	}
+	defer logCloser.Close()
+	if opts.Profile != "" {
+		slog.SetDefault(slog.Default().With("profile", opts.Profile))
+	}
+	if opts.Stage != "" {
+		slog.SetDefault(slog.Default().With("stage", opts.Stage))
+	}
+	if faults != nil {
+		slog.Warn("已启用故障注入，仅用于测试", "faults", opts.Faults)
+	}
+	applyPriority(config.Priority)
+	code, err := (&Mover{cfg: config, opts: opts}).run(shutdownContext())
+	if err != nil {
+		slog.Error("无法启动", "err", err)
+		return exitError
+	}
+	return code
+}
+
+// run 启动后台任务后持续调度，返回退出码；启动失败时返回错误
+func (m *Mover) run(ctx context.Context) (int, error) {
+	opts := m.opts
+	unlock, err := acquireLocks(opts.ConfigPath)
+	if err != nil {
+		return exitError, err
+	}
+	defer unlock()
+	applyRuntimeConfig()
+	destSpeeds.LoadHistory(config.History.File)
+	journal, err = OpenJournal(config.JournalFile)
+	if err != nil {
+		return exitError, fmt.Errorf(T("读取任务日志失败: %w"), err)
+	}
+	if config.API.Listen != "" {
+		StartAPIServer(config.API.Listen, config.API.Token)
+	}
+	if config.JSONEvents != "" {
+		if err := StartEventStream(config.JSONEvents); err != nil {
+			return exitError, fmt.Errorf(T("启动事件输出失败: %w"), err)
+		}
+	}
+	sched := NewScheduler(config, slog.Default())
+	defer StartMQTT()()
+	if *config.ProgressInterval > 0 {
+		StartProgressReporter(*config.ProgressInterval)
+	}
+	if opts.TUI {
+		stopTUI := StartTUI(time.Second, sched.ShouldSkip)
+		defer stopTUI()
+	}
+	StartPauseFileWatcher(config.PauseFile)
+	StartEmailDigest()
+	defer SendDigest()
+	defer runStats.Log()
+	defer WaitHarvesterRefresh()
+	if config.Daemon && *config.SummaryInterval > 0 {
+		StartSummaryReporter(*config.SummaryInterval)
+	}
+	if config.Daemon {
+		StartHotplugWatcher()
+	}
+	discoverDestinations(config)
+	logNetworkDestinations(destinations())
+	cleanStalePartials(config, journal, destinations())
+	defer StartTrashPurger(ctx)()
+	StartWatchdog(ctx, sched.Stuck)
+	defer StartSourceSpaceWatchdog(ctx)()
+	sdNotify("READY=1")
+	defer sdNotify("STOPPING=1")
+	return sched.Loop(ctx, opts), nil
+}
@@ -0,0 +1,231 @@
+package chiamove
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ManifestConfig 在每个本地目标的根目录维护清单文件，迁移成功后追加迁入文件的名称、大小和SHA-256，
+// 供 verify-manifest 子命令定期检查目标盘上的文件有没有损坏
+type ManifestConfig struct {
+	// 计算SHA-256会多读一遍目标上的副本
+	Enabled bool `yaml:"enabled"`
+}
+
+// 目标根目录下的清单文件，每行一个 ManifestEntry，同名文件以最后一行为准
+const manifestFile = ".chiamove-manifest.jsonl"
+
+type ManifestEntry struct {
+	Name    string    `json:"name"` // 相对目标根目录的路径
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	MovedAt time.Time `json:"movedAt"`
+}
+
+var manifestMu sync.Mutex
+
+// recordManifest 把迁入 disk 的 final 中的文件追加到 disk 的清单，失败只记录日志
+func recordManifest(c *Config, disk, final string) {
+	if !c.Manifest.Enabled || isRemoteDest(disk) {
+		return
+	}
+	var entries []ManifestEntry
+	err := filepath.WalkDir(final, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := checksumFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(disk, p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, ManifestEntry{Name: filepath.ToSlash(rel), Size: info.Size(), SHA256: sum, MovedAt: time.Now()})
+		return nil
+	})
+	if err == nil {
+		err = appendManifest(disk, entries)
+	}
+	if err != nil {
+		slog.Warn("更新目标清单失败", "dst", disk, "path", final, "err", err)
+	}
+}
+
+func appendManifest(disk string, entries []ManifestEntry) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	f, err := os.OpenFile(filepath.Join(disk, manifestFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		buf, err := json.Marshal(e)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := f.Write(append(buf, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// readManifest 读取清单，同名文件只保留最后一条，按名称排序
+func readManifest(disk string) ([]ManifestEntry, error) {
+	f, err := os.Open(filepath.Join(disk, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	latest := map[string]ManifestEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e ManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Name == "" {
+			// 进程被杀时最后一行可能不完整
+			continue
+		}
+		latest[e.Name] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	entries := make([]ManifestEntry, 0, len(latest))
+	for _, e := range latest {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// writeManifest 用 entries 替换整个清单
+func writeManifest(disk string, entries []ManifestEntry) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	path := filepath.Join(disk, manifestFile)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range entries {
+		buf, err := json.Marshal(e)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(buf, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// runVerifyManifest 实现 verify-manifest 子命令，按清单重新检查目标盘上的文件，发现缺失或损坏时返回1
+func runVerifyManifest(args []string) int {
+	fs := flag.NewFlagSet("chiamove verify-manifest", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", T("配置文件路径，没有指定目标时检查其中的 toPaths"))
+	quick := fs.Bool("quick", false, T("只比较大小，不计算SHA-256"))
+	prune := fs.Bool("prune", false, T("从清单中删除已不存在的文件，如手动删除或替换的plot；会重写清单，不要在迁移进行中使用"))
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	dests := fs.Args()
+	if len(dests) == 0 {
+		c, err := ReadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, T("读取配置失败: %v\n"), err)
+			return exitConfigError
+		}
+		SetLanguage(c.Language)
+		dests = c.ToPaths
+	}
+	code := exitOK
+	for _, disk := range dests {
+		if isRemoteDest(disk) {
+			continue
+		}
+		entries, err := readManifest(disk)
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Printf(T("%s: 没有清单\n"), disk)
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, T("读取清单失败 %s: %v\n"), disk, err)
+			code = exitError
+			continue
+		}
+		var kept []ManifestEntry
+		ok, bad, missing := 0, 0, 0
+		for _, e := range entries {
+			path := filepath.Join(disk, filepath.FromSlash(e.Name))
+			info, err := os.Stat(path)
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				missing++
+				fmt.Printf(T("缺失 %s\n"), path)
+				if *prune {
+					continue
+				}
+			case err != nil:
+				bad++
+				fmt.Printf(T("无法读取 %s: %v\n"), path, err)
+			case info.Size() != e.Size:
+				bad++
+				fmt.Printf(T("大小不一致 %s: %d，清单中为 %d\n"), path, info.Size(), e.Size)
+			case *quick:
+				ok++
+			default:
+				sum, err := checksumFile(path)
+				switch {
+				case err != nil:
+					bad++
+					fmt.Printf(T("无法读取 %s: %v\n"), path, err)
+				case sum != e.SHA256:
+					bad++
+					fmt.Printf(T("校验和不一致 %s\n"), path)
+				default:
+					ok++
+				}
+			}
+			kept = append(kept, e)
+		}
+		fmt.Printf(T("%s: %d 个文件正常，%d 个损坏，%d 个缺失\n"), disk, ok, bad, missing)
+		if *prune && len(kept) < len(entries) {
+			if err := writeManifest(disk, kept); err != nil {
+				fmt.Fprintf(os.Stderr, T("更新清单失败 %s: %v\n"), disk, err)
+				code = exitError
+			}
+		} else if missing > 0 {
+			code = exitError
+		}
+		if bad > 0 {
+			code = exitError
+		}
+	}
+	return code
+}
@@ -0,0 +1,26 @@
+package chiamove
+
+import "golang.org/x/sys/unix"
+
+// fstabMountPoints macOS上的硬盘通常自动挂载，不检查 fstab
+func fstabMountPoints(path string) []string {
+	return nil
+}
+
+// mountPoints 通过 getfsstat 获取当前所有挂载点
+func mountPoints() ([]string, error) {
+	n, err := unix.Getfsstat(nil, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]unix.Statfs_t, n)
+	n, err = unix.Getfsstat(buf, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil, err
+	}
+	mounts := make([]string, 0, n)
+	for _, fs := range buf[:n] {
+		mounts = append(mounts, unix.ByteSliceToString(fs.Mntonname[:]))
+	}
+	return mounts, nil
+}
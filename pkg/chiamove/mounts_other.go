@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package chiamove
+
+import "errors"
+
+func fstabMountPoints(path string) []string {
+	return nil
+}
+
+func mountPoints() ([]string, error) {
+	return nil, errors.New(T("当前系统不支持检测新挂载的硬盘"))
+}
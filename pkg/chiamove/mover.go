@@ -0,0 +1,63 @@
+// Package chiamove 把P好的plot从源盘迁移到目标盘，命令行程序在 cmd/chiamove，
+// 其他Go程序（如农场管理工具）可以用 NewMover 嵌入迁移功能
+package chiamove
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+var (
+	// ErrPartialFailure 有迁移失败的任务
+	ErrPartialFailure = sentinelError("有迁移失败的任务")
+	// ErrNoDestinations 没有可用的目标，目标全部已满或不可用
+	ErrNoDestinations = sentinelError("没有可用的目标")
+	// ErrAlreadyRunning 同一个进程中已经有 Mover 在运行
+	ErrAlreadyRunning = sentinelError("已有 Mover 正在运行")
+)
+
+// moverRunning 是否有 Mover 正在运行，包内的配置和状态只能被一个 Mover 使用
+var moverRunning atomic.Bool
+
+// Mover 按配置迁移plot。配置、任务日志和进度等状态是包内全局的，同一个进程中同时只能运行一个 Mover，
+// 另一个 Mover 正在运行时 Run 返回 ErrAlreadyRunning；
+// 不处理退出信号、不调整进程优先级，也不会设置 slog 的默认日志
+type Mover struct {
+	cfg  *Config
+	opts *Options
+}
+
+// NewMover 使用 cfg 创建 Mover，cfg 可以由 ReadConfig 读取，也可以在代码中构造，没有设置的字段在 Run 时使用与配置文件相同的默认值；
+// 没有配置文件路径，不会监视配置变化，lock 为 config 时不加锁
+func NewMover(cfg *Config) *Mover {
+	return &Mover{cfg: cfg, opts: &Options{}}
+}
+
+// Run 持续迁移直到源盘已空或目标已满（守护模式下直到 ctx 取消），未完成的任务下次运行时续传
+func (m *Mover) Run(ctx context.Context) error {
+	if !moverRunning.CompareAndSwap(false, true) {
+		return ErrAlreadyRunning
+	}
+	defer moverRunning.Store(false)
+	m.cfg.applyDefaults()
+	if err := m.cfg.compile(); err != nil {
+		return err
+	}
+	if err := m.cfg.Validate(); err != nil {
+		return err
+	}
+	configMu.Lock()
+	config = m.cfg
+	configMu.Unlock()
+	code, err := m.run(ctx)
+	if err != nil {
+		return err
+	}
+	switch code {
+	case exitPartialFailure:
+		return ErrPartialFailure
+	case exitNoDestinations:
+		return ErrNoDestinations
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package chiamove_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"chiaMove/pkg/chiamove"
+)
+
+// newTestConfig 在代码中构造配置，只设置路径和过滤条件，其他字段使用默认值
+func newTestConfig(t *testing.T, src, dst string) *chiamove.Config {
+	state := t.TempDir()
+	cfg := &chiamove.Config{
+		FromPaths:   []string{src},
+		ToPaths:     []string{dst},
+		JournalFile: filepath.Join(state, "journal.json"),
+		PauseFile:   filepath.Join(state, "PAUSE"),
+	}
+	cfg.FromPathFilter.Extension = ".plot"
+	cfg.FromPathFilter.MinSize = 1
+	cfg.FromPathFilter.MaxSize = 1 << 30
+	cfg.History.File = filepath.Join(state, "history.jsonl")
+	return cfg
+}
+
+func TestMoverRunWithConfigFromCode(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	name := "plot-k32-2024-01-01-00-00-test.plot"
+	if err := os.WriteFile(filepath.Join(src, name), make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newTestConfig(t, src, dst)
+	cfg.FromPathFilter.ExcludeRegex = []string{`^skip-`}
+	if err := os.WriteFile(filepath.Join(src, "skip-"+name), make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := chiamove.NewMover(cfg).Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+		t.Errorf("plot not moved to destination: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(src, name)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("source still exists after move: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "skip-"+name)); err != nil {
+		t.Errorf("excluded plot was moved: %v", err)
+	}
+}
+
+func TestMoverRunInvalidConfig(t *testing.T) {
+	cfg := newTestConfig(t, t.TempDir(), t.TempDir())
+	cfg.FromPaths = nil
+	if err := chiamove.NewMover(cfg).Run(context.Background()); err == nil {
+		t.Fatal("Run with empty fromPaths returned nil error")
+	}
+}
+
+func TestMoverRunConcurrent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		cfg := newTestConfig(t, t.TempDir(), t.TempDir())
+		// 守护模式下源盘为空时一直运行到 ctx 取消
+		cfg.Daemon = true
+		go func(m *chiamove.Mover) { errs <- m.Run(ctx) }(chiamove.NewMover(cfg))
+	}
+	if err := <-errs; !errors.Is(err, chiamove.ErrAlreadyRunning) {
+		t.Errorf("second Run = %v, want %v", err, chiamove.ErrAlreadyRunning)
+	}
+	cancel()
+	if err := <-errs; err != nil {
+		t.Errorf("first Run = %v", err)
+	}
+}
@@ -0,0 +1,336 @@
+package chiamove
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// MQTTConfig 把任务事件、通知和目标容量发布到MQTT服务器，供 Home Assistant 等读取。主题：
+// <prefix>/status 在线状态（online / offline，保留消息），<prefix>/events 任务事件（与 --json-events 相同），
+// <prefix>/notify/<事件> 通知，<prefix>/destinations/<目标> 目标容量（保留消息）。需要重启生效
+type MQTTConfig struct {
+	// 如 tcp://192.168.1.10:1883，TLS 使用 ssl://host:8883
+	Broker   string `yaml:"broker"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// 默认 chiamove-<主机名>
+	ClientID string `yaml:"clientId"`
+	// 默认 chiamove
+	TopicPrefix string `yaml:"topicPrefix"`
+	// 发布目标容量的间隔，默认1m
+	Interval time.Duration `yaml:"interval"`
+	// 发布到 notify 主题的通知，为空时为全部
+	Events []Event `yaml:"events"`
+}
+
+const (
+	mqttKeepAlive = 60 * time.Second
+	mqttTimeout   = 10 * time.Second
+	// 连接断开时最多缓存的消息数，超过后丢弃，不影响迁移
+	mqttQueueSize = 256
+)
+
+var mqttTopicUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+type mqttPublisher struct {
+	cfg   MQTTConfig
+	queue chan mqttMessage
+}
+
+// mqttClient 为nil时不发布
+var mqttClient *mqttPublisher
+
+// StartMQTT 配置了 notify.mqtt.broker 时在后台连接服务器，断开后自动重连，并定时发布目标容量；
+// 返回的函数发送完队列中的消息后把状态改为 offline 并断开
+func StartMQTT() func() {
+	cfg := config.Notify.MQTT
+	if cfg == nil || cfg.Broker == "" {
+		return func() {}
+	}
+	p := &mqttPublisher{cfg: *cfg, queue: make(chan mqttMessage, mqttQueueSize)}
+	if p.cfg.ClientID == "" {
+		host, _ := os.Hostname()
+		p.cfg.ClientID = "chiamove-" + host
+	}
+	if p.cfg.TopicPrefix == "" {
+		p.cfg.TopicPrefix = "chiamove"
+	}
+	if p.cfg.Interval <= 0 {
+		p.cfg.Interval = time.Minute
+	}
+	mqttClient = p
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.run(stop)
+	}()
+	go func() {
+		for {
+			p.publishDisks()
+			select {
+			case <-stop:
+				return
+			case <-time.After(p.cfg.Interval):
+			}
+		}
+	}()
+	return func() {
+		p.publishDisks()
+		close(stop)
+		select {
+		case <-done:
+		case <-time.After(mqttTimeout):
+		}
+	}
+}
+
+func (p *mqttPublisher) topic(suffix string) string {
+	return p.cfg.TopicPrefix + "/" + suffix
+}
+
+// publish 放入发送队列，不等待发送；队列已满时丢弃
+func (p *mqttPublisher) publish(topic string, payload any, retain bool) {
+	if p == nil {
+		return
+	}
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	select {
+	case p.queue <- mqttMessage{topic: topic, payload: buf, retain: retain}:
+	default:
+		slog.Debug("MQTT发送队列已满，丢弃消息", "topic", topic)
+	}
+}
+
+// publishEvent 发布任务事件，进度由定时发布的目标容量体现
+func (p *mqttPublisher) publishEvent(ev TransferEvent) {
+	if p == nil || ev.Type == "progress" {
+		return
+	}
+	p.publish(p.topic("events"), ev, false)
+}
+
+func (p *mqttPublisher) publishDisks() {
+	for _, d := range diskStatuses() {
+		name := mqttTopicUnsafe.ReplaceAllString(d.Path, "_")
+		p.publish(p.topic("destinations/"+name), d, true)
+	}
+}
+
+// run 连接服务器并发送队列中的消息，失败后按指数退避重连，直到 stop 被关闭
+func (p *mqttPublisher) run(stop <-chan struct{}) {
+	delay := time.Second
+	for {
+		conn, err := p.connect()
+		if err != nil {
+			slog.Warn("连接MQTT服务器失败", "broker", p.cfg.Broker, "err", err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, time.Minute)
+			continue
+		}
+		delay = time.Second
+		slog.Info("已连接MQTT服务器", "broker", p.cfg.Broker)
+		stopped := p.serve(conn, stop)
+		conn.Close()
+		if stopped {
+			return
+		}
+	}
+}
+
+// serve 在连接上发送消息和心跳，stop 被关闭时返回true，连接出错时返回false
+func (p *mqttPublisher) serve(conn net.Conn, stop <-chan struct{}) bool {
+	write := func(packet []byte) error {
+		conn.SetWriteDeadline(time.Now().Add(mqttTimeout))
+		_, err := conn.Write(packet)
+		return err
+	}
+	if err := write(mqttPublishPacket(p.topic("status"), []byte("online"), true)); err != nil {
+		slog.Warn("MQTT连接已断开", "broker", p.cfg.Broker, "err", err)
+		return false
+	}
+	// 只发布QoS 0的消息，服务器发来的只有心跳响应
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, conn)
+		readErr <- err
+	}()
+	ping := time.NewTicker(mqttKeepAlive / 2)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case m := <-p.queue:
+			err = write(mqttPublishPacket(m.topic, m.payload, m.retain))
+		case <-ping.C:
+			err = write([]byte{0xc0, 0})
+		case err = <-readErr:
+			if err == nil {
+				err = io.EOF
+			}
+		case <-stop:
+			for {
+				select {
+				case m := <-p.queue:
+					err = write(mqttPublishPacket(m.topic, m.payload, m.retain))
+				default:
+					write(mqttPublishPacket(p.topic("status"), []byte("offline"), true))
+					write([]byte{0xe0, 0})
+					return true
+				}
+				if err != nil {
+					return true
+				}
+			}
+		}
+		if err != nil {
+			slog.Warn("MQTT连接已断开", "broker", p.cfg.Broker, "err", err)
+			return false
+		}
+	}
+}
+
+func (c *MQTTConfig) validate() error {
+	u, err := url.Parse(c.Broker)
+	if err != nil || u.Host == "" || !slices.Contains([]string{"tcp", "mqtt", "ssl", "tls", "mqtts"}, u.Scheme) {
+		return fmt.Errorf(T("notify.mqtt.broker 无效 %q，应为 tcp://host:1883 或 ssl://host:8883"), c.Broker)
+	}
+	return nil
+}
+
+// connect 建立连接并完成MQTT 3.1.1握手，异常断开时服务器把状态改为 offline
+func (p *mqttPublisher) connect() (net.Conn, error) {
+	u, err := url.Parse(p.cfg.Broker)
+	if err != nil {
+		return nil, err
+	}
+	addr := u.Host
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "1883")
+		}
+		conn, err = dialer.Dial("tcp", addr)
+	case "ssl", "tls", "mqtts":
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "8883")
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf(T("notify.mqtt.broker 无效 %q，应为 tcp://host:1883 或 ssl://host:8883"), p.cfg.Broker)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(mqttTimeout))
+	if _, err := conn.Write(p.connectPacket()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if ack[0] != 0x20 || ack[3] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf(T("MQTT服务器拒绝连接(返回码 %d)"), ack[3])
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func (p *mqttPublisher) connectPacket() []byte {
+	// clean session，遗嘱消息为保留的 offline
+	flags := byte(0x02 | 0x04 | 0x20)
+	var payload bytes.Buffer
+	mqttWriteString(&payload, p.cfg.ClientID)
+	mqttWriteString(&payload, p.topic("status"))
+	mqttWriteString(&payload, "offline")
+	if p.cfg.Username != "" {
+		flags |= 0x80
+		mqttWriteString(&payload, p.cfg.Username)
+		if p.cfg.Password != "" {
+			flags |= 0x40
+			mqttWriteString(&payload, p.cfg.Password)
+		}
+	}
+	var body bytes.Buffer
+	mqttWriteString(&body, "MQTT")
+	keepAlive := uint16(mqttKeepAlive / time.Second)
+	body.Write([]byte{4, flags, byte(keepAlive >> 8), byte(keepAlive)})
+	body.Write(payload.Bytes())
+	return mqttPacket(0x10, body.Bytes())
+}
+
+func mqttPublishPacket(topic string, payload []byte, retain bool) []byte {
+	header := byte(0x30)
+	if retain {
+		header |= 0x01
+	}
+	var body bytes.Buffer
+	mqttWriteString(&body, topic)
+	body.Write(payload)
+	return mqttPacket(header, body.Bytes())
+}
+
+// mqttPacket 固定头之后为变长编码的剩余长度
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+func mqttWriteString(buf *bytes.Buffer, s string) {
+	buf.Write([]byte{byte(len(s) >> 8), byte(len(s))})
+	buf.WriteString(s)
+}
+
+// mqttNotifier 把通知发布到 <prefix>/notify/<事件>
+type mqttNotifier struct{}
+
+func (mqttNotifier) Name() string { return "mqtt" }
+
+func (mqttNotifier) Notify(n Notification) error {
+	if mqttClient == nil {
+		return nil
+	}
+	mqttClient.publish(mqttClient.topic("notify/"+string(n.Event)), n, false)
+	return nil
+}
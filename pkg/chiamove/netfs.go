@@ -0,0 +1,48 @@
+package chiamove
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// NetworkFSConfig NFS、CIFS/SMB等网络文件系统上的目标使用的参数
+type NetworkFSConfig struct {
+	// rsync使用 --whole-file，网络文件系统上增量传输要先读回目标文件，比直接整个写入更慢，默认 true
+	WholeFile *bool `yaml:"wholeFile"`
+	// rsync的 --timeout，也是卡住检测的最短时间，默认 10m
+	Timeout time.Duration `yaml:"timeout"`
+	// 临时性错误（EIO、连接断开等）的最多尝试次数，不少于 retry.maxAttempts，默认 10
+	MaxAttempts int `yaml:"maxAttempts"`
+}
+
+// networkDest 返回本地目标所在的网络文件系统类型，ssh、agent、s3 等远程目标不算
+func networkDest(dst string) (string, bool) {
+	if isRemoteDest(dst) {
+		return "", false
+	}
+	return networkFS(dst)
+}
+
+// networkRsyncArgs 网络文件系统上不使用 --append/--append-verify，续传时校验要读回整个文件
+func networkRsyncArgs(c NetworkFSConfig, args []string) []string {
+	args = slices.DeleteFunc(args, func(a string) bool {
+		return a == "--append" || a == "--append-verify"
+	})
+	if *c.WholeFile {
+		args = append(args, "--whole-file")
+	}
+	if t := c.Timeout; t > 0 {
+		args = append(args, fmt.Sprintf("--timeout=%d", int(t.Seconds())))
+	}
+	return args
+}
+
+func logNetworkDestinations(dests []string) {
+	for _, d := range dests {
+		if fstype, ok := networkDest(d); ok {
+			slog.Info("目标在网络文件系统上，使用 networkFS 中的参数", "path", d, "fstype", fstype)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package chiamove
+
+import "golang.org/x/sys/unix"
+
+// networkFS 按 statfs 返回的文件系统名称判断路径是否在网络文件系统上
+func networkFS(path string) (string, bool) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	switch name := unix.ByteSliceToString(st.Fstypename[:]); name {
+	case "nfs", "smbfs", "afpfs", "webdav":
+		return name, true
+	}
+	return "", false
+}
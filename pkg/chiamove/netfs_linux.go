@@ -0,0 +1,21 @@
+package chiamove
+
+import "golang.org/x/sys/unix"
+
+var networkFSMagics = map[int64]string{
+	unix.NFS_SUPER_MAGIC:  "nfs",
+	unix.SMB_SUPER_MAGIC:  "smb",
+	unix.SMB2_SUPER_MAGIC: "smb2",
+	unix.CIFS_SUPER_MAGIC: "cifs",
+	unix.CEPH_SUPER_MAGIC: "ceph",
+}
+
+// networkFS 按 statfs 返回的文件系统类型判断路径是否在网络文件系统上
+func networkFS(path string) (string, bool) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	name, ok := networkFSMagics[int64(uint32(st.Type))]
+	return name, ok
+}
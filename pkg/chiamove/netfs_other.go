@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package chiamove
+
+// networkFS 其他系统上不检测
+func networkFS(path string) (string, bool) {
+	return "", false
+}
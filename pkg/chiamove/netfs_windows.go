@@ -0,0 +1,28 @@
+package chiamove
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// networkFS UNC路径和映射的网络驱动器认为在网络文件系统上
+func networkFS(path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	vol := filepath.VolumeName(abs)
+	if strings.HasPrefix(vol, `\\`) {
+		return "smb", true
+	}
+	root, err := windows.UTF16PtrFromString(vol + `\`)
+	if err != nil {
+		return "", false
+	}
+	if windows.GetDriveType(root) == windows.DRIVE_REMOTE {
+		return "smb", true
+	}
+	return "", false
+}
@@ -0,0 +1,158 @@
+package chiamove
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+type Event string
+
+const (
+	EventTransferDone      Event = "transfer_done"
+	EventTransferFailed    Event = "transfer_failed"
+	EventSourceEmpty       Event = "source_empty"
+	EventDestinationsFull  Event = "destinations_full"
+	EventDestinationOnline Event = "destination_online"
+	// 目标连续失败后暂停使用，恢复时发送 destination_online
+	EventDestinationDisabled Event = "destination_disabled"
+	// 源路径或其中的条目无法读取，已跳过；恢复前每个路径只发送一次
+	EventScanError Event = "scan_error"
+	// 源盘剩余空间低于 sourceSpace.minFree，恢复到 resumeFree 后发送 source_space_recovered
+	EventSourceSpaceLow       Event = "source_space_low"
+	EventSourceSpaceRecovered Event = "source_space_recovered"
+)
+
+type Notification struct {
+	Event   Event     `json:"event"`
+	Message string    `json:"message"`
+	Src     string    `json:"src,omitempty"`
+	Dst     string    `json:"dst,omitempty"`
+	Size    uint64    `json:"size,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Notifier 通知渠道，新增渠道只需实现该接口并在 SetupNotifiers 中注册
+type Notifier interface {
+	Name() string
+	Notify(n Notification) error
+}
+
+// NotifyConfig 每个渠道的 events 为空时接收所有事件
+type NotifyConfig struct {
+	Webhook  *WebhookConfig  `yaml:"webhook"`
+	Telegram *TelegramConfig `yaml:"telegram"`
+	Discord  *DiscordConfig  `yaml:"discord"`
+	Email    *EmailConfig    `yaml:"email"` // 定期发送汇总，不按事件发送
+	MQTT     *MQTTConfig     `yaml:"mqtt"`
+}
+
+type WebhookConfig struct {
+	URL    string  `yaml:"url"`
+	Events []Event `yaml:"events"`
+}
+
+type TelegramConfig struct {
+	BotToken string  `yaml:"botToken"`
+	ChatID   string  `yaml:"chatId"`
+	Events   []Event `yaml:"events"`
+}
+
+type DiscordConfig struct {
+	WebhookURL string  `yaml:"webhookUrl"`
+	Events     []Event `yaml:"events"`
+}
+
+type subscription struct {
+	notifier Notifier
+	events   []Event
+}
+
+var subscriptions []subscription
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+func SetupNotifiers(cfg NotifyConfig) {
+	subscriptions = nil
+	if cfg.Webhook != nil && cfg.Webhook.URL != "" {
+		subscriptions = append(subscriptions, subscription{&webhookNotifier{url: cfg.Webhook.URL}, cfg.Webhook.Events})
+	}
+	if cfg.Telegram != nil && cfg.Telegram.BotToken != "" {
+		subscriptions = append(subscriptions, subscription{&telegramNotifier{token: cfg.Telegram.BotToken, chatID: cfg.Telegram.ChatID}, cfg.Telegram.Events})
+	}
+	if cfg.Discord != nil && cfg.Discord.WebhookURL != "" {
+		subscriptions = append(subscriptions, subscription{&discordNotifier{url: cfg.Discord.WebhookURL}, cfg.Discord.Events})
+	}
+	if cfg.MQTT != nil && cfg.MQTT.Broker != "" {
+		subscriptions = append(subscriptions, subscription{mqttNotifier{}, cfg.MQTT.Events})
+	}
+}
+
+// Notify 同步发送到所有订阅了该事件的渠道，发送失败只记录日志
+func Notify(n Notification) {
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	for _, s := range subscriptions {
+		if len(s.events) > 0 && !slices.Contains(s.events, n.Event) {
+			continue
+		}
+		if err := s.notifier.Notify(n); err != nil {
+			slog.Warn("发送通知失败", "channel", s.notifier.Name(), "event", n.Event, "err", err)
+		}
+	}
+}
+
+func postJSON(url string, body any) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
+
+type webhookNotifier struct {
+	url string
+}
+
+func (w *webhookNotifier) Name() string { return "webhook" }
+
+func (w *webhookNotifier) Notify(n Notification) error {
+	return postJSON(w.url, n)
+}
+
+type telegramNotifier struct {
+	token  string
+	chatID string
+}
+
+func (t *telegramNotifier) Name() string { return "telegram" }
+
+func (t *telegramNotifier) Notify(n Notification) error {
+	api := "https://api.telegram.org/bot" + url.PathEscape(t.token) + "/sendMessage"
+	return postJSON(api, map[string]string{"chat_id": t.chatID, "text": "chiaMove: " + n.Message})
+}
+
+type discordNotifier struct {
+	url string
+}
+
+func (d *discordNotifier) Name() string { return "discord" }
+
+func (d *discordNotifier) Notify(n Notification) error {
+	return postJSON(d.url, map[string]string{"content": "chiaMove: " + n.Message})
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package chiamove
+
+// hasOpenFiles 非Linux系统没有 /proc，不做检查
+func hasOpenFiles(path string) bool {
+	return false
+}
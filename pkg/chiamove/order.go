@@ -0,0 +1,105 @@
+package chiamove
+
+import (
+	"cmp"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// expandFromPaths 展开 fromPaths 中带通配符的路径（如 /mnt/plotter*/final），只保留存在的目录，
+// 每轮调度重新查找，新挂载的临时盘会自动加入；不带通配符的路径和HTTP源原样保留
+func expandFromPaths(paths []string) []string {
+	var expanded []string
+	for _, p := range paths {
+		if isRemoteSource(p) || !hasGlob(p) {
+			if !slices.Contains(expanded, p) {
+				expanded = append(expanded, p)
+			}
+			continue
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			slog.Error("fromPaths 中的通配符无效", "pattern", p, "err", err)
+			continue
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && info.IsDir() && !slices.Contains(expanded, m) {
+				expanded = append(expanded, m)
+			}
+		}
+	}
+	return expanded
+}
+
+func hasGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// matchSourcePath 判断源路径 fromPath 是否为配置中的 pattern，pattern 可以带通配符
+func matchSourcePath(pattern, fromPath string) bool {
+	pattern, fromPath = filepath.Clean(pattern), filepath.Clean(fromPath)
+	if pattern == fromPath {
+		return true
+	}
+	ok, _ := filepath.Match(pattern, fromPath)
+	return ok && hasGlob(pattern)
+}
+
+// sortEntries 按 sourceOrder 排序源路径下的条目：name 按名称，oldest 修改时间最早的在前，largest 最大的在前
+func (s *Scheduler) sortEntries(dir string, entries []fs.DirEntry) []fs.DirEntry {
+	switch s.cfg.SourceOrder {
+	case "oldest":
+		mtimes := map[string]time.Time{}
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil {
+				mtimes[e.Name()] = info.ModTime()
+			}
+		}
+		slices.SortStableFunc(entries, func(a, b fs.DirEntry) int {
+			return mtimes[a.Name()].Compare(mtimes[b.Name()])
+		})
+	case "largest":
+		sizes := map[string]uint64{}
+		for _, e := range entries {
+			if e.IsDir() {
+				sizes[e.Name()], _ = s.dirSize(filepath.Join(dir, e.Name()))
+			} else if info, err := e.Info(); err == nil {
+				sizes[e.Name()] = uint64(info.Size())
+			}
+		}
+		slices.SortStableFunc(entries, func(a, b fs.DirEntry) int {
+			return cmp.Compare(sizes[b.Name()], sizes[a.Name()])
+		})
+	}
+	return entries
+}
+
+// sourcePaths 返回本轮扫描源路径的顺序，排在前面的源优先分配目标；
+// sourcePriority 为 fullest 时已使用比例最高的源盘在前，否则按 fromPaths 的顺序
+func sourcePaths(c *Config) []string {
+	paths := expandFromPaths(c.FromPaths)
+	if c.SourcePriority != "fullest" {
+		return paths
+	}
+	used := map[string]float64{}
+	for _, p := range paths {
+		usage, err := GetDiskUsage(p)
+		if r, ok := remoteFor(c, p); ok {
+			usage, err = r.diskUsage()
+		}
+		if err != nil || usage.Total == 0 {
+			slog.Debug("获取源盘容量失败", "path", p, "err", err)
+			continue
+		}
+		used[p] = float64(usage.Total-usage.Free) / float64(usage.Total)
+	}
+	slices.SortStableFunc(paths, func(a, b string) int {
+		return cmp.Compare(used[b], used[a])
+	})
+	return paths
+}
@@ -0,0 +1,182 @@
+package chiamove
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 复制过程中目标使用的临时名称，复制完成后再改为最终名称，避免harvester读到只写了一半的plot
+const partialSuffix = ".chiamove.partial"
+
+// destPath 返回目标 dst 下名为 name 的路径，远程目标返回 ssh://、rsync://、agent:// 或 s3:// 形式
+func destPath(dst, name string) string {
+	if t, ok := parseS3(dst); ok {
+		return t.dest(name)
+	}
+	if t, ok := parseRsyncDaemon(dst); ok {
+		return t.dest(name)
+	}
+	if r, ok := parseRemote(dst); ok {
+		return "ssh://" + r.userHost + ":" + path.Join(r.path, name)
+	}
+	if a, ok := parseAgent(dst); ok {
+		return a.dest(path.Join(a.path, name))
+	}
+	return filepath.Join(dst, name)
+}
+
+// preparePartial 本地目标上已有最终名称的文件而没有临时文件时，比源小（旧版本中断的复制）或任务日志记录了
+// 迁移到该目标的中断任务（interrupted）时改名为临时文件继续续传，否则是已有的完整副本，返回 errDuplicate
+func preparePartial(c *Config, src, dst string, interrupted bool) error {
+	final := filepath.Join(dst, filepath.Base(src))
+	if _, err := os.Lstat(final + partialSuffix); !os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Lstat(final); err != nil {
+		return nil
+	}
+	if !interrupted {
+		srcSize, err := dirSize(osFS{}, c.DirSize, src)
+		if err != nil {
+			return err
+		}
+		size, err := dirSize(osFS{}, c.DirSize, final)
+		if err != nil {
+			return err
+		}
+		if size >= srcSize {
+			return fmt.Errorf(T("%w: %s 为 %d 字节，源为 %d 字节"), errDuplicate, final, size, srcSize)
+		}
+	}
+	if err := os.Rename(final, final+partialSuffix); err != nil {
+		slog.Warn("改名已有的目标失败", "path", final, "err", err)
+	}
+	return nil
+}
+
+// finishPartial 本地目标复制完成后把临时名称改为最终名称
+func finishPartial(src, dst string) error {
+	final := filepath.Join(dst, filepath.Base(src))
+	if _, err := os.Lstat(final); err == nil {
+		return fmt.Errorf(T("目标已存在: %s"), final)
+	}
+	return os.Rename(final+partialSuffix, final)
+}
+
+// removePartial 删除任务在目标 dst 上未完成的副本，换到其他目标后不再续传；
+// agent://、s3:// 和 rsync:// 目标上的由启动时的 partials 处理或对象存储的生命周期规则清理
+func removePartial(c *Config, src, dst string) {
+	name := sourceName(src) + partialSuffix
+	var err error
+	if r, ok := remoteFor(c, dst); ok {
+		_, err = r.run("rm -rf -- " + shellQuote(path.Join(r.path, name)))
+	} else if !isRemoteDest(dst) {
+		err = os.RemoveAll(copiedPath(src, dst) + partialSuffix)
+	} else {
+		return
+	}
+	if err != nil {
+		slog.Warn("删除未完成的副本失败", "dst", dst, "name", name, "err", err)
+	}
+}
+
+// PartialsConfig 启动时对目标上残留的未完成文件的处理
+type PartialsConfig struct {
+	// remove: 删除 / resume: 源还在源路径中时续传到原目标，否则删除 / off: 不处理
+	Action string `yaml:"action"`
+	// 只处理超过该时长没有修改的文件，避免删除其他进程正在写入的文件，默认 1h
+	OlderThan time.Duration `yaml:"olderThan"`
+}
+
+// resumableSource 返回 .chiamove.partial 对应的、仍在源路径中的源，没有时返回空
+func resumableSource(fromPaths []string, partial string) string {
+	name, ok := strings.CutSuffix(filepath.Base(partial), partialSuffix)
+	if !ok {
+		return ""
+	}
+	return sourceNamed(fromPaths, name)
+}
+
+// sourceNamed 返回源路径中名为 name 的源，没有时返回空
+func sourceNamed(fromPaths []string, name string) string {
+	for _, from := range fromPaths {
+		src := filepath.Join(from, name)
+		if _, err := os.Lstat(src); err == nil {
+			return src
+		}
+	}
+	return ""
+}
+
+// cleanStalePartials 启动时按 c.Partials 处理目标上残留的、不属于任务日志 j 中待续传任务的临时文件；
+// 续传的任务写入 j，随后由 resumeJournal 继续
+func cleanStalePartials(c *Config, j *Journal, dests []string) {
+	if c.Partials.Action == "off" {
+		return
+	}
+	fromPaths := expandFromPaths(c.FromPaths)
+	for _, p := range stalePartials(dests, fromPaths, j, c.Partials.OlderThan) {
+		if c.Partials.Action == "resume" {
+			if src := resumableSource(fromPaths, p); src != "" {
+				slog.Info("残留的临时文件对应的源仍在，续传", "path", p, "src", src)
+				j.Set(src, filepath.Dir(p), StateQueued, nil)
+				continue
+			}
+		}
+		if err := os.RemoveAll(p); err != nil {
+			slog.Warn("删除残留的临时文件失败", "path", p, "err", err)
+			continue
+		}
+		slog.Info("已删除残留的临时文件", "path", p)
+	}
+	if c.Partials.Action == "resume" {
+		resumeTruncatedCopies(c, j, dests)
+	}
+}
+
+// resumeTruncatedCopies 查找本地目标上与源同名但比源小的文件或文件夹（中断的复制，如旧版本直接写入最终名称），
+// 写入任务日志后由 resumeJournal 续传到原目标，而不是被当作重复的plot跳过
+func resumeTruncatedCopies(c *Config, j *Journal, dests []string) {
+	fromPaths := expandFromPaths(c.FromPaths)
+	cutoff := time.Now().Add(-c.Partials.OlderThan)
+	pending := map[string]bool{}
+	for _, e := range j.Pending() {
+		pending[e.Src] = true
+	}
+	for _, dest := range dests {
+		if isRemoteDest(dest) {
+			continue
+		}
+		entries, err := os.ReadDir(dest)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if strings.HasSuffix(name, partialSuffix) {
+				continue
+			}
+			src := sourceNamed(fromPaths, name)
+			if src == "" || pending[src] {
+				continue
+			}
+			if info, err := e.Info(); err != nil || info.ModTime().After(cutoff) {
+				continue
+			}
+			path := filepath.Join(dest, name)
+			srcSize, err1 := dirSize(osFS{}, c.DirSize, src)
+			size, err2 := dirSize(osFS{}, c.DirSize, path)
+			if err1 != nil || err2 != nil || size >= srcSize {
+				continue
+			}
+			slog.Info("目标上的副本比源小，续传", "path", path, "src", src, "size", size, "srcSize", srcSize)
+			j.Set(src, dest, StateQueued, nil)
+			pending[src] = true
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package chiamove
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPreparePartial(t *testing.T) {
+	src := t.TempDir()
+	p := writePlot(t, src, "plot-a.plot", 100, time.Time{})
+	c := newTestConfig(t, src, t.TempDir())
+	for _, tc := range []struct {
+		name        string
+		size        int
+		interrupted bool
+		renamed     bool
+		err         error
+	}{
+		{"smaller copy", 50, false, true, nil},
+		{"complete copy", 100, false, false, errDuplicate},
+		{"interrupted transfer", 100, true, true, nil},
+	} {
+		dst := t.TempDir()
+		final := writePlot(t, dst, "plot-a.plot", tc.size, time.Time{})
+		err := preparePartial(c, p, dst, tc.interrupted)
+		if !errors.Is(err, tc.err) || (tc.err == nil && err != nil) {
+			t.Errorf("%s: preparePartial = %v, want %v", tc.name, err, tc.err)
+		}
+		_, statErr := os.Stat(final + partialSuffix)
+		if renamed := statErr == nil; renamed != tc.renamed {
+			t.Errorf("%s: renamed to partial = %v, want %v", tc.name, renamed, tc.renamed)
+		}
+	}
+
+	// 已有临时文件时从临时文件续传，不处理最终名称的文件
+	dst := t.TempDir()
+	final := writePlot(t, dst, "plot-a.plot", 100, time.Time{})
+	writePlot(t, dst, "plot-a.plot"+partialSuffix, 10, time.Time{})
+	if err := preparePartial(c, p, dst, false); err != nil {
+		t.Errorf("with existing partial: preparePartial = %v", err)
+	}
+	if _, err := os.Stat(final); err != nil {
+		t.Errorf("final copy touched: %v", err)
+	}
+}
+
+func TestJournalInterrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Set("/src/plot-a.plot", "/dst1", StateRunning, nil)
+	j.Set("/src/plot-b.plot", "/dst1", StateDone, nil)
+
+	// 只有打开时还没有结束的任务算作中断
+	if j.Interrupted("/src/plot-a.plot", "/dst1") {
+		t.Error("transfer started in this run reported as interrupted")
+	}
+	if j, err = OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	if !j.Interrupted("/src/plot-a.plot", "/dst1") || j.Interrupted("/src/plot-a.plot", "/dst2") {
+		t.Error("Interrupted does not match the destination of the unfinished transfer")
+	}
+	j.Set("/src/plot-a.plot", "/dst1", StateDone, nil)
+	if j.Interrupted("/src/plot-a.plot", "/dst1") {
+		t.Error("finished transfer still reported as interrupted")
+	}
+}
+
+func TestRunSkipsCompleteCopyOnDestination(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	p := writePlot(t, src, "plot-a.plot", 100, time.Time{})
+	existing := writePlot(t, dst, "plot-a.plot", 100, time.Time{})
+	c := newTestConfig(t, src, dst)
+	c.CopyMethod = "native"
+	s := newTestScheduler(t, c, nil)
+	s.transport = func(dst string) Transport { return transportFor(c, dst) }
+
+	s.Run(context.Background(), []*Executor{{fromPath: p, toPath: dst, size: 100}})
+	if _, err := os.Stat(existing); err != nil {
+		t.Errorf("existing copy renamed or removed: %v", err)
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Errorf("source removed: %v", err)
+	}
+	if s.journal.Failed(p) || !s.ShouldSkip(p) {
+		t.Errorf("duplicate source failed = %v, skipped = %v; want not failed and skipped", s.journal.Failed(p), s.ShouldSkip(p))
+	}
+	if code := s.stats.ExitCode(exitOK); code != exitOK {
+		t.Errorf("exit code = %d, want %d", code, exitOK)
+	}
+}
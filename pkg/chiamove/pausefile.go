@@ -0,0 +1,29 @@
+package chiamove
+
+import (
+	"log/slog"
+	"os"
+	"time"
+)
+
+const pauseFileInterval = 2 * time.Second
+
+// StartPauseFileWatcher 文件 path 出现时暂停调度，删除后恢复；正在进行的任务不受影响
+func StartPauseFileWatcher(path string) {
+	go func() {
+		exists := false
+		for ; ; time.Sleep(pauseFileInterval) {
+			_, err := os.Stat(path)
+			switch now := err == nil; {
+			case now && !exists:
+				tracker.Pause()
+				slog.Info("调度已暂停，进行中的任务完成后不再开始新任务，删除该文件后恢复", "by", "file", "path", path)
+			case !now && exists:
+				tracker.Resume()
+				wake()
+				slog.Info("调度已恢复", "by", "file", "path", path)
+			}
+			exists = err == nil
+		}
+	}()
+}
@@ -0,0 +1,105 @@
+package chiamove
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// plot-k32-2021-05-05-12-30-<id>.plot 或压缩plot plot-k32-c05-2023-05-01-12-30-<id>.plot
+var plotNamePattern = regexp.MustCompile(`^plot-k(\d+)(?:-c(\d+))?-(\d{4}-\d{2}-\d{2}-\d{2}-\d{2})-([0-9a-fA-F]+)\.plot$`)
+
+type PlotInfo struct {
+	KSize       int
+	Compression int
+	CreatedAt   time.Time
+	ID          string
+}
+
+func ParsePlotName(name string) (PlotInfo, bool) {
+	m := plotNamePattern.FindStringSubmatch(name)
+	if m == nil {
+		return PlotInfo{}, false
+	}
+	k, _ := strconv.Atoi(m[1])
+	var c int
+	if m[2] != "" {
+		c, _ = strconv.Atoi(m[2])
+	}
+	createdAt, err := time.ParseInLocation("2006-01-02-15-04", m[3], time.Local)
+	if err != nil {
+		return PlotInfo{}, false
+	}
+	return PlotInfo{KSize: k, Compression: c, CreatedAt: createdAt, ID: m[4]}, true
+}
+
+// Date 配置中 2023-05-01 形式的日期
+type Date struct {
+	time.Time
+}
+
+func (d *Date) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return err
+	}
+	d.Time = t
+	return nil
+}
+
+type PlotFilter struct {
+	KSizes            []int `yaml:"kSizes"`
+	CompressionLevels []int `yaml:"compressionLevels"`
+	DateFrom          Date  `yaml:"dateFrom"`
+	DateTo            Date  `yaml:"dateTo"` // 包含当天
+}
+
+func (f PlotFilter) enabled() bool {
+	return len(f.KSizes) > 0 || len(f.CompressionLevels) > 0 || !f.DateFrom.IsZero() || !f.DateTo.IsZero()
+}
+
+func (f PlotFilter) Match(info PlotInfo) bool {
+	if len(f.KSizes) > 0 && !slices.Contains(f.KSizes, info.KSize) {
+		return false
+	}
+	if len(f.CompressionLevels) > 0 && !slices.Contains(f.CompressionLevels, info.Compression) {
+		return false
+	}
+	if !f.DateFrom.IsZero() && info.CreatedAt.Before(f.DateFrom.Time) {
+		return false
+	}
+	if !f.DateTo.IsZero() && !info.CreatedAt.Before(f.DateTo.AddDate(0, 0, 1)) {
+		return false
+	}
+	return true
+}
+
+// MatchPath 单个文件按文件名判断，文件夹按其中第一个 .plot 文件判断；没有设置plot过滤条件时总是返回true
+func (f PlotFilter) MatchPath(path string, isDir bool) bool {
+	if !f.enabled() {
+		return true
+	}
+	name := filepath.Base(path)
+	if isDir {
+		entries, err := osFS{}.ReadDir(path)
+		if err != nil {
+			return false
+		}
+		name = ""
+		for _, entry := range entries {
+			if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".plot") {
+				name = entry.Name()
+				break
+			}
+		}
+	}
+	info, ok := ParsePlotName(name)
+	return ok && f.Match(info)
+}
@@ -0,0 +1,117 @@
+package chiamove
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PlotCheckConfig 复制完成后、删除源之前，对目标上的plot执行 chia plots check，
+// 目标所在目录需要已经加入chia的 plot_directories，否则 -g 找不到plot
+type PlotCheckConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Binary     string `yaml:"binary"`     // 默认 chia
+	Challenges int    `yaml:"challenges"` // 对应 -n，默认 30
+}
+
+var (
+	errPlotInvalid     = sentinelError("plot校验未通过")
+	errPlotCheckFailed = sentinelError("chia plots check 执行失败")
+)
+
+var (
+	validPlotsPattern   = regexp.MustCompile(`Found (\d+) valid plots`)
+	invalidPlotsPattern = regexp.MustCompile(`(\d+) invalid plots found`)
+)
+
+// checkDestinationPlots 校验 src 复制到 dst 后的所有 .plot 文件，不通过的目标文件重命名为 .invalid
+func checkDestinationPlots(ctx context.Context, c *Config, src, dst string) error {
+	if _, ok := parseAgent(dst); ok {
+		slog.Warn("agent目标不支持plot校验，跳过", "dst", dst)
+		return nil
+	}
+	if _, ok := parseS3(dst); ok {
+		slog.Warn("s3目标不支持plot校验，跳过", "dst", dst)
+		return nil
+	}
+	if _, ok := parseRsyncDaemon(dst); ok {
+		slog.Warn("rsync目标不支持plot校验，跳过", "dst", dst)
+		return nil
+	}
+	name := filepath.Base(src)
+	var plots []string
+	if strings.HasSuffix(name, ".plot") {
+		plots = []string{name}
+	} else {
+		for _, p := range plotFiles(src) {
+			plots = append(plots, path.Join(name, p))
+		}
+	}
+	r, remote := remoteFor(c, dst)
+	for _, rel := range plots {
+		var plot string
+		var err error
+		if remote {
+			plot = path.Join(r.path, rel)
+			err = runPlotCheck(ctx, c.PlotCheck, plot, &r)
+		} else {
+			plot = filepath.Join(dst, rel)
+			err = runPlotCheck(ctx, c.PlotCheck, plot, nil)
+		}
+		if err != nil {
+			slog.Error("plot校验未通过，保留源文件", "plot", plot, "dst", dst, "err", err)
+			if !remote && errors.Is(err, errPlotInvalid) {
+				if err := os.Rename(plot, plot+".invalid"); err != nil {
+					slog.Error("标记无效plot失败", "plot", plot, "err", err)
+				}
+			}
+			return err
+		}
+		slog.Info("plot校验通过", "plot", plot, "dst", dst)
+	}
+	return nil
+}
+
+// runPlotCheck 执行 chia plots check，remote 不为空时通过ssh在远端执行
+func runPlotCheck(ctx context.Context, cfg PlotCheckConfig, plot string, remote *remoteTarget) error {
+	args := []string{"plots", "check", "-g", plot, "-n", strconv.Itoa(cfg.Challenges)}
+	var out []byte
+	var err error
+	if remote != nil {
+		quoted := make([]string, len(args))
+		for i, a := range args {
+			quoted[i] = shellQuote(a)
+		}
+		out, err = remote.runContext(ctx, cfg.Binary+" "+strings.Join(quoted, " ")+" 2>&1")
+	} else {
+		cmd := exec.CommandContext(ctx, cfg.Binary, args...)
+		setProcessGroup(cmd)
+		out, err = cmd.CombinedOutput()
+	}
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf(T("无法执行 chia plots check: %w"), err)
+	}
+	// 只有输出中报告了无效的plot才是 errPlotInvalid，执行失败（如ssh断开、chia出错）按普通错误重试
+	if m := invalidPlotsPattern.FindSubmatch(out); m != nil && string(m[1]) != "0" {
+		return fmt.Errorf("%w: %s", errPlotInvalid, m[0])
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", errPlotCheckFailed, err)
+	}
+	m := validPlotsPattern.FindSubmatch(out)
+	if m == nil || string(m[1]) == "0" {
+		return fmt.Errorf(T("%w: 未找到有效plot，请确认目标目录已加入chia的plot_directories"), errPlotCheckFailed)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package chiamove
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeChia 返回一个输出 out 并以 code 退出的 chia 脚本
+func fakeChia(t *testing.T, out string, code int) PlotCheckConfig {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake chia binary is a shell script")
+	}
+	bin := filepath.Join(t.TempDir(), "chia")
+	script := "#!/bin/sh\nprintf '%s\\n' '" + out + "'\nexit " + strconv.Itoa(code) + "\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return PlotCheckConfig{Enabled: true, Binary: bin, Challenges: 30}
+}
+
+func TestRunPlotCheck(t *testing.T) {
+	ctx := context.Background()
+	plot := filepath.Join(t.TempDir(), "plot-a.plot")
+
+	if err := runPlotCheck(ctx, fakeChia(t, "Found 1 valid plots", 0), plot, nil); err != nil {
+		t.Errorf("valid plot: runPlotCheck = %v", err)
+	}
+	err := runPlotCheck(ctx, fakeChia(t, "1 invalid plots found", 0), plot, nil)
+	if !errors.Is(err, errPlotInvalid) || classifyError(err) != errPermanent {
+		t.Errorf("invalid plot: runPlotCheck = %v, want permanent %v", err, errPlotInvalid)
+	}
+	// 执行失败和没有找到plot都不能说明plot损坏，按普通错误重试
+	for _, tc := range []struct {
+		out  string
+		code int
+	}{
+		{"Connection reset by peer", 1},
+		{"Found 0 valid plots", 0},
+	} {
+		err := runPlotCheck(ctx, fakeChia(t, tc.out, tc.code), plot, nil)
+		if err == nil || errors.Is(err, errPlotInvalid) || classifyError(err) != errTransient {
+			t.Errorf("%q exit %d: runPlotCheck = %v, want transient error", tc.out, tc.code, err)
+		}
+	}
+}
+
+func TestCheckDestinationPlotsKeepsPlotOnFailure(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	p := writePlot(t, src, "plot-a.plot", 10, time.Time{})
+	copied := writePlot(t, dst, "plot-a.plot", 10, time.Time{})
+	c := newTestConfig(t, src, dst)
+	c.PlotCheck = fakeChia(t, "Connection reset by peer", 1)
+
+	if err := checkDestinationPlots(context.Background(), c, p, dst); err == nil || errors.Is(err, errPlotInvalid) {
+		t.Fatalf("checkDestinationPlots = %v, want execution error", err)
+	}
+	if _, err := os.Stat(copied); err != nil {
+		t.Errorf("copy renamed after execution failure: %v", err)
+	}
+}
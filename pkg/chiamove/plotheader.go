@@ -0,0 +1,112 @@
+package chiamove
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+)
+
+// HeaderCheckConfig 选择源之前读取其中 .plot 文件的文件头，明显截断或不是plot的文件不迁移，
+// 避免花几个小时复制崩溃的plotter留下的无效文件
+type HeaderCheckConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// skip: 跳过并记录日志 / fail: 记入任务日志并按 failed.action 处理，可用 retry-failed 查看和重新排队
+	Action string `yaml:"action"`
+}
+
+// chiapos支持的k值范围
+const (
+	minPlotK = 18
+	maxPlotK = 50
+)
+
+// 已报告过的头无效的源，action 为 skip 时每个源只记录一次日志
+var badHeaders sync.Map
+
+// headerCheckPassed 检查源中的plot文件头，不通过时按 headerCheck.action 处理并返回 false
+func (s *Scheduler) headerCheckPassed(src string, isDir bool) bool {
+	if !s.cfg.HeaderCheck.Enabled {
+		return true
+	}
+	err := s.queue.Header(src, func() error { return checkSourceHeaders(s.fsys, s.cfg.PlotSize, src, isDir) })
+	if err == nil {
+		return true
+	}
+	if s.cfg.HeaderCheck.Action == "fail" {
+		slog.Error("plot头无效，按失败处理", "path", src, "err", err)
+		s.journal.Set(src, "", StateFailed, err)
+		handleFailed(s.cfg, src)
+		Notify(Notification{
+			Event:   EventTransferFailed,
+			Message: fmt.Sprintf(T("plot头无效 %s: %v"), src, err),
+			Src:     src, Error: err.Error(),
+		})
+	} else if _, logged := badHeaders.LoadOrStore(src, true); !logged {
+		slog.Warn("plot头无效，跳过", "path", src, "err", err)
+	}
+	return false
+}
+
+// checkSourceHeaders 单个文件检查其本身，文件夹检查其中所有 .plot 文件，没有 .plot 文件的文件夹不检查
+func checkSourceHeaders(fsys FileSystem, sizes PlotSizeConfig, src string, isDir bool) error {
+	files := []string{src}
+	if isDir {
+		files = nil
+		for _, name := range plotFiles(src) {
+			files = append(files, filepath.Join(src, name))
+		}
+	}
+	for _, file := range files {
+		if err := checkPlotHeader(fsys, sizes, file); err != nil && isDir {
+			return fmt.Errorf("%s: %w", filepath.Base(file), err)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPlotHeader 检查文件头的magic、k值和memo长度，k值与文件名一致，
+// 文件不小于v1格式文件头中各表的位置，也不明显小于按文件名估算的大小
+func checkPlotHeader(fsys FileSystem, sizes PlotSizeConfig, path string) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 1024)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	h, err := parsePlotHeader(buf[:n])
+	if err != nil {
+		return err
+	}
+	if h.KSize < minPlotK || h.KSize > maxPlotK {
+		return fmt.Errorf(T("%w: k值 %d 无效"), errPlotHeader, h.KSize)
+	}
+	size := uint64(info.Size())
+	for _, p := range h.TablePointers {
+		if p > size {
+			return fmt.Errorf(T("文件已截断: 大小 %d 小于文件头中表的位置 %d"), size, p)
+		}
+	}
+	if name, ok := ParsePlotName(filepath.Base(path)); ok {
+		if name.KSize != h.KSize {
+			return fmt.Errorf(T("%w: 文件头中的k值 %d 与文件名中的 k%d 不一致"), errPlotHeader, h.KSize, name.KSize)
+		}
+		// 不同plotter的压缩plot大小不同，只把不到估算大小一半的当作截断
+		if expected, ok := sizes.expectedPlotSize(name); ok && size < expected/2 {
+			return fmt.Errorf(T("文件已截断: 大小 %s，估算大小 %s"), formatBytes(size), formatBytes(expected))
+		}
+	}
+	return nil
+}
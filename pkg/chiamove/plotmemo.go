@@ -0,0 +1,209 @@
+package chiamove
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// PlotMemo plot头中的memo：矿池合约的puzzle hash 或pool公钥、farmer公钥
+type PlotMemo struct {
+	PoolContract []byte // 32字节，plotNFT（矿池合约）plot
+	PoolKey      []byte // 48字节，使用pool公钥的plot，solo或旧的OG矿池
+	FarmerKey    []byte // 48字节
+}
+
+const (
+	plotMagicV1 = "Proof of Space Plot"
+	plotMagicV2 = "PLOT"
+)
+
+var errPlotHeader = sentinelError("无法识别的plot头")
+
+// ReadPlotMemo 读取 .plot 文件头中的memo，支持v1和bladebit压缩plot使用的v2格式
+func ReadPlotMemo(path string) (PlotMemo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return PlotMemo{}, err
+	}
+	defer f.Close()
+	header := make([]byte, 1024)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return PlotMemo{}, err
+	}
+	return parsePlotMemo(header[:n])
+}
+
+func parsePlotMemo(header []byte) (PlotMemo, error) {
+	h, err := parsePlotHeader(header)
+	return h.Memo, err
+}
+
+// plotHeader plot文件头中的k值、memo，以及v1格式各表的起始位置
+type plotHeader struct {
+	KSize         int
+	Memo          PlotMemo
+	TablePointers []uint64 // 只有v1格式，文件比其中最大的位置小时说明被截断
+}
+
+func parsePlotHeader(header []byte) (plotHeader, error) {
+	var h plotHeader
+	r := bytes.NewReader(header)
+	skip := func(n int64) { r.Seek(n, io.SeekCurrent) }
+	readLen := func() int {
+		var n uint16
+		if binary.Read(r, binary.BigEndian, &n) != nil {
+			return -1
+		}
+		return int(n)
+	}
+	v1 := bytes.HasPrefix(header, []byte(plotMagicV1))
+	switch {
+	case v1:
+		// magic、plot id(32)、k(1)、格式描述
+		skip(int64(len(plotMagicV1)) + 32)
+	case bytes.HasPrefix(header, []byte(plotMagicV2)):
+		// magic、版本(4)、plot id(32)、k(1)
+		skip(int64(len(plotMagicV2)) + 4 + 32)
+	default:
+		return h, errPlotHeader
+	}
+	k, err := r.ReadByte()
+	if err != nil {
+		return h, errPlotHeader
+	}
+	h.KSize = int(k)
+	if v1 {
+		skip(int64(readLen()))
+	}
+	memo := make([]byte, max(readLen(), 0))
+	if _, err := io.ReadFull(r, memo); err != nil {
+		return h, errPlotHeader
+	}
+	// 最后32字节为本地主私钥，不读取
+	switch len(memo) {
+	case 32 + 48 + 32:
+		h.Memo = PlotMemo{PoolContract: memo[:32], FarmerKey: memo[32:80]}
+	case 48 + 48 + 32:
+		h.Memo = PlotMemo{PoolKey: memo[:48], FarmerKey: memo[48:96]}
+	default:
+		return h, fmt.Errorf(T("%w: memo长度 %d"), errPlotHeader, len(memo))
+	}
+	if v1 {
+		// 10个表的起始位置，大端
+		h.TablePointers = make([]uint64, 10)
+		if binary.Read(r, binary.BigEndian, h.TablePointers) != nil {
+			return h, fmt.Errorf(T("%w: 文件头不完整"), errPlotHeader)
+		}
+	}
+	return h, nil
+}
+
+// plotMemos 源路径 -> memo，同一个源在每轮调度中都要匹配路由，只读一次
+var plotMemos sync.Map
+
+// sourceMemo 单个 .plot 文件读取其memo，文件夹读取其中第一个 .plot 文件的memo
+func sourceMemo(src string) (PlotMemo, error) {
+	if memo, ok := plotMemos.Load(src); ok {
+		return memo.(PlotMemo), nil
+	}
+	file := src
+	if !strings.HasSuffix(src, ".plot") {
+		plots := plotFiles(src)
+		if len(plots) == 0 {
+			return PlotMemo{}, errPlotHeader
+		}
+		file = filepath.Join(src, plots[0])
+	}
+	memo, err := ReadPlotMemo(file)
+	if err != nil {
+		return PlotMemo{}, err
+	}
+	plotMemos.Store(src, memo)
+	return memo, nil
+}
+
+// parsePuzzleHash 解析矿池合约地址 xch1... / txch1... 或 32 字节的十六进制puzzle hash
+func parsePuzzleHash(s string) ([]byte, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if strings.HasPrefix(s, "xch1") || strings.HasPrefix(s, "txch1") {
+		return decodeBech32m(s)
+	}
+	return parseHexKey(s, 32)
+}
+
+func parseHexKey(s string, size int) ([]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+	if err != nil || len(b) != size {
+		return nil, fmt.Errorf(T("%q 不是 %d 字节的十六进制"), s, size)
+	}
+	return b, nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// decodeBech32m 解码chia地址，返回其中的puzzle hash
+func decodeBech32m(s string) ([]byte, error) {
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || len(s)-sep-1 < 6 {
+		return nil, fmt.Errorf(T("地址 %q 无效"), s)
+	}
+	hrp := s[:sep]
+	var data []byte
+	for _, c := range s[sep+1:] {
+		v := strings.IndexRune(bech32Charset, c)
+		if v < 0 {
+			return nil, fmt.Errorf(T("地址 %q 无效"), s)
+		}
+		data = append(data, byte(v))
+	}
+	values := make([]byte, 0, len(hrp)*2+1+len(data))
+	for _, c := range hrp {
+		values = append(values, byte(c>>5))
+	}
+	values = append(values, 0)
+	for _, c := range hrp {
+		values = append(values, byte(c&31))
+	}
+	if bech32Polymod(append(values, data...)) != 0x2bc830a3 {
+		return nil, fmt.Errorf(T("地址 %q 校验和错误"), s)
+	}
+	// 5位一组转为8位一组，去掉最后6个校验字符
+	var out []byte
+	acc, bits := 0, 0
+	for _, v := range data[:len(data)-6] {
+		acc = acc<<5 | int(v)
+		bits += 5
+		if bits >= 8 {
+			bits -= 8
+			out = append(out, byte(acc>>bits))
+		}
+	}
+	if len(out) != 32 {
+		return nil, fmt.Errorf(T("地址 %q 无效"), s)
+	}
+	return out, nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if top>>i&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
@@ -0,0 +1,69 @@
+package chiamove
+
+import (
+	"math"
+	"path/filepath"
+)
+
+// PlotSizeConfig 按plot文件名中的k值和压缩等级估算plot的大小，供过滤规则的 expectedSize 使用
+type PlotSizeConfig struct {
+	// k32各压缩等级的大小，覆盖或补充内置的bladebit C0-C7，如gigahorse的压缩等级大小与bladebit不同
+	K32 map[int]ByteSize `yaml:"k32"`
+	// 实际大小与估算大小相差不超过该百分比时认为符合，默认 2
+	Tolerance float64 `yaml:"tolerance"`
+}
+
+// bladebit k32 各压缩等级的大小，单位GiB
+var defaultK32Sizes = map[int]float64{
+	0: 101.4,
+	1: 87.5,
+	2: 86.0,
+	3: 84.4,
+	4: 82.8,
+	5: 81.2,
+	6: 79.6,
+	7: 78.0,
+}
+
+// expectedPlotSize 返回plot的估算大小，其他k值按k每加1大小翻倍换算；不知道该压缩等级的大小时返回false
+func (c PlotSizeConfig) expectedPlotSize(info PlotInfo) (uint64, bool) {
+	size, ok := c.K32[info.Compression]
+	if !ok {
+		var gib float64
+		gib, ok = defaultK32Sizes[info.Compression]
+		size = ByteSize(gib * (1 << 30))
+	}
+	if !ok || info.KSize < 25 || info.KSize > 40 {
+		return 0, false
+	}
+	if info.KSize >= 32 {
+		return uint64(size) << (info.KSize - 32), true
+	}
+	return uint64(size) >> (32 - info.KSize), true
+}
+
+// expectedUnitSize 返回迁移单位的估算大小，文件夹为其中所有plot的估算大小之和；有无法估算的plot时返回false
+func (c PlotSizeConfig) expectedUnitSize(path string, isDir bool) (uint64, bool) {
+	names := []string{filepath.Base(path)}
+	if isDir {
+		names = plotFiles(path)
+	}
+	var total uint64
+	for _, name := range names {
+		info, ok := ParsePlotName(name)
+		if !ok {
+			return 0, false
+		}
+		size, ok := c.expectedPlotSize(info)
+		if !ok {
+			return 0, false
+		}
+		total += size
+	}
+	return total, len(names) > 0
+}
+
+// matchExpectedSize 判断实际大小与估算大小的差是否在 plotSize.tolerance 以内
+func (c PlotSizeConfig) matchExpectedSize(size, expected uint64) bool {
+	return math.Abs(float64(size)-float64(expected)) <= float64(expected)*c.Tolerance/100
+}
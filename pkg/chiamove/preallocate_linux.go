@@ -0,0 +1,19 @@
+//go:build linux
+
+package chiamove
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate 用 fallocate 为 f 预留 size 字节，不改变文件大小（续传按文件大小判断已写入的位置）；文件系统不支持时忽略
+func preallocate(f *os.File, size int64) error {
+	err := unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_KEEP_SIZE, 0, size)
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOSYS) {
+		return nil
+	}
+	return err
+}
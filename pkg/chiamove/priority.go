@@ -0,0 +1,42 @@
+package chiamove
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// PriorityConfig 降低迁移进程的CPU和IO优先级，让harvester读取plot不受影响；
+// 对整个进程生效，rsync、ssh等子进程会继承
+type PriorityConfig struct {
+	Nice int `yaml:"nice"` // 0-19，越大优先级越低
+	// IO调度类别: idle 只在磁盘空闲时读写 / best-effort，为空时不修改，仅支持Linux
+	IOClass string `yaml:"ioClass"`
+	IOLevel int    `yaml:"ioLevel"` // best-effort 的等级 0-7，越大优先级越低
+}
+
+func (p PriorityConfig) Validate() error {
+	if p.Nice < 0 || p.Nice > 19 {
+		return fmt.Errorf(T("priority.nice 必须在 0-19 之间: %d"), p.Nice)
+	}
+	switch p.IOClass {
+	case "", "idle", "best-effort":
+	default:
+		return fmt.Errorf(T("priority.ioClass 无效 %q"), p.IOClass)
+	}
+	if p.IOLevel < 0 || p.IOLevel > 7 {
+		return fmt.Errorf(T("priority.ioLevel 必须在 0-7 之间: %d"), p.IOLevel)
+	}
+	return nil
+}
+
+// applyPriority 启动时设置进程优先级，失败只记录日志
+func applyPriority(p PriorityConfig) {
+	if p.Nice == 0 && p.IOClass == "" {
+		return
+	}
+	if err := setPriority(p); err != nil {
+		slog.Warn("设置进程优先级失败", "nice", p.Nice, "ioClass", p.IOClass, "err", err)
+		return
+	}
+	slog.Info("已设置进程优先级", "nice", p.Nice, "ioClass", p.IOClass, "ioLevel", p.IOLevel)
+}
@@ -0,0 +1,49 @@
+//go:build linux
+
+package chiamove
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// setPriority Linux上nice和IO优先级都是按线程的，逐个设置当前所有线程，之后创建的线程和子进程会继承
+func setPriority(p PriorityConfig) error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	var ioprio int
+	switch p.IOClass {
+	case "idle":
+		ioprio = ioprioClassIdle << ioprioClassShift
+	case "best-effort":
+		ioprio = ioprioClassBE<<ioprioClassShift | p.IOLevel
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if p.Nice != 0 {
+			if err := unix.Setpriority(unix.PRIO_PROCESS, tid, p.Nice); err != nil {
+				return err
+			}
+		}
+		if ioprio != 0 {
+			if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(ioprio)); errno != 0 {
+				return errno
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build unix && !linux
+
+package chiamove
+
+import (
+	"log/slog"
+
+	"golang.org/x/sys/unix"
+)
+
+func setPriority(p PriorityConfig) error {
+	if p.IOClass != "" {
+		slog.Warn("当前系统不支持设置IO优先级，只设置nice", "ioClass", p.IOClass)
+	}
+	return unix.Setpriority(unix.PRIO_PROCESS, 0, p.Nice)
+}
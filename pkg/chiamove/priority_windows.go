@@ -0,0 +1,7 @@
+package chiamove
+
+import "errors"
+
+func setPriority(p PriorityConfig) error {
+	return errors.New(T("Windows不支持"))
+}
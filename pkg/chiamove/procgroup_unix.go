@@ -0,0 +1,16 @@
+//go:build unix
+
+package chiamove
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 让命令运行在单独的进程组中，取消时杀掉整个进程组，避免rsync、ssh等子进程成为孤儿
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
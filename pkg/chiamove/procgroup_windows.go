@@ -0,0 +1,8 @@
+//go:build windows
+
+package chiamove
+
+import "os/exec"
+
+// setProcessGroup Windows上取消时只能终止命令本身
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,115 @@
+package chiamove
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+)
+
+// applyProfile 把 profiles 中名为 name 的配置覆盖到顶层配置上，字段与 stages 相同；
+// 各profile可以同时运行，lock 为 config 时改为锁定源路径，源路径重叠的profile不会同时迁移
+func (c *Config) applyProfile(name string) error {
+	i := slices.IndexFunc(c.Profiles, func(p Stage) bool { return p.Name == name })
+	if i < 0 {
+		return fmt.Errorf(T("profiles 中没有名为 %q 的配置"), name)
+	}
+	if err := c.applyOverrides(name, c.Profiles[i].Overrides); err != nil {
+		return fmt.Errorf(T("profiles 中 %s 无效: %w"), name, err)
+	}
+	if c.Lock == "" || c.Lock == "config" {
+		c.Lock = "source"
+	}
+	c.Profiles = nil
+	return nil
+}
+
+func validateProfiles(profiles []Stage) error {
+	seen := make(map[string]bool)
+	for _, p := range profiles {
+		if p.Name == "" {
+			return errors.New(T("profiles 中每个配置都需要 name"))
+		}
+		if seen[p.Name] {
+			return fmt.Errorf(T("profiles 中的名称 %q 重复"), p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
+
+// runProfiles 没有指定 --profile 时为每个profile启动一个子进程，各自独立调度，全部退出后返回
+func runProfiles(opts *Options, args []string) int {
+	if err := validateProfiles(config.Profiles); err != nil {
+		slog.Error("配置无效", "err", err)
+		return exitConfigError
+	}
+	if len(opts.From) > 0 || len(opts.To) > 0 || opts.TUI {
+		slog.Error("配置无效", "err", T("配置了 profiles 时不能使用 --from、--to 和 --tui，可以用 --profile 只运行其中一个"))
+		return exitConfigError
+	}
+	for _, p := range config.Profiles {
+		c, err := readConfig(opts.ConfigPath, p.Name, "")
+		if err == nil {
+			opts.Apply(c)
+			err = c.Validate()
+		}
+		if err != nil {
+			slog.Error("配置无效", "profile", p.Name, "err", err)
+			return exitConfigError
+		}
+	}
+	logCloser, err := SetupLogger(config.Logging, os.Stderr)
+	if err != nil {
+		slog.Error("初始化日志失败", "err", err)
+		return exitError
+	}
+	defer logCloser.Close()
+	if config.Lock != "source" {
+		unlock, err := acquireLocks(opts.ConfigPath)
+		if err != nil {
+			slog.Error("无法启动", "err", err)
+			return exitError
+		}
+		defer unlock()
+	}
+	self, err := os.Executable()
+	if err != nil {
+		slog.Error("无法启动", "err", err)
+		return exitError
+	}
+	ctx := shutdownContext()
+	codes := make([]int, len(config.Profiles))
+	done := make(chan struct{})
+	for i, p := range config.Profiles {
+		go func(i int, name string) {
+			codes[i] = runProfileProcess(ctx, self, args, name)
+			done <- struct{}{}
+		}(i, p.Name)
+	}
+	for range config.Profiles {
+		<-done
+	}
+	code := exitOK
+	for i, c := range codes {
+		if c != exitOK {
+			slog.Warn("profile异常退出", "profile", config.Profiles[i].Name, "code", c)
+		}
+		if c == exitPartialFailure || code == exitOK {
+			code = c
+		}
+	}
+	return code
+}
+
+func runProfileProcess(ctx context.Context, self string, args []string, name string) int {
+	cmd := childCommand(ctx, self, append([]string{"move", "-profile", name}, args...))
+	slog.Info("启动profile", "profile", name)
+	if err := cmd.Run(); cmd.ProcessState == nil || cmd.ProcessState.ExitCode() < 0 {
+		slog.Error("profile运行失败", "profile", name, "err", err)
+		return exitError
+	}
+	return cmd.ProcessState.ExitCode()
+}
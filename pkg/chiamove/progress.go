@@ -0,0 +1,66 @@
+package chiamove
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+type progressSample struct {
+	copied uint64
+	at     time.Time
+}
+
+// StartProgressReporter 定期输出每个任务的进度条、速度、剩余时间以及总速度
+func StartProgressReporter(interval time.Duration) {
+	go func() {
+		last := map[string]progressSample{}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			last = reportProgress(last)
+		}
+	}()
+}
+
+func reportProgress(last map[string]progressSample) map[string]progressSample {
+	now := time.Now()
+	samples := map[string]progressSample{}
+	var total float64
+	transfers := tracker.Active()
+	for _, tr := range transfers {
+		prev, ok := last[tr.Src]
+		if !ok {
+			prev = progressSample{at: tr.StartedAt}
+		}
+		var speed float64
+		if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 && tr.Copied >= prev.copied {
+			speed = float64(tr.Copied-prev.copied) / elapsed
+		}
+		total += speed
+		samples[tr.Src] = progressSample{copied: tr.Copied, at: now}
+		var ratio float64
+		if tr.Size > 0 {
+			ratio = float64(tr.Copied) / float64(tr.Size)
+		}
+		eta := "-"
+		if speed > 0 {
+			eta = time.Duration(float64(tr.Size-tr.Copied) / speed * float64(time.Second)).Round(time.Second).String()
+		}
+		slog.Info("迁移进度", "from", tr.Src, "to", tr.Dst,
+			"progress", progressBar(ratio, 20),
+			"copied", formatBytes(tr.Copied)+"/"+formatBytes(tr.Size),
+			"speed", formatBytes(uint64(speed))+"/s", "eta", eta)
+	}
+	if len(transfers) > 0 {
+		slog.Info("总体进度", "transfers", len(transfers), "speed", formatBytes(uint64(total))+"/s")
+	}
+	return samples
+}
+
+func progressBar(ratio float64, width int) string {
+	ratio = min(max(ratio, 0), 1)
+	filled := int(ratio * float64(width))
+	return fmt.Sprintf("[%s%s] %.1f%%", strings.Repeat("#", filled), strings.Repeat("-", width-filled), ratio*100)
+}
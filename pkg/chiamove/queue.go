@@ -0,0 +1,108 @@
+package chiamove
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// queuedSource 扫描时发现的一个源
+type queuedSource struct {
+	size    uint64
+	modTime time.Time
+	// 检查plot头的结果，源变化后重新检查
+	headerChecked bool
+	headerErr     error
+	scheduled     bool // 已分配目标，迁移结束前不再选择
+}
+
+// SourceQueue 按源路径记录扫描发现的源：大小只在源变化后重新计算，plot头只检查一次，
+// 分配目标后直到迁移结束（成功、失败或取消）都不会被再次调度
+type SourceQueue struct {
+	mu    sync.Mutex
+	items map[string]*queuedSource
+}
+
+var sourceQueue = &SourceQueue{items: map[string]*queuedSource{}}
+
+// Measure 返回源的大小并记录到队列，文件夹的大小由 dirSize 计算；文件的大小或修改时间、文件夹的总大小或修改时间变化后，之前的检查结果失效
+func (q *SourceQueue) Measure(path string, entry fs.DirEntry, dirSize func(path string) (uint64, error)) (uint64, error) {
+	info, err := entry.Info()
+	if err != nil {
+		return 0, err
+	}
+	size := uint64(info.Size())
+	if entry.IsDir() {
+		if size, err = dirSize(path); err != nil {
+			return 0, err
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.items[path]
+	if !ok || s.size != size || !s.modTime.Equal(info.ModTime()) {
+		q.items[path] = &queuedSource{size: size, modTime: info.ModTime(), scheduled: ok && s.scheduled}
+	}
+	return size, nil
+}
+
+// Header 返回源上一次检查plot头的结果，没有检查过时调用 check
+func (q *SourceQueue) Header(path string, check func() error) error {
+	q.mu.Lock()
+	s, ok := q.items[path]
+	if ok && s.headerChecked {
+		q.mu.Unlock()
+		return s.headerErr
+	}
+	q.mu.Unlock()
+	err := check()
+	if ok {
+		q.mu.Lock()
+		s.headerChecked, s.headerErr = true, err
+		q.mu.Unlock()
+	}
+	return err
+}
+
+// Schedule 源已分配目标
+func (q *SourceQueue) Schedule(path string, size uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.items[path]
+	if !ok {
+		// 续传的任务没有经过扫描
+		s = &queuedSource{size: size}
+		q.items[path] = s
+	}
+	s.scheduled = true
+}
+
+func (q *SourceQueue) Scheduled(path string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.items[path]
+	return ok && s.scheduled
+}
+
+// Remove 迁移结束后移除源，源还在时（失败或取消）下一轮扫描重新计算
+func (q *SourceQueue) Remove(path string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.items, path)
+}
+
+// Prune 移除已经不存在的本地源，如被手动删除或移走；远程源迁移结束后由 Remove 移除
+func (q *SourceQueue) Prune(fsys FileSystem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for path, s := range q.items {
+		if s.scheduled || isRemoteSource(path) {
+			continue
+		}
+		if _, err := fsys.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+			delete(q.items, path)
+			forgetDirSize(path)
+		}
+	}
+}
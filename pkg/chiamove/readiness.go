@@ -0,0 +1,92 @@
+package chiamove
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+)
+
+// fstabPath 配置的挂载点，其中的挂载点没有挂载时不向其下的目标写入
+var fstabPath = "/etc/fstab"
+
+// checkDestinationReady 分配任务前确认目标可用：是目录、所在的 fstab 挂载点已经挂载、可以写入（出错后被重新挂载为只读时会失败），
+// 配置了 requireMount 时还要求不在系统盘上，避免硬盘没挂载时把plot写进根分区
+func checkDestinationReady(c *Config, dest string) error {
+	if isSimulated(dest) {
+		return nil
+	}
+	if r, ok := remoteFor(c, dest); ok {
+		p := shellQuote(r.path)
+		if _, err := r.run("test -d " + p + " && test -w " + p); err != nil {
+			return fmt.Errorf(T("远程目标不存在或不可写: %w"), err)
+		}
+		return nil
+	}
+	if t, ok := rsyncDaemonFor(c, dest); ok {
+		if err := t.ready(); err != nil {
+			return fmt.Errorf(T("rsync目标不可用: %w"), err)
+		}
+		return nil
+	}
+	if a, ok := agentFor(c, dest); ok {
+		if err := a.ready(); err != nil {
+			return fmt.Errorf(T("agent目标不可用: %w"), err)
+		}
+		return nil
+	}
+	if t, ok := s3For(c, dest); ok {
+		if err := t.ready(); err != nil {
+			return fmt.Errorf(T("s3目标不可用: %w"), err)
+		}
+		return nil
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New(T("不是目录"))
+	}
+	if m := unmountedMountPoint(dest); m != "" {
+		return fmt.Errorf(T("挂载点 %s 没有挂载，硬盘可能掉线"), m)
+	}
+	if c.RequireMount && sameFilesystem(dest, systemRoot()) {
+		return fmt.Errorf(T("与系统盘 %s 在同一个文件系统上，硬盘可能没有挂载"), systemRoot())
+	}
+	f, err := os.CreateTemp(dest, ".chiamove-ready-*")
+	if err != nil {
+		return fmt.Errorf(T("不可写: %w"), err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// unmountedMountPoint 返回 fstab 中包含 dest 但当前没有挂载的挂载点，其中只是上级文件系统上的空目录；
+// 无法读取当前的挂载点时按挂载点与上级目录是否在同一个文件系统上判断
+func unmountedMountPoint(dest string) string {
+	mounted, err := mountPoints()
+	for _, m := range fstabMountPoints(fstabPath) {
+		parent := filepath.Dir(m)
+		if m == parent || !isWithin(m, dest) {
+			continue
+		}
+		unmounted := sameFilesystem(m, parent)
+		if err == nil {
+			unmounted = !slices.Contains(mounted, filepath.Clean(m))
+		}
+		if unmounted {
+			return m
+		}
+	}
+	return ""
+}
+
+func systemRoot() string {
+	if runtime.GOOS == "windows" {
+		return os.Getenv("SystemDrive") + `\`
+	}
+	return "/"
+}
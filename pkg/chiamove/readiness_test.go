@@ -0,0 +1,60 @@
+package chiamove
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// useFstab 把 fstab 替换为挂载点 mounts 的临时文件，测试结束后恢复
+func useFstab(t *testing.T, mounts ...string) {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("# <file system> <mount point> <type> <options> <dump> <pass>\n")
+	for _, m := range mounts {
+		b.WriteString("UUID=0000 " + strings.ReplaceAll(m, " ", `\040`) + " ext4 defaults,nofail 0 2\n")
+	}
+	b.WriteString("/swapfile none swap sw 0 0\n")
+	p := filepath.Join(t.TempDir(), "fstab")
+	if err := os.WriteFile(p, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := fstabPath
+	t.Cleanup(func() { fstabPath = old })
+	fstabPath = p
+}
+
+func TestCheckDestinationReadyUnmounted(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fstab is only checked on Linux")
+	}
+	// 没有挂载的挂载点只是上级文件系统上的空目录，目标仍然可以写入
+	disk := filepath.Join(t.TempDir(), "disk 1")
+	dest := filepath.Join(disk, "plots")
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	other := t.TempDir()
+	c := newTestConfig(t, t.TempDir(), dest, other)
+	// other 所在的挂载点已经挂载
+	mounts, err := mountPoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mounted := "/"
+	for _, m := range mounts {
+		if isWithin(m, other) && len(m) > len(mounted) {
+			mounted = m
+		}
+	}
+	useFstab(t, "/", mounted, disk)
+
+	if err := checkDestinationReady(c, dest); err == nil || !strings.Contains(err.Error(), disk) {
+		t.Errorf("checkDestinationReady under unmounted %s = %v, want error", disk, err)
+	}
+	if err := checkDestinationReady(c, other); err != nil {
+		t.Errorf("checkDestinationReady under mounted %s = %v", mounted, err)
+	}
+}
@@ -0,0 +1,203 @@
+package chiamove
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// rebalanceDisk 参与平衡的一块本地目标盘
+type rebalanceDisk struct {
+	path              string
+	total, used, free uint64
+}
+
+func (d *rebalanceDisk) ratio() float64 {
+	return float64(d.used) / float64(d.total)
+}
+
+func (d *rebalanceDisk) refresh() error {
+	usage, err := GetDiskUsage(d.path)
+	if err != nil {
+		return err
+	}
+	d.total, d.free, d.used = usage.Total, usage.Free, usage.Total-usage.Free
+	return nil
+}
+
+// rebalanceMove 一次平衡迁移：把 from 上的 plot 移到 to
+type rebalanceMove struct {
+	plot     string
+	size     uint64
+	from, to *rebalanceDisk
+}
+
+// runRebalance 实现 rebalance 子命令：把所有本地目标盘同时当作源和目标，每次从使用比例最高的盘上
+// 把一个plot迁移到使用比例最低的盘，直到两者相差不超过 --threshold；复制、校验和删除与 move 相同
+func runRebalance(args []string) int {
+	fs := flag.NewFlagSet("chiamove rebalance", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", T("配置文件路径"))
+	threshold := fs.Float64("threshold", 5, T("使用比例最高和最低的盘相差不超过该百分比时停止"))
+	maxMoves := fs.Int("max-moves", 0, T("最多迁移的plot数量，0 为不限制"))
+	dryRun := fs.Bool("dry-run", false, T("只列出计划的迁移"))
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	c, err := ReadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("读取配置失败: %v\n"), err)
+		return exitConfigError
+	}
+	SetLanguage(c.Language)
+	if err := c.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, T("配置无效: %v\n"), err)
+		return exitConfigError
+	}
+	if c.DeletePolicy == "never" {
+		fmt.Fprintln(os.Stderr, T("deletePolicy 为 never 时复制后不会删除原来的plot，不能用于 rebalance"))
+		return exitConfigError
+	}
+	config = c
+	logCloser, err := SetupLogger(c.Logging, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("初始化日志失败: %v\n"), err)
+		return exitError
+	}
+	defer logCloser.Close()
+	// 与使用同一配置的 move 同时运行时，双方可能选择同一块盘
+	unlock, err := acquireLocks(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("无法启动: %v\n"), err)
+		return exitError
+	}
+	defer unlock()
+	applyRuntimeConfig()
+	discoverDestinations(config)
+	disks := rebalanceDisks(destinations())
+	if len(disks) < 2 {
+		fmt.Fprintln(os.Stderr, T("至少需要两块不在同一个文件系统上的本地目标盘"))
+		return exitNoDestinations
+	}
+	defer WaitHarvesterRefresh()
+	ctx := shutdownContext()
+	planned := map[string]bool{}
+	code := exitOK
+	for moves := 0; *maxMoves == 0 || moves < *maxMoves; moves++ {
+		if ctx.Err() != nil {
+			break
+		}
+		m, ok := planRebalance(disks, *threshold/100, planned)
+		if !ok {
+			break
+		}
+		planned[m.plot] = true
+		fmt.Printf("%s -> %s  %s\n", m.plot, m.to.path, formatBytes(m.size))
+		if *dryRun {
+			m.from.used, m.from.free = m.from.used-m.size, m.from.free+m.size
+			m.to.used, m.to.free = m.to.used+m.size, m.to.free-m.size
+			continue
+		}
+		if err := CopyWithRetry(ctx, m.plot, m.to.path); err != nil {
+			slog.Error("平衡迁移失败", "from", m.plot, "to", m.to.path, "err", err)
+			code = exitPartialFailure
+			break
+		}
+		if _, err := os.Stat(m.plot); err == nil {
+			// 没有校验时 deletePolicy 为 afterVerify 会保留源，继续平衡只会产生重复的plot
+			slog.Error("按 deletePolicy 保留了源，停止平衡", "path", m.plot, "policy", config.DeletePolicy)
+			code = exitPartialFailure
+			break
+		}
+		RequestHarvesterRefresh(config, m.to.path)
+		for _, d := range []*rebalanceDisk{m.from, m.to} {
+			if err := d.refresh(); err != nil {
+				slog.Error("获取文件系统信息失败", "path", d.path, "err", err)
+				return exitError
+			}
+		}
+	}
+	for _, d := range disks {
+		fmt.Printf(T("%s  已使用 %.1f%%，剩余 %s\n"), d.path, d.ratio()*100, formatBytes(d.free))
+	}
+	return code
+}
+
+// rebalanceDisks 返回可以写入的本地目标盘，同一个文件系统上的多个目标路径只取第一个
+func rebalanceDisks(dests []string) []*rebalanceDisk {
+	var disks []*rebalanceDisk
+	for _, dest := range dests {
+		if isRemoteDest(dest) || isSimulated(dest) || destHealth.Disabled(dest) {
+			continue
+		}
+		if err := checkDestinationReady(config, dest); err != nil {
+			slog.Warn("目标不可用，跳过", "path", dest, "err", err)
+			continue
+		}
+		if slices.ContainsFunc(disks, func(d *rebalanceDisk) bool { return sameFilesystem(d.path, dest) }) {
+			continue
+		}
+		d := &rebalanceDisk{path: dest}
+		if err := d.refresh(); err != nil || d.total == 0 {
+			slog.Warn("获取文件系统信息失败", "path", dest, "err", err)
+			continue
+		}
+		disks = append(disks, d)
+	}
+	return disks
+}
+
+// planRebalance 选择使用比例最高的盘上的一个plot迁移到使用比例最低的盘，两者相差不超过 threshold 时返回 false；
+// 迁移后源盘的使用比例不能低于目标盘，目标盘还要留出 minFreeReserve
+func planRebalance(disks []*rebalanceDisk, threshold float64, planned map[string]bool) (rebalanceMove, bool) {
+	sorted := append([]*rebalanceDisk{}, disks...)
+	sort.SliceStable(sorted, func(a, b int) bool { return sorted[a].ratio() > sorted[b].ratio() })
+	from, to := sorted[0], sorted[len(sorted)-1]
+	if from.ratio()-to.ratio() <= threshold {
+		return rebalanceMove{}, false
+	}
+	for _, p := range diskPlots(from.path) {
+		if planned[p.plot] {
+			continue
+		}
+		if p.size > from.used || p.size+minFreeReserve(config, to.path) > to.free {
+			continue
+		}
+		if float64(from.used-p.size)/float64(from.total) < float64(to.used+p.size)/float64(to.total) {
+			continue
+		}
+		p.from, p.to = from, to
+		return p, true
+	}
+	slog.Info("没有可以平衡的plot", "from", from.path, "to", to.path)
+	return rebalanceMove{}, false
+}
+
+// diskPlots 返回目标盘上（包括 destinationLayout 的子文件夹中）的 .plot 文件，跳过隐藏文件夹和回收站
+func diskPlots(root string) []rebalanceMove {
+	var plots []rebalanceMove
+	walkDir(osFS{}, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != root && (strings.HasPrefix(d.Name(), ".") || isTrashDir(config, root, p)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !strings.HasSuffix(d.Name(), ".plot") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			plots = append(plots, rebalanceMove{plot: p, size: uint64(info.Size())})
+		}
+		return nil
+	})
+	return plots
+}
@@ -0,0 +1,110 @@
+package chiamove
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// scanInterval 的默认值，也是多级迁移时重新启动已退出的子进程的间隔
+	daemonPollInterval = 30 * time.Second
+	// 检查配置文件修改时间的间隔
+	configWatchInterval = 5 * time.Second
+)
+
+// WatchConfig 收到SIGHUP，或 watch 为true且配置文件被修改时，向返回的channel发送通知，
+// 由主循环在两轮调度之间重新加载，不影响正在进行的迁移
+func WatchConfig(path string, watch bool) <-chan struct{} {
+	reload := make(chan struct{}, 1)
+	// 嵌入其他程序时没有配置文件，也不接管其SIGHUP
+	if path == "" {
+		return reload
+	}
+	trigger := func() {
+		select {
+		case reload <- struct{}{}:
+		default:
+		}
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		for range sig {
+			slog.Info("收到SIGHUP，将重新加载配置")
+			trigger()
+		}
+	}()
+	if watch {
+		go func() {
+			last := configVersion(path)
+			for range time.Tick(configWatchInterval) {
+				if t := configVersion(path); t != last {
+					last = t
+					slog.Info("配置文件已修改，将重新加载", "path", path)
+					trigger()
+				}
+			}
+		}()
+	}
+	return reload
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reloadConfig 重新读取并校验配置，返回新的配置，失败时返回 nil 并继续使用原来的配置；
+// 日志、API监听地址和任务日志文件需要重启才能生效
+func reloadConfig(opts *Options) *Config {
+	sdNotify("RELOADING=1")
+	defer sdNotify("READY=1")
+	newConfig, err := readConfig(opts.ConfigPath, opts.Profile, opts.Stage)
+	if err == nil {
+		opts.Apply(newConfig)
+		err = newConfig.Validate()
+	}
+	if err != nil {
+		slog.Error("重新加载配置失败，继续使用原来的配置", "path", opts.ConfigPath, "err", err)
+		return nil
+	}
+	configMu.Lock()
+	config = newConfig
+	configMu.Unlock()
+	applyRuntimeConfig()
+	slog.Info("配置已重新加载", "fromPaths", newConfig.FromPaths, "toPaths", newConfig.ToPaths)
+	return newConfig
+}
+
+// currentConfig 返回当前配置的快照，配置可能被重新加载
+func currentConfig() *Config {
+	configMu.Lock()
+	defer configMu.Unlock()
+	return config
+}
+
+// applyRuntimeConfig 应用启动和重新加载时都可以直接生效的配置
+func applyRuntimeConfig() {
+	SetLanguage(config.Language)
+	globalLimiterRate = uint64(currentThrottle(config).Global)
+	globalLimiter = newRateLimiter(globalLimiterRate)
+	sourceDevices.SetLimit(config.MaxReadsPerDevice)
+	SetupNotifiers(config.Notify)
+	setAgentClient(config.Agent)
+}
+
+// configVersion 由配置文件和 include 的各文件的修改时间组成，其中任意一个修改或 include 变化时改变
+func configVersion(path string) string {
+	var version []string
+	for _, f := range configFiles(path) {
+		version = append(version, f+"@"+modTime(f).String())
+	}
+	return strings.Join(version, "\n")
+}
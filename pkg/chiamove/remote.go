@@ -0,0 +1,165 @@
+package chiamove
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type SSHConfig struct {
+	Binary string   `yaml:"binary"`
+	Args   []string `yaml:"args"` // 如 ["-p", "2222", "-i", "/root/.ssh/id_ed25519"]
+	// 只使用该私钥认证，不尝试ssh-agent中的其他密钥
+	IdentityFile string `yaml:"identityFile"`
+	// 只信任该文件中的主机公钥，未知或公钥变化的主机拒绝连接，防止中间人窃听或篡改传输的plot
+	KnownHostsFile string `yaml:"knownHostsFile"`
+}
+
+func (c SSHConfig) args() []string {
+	args := append([]string{}, c.Args...)
+	if f := c.IdentityFile; f != "" {
+		args = append(args, "-i", f, "-o", "IdentitiesOnly=yes")
+	}
+	if f := c.KnownHostsFile; f != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+f, "-o", "StrictHostKeyChecking=yes")
+	}
+	return args
+}
+
+// remoteTarget 对应 ssh://user@host:/mnt/disk1 形式的目标路径，在远端执行命令时按 ssh 连接
+type remoteTarget struct {
+	userHost string
+	path     string
+	ssh      SSHConfig
+}
+
+// remoteFor 解析 ssh:// 路径，在远端执行命令时使用 c 中的ssh配置
+func remoteFor(c *Config, dest string) (remoteTarget, bool) {
+	r, ok := parseRemote(dest)
+	r.ssh = c.SSH
+	return r, ok
+}
+
+func parseRemote(dest string) (remoteTarget, bool) {
+	rest, ok := strings.CutPrefix(dest, "ssh://")
+	if !ok {
+		return remoteTarget{}, false
+	}
+	if userHost, path, ok := strings.Cut(rest, ":"); ok {
+		return remoteTarget{userHost: userHost, path: path}, true
+	}
+	// 兼容 ssh://user@host/mnt/disk1 的写法
+	i := strings.Index(rest, "/")
+	if i < 0 {
+		return remoteTarget{userHost: rest, path: "."}, true
+	}
+	return remoteTarget{userHost: rest[:i], path: rest[i:]}, true
+}
+
+// sshTransport 通过rsync over ssh复制到 ssh:// 目标，先写入临时名称，完成后在远端改名
+type sshTransport struct{ cfg *Config }
+
+func (sshTransport) Name() string { return "ssh" }
+
+func (sshTransport) Resume(src, dst string, interrupted bool) error { return nil }
+
+func (t sshTransport) Copy(ctx context.Context, src, dst string) error {
+	name := filepath.Base(src)
+	if err := rsyncCopy(ctx, t.cfg, src, destPath(dst, name+partialSuffix)); err != nil {
+		return err
+	}
+	r, _ := remoteFor(t.cfg, dst)
+	partial, final := shellQuote(path.Join(r.path, name+partialSuffix)), shellQuote(path.Join(r.path, name))
+	if _, err := r.run("test ! -e " + final + " && mv -- " + partial + " " + final); err != nil {
+		return fmt.Errorf(T("远程目标改名失败: %w"), err)
+	}
+	return nil
+}
+
+func (t sshTransport) Verify(ctx context.Context, src, dst string) error {
+	r, _ := remoteFor(t.cfg, dst)
+	return verifyCopy(ctx, t.cfg, osFS{}, src, path.Join(r.path, filepath.Base(src)), sshFiles{r})
+}
+
+func (t sshTransport) FreeSpace(dst string) (DiskUsage, error) {
+	r, _ := remoteFor(t.cfg, dst)
+	return r.diskUsage()
+}
+
+// isRemoteDest 判断目标是否为 ssh://、rsync://、agent:// 或 s3:// 形式的远程目标；模拟的目标也不在本地磁盘上
+func isRemoteDest(dest string) bool {
+	_, ssh := parseRemote(dest)
+	_, rsyncd := parseRsyncDaemon(dest)
+	_, agent := parseAgent(dest)
+	_, s3 := parseS3(dest)
+	return ssh || rsyncd || agent || s3 || isSimulated(dest)
+}
+
+// rsyncTarget 返回rsync能识别的 user@host:/path 形式
+func (r remoteTarget) rsyncTarget() string {
+	return r.userHost + ":" + r.path
+}
+
+func (c SSHConfig) binary() string {
+	if c.Binary != "" {
+		return c.Binary
+	}
+	return "ssh"
+}
+
+// command 作为rsync的 -e 参数，rsync按空格拆分，每个参数加引号，路径中可以有空格
+func (c SSHConfig) command() string {
+	var quoted []string
+	for _, arg := range append([]string{c.binary()}, c.args()...) {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (r remoteTarget) run(command string) ([]byte, error) {
+	return r.runContext(context.Background(), command)
+}
+
+func (r remoteTarget) runContext(ctx context.Context, command string) ([]byte, error) {
+	args := append(r.ssh.args(), r.userHost, command)
+	cmd := exec.CommandContext(ctx, r.ssh.binary(), args...)
+	setProcessGroup(cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf(T("ssh %s 执行 %q 失败: %w: %s"), r.userHost, command, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// diskUsage 在远端执行 df 获取容量和剩余空间
+func (r remoteTarget) diskUsage() (DiskUsage, error) {
+	out, err := r.run("df -Pk -- " + shellQuote(r.path))
+	if err != nil {
+		return DiskUsage{}, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) < 2 {
+		return DiskUsage{}, fmt.Errorf(T("无法解析df输出: %q"), out)
+	}
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return DiskUsage{}, fmt.Errorf(T("无法解析df输出: %q"), out)
+	}
+	totalKB, err1 := strconv.ParseUint(fields[1], 10, 64)
+	freeKB, err2 := strconv.ParseUint(fields[3], 10, 64)
+	if err1 != nil || err2 != nil {
+		return DiskUsage{}, fmt.Errorf(T("无法解析df输出: %q"), out)
+	}
+	return DiskUsage{Total: totalKB * 1024, Free: freeKB * 1024}, nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,53 @@
+package chiamove
+
+import "sync"
+
+// Reservations 已分配目标但还没有写完的任务预留的空间，选择目标时从剩余空间中扣除，
+// 避免多个并发任务选中同一块快满的盘，其中一个因为空间不足失败
+type Reservations struct {
+	mu sync.Mutex
+	// 目标路径 -> 源路径 -> 大小
+	m map[string]map[string]uint64
+}
+
+var reservations = &Reservations{m: map[string]map[string]uint64{}}
+
+func (r *Reservations) Reserve(dst, src string, size uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.m[dst] == nil {
+		r.m[dst] = map[string]uint64{}
+	}
+	r.m[dst][src] = size
+}
+
+func (r *Reservations) Release(dst, src string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.m[dst], src)
+	if len(r.m[dst]) == 0 {
+		delete(r.m, dst)
+	}
+}
+
+// Sources 返回目标上正在写入的源路径
+func (r *Reservations) Sources(dst string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sources []string
+	for src := range r.m[dst] {
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+// Outstanding 返回目标上还需要写入的字节数，已经写入的部分已经体现在剩余空间中
+func (r *Reservations) Outstanding(c *Config, dst string) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var total uint64
+	for src, size := range r.m[dst] {
+		total += size - min(transferredBytes(c, src, dst), size)
+	}
+	return total
+}
@@ -0,0 +1,154 @@
+package chiamove
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type RetryConfig struct {
+	MaxAttempts  int           `yaml:"maxAttempts"`
+	InitialDelay time.Duration `yaml:"initialDelay"`
+	MaxDelay     time.Duration `yaml:"maxDelay"`
+}
+
+type errorClass int
+
+const (
+	errTransient errorClass = iota // 网络抖动、IO错误等，重试可能成功
+	errPermanent                   // 磁盘已满、只读、权限不足等，重试没有意义
+)
+
+// rsync退出码含义见 man rsync 的 EXIT VALUES
+var permanentRsyncCodes = map[int]bool{
+	1: true, // 语法或用法错误
+	2: true, // 协议不兼容
+	4: true, // 不支持的操作
+}
+
+var permanentErrnos = []error{
+	syscall.ENOSPC,
+	syscall.EROFS,
+	syscall.EACCES,
+	syscall.EPERM,
+	syscall.EDQUOT,
+}
+
+var permanentMessages = []string{
+	"no space left on device",
+	"not enough space on the disk",
+	"read-only file system",
+	"permission denied",
+	"disk quota exceeded",
+}
+
+type rsyncError struct {
+	code   int
+	stderr string
+	err    error
+}
+
+func (e *rsyncError) Error() string {
+	return fmt.Sprintf(T("rsync命令执行出错(退出码 %d): %v"), e.code, e.err)
+}
+
+func (e *rsyncError) Unwrap() error {
+	return e.err
+}
+
+func classifyError(err error) errorClass {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return errPermanent
+	}
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, exec.ErrNotFound) || errors.Is(err, errPlotInvalid) || errors.Is(err, errSizeMismatch) || errors.Is(err, errOverlap) || errors.Is(err, errLayout) || errors.Is(err, errDuplicate) {
+		return errPermanent
+	}
+	for _, target := range permanentErrnos {
+		if errors.Is(err, target) {
+			return errPermanent
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	var rerr *rsyncError
+	if errors.As(err, &rerr) {
+		if permanentRsyncCodes[rerr.code] {
+			return errPermanent
+		}
+		msg = strings.ToLower(rerr.stderr)
+	}
+	for _, m := range permanentMessages {
+		if strings.Contains(msg, m) {
+			return errPermanent
+		}
+	}
+	return errTransient
+}
+
+var noSpaceMessages = []string{
+	"no space left on device",
+	"not enough space on the disk",
+	"disk quota exceeded",
+}
+
+// isNoSpace 判断复制是否因为目标空间不足而失败，这样的任务换到其他目标重试，不把源当作失败
+func isNoSpace(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	var rerr *rsyncError
+	if errors.As(err, &rerr) {
+		msg += " " + strings.ToLower(rerr.stderr)
+	}
+	for _, m := range noSpaceMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// CopyWithRetry 按已加载的配置复制，对临时性错误按指数退避重试，永久性错误、ctx 被取消或重试次数用完后返回最后一次的错误
+func CopyWithRetry(ctx context.Context, src, dst string) error {
+	return NewScheduler(currentConfig(), slog.Default()).copyWithRetry(ctx, src, dst)
+}
+
+func (s *Scheduler) copyWithRetry(ctx context.Context, src, dst string) error {
+	retry := s.cfg.Retry
+	if _, ok := networkDest(dst); ok {
+		retry.MaxAttempts = max(retry.MaxAttempts, s.cfg.NetworkFS.MaxAttempts)
+	}
+	delay := retry.InitialDelay
+	for attempt := 1; ; attempt++ {
+		err := s.copySource(ctx, src, dst)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf(T("已终止(%w): %v"), context.Cause(ctx), err)
+		}
+		if classifyError(err) == errPermanent {
+			return fmt.Errorf(T("永久性错误，不再重试: %w"), err)
+		}
+		if attempt >= retry.MaxAttempts {
+			return fmt.Errorf(T("重试 %d 次后仍然失败: %w"), attempt, err)
+		}
+		slog.Warn("复制失败，稍后重试", "from", src, "to", dst, "attempt", attempt, "delay", delay, "err", err)
+		s.tracker.Retry(src)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf(T("已终止(%w): %v"), context.Cause(ctx), err)
+		}
+		delay = min(delay*2, retry.MaxDelay)
+	}
+}
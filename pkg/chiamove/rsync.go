@@ -0,0 +1,75 @@
+package chiamove
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+type RsyncConfig struct {
+	Binary string   `yaml:"binary"`
+	Args   []string `yaml:"args"`
+}
+
+// 默认参数，支持断点续传
+// --partial 使得rsync在单个文件传输被中断时保留部分文件，以便续传
+// --append-verify 使用文件已传输的部分，完成后校验整个文件，不一致时重新传输
+// 不使用 -z，plot文件无法压缩，压缩只会浪费CPU
+var defaultRsyncArgs = []string{"-av", "--partial", "--append-verify"}
+
+// rsyncCopy 按 c 中的rsync、ssh和网络文件系统配置把 src 复制为 target
+func rsyncCopy(ctx context.Context, c *Config, src, target string) error {
+	args := append([]string{}, c.Rsync.Args...)
+	if c.DirSize.OneFileSystem {
+		args = append(args, "--one-file-system")
+	}
+	if bwlimit := rsyncBwlimit(c); bwlimit != "" {
+		args = append(args, "--bwlimit="+bwlimit)
+	}
+	if _, ok := networkDest(filepath.Dir(target)); ok {
+		args = networkRsyncArgs(c.NetworkFS, args)
+	}
+	if _, ok := parseRsyncDaemon(target); ok {
+		args = rsyncDaemonArgs(c.RsyncDaemon, args)
+	}
+	if r, ok := parseRemote(target); ok {
+		args = append(args, "-e", c.SSH.command())
+		target = r.rsyncTarget()
+	}
+	if r, ok := parseRemote(src); ok {
+		// 从 ssh:// 源拉取
+		args = append(args, "-e", c.SSH.command())
+		src = r.rsyncTarget()
+	}
+	if info, err := os.Stat(src); err == nil && info.IsDir() {
+		// 带斜杠时复制文件夹里的内容，而不是在 target 下再建一层
+		src += string(filepath.Separator)
+	}
+	cmd := exec.CommandContext(ctx, c.Rsync.Binary, append(args, src, target)...)
+	setProcessGroup(cmd)
+	// 被终止时rsync的子进程可能还占着输出管道，不无限等待
+	cmd.WaitDelay = 5 * time.Second
+	stdout := newLogWriter(slog.LevelDebug, "src", src)
+	stderr := newLogWriter(slog.LevelWarn, "src", src)
+	var errOutput bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = io.MultiWriter(stderr, &errOutput)
+	err := cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+	if err != nil {
+		code := -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		}
+		return &rsyncError{code: code, stderr: errOutput.String(), err: err}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package chiamove
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RsyncDaemonConfig rsync://host[:port]/module/path 目标使用的参数，用于harvester上运行rsyncd而不允许ssh的环境
+type RsyncDaemonConfig struct {
+	// 传给rsync的 --password-file，为空时rsync使用环境变量 RSYNC_PASSWORD
+	PasswordFile string `yaml:"passwordFile"`
+}
+
+// rsyncDaemonTarget 对应 rsync://host[:port]/module/path 形式的目标路径，列出、删除和查询容量时按 cfg 执行rsync
+type rsyncDaemonTarget struct {
+	host   string
+	module string
+	path   string // 模块内的路径，模块根目录为 /
+	cfg    *Config
+}
+
+func parseRsyncDaemon(dest string) (rsyncDaemonTarget, bool) {
+	rest, ok := strings.CutPrefix(dest, "rsync://")
+	if !ok {
+		return rsyncDaemonTarget{}, false
+	}
+	host, p, _ := strings.Cut(rest, "/")
+	module, p, _ := strings.Cut(p, "/")
+	return rsyncDaemonTarget{host: host, module: module, path: path.Clean("/" + p)}, true
+}
+
+// rsyncDaemonFor 解析 rsync:// 路径，按 c 中的rsync配置执行命令
+func rsyncDaemonFor(c *Config, dest string) (rsyncDaemonTarget, bool) {
+	t, ok := parseRsyncDaemon(dest)
+	t.cfg = c
+	return t, ok
+}
+
+// url 返回模块内路径 p 对应的rsync地址
+func (t rsyncDaemonTarget) url(p string) string {
+	return "rsync://" + t.host + "/" + t.module + path.Clean("/"+p)
+}
+
+// dirURL 返回目标目录的rsync地址，以 / 结尾时rsync列出或同步目录中的内容
+func (t rsyncDaemonTarget) dirURL() string {
+	return strings.TrimSuffix(t.url(t.path), "/") + "/"
+}
+
+// dest 返回目标下名为 name 的rsync地址
+func (t rsyncDaemonTarget) dest(name string) string {
+	return t.url(path.Join(t.path, name))
+}
+
+func (c RsyncDaemonConfig) passwordArgs() []string {
+	if c.PasswordFile == "" {
+		return nil
+	}
+	return []string{"--password-file=" + c.PasswordFile}
+}
+
+// rsyncDaemonArgs rsyncd不能在远端改名，改为让rsync把未完成的文件放在 .chiamove.partial 目录中，
+// 每个文件完成后才以最终名称出现；--partial-dir 不能与 --inplace、--append 同时使用
+func rsyncDaemonArgs(c RsyncDaemonConfig, args []string) []string {
+	args = slices.DeleteFunc(args, func(a string) bool {
+		return a == "--partial" || a == "--inplace" || a == "--append" || a == "--append-verify"
+	})
+	return append(append(args, "--partial-dir="+partialSuffix), c.passwordArgs()...)
+}
+
+// runRsync 执行不传输数据的rsync命令，返回标准输出
+func (t rsyncDaemonTarget) runRsync(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, t.cfg.Rsync.Binary, append(t.cfg.RsyncDaemon.passwordArgs(), args...)...)
+	setProcessGroup(cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("rsync %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// rsyncd列出的条目，如 drwxr-xr-x          4,096 2023/05/01 12:00:00 name
+var rsyncListPattern = regexp.MustCompile(`^([-dlcbps])\S*\s+([\d,.]+)\s+\S+\s+\S+\s+(.+)$`)
+
+type rsyncListEntry struct {
+	name string // 相对列出的目录
+	dir  bool
+	size uint64
+}
+
+// list 用 rsync --list-only 列出目标下的条目，recursive 时包括所有子目录中的文件
+func (t rsyncDaemonTarget) list(recursive bool) ([]rsyncListEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), agentRequestTimeout)
+	defer cancel()
+	args := []string{"--list-only"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	out, err := t.runRsync(ctx, append(args, t.dirURL())...)
+	if err != nil {
+		return nil, err
+	}
+	var entries []rsyncListEntry
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		m := rsyncListPattern.FindStringSubmatch(scanner.Text())
+		if m == nil || m[3] == "." {
+			continue
+		}
+		size, _ := strconv.ParseUint(strings.NewReplacer(",", "", ".", "").Replace(m[2]), 10, 64)
+		name, _, _ := strings.Cut(m[3], " -> ")
+		entries = append(entries, rsyncListEntry{name: name, dir: m[1] == "d", size: size})
+	}
+	return entries, nil
+}
+
+// names 返回目标下第一级已完成的plot文件和文件夹的名称，以及其中所有 .plot 文件的名称
+func (t rsyncDaemonTarget) names() ([]string, error) {
+	entries, err := t.list(true)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if strings.Contains(e.name, partialSuffix) {
+			continue
+		}
+		first, _, _ := strings.Cut(e.name, "/")
+		if first == e.name {
+			if indexable(first, e.dir) {
+				names = append(names, first)
+			}
+		} else if base := path.Base(e.name); !e.dir && strings.HasSuffix(base, ".plot") {
+			names = append(names, base)
+		}
+	}
+	return names, nil
+}
+
+func (t rsyncDaemonTarget) ready() error {
+	_, err := t.list(false)
+	return err
+}
+
+func (t rsyncDaemonTarget) exists(name string) (bool, error) {
+	entries, err := t.list(false)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		if e.name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// diskUsage rsyncd不能查询剩余空间：设置了 usageAgent 时由该主机上的agent报告，
+// 否则按 capacity 减去目标下已有文件的总大小计算
+func (t rsyncDaemonTarget) diskUsage(dst string) (DiskUsage, error) {
+	d, _ := destinationConfig(t.cfg, dst)
+	if a, ok := agentFor(t.cfg, d.UsageAgent); ok {
+		return a.diskUsage()
+	}
+	if d.Capacity == 0 {
+		return DiskUsage{}, fmt.Errorf(T("rsync:// 目标 %s 需要在 toPathsConfig 中设置 usageAgent 或 capacity"), dst)
+	}
+	entries, err := t.list(true)
+	if err != nil {
+		return DiskUsage{}, err
+	}
+	var used uint64
+	for _, e := range entries {
+		if !e.dir {
+			used += e.size
+		}
+	}
+	capacity := uint64(d.Capacity)
+	return DiskUsage{Total: capacity, Free: capacity - min(used, capacity)}, nil
+}
+
+// remove 用只包含 name 的同步删除目标上的 name，rsyncd的模块需要可写且没有禁止 --delete
+func (t rsyncDaemonTarget) remove(name string) error {
+	empty, err := os.MkdirTemp("", "chiamove-rsyncd-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(empty)
+	ctx, cancel := context.WithTimeout(context.Background(), agentRequestTimeout)
+	defer cancel()
+	_, err = t.runRsync(ctx, "-r", "--delete", "--include=/"+name, "--include=/"+name+"/***", "--exclude=*",
+		empty+string(filepath.Separator), t.dirURL())
+	return err
+}
+
+// rsyncDaemonTransport 通过rsync协议写入 rsync:// 目标，不需要ssh
+type rsyncDaemonTransport struct{ cfg *Config }
+
+func (rsyncDaemonTransport) Name() string { return "rsyncd" }
+
+// Resume 未完成的文件由rsync保留在 .chiamove.partial 目录中，下次复制时自动使用
+func (rsyncDaemonTransport) Resume(src, dst string, interrupted bool) error { return nil }
+
+func (tr rsyncDaemonTransport) Copy(ctx context.Context, src, dst string) error {
+	t, _ := rsyncDaemonFor(tr.cfg, dst)
+	name := filepath.Base(src)
+	exists, err := t.exists(name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf(T("目标已存在: %s"), t.dest(name))
+	}
+	return rsyncCopy(ctx, tr.cfg, src, t.dest(name))
+}
+
+// Verify rsyncd不能按偏移读取，由rsync比较两边完整文件的校验和，sample 与 full 相同
+func (tr rsyncDaemonTransport) Verify(ctx context.Context, src, dst string) error {
+	if tr.cfg.Verify == "none" {
+		return nil
+	}
+	t, _ := rsyncDaemonFor(tr.cfg, dst)
+	name := filepath.Base(src)
+	from := src
+	if info, err := os.Stat(src); err == nil && info.IsDir() {
+		from += string(filepath.Separator)
+	}
+	out, err := t.runRsync(ctx, "-r", "--checksum", "--dry-run", "--itemize-changes", from, t.dest(name))
+	if err != nil {
+		return err
+	}
+	var differ []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// 如 >fc.T...... k32-xxx.plot，需要传输的文件表示内容不一致或缺失
+		if line := scanner.Text(); len(line) > 12 && strings.ContainsRune("<>c", rune(line[0])) && line[1] == 'f' {
+			differ = append(differ, strings.TrimSpace(line[12:]))
+		}
+	}
+	if len(differ) == 0 {
+		return nil
+	}
+	err = fmt.Errorf(T("%w: %s 中的 %s 与源文件不一致"), errVerifyFailed, t.dest(name), strings.Join(differ, ", "))
+	slog.Error("校验未通过，删除目标上的副本并保留源文件", "src", src, "dst", t.dest(name), "err", err)
+	if err := t.remove(name); err != nil {
+		slog.Error("删除校验未通过的目标失败", "path", t.dest(name), "err", err)
+	}
+	return err
+}
+
+func (tr rsyncDaemonTransport) FreeSpace(dst string) (DiskUsage, error) {
+	t, _ := rsyncDaemonFor(tr.cfg, dst)
+	return t.diskUsage(dst)
+}
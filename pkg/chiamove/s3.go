@@ -0,0 +1,465 @@
+package chiamove
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// S3Config s3://bucket/prefix 目标使用的参数，兼容MinIO等S3协议的对象存储
+type S3Config struct {
+	Endpoint    string   `yaml:"endpoint"`    // 默认 https://s3.amazonaws.com
+	Region      string   `yaml:"region"`      // 默认 us-east-1
+	AccessKey   string   `yaml:"accessKey"`   // 为空时使用环境变量 AWS_ACCESS_KEY_ID
+	SecretKey   string   `yaml:"secretKey"`   // 为空时使用环境变量 AWS_SECRET_ACCESS_KEY
+	VirtualHost bool     `yaml:"virtualHost"` // 使用 bucket.endpoint 形式的地址，默认为 endpoint/bucket
+	PartSize    ByteSize `yaml:"partSize"`    // 分段上传每段的大小，默认 64MiB
+	Quota       ByteSize `yaml:"quota"`       // 该前缀下允许使用的容量，0 为不限制
+}
+
+// 不限制容量时报告的总容量和剩余空间
+const s3Unlimited = 1 << 60
+
+// S3最多10000段，每段至少5MiB（最后一段除外）
+const (
+	s3MaxParts    = 10000
+	s3MinPartSize = 5 << 20
+)
+
+// s3Target 对应 s3://bucket/prefix 形式的目标路径，请求时按 cfg 中的地址、密钥和容量
+type s3Target struct {
+	bucket string
+	prefix string
+	cfg    S3Config
+}
+
+func parseS3(dest string) (s3Target, bool) {
+	rest, ok := strings.CutPrefix(dest, "s3://")
+	if !ok {
+		return s3Target{}, false
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	return s3Target{bucket: bucket, prefix: strings.Trim(prefix, "/")}, true
+}
+
+// s3For 解析 s3:// 路径，请求时使用 c 中的 s3 配置
+func s3For(c *Config, dest string) (s3Target, bool) {
+	t, ok := parseS3(dest)
+	t.cfg = c.S3
+	return t, ok
+}
+
+func (t s3Target) key(name string) string {
+	return strings.TrimPrefix(path.Join(t.prefix, name), "/")
+}
+
+// dest 返回前缀下 name 对应的目标写法
+func (t s3Target) dest(name string) string {
+	return "s3://" + t.bucket + "/" + t.key(name)
+}
+
+// 上传不设置超时，由任务的 ctx 控制；其他请求使用 agentRequestTimeout
+var s3Client = &http.Client{}
+
+func (t s3Target) url(key string, query url.Values) *url.URL {
+	u, _ := url.Parse(t.cfg.Endpoint)
+	if t.cfg.VirtualHost {
+		u.Host = t.bucket + "." + u.Host
+		u.Path = "/" + key
+	} else {
+		u.Path = strings.TrimSuffix("/"+t.bucket+"/"+key, "/")
+	}
+	u.RawPath = s3Escape(u.Path, true)
+	u.RawQuery = s3CanonicalQuery(query)
+	return u
+}
+
+// do 发送签名后的请求，状态码不是2xx时返回错误
+func (t s3Target) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := t.url(key, query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if body != nil {
+		sum := md5.Sum(body)
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	s3Sign(t.cfg, req, u, time.Now().UTC())
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("s3 %s %s: %s", method, resp.Status, strings.TrimSpace(string(msg)))
+		if resp.StatusCode == http.StatusNotFound {
+			err = fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// call 发送不需要长时间传输的请求，out 不为nil时解析XML响应
+func (t s3Target) call(method, key string, query url.Values, body []byte, out any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), agentRequestTimeout)
+	defer cancel()
+	resp, err := t.do(ctx, method, key, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return xml.NewDecoder(resp.Body).Decode(out)
+}
+
+// s3Sign 按AWS Signature Version 4签名，不对请求体计算哈希（UNSIGNED-PAYLOAD），由 Content-MD5 保证完整性
+func s3Sign(c S3Config, req *http.Request, u *url.URL, now time.Time) {
+	accessKey, secretKey := c.AccessKey, c.SecretKey
+	if accessKey == "" {
+		accessKey, secretKey = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	headers := map[string]string{"host": u.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonical := strings.Join([]string{req.Method, u.RawPath, u.RawQuery, canonicalHeaders.String(), signedHeaders, "UNSIGNED-PAYLOAD"}, "\n")
+	scope := date + "/" + c.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, c.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape 按SigV4的要求编码，只保留 A-Z a-z 0-9 - _ . ~，keepSlash 时保留路径中的 /
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+type s3Object struct {
+	Key  string `xml:"Key"`
+	Size int64  `xml:"Size"`
+}
+
+// listObjects 列出前缀下的所有对象
+func (t s3Target) listObjects() ([]s3Object, error) {
+	var objects []s3Object
+	query := url.Values{"list-type": {"2"}}
+	if t.prefix != "" {
+		query.Set("prefix", t.prefix+"/")
+	}
+	for {
+		var result struct {
+			Contents              []s3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+		if err := t.call(http.MethodGet, "", query, nil, &result); err != nil {
+			return nil, err
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated {
+			return objects, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// diskUsage 配置了 quota 时统计前缀下已使用的容量，否则视为不限制
+func (t s3Target) diskUsage() (DiskUsage, error) {
+	quota := uint64(t.cfg.Quota)
+	if quota == 0 {
+		return DiskUsage{Total: s3Unlimited, Free: s3Unlimited}, nil
+	}
+	objects, err := t.listObjects()
+	if err != nil {
+		return DiskUsage{}, err
+	}
+	var used uint64
+	for _, o := range objects {
+		used += uint64(o.Size)
+	}
+	return DiskUsage{Total: quota, Free: quota - min(used, quota)}, nil
+}
+
+func (t s3Target) ready() error {
+	query := url.Values{"list-type": {"2"}, "max-keys": {"1"}}
+	if t.prefix != "" {
+		query.Set("prefix", t.prefix+"/")
+	}
+	return t.call(http.MethodGet, "", query, nil, nil)
+}
+
+// list 返回前缀下第一级的名称和其中所有 .plot 文件的名称
+func (t s3Target) list() ([]string, error) {
+	objects, err := t.listObjects()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, o := range objects {
+		rel := strings.TrimPrefix(strings.TrimPrefix(o.Key, t.prefix), "/")
+		first, _, _ := strings.Cut(rel, "/")
+		if indexable(first, first != rel) {
+			names = append(names, first)
+		}
+		if base := path.Base(rel); base != first && strings.HasSuffix(base, ".plot") {
+			names = append(names, base)
+		}
+	}
+	return names, nil
+}
+
+// s3Transport 分段上传到 s3:// 目标，上传完成前对象不可见，直接使用最终名称
+type s3Transport struct{ cfg *Config }
+
+func (s3Transport) Name() string { return "s3" }
+
+func (s3Transport) Resume(src, dst string, interrupted bool) error { return nil }
+
+func (t s3Transport) Copy(ctx context.Context, src, dst string) error {
+	return s3Copy(ctx, t.cfg, src, destPath(dst, filepath.Base(src)))
+}
+
+// Verify 每段上传时都带有 Content-MD5，由对象存储校验
+func (s3Transport) Verify(ctx context.Context, src, dst string) error {
+	return nil
+}
+
+func (tr s3Transport) FreeSpace(dst string) (DiskUsage, error) {
+	t, _ := s3For(tr.cfg, dst)
+	return t.diskUsage()
+}
+
+// s3Copy 把 src（文件或文件夹）上传为 target 下的对象，文件夹中的每个文件为一个对象。
+// 分段上传完成前对象不可见，不需要临时名称；中断后从已上传的分段继续
+func s3Copy(ctx context.Context, c *Config, src, target string) error {
+	t, _ := s3For(c, target)
+	limiters := []*rateLimiter{newRateLimiter(uint64(currentThrottle(c).PerTransfer)), globalLimiter}
+	copied := new(atomic.Uint64)
+	nativeProgress.Store(src, copied)
+	defer nativeProgress.Delete(src)
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return fmt.Errorf(T("s3目标不支持的文件类型: %s"), p)
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		w := &throttledWriter{ctx: ctx, limiters: limiters, copied: copied}
+		return t.uploadFile(ctx, p, t.key(filepath.ToSlash(rel)), w)
+	})
+}
+
+// uploadFile 上传单个文件，w 只提供限速、取消和进度统计
+func (t s3Target) uploadFile(ctx context.Context, src, key string, w *throttledWriter) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	partSize := max(int64(t.cfg.PartSize), (size+s3MaxParts-1)/s3MaxParts)
+	if size <= partSize {
+		body, err := readPart(in, 0, size, w)
+		if err != nil {
+			return err
+		}
+		resp, err := t.do(ctx, http.MethodPut, key, nil, body)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	uploadID, done, err := t.resumeUpload(key)
+	if err != nil {
+		return err
+	}
+	var parts []s3Part
+	for number, offset := 1, int64(0); offset < size; number, offset = number+1, offset+partSize {
+		body, err := readPart(in, offset, min(partSize, size-offset), w)
+		if err != nil {
+			return err
+		}
+		sum := md5.Sum(body)
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+		if done[number] != etag {
+			query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+			resp, err := t.do(ctx, http.MethodPut, key, query, body)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+		}
+		parts = append(parts, s3Part{Number: number, ETag: etag})
+	}
+	return t.completeUpload(key, uploadID, parts)
+}
+
+// readPart 读取 [offset, offset+length)，经过 w 限速和统计进度
+func readPart(in *os.File, offset, length int64, w *throttledWriter) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, length))
+	w.w = buf
+	if _, err := io.Copy(w, io.NewSectionReader(in, offset, length)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type s3Part struct {
+	Number int    `xml:"PartNumber"`
+	ETag   string `xml:"ETag"`
+}
+
+// resumeUpload 返回该对象未完成的分段上传和已上传的分段（段号 -> ETag），没有时新建
+func (t s3Target) resumeUpload(key string) (string, map[int]string, error) {
+	var uploads struct {
+		Uploads []struct {
+			Key      string `xml:"Key"`
+			UploadID string `xml:"UploadId"`
+		} `xml:"Upload"`
+	}
+	if err := t.call(http.MethodGet, "", url.Values{"uploads": {""}, "prefix": {key}}, nil, &uploads); err != nil {
+		return "", nil, err
+	}
+	for _, u := range uploads.Uploads {
+		if u.Key != key {
+			continue
+		}
+		done := map[int]string{}
+		query := url.Values{"uploadId": {u.UploadID}}
+		for {
+			var result struct {
+				Parts                []s3Part `xml:"Part"`
+				IsTruncated          bool     `xml:"IsTruncated"`
+				NextPartNumberMarker string   `xml:"NextPartNumberMarker"`
+			}
+			if err := t.call(http.MethodGet, key, query, nil, &result); err != nil {
+				return "", nil, err
+			}
+			for _, p := range result.Parts {
+				done[p.Number] = p.ETag
+			}
+			if !result.IsTruncated {
+				break
+			}
+			query.Set("part-number-marker", result.NextPartNumberMarker)
+		}
+		return u.UploadID, done, nil
+	}
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := t.call(http.MethodPost, key, url.Values{"uploads": {""}}, nil, &created); err != nil {
+		return "", nil, err
+	}
+	return created.UploadID, nil, nil
+}
+
+func (t s3Target) completeUpload(key, uploadID string, parts []s3Part) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	// 合并较大的对象可能需要几分钟，出错时也可能返回200并在响应体中给出错误
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	resp, err := t.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(data, []byte("<Error>")) {
+		return errors.New("s3: " + string(data))
+	}
+	return nil
+}
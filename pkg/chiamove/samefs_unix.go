@@ -0,0 +1,14 @@
+//go:build unix
+
+package chiamove
+
+import "golang.org/x/sys/unix"
+
+// sameFilesystem 判断两个路径是否在同一个文件系统上，是的话可以直接rename
+func sameFilesystem(a, b string) bool {
+	var sa, sb unix.Stat_t
+	if unix.Stat(a, &sa) != nil || unix.Stat(b, &sb) != nil {
+		return false
+	}
+	return sa.Dev == sb.Dev
+}
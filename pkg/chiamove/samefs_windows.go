@@ -0,0 +1,18 @@
+//go:build windows
+
+package chiamove
+
+import "strings"
+
+// sameFilesystem 判断两个路径是否在同一个卷上，是的话可以直接rename
+func sameFilesystem(a, b string) bool {
+	va, err := deviceID(a)
+	if err != nil {
+		return false
+	}
+	vb, err := deviceID(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(va, vb)
+}
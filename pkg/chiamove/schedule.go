@@ -0,0 +1,157 @@
+package chiamove
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ScheduleConfig 允许开始迁移的时间段，没有配置时全天迁移
+type ScheduleConfig struct {
+	Windows []TimeWindow `yaml:"windows"`
+}
+
+// TimeWindow 一个时间段，end 早于 start 时跨过午夜；throttle 不为空时该时间段内使用这个限速代替 throttle
+type TimeWindow struct {
+	Start    string          `yaml:"start"` // 如 01:00
+	End      string          `yaml:"end"`   // 如 07:00
+	Days     []string        `yaml:"days"`  // mon / tue / ... / sun，按时间段开始的那天判断，为空时每天
+	Throttle *ThrottleConfig `yaml:"throttle"`
+
+	start, end time.Duration
+	days       map[time.Weekday]bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func (s *ScheduleConfig) Validate() error {
+	for i := range s.Windows {
+		w := &s.Windows[i]
+		var err error
+		if w.start, err = parseClock(w.Start); err != nil {
+			return err
+		}
+		if w.end, err = parseClock(w.End); err != nil {
+			return err
+		}
+		if w.start == w.end {
+			return fmt.Errorf(T("schedule.windows 的 start 和 end 不能相同: %s"), w.Start)
+		}
+		w.days = nil
+		for _, d := range w.Days {
+			day, ok := weekdays[strings.ToLower(d)]
+			if !ok {
+				return fmt.Errorf(T("schedule.windows 的 days 无效 %q，可选 mon / tue / wed / thu / fri / sat / sun"), d)
+			}
+			if w.days == nil {
+				w.days = map[time.Weekday]bool{}
+			}
+			w.days[day] = true
+		}
+	}
+	return nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf(T("时间 %q 无效，格式为 HH:MM"), s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// startAt 返回 day 这天该时间段的开始时间，day 不在 days 中时返回 false
+func (w *TimeWindow) startAt(day time.Time) (time.Time, bool) {
+	if w.days != nil && !w.days[day.Weekday()] {
+		return time.Time{}, false
+	}
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	return midnight.Add(w.start), true
+}
+
+func (w *TimeWindow) length() time.Duration {
+	if w.end > w.start {
+		return w.end - w.start
+	}
+	return 24*time.Hour - w.start + w.end
+}
+
+// activeWindow 返回 now 所在的时间段；没有配置时间段时返回 nil, true
+func activeWindow(c *Config, now time.Time) (*TimeWindow, bool) {
+	windows := c.Schedule.Windows
+	if len(windows) == 0 {
+		return nil, true
+	}
+	for i := range windows {
+		w := &windows[i]
+		// 跨午夜的时间段可能是前一天开始的
+		for _, day := range []time.Time{now, now.AddDate(0, 0, -1)} {
+			start, ok := w.startAt(day)
+			if ok && !now.Before(start) && now.Before(start.Add(w.length())) {
+				return w, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// nextWindowStart 返回 now 之后最近的时间段开始时间
+func nextWindowStart(c *Config, now time.Time) time.Time {
+	var next time.Time
+	for i := range c.Schedule.Windows {
+		w := &c.Schedule.Windows[i]
+		for d := 0; d <= 7; d++ {
+			start, ok := w.startAt(now.AddDate(0, 0, d))
+			if ok && start.After(now) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+	return next
+}
+
+// currentThrottle 返回当前时间段的限速
+func currentThrottle(c *Config) ThrottleConfig {
+	if w, _ := activeWindow(c, time.Now()); w != nil && w.Throttle != nil {
+		return *w.Throttle
+	}
+	return c.Throttle
+}
+
+var globalLimiterRate uint64
+
+// updateGlobalLimiter 进入限速不同的时间段时替换全局限速，进行中的任务仍使用开始时的限速
+func updateGlobalLimiter(c *Config) {
+	if rate := uint64(currentThrottle(c).Global); rate != globalLimiterRate {
+		globalLimiter = newRateLimiter(rate)
+		globalLimiterRate = rate
+	}
+}
+
+// waitForWindow 不在允许迁移的时间段内时，守护模式下等到下一个时间段开始（或收到退出信号）并返回 true，
+// 否则返回 false
+func (s *Scheduler) waitForWindow(ctx context.Context, reload <-chan struct{}, opts *Options) bool {
+	for {
+		if _, ok := activeWindow(s.cfg, time.Now()); ok {
+			updateGlobalLimiter(s.cfg)
+			return true
+		}
+		next := nextWindowStart(s.cfg, time.Now())
+		if !s.cfg.Daemon {
+			s.log.Info("不在允许迁移的时间段内，退出", "next", next.Format(time.DateTime))
+			return false
+		}
+		s.log.Info("不在允许迁移的时间段内，等待", "next", next.Format(time.DateTime))
+		select {
+		case <-ctx.Done():
+			return true
+		case <-time.After(time.Until(next)):
+		case <-reload:
+			s.reload(opts)
+		}
+	}
+}
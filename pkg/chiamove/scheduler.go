@@ -0,0 +1,399 @@
+package chiamove
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Scheduler 一次 move 运行的调度：选择源、分配目标、执行任务，以及本次运行中不再选择的源。
+// 选择、分配、复制后端、校验和远程源都按 cfg 以及下面的状态进行，NewScheduler 使用包内共享的状态，API、TUI和进度输出读取的是同一份；
+// 通知、全局限速、harvester刷新和目录锁仍是进程内共享的
+type Scheduler struct {
+	cfg *Config
+	log *slog.Logger
+
+	fsys         FileSystem
+	journal      *Journal
+	stats        *RunStats
+	queue        *SourceQueue
+	tracker      *Tracker
+	reservations *Reservations
+	events       *EventStream
+	speeds       *SpeedStats
+	health       *DestinationHealth
+	faults       *faultInjector
+	// transport 返回目标使用的复制后端，默认为按 cfg 的 transportFor
+	transport func(dst string) Transport
+
+	mu      sync.Mutex
+	skipped map[string]bool // 目标上已有同名plot等本次运行中跳过的源，失败和取消的源记录在任务日志中
+	wg      sync.WaitGroup
+	// 连续空闲时下一次等待的时长，0 表示从 scanInterval 开始
+	idleDelay time.Duration
+	// 开始扫描、分配目标的时间（UnixNano），在等待或复制中时为0，供 systemd watchdog 判断调度是否卡住
+	busySince atomic.Int64
+}
+
+func NewScheduler(cfg *Config, log *slog.Logger) *Scheduler {
+	s := &Scheduler{
+		cfg: cfg, log: log,
+		fsys: osFS{}, journal: journal, stats: runStats, queue: sourceQueue, tracker: tracker, reservations: reservations,
+		events: events, speeds: destSpeeds, health: destHealth, faults: faults,
+		skipped: map[string]bool{},
+	}
+	s.transport = func(dst string) Transport { return transportFor(s.cfg, dst) }
+	return s
+}
+
+// reload 重新加载配置，失败时继续使用原来的配置
+func (s *Scheduler) reload(opts *Options) {
+	if c := reloadConfig(opts); c != nil {
+		s.cfg = c
+	}
+}
+
+// Loop 续传未完成的任务后持续调度，直到源盘已空、目标已满（守护模式下不退出）或收到退出信号，返回退出码
+func (s *Scheduler) Loop(ctx context.Context, opts *Options) int {
+	s.resumeJournal(ctx)
+	reload := WatchConfig(opts.ConfigPath, s.cfg.WatchConfig)
+	// 守护模式下同一种空闲状态只通知一次
+	var idle Event
+	for {
+		select {
+		case <-reload:
+			s.reload(opts)
+		default:
+		}
+		s.tracker.WaitIfPaused(ctx)
+		if !s.waitForWindow(ctx, reload, opts) {
+			return s.stats.ExitCode(exitOK)
+		}
+		if ctx.Err() != nil {
+			s.log.Info("已停止，未完成的任务下次启动时续传")
+			return s.stats.ExitCode(exitOK)
+		}
+		s.setBusy(true)
+		discoverDestinations(s.cfg)
+		s.queue.Prune(s.fsys)
+		var executors []*Executor
+		skip := func(path string, isDir bool) bool {
+			return s.ShouldSkip(path)
+		}
+		if s.cfg.Duplicates.Action != "off" {
+			index := buildPlotIndex(s.cfg, s.destinations())
+			skip = func(path string, isDir bool) bool {
+				if s.ShouldSkip(path) {
+					return true
+				}
+				if handleDuplicate(s.cfg, index, path, isDir) {
+					s.Skip(path)
+					return true
+				}
+				return false
+			}
+		}
+		for _, exe := range s.scan(sourcePaths(s.cfg), skip) {
+			if exe == nil {
+				continue
+			}
+			if to, ok := overlappingDestination(exe.fromPath, s.destinations()); ok {
+				s.log.Error("源和目标重叠，拒绝迁移", "from", exe.fromPath, "to", to)
+				s.Skip(exe.fromPath)
+				continue
+			}
+			executors = append(executors, exe)
+		}
+		if len(executors) == 0 {
+			if idle != EventSourceEmpty {
+				idle = EventSourceEmpty
+				s.log.Info("A盘已空，请换盘！")
+				Notify(Notification{Event: EventSourceEmpty, Message: T("A盘已空，请换盘！")})
+				s.allDone(ctx, string(EventSourceEmpty))
+			}
+			if !s.cfg.Daemon {
+				return s.stats.ExitCode(exitOK)
+			}
+			s.setBusy(false)
+			s.waitIdle(ctx, reload, opts)
+			continue
+		}
+		if executors = s.limitExecutors(executors); len(executors) == 0 {
+			s.allDone(ctx, "limit_reached")
+			return s.stats.ExitCode(exitOK)
+		}
+		index := s.assignDestinations(executors, nil)
+		if index == 0 {
+			if idle != EventDestinationsFull {
+				idle = EventDestinationsFull
+				s.log.Info("B盘已满，任务完成！")
+				Notify(Notification{Event: EventDestinationsFull, Message: T("B盘已满，任务完成！")})
+				s.allDone(ctx, string(EventDestinationsFull))
+			}
+			if !s.cfg.Daemon && !s.cfg.DiskSwap.Wait {
+				return s.stats.ExitCode(exitNoDestinations)
+			}
+			need := slices.MinFunc(executors, func(a, b *Executor) int { return cmp.Compare(a.size, b.size) }).size
+			s.setBusy(false)
+			s.waitForSpace(ctx, reload, opts, need)
+			continue
+		}
+		idle = ""
+		s.idleDelay = 0
+		index = min(index, concurrency.Limit(s.cfg.Concurrency))
+		if s.cfg.DryRun {
+			// 不实际复制时源不会减少，只规划一轮
+			for _, exe := range executors[:index] {
+				s.log.Info("dry-run: 将要迁移", "from", exe.fromPath, "to", exe.toPath, "size", exe.size)
+			}
+			return exitOK
+		}
+		// 复制有 stallTimeout、transferTimeout 检测，不计入
+		s.setBusy(false)
+		s.Run(ctx, executors[:index])
+	}
+}
+
+// setBusy 记录调度进入或离开扫描、分配目标等不会主动等待的步骤
+func (s *Scheduler) setBusy(busy bool) {
+	if !busy {
+		s.busySince.Store(0)
+		return
+	}
+	s.busySince.CompareAndSwap(0, time.Now().UnixNano())
+}
+
+// Stuck 调度在扫描、分配目标等步骤中超过 timeout 没有完成时返回 true，如源或目标硬盘掉线导致读取一直阻塞
+func (s *Scheduler) Stuck(timeout time.Duration) bool {
+	since := s.busySince.Load()
+	return since != 0 && time.Since(time.Unix(0, since)) >= timeout
+}
+
+// scan 最多同时在 scanWorkers 个源路径下查找可以迁移的源，网络挂载的源较多时不用逐个等待；
+// 结果按 fromPaths 的顺序排列，没有可迁移的源或出错的为 nil，出错的源路径记录在运行汇总中
+func (s *Scheduler) scan(fromPaths []string, skip func(path string, isDir bool) bool) []*Executor {
+	found := make([]*Executor, len(fromPaths))
+	sem := make(chan struct{}, s.cfg.ScanWorkers)
+	var wg sync.WaitGroup
+	for i, fromPath := range fromPaths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, fromPath string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			p, size, err := s.getCanMovePath(fromPath, skip)
+			switch {
+			case err == nil:
+				found[i] = &Executor{fromPath: p, size: size}
+			case !errors.Is(err, errNoCandidate):
+				// 源路径无法读取（如硬盘掉线、权限不足）时跳过，不影响其他源
+				s.stats.ScanFailed(fromPath, err)
+				return
+			}
+			s.stats.ScanSucceeded(fromPath)
+		}(i, fromPath)
+	}
+	wg.Wait()
+	return found
+}
+
+// waitIdle 守护模式下没有可迁移的任务时，等待一段时间、被唤醒或配置重新加载后再扫描；
+// 连续空闲时等待时长从 scanInterval 开始翻倍，最长 maxScanInterval
+func (s *Scheduler) waitIdle(ctx context.Context, reload <-chan struct{}, opts *Options) {
+	if s.idleDelay == 0 {
+		s.idleDelay = s.cfg.ScanInterval
+	}
+	delay := s.idleDelay
+	s.idleDelay = min(s.idleDelay*2, s.cfg.MaxScanInterval)
+	s.log.Debug("没有可迁移的源，等待后重新扫描", "delay", delay)
+	select {
+	case <-ctx.Done():
+	case <-time.After(delay):
+	case <-wakeCh:
+		s.idleDelay = 0
+	case <-reload:
+		s.idleDelay = 0
+		s.reload(opts)
+	}
+}
+
+// Skip 本次运行中不再选择该源
+func (s *Scheduler) Skip(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skipped[path] = true
+}
+
+func (s *Scheduler) ShouldSkip(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return isFailedPath(path) || s.skipped[path] || s.journal.Completed(path) || s.journal.Failed(path) || s.queue.Scheduled(path)
+}
+
+// Run 并发执行已分配目标的任务，全部结束后返回
+func (s *Scheduler) Run(ctx context.Context, executors []*Executor) {
+	cancels := make([]context.CancelCauseFunc, len(executors))
+	ctxs := make([]context.Context, len(executors))
+	for i, exe := range executors {
+		ctxs[i], cancels[i] = context.WithCancelCause(ctx)
+		s.journal.Set(exe.fromPath, exe.toPath, StateQueued, nil)
+		s.tracker.Queue(exe.fromPath, exe.toPath, cancels[i])
+		s.events.Emit(TransferEvent{Type: "queued", Src: exe.fromPath, Dst: exe.toPath, Size: exe.size})
+		s.reservations.Reserve(exe.toPath, exe.fromPath, exe.size)
+		s.queue.Schedule(exe.fromPath, exe.size)
+	}
+	round := make([]Transfer, len(executors))
+	for i, exe := range executors {
+		s.wg.Add(1)
+		go func(i int, ctx context.Context, cancel context.CancelCauseFunc, exe *Executor) {
+			defer s.wg.Done()
+			defer cancel(nil)
+			defer func() { s.reservations.Release(exe.toPath, exe.fromPath) }()
+			defer forgetDirSize(exe.fromPath)
+			defer s.queue.Remove(exe.fromPath)
+			closeLog := openTransferLog(s.cfg, exe.fromPath, exe.toPath)
+			if s.cfg.TransferTimeout > 0 {
+				var stop context.CancelFunc
+				ctx, stop = context.WithTimeoutCause(ctx, s.cfg.TransferTimeout, errTransferTimeout)
+				defer stop()
+			}
+			release, err := sourceDevices.Acquire(ctx, exe.fromPath)
+			if err == nil {
+				defer release()
+				err = s.cfg.Hooks.run(ctx, "preTransfer", s.cfg.Hooks.PreTransfer, transferHookEnv(exe.fromPath, exe.toPath, exe.size, 0, nil))
+			}
+			if err == nil {
+				s.log.Info("开始迁移", "from", exe.fromPath, "to", exe.toPath)
+				s.journal.Set(exe.fromPath, exe.toPath, StateRunning, nil)
+				s.tracker.Start(exe.fromPath, exe.size)
+				s.events.Emit(TransferEvent{Type: "started", Src: exe.fromPath, Dst: exe.toPath, Size: exe.size})
+				err = s.copyWithRetry(ctx, exe.fromPath, exe.toPath)
+				tried := []string{exe.toPath}
+				for isNoSpace(err) && ctx.Err() == nil && s.reroute(exe, tried, err) {
+					tried = append(tried, exe.toPath)
+					err = s.copyWithRetry(ctx, exe.fromPath, exe.toPath)
+				}
+			}
+			tr := s.tracker.Finish(exe.fromPath, err)
+			round[i] = tr
+			s.recordHistory(tr)
+			if !errors.Is(context.Cause(ctx), errShutdown) && !errors.Is(err, errDuplicate) {
+				s.stats.Add(tr)
+			}
+			if err != nil {
+				s.events.Emit(TransferEvent{Type: "failed", Src: exe.fromPath, Dst: exe.toPath, Size: exe.size, Copied: tr.Copied, Error: err.Error()})
+			} else {
+				s.events.Emit(TransferEvent{Type: "completed", Src: exe.fromPath, Dst: exe.toPath, Size: exe.size, Copied: tr.Copied})
+			}
+			switch {
+			case errors.Is(context.Cause(ctx), errShutdown):
+				// 任务日志中仍是排队或迁移中，下次启动时续传
+				s.log.Warn("进程退出，任务已中断", "from", exe.fromPath, "to", exe.toPath)
+			case errors.Is(context.Cause(ctx), errCanceledByUser):
+				s.log.Warn("任务已取消", "from", exe.fromPath, "to", exe.toPath)
+				s.journal.Set(exe.fromPath, exe.toPath, StateFailed, err)
+			case isNoSpace(err):
+				// 不当作失败的源；目标的剩余空间与实际可写入的不一致时，reroute 记录的失败次数达到上限后暂停该目标
+				s.log.Warn("目标空间不足，没有其他可用的目标，下一轮重新分配", "from", exe.fromPath, "to", exe.toPath, "err", err)
+				s.journal.Remove(exe.fromPath)
+			case errors.Is(err, errDuplicate):
+				// 与扫描时发现的重复plot相同，保留源，本次运行中不再选择
+				s.log.Warn("目标上已有完整的同名副本，跳过该源", "from", exe.fromPath, "to", exe.toPath, "err", err)
+				s.journal.Remove(exe.fromPath)
+				s.Skip(exe.fromPath)
+			case err != nil:
+				s.log.Error("复制失败", "from", exe.fromPath, "to", exe.toPath, "err", err)
+				s.journal.Set(exe.fromPath, exe.toPath, StateFailed, err)
+				if destinationFault(exe.fromPath, err) {
+					s.health.Failed(s.cfg, exe.toPath, err)
+				}
+				Notify(Notification{
+					Event:   EventTransferFailed,
+					Message: fmt.Sprintf(T("复制失败 %s -> %s: %v"), exe.fromPath, exe.toPath, err),
+					Src:     exe.fromPath, Dst: exe.toPath, Size: exe.size, Error: err.Error(),
+				})
+				if moved := handleFailed(s.cfg, exe.fromPath); moved != exe.fromPath {
+					s.Skip(moved)
+				}
+				digest.Add(tr)
+				s.cfg.Hooks.run(context.WithoutCancel(ctx), "onFailure", s.cfg.Hooks.OnFailure, transferHookEnv(exe.fromPath, exe.toPath, exe.size, tr.Elapsed(), err))
+			default:
+				s.log.Info("复制成功", "from", exe.fromPath, "to", exe.toPath)
+				s.journal.Set(exe.fromPath, exe.toPath, StateDone, nil)
+				s.health.Succeeded(exe.toPath)
+				RequestHarvesterRefresh(s.cfg, exe.toPath)
+				Notify(Notification{
+					Event:   EventTransferDone,
+					Message: fmt.Sprintf(T("复制成功 %s -> %s (%s)"), exe.fromPath, exe.toPath, formatBytes(exe.size)),
+					Src:     exe.fromPath, Dst: exe.toPath, Size: exe.size,
+				})
+				digest.Add(tr)
+				s.cfg.Hooks.run(ctx, "postTransfer", s.cfg.Hooks.PostTransfer, transferHookEnv(exe.fromPath, exe.toPath, exe.size, tr.Elapsed(), nil))
+			}
+			closeLog(tr, err)
+		}(i, ctxs[i], cancels[i], exe)
+	}
+	s.wg.Wait()
+	concurrency.Observe(s.cfg.Concurrency, round)
+}
+
+// reroute 任务因目标空间不足失败时删除该目标上未完成的副本，换到还没有尝试过的下一个可用目标；
+// 没有可用的目标时返回 false，任务仍使用原来的目标
+func (s *Scheduler) reroute(exe *Executor, tried []string, err error) bool {
+	from := exe.toPath
+	removePartial(s.cfg, exe.fromPath, from)
+	s.health.Failed(s.cfg, from, err)
+	s.reservations.Release(from, exe.fromPath)
+	next := &Executor{fromPath: exe.fromPath, size: exe.size}
+	if s.assignDestinations([]*Executor{next}, tried) == 0 {
+		s.reservations.Reserve(from, exe.fromPath, exe.size)
+		return false
+	}
+	exe.toPath = next.toPath
+	s.reservations.Reserve(exe.toPath, exe.fromPath, exe.size)
+	s.log.Warn("目标空间不足，换到下一个目标", "from", exe.fromPath, "full", from, "to", exe.toPath, "err", err)
+	s.journal.Set(exe.fromPath, exe.toPath, StateRunning, nil)
+	s.tracker.Reroute(exe.fromPath, exe.toPath)
+	s.events.Emit(TransferEvent{Type: "rerouted", Src: exe.fromPath, Dst: exe.toPath, Size: exe.size})
+	return true
+}
+
+// resumeJournal 续传上次进程退出时还没有完成的任务
+func (s *Scheduler) resumeJournal(ctx context.Context) {
+	var executors []*Executor
+	for _, e := range s.journal.Pending() {
+		if _, err := s.fsys.Stat(e.Src); err != nil && !isRemoteSource(e.Src) {
+			if errors.Is(err, fs.ErrNotExist) {
+				// 源已经不存在，说明上次复制完成后已删除源目录
+				s.journal.Set(e.Src, e.Dst, StateDone, nil)
+				continue
+			}
+			// 源盘暂时无法访问（如没有挂载）时保留任务，下次启动时再续传
+			s.log.Warn("无法访问源，暂不续传", "from", e.Src, "to", e.Dst, "err", err)
+			continue
+		}
+		if s.cfg.DryRun {
+			s.log.Info("dry-run: 将续传未完成的任务", "from", e.Src, "to", e.Dst)
+			continue
+		}
+		s.log.Info("续传未完成的任务", "from", e.Src, "to", e.Dst)
+		size, _ := dirSize(s.fsys, s.cfg.DirSize, e.Src)
+		if isHTTPSource(e.Src) {
+			size, _ = httpSourceSize(ctx, s.cfg, e.Src)
+		}
+		if isSSHSource(e.Src) {
+			size, _ = sshSourceSize(ctx, s.cfg, e.Src)
+		}
+		executors = append(executors, &Executor{fromPath: e.Src, toPath: e.Dst, size: size})
+	}
+	if len(executors) > 0 {
+		s.Run(ctx, executors)
+	}
+}
@@ -0,0 +1,396 @@
+package chiamove
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeTransport 测试用的复制后端：按 copy 返回错误，没有设置或返回nil且 ctx 没有结束时真正复制文件；剩余空间按 free，没有设置的为 1GiB
+type fakeTransport struct {
+	mu     sync.Mutex
+	copy   func(src, dst string) error
+	free   map[string]uint64
+	copied []string // 成功复制的 src -> dst
+}
+
+func (t *fakeTransport) Name() string                                   { return "fake" }
+func (t *fakeTransport) Resume(src, dst string, interrupted bool) error { return nil }
+
+func (t *fakeTransport) Copy(ctx context.Context, src, dst string) error {
+	if t.copy != nil {
+		if err := t.copy(src, dst); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(filepath.Join(dst, filepath.Base(src)))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.copied = append(t.copied, src+" -> "+dst)
+	return nil
+}
+
+func (t *fakeTransport) Verify(ctx context.Context, src, dst string) error { return nil }
+
+func (t *fakeTransport) FreeSpace(dst string) (DiskUsage, error) {
+	free, ok := t.free[dst]
+	if !ok {
+		free = 1 << 30
+	}
+	return DiskUsage{Total: 2 << 30, Free: free}, nil
+}
+
+// newTestConfig 在代码中构造配置，目标为 dsts；保留源，避免同一个文件系统上直接rename而不经过复制后端
+func newTestConfig(t *testing.T, src string, dsts ...string) *Config {
+	t.Helper()
+	c := &Config{
+		FromPaths:    []string{src},
+		ToPaths:      dsts,
+		DeletePolicy: "never",
+	}
+	c.FromPathFilter.Extension = ".plot"
+	c.FromPathFilter.MinSize = 1
+	c.FromPathFilter.MaxSize = 1 << 30
+	c.History.File = filepath.Join(t.TempDir(), "history.jsonl")
+	c.Retry.MaxAttempts = 1
+	c.applyDefaults()
+	if err := c.compile(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// newTestScheduler 使用独立的状态创建调度，不读取也不修改包内共享的状态
+func newTestScheduler(t *testing.T, c *Config, transport *fakeTransport) *Scheduler {
+	t.Helper()
+	j, err := OpenJournal(filepath.Join(t.TempDir(), "journal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewScheduler(c, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	s.fsys = osFS{}
+	s.journal = j
+	s.stats = &RunStats{start: time.Now(), perDest: map[string]*destStats{}, scanErrors: map[string]string{}}
+	s.queue = &SourceQueue{items: map[string]*queuedSource{}}
+	s.tracker = NewTracker()
+	s.reservations = &Reservations{m: map[string]map[string]uint64{}}
+	s.events = nil
+	s.speeds = &SpeedStats{speeds: map[string]float64{}}
+	s.health = &DestinationHealth{dests: map[string]*destHealthState{}}
+	s.faults = nil
+	s.transport = func(string) Transport { return transport }
+	return s
+}
+
+func writePlot(t *testing.T, dir, name string, size int, mtime time.Time) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !mtime.IsZero() {
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+func noSkip(string, bool) bool { return false }
+
+func TestGetCanMovePath(t *testing.T) {
+	src := t.TempDir()
+	old := writePlot(t, src, "plot-a.plot", 100, time.Now().Add(-2*time.Hour))
+	newest := writePlot(t, src, "plot-b.plot", 100, time.Now().Add(-time.Hour))
+	writePlot(t, src, "skip-c.plot", 100, time.Time{})
+	writePlot(t, src, "notes.txt", 100, time.Time{})
+
+	c := newTestConfig(t, src, t.TempDir())
+	c.FromPathFilter.ExcludeRegex = []string{`^skip-`}
+	c.SourceOrder = "oldest"
+	if err := c.compile(); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestScheduler(t, c, &fakeTransport{})
+
+	got, size, err := s.getCanMovePath(src, noSkip)
+	if err != nil || got != old || size != 100 {
+		t.Fatalf("getCanMovePath = %q, %d, %v; want %q, 100, nil", got, size, err, old)
+	}
+
+	// keepOnSource 保留最新的plot
+	c.KeepOnSource = 1
+	skipOld := func(path string, isDir bool) bool { return path == old }
+	if got, _, err := s.getCanMovePath(src, skipOld); !errors.Is(err, errNoCandidate) {
+		t.Errorf("with keepOnSource=1 and %s skipped: got %q, %v; want errNoCandidate", old, got, err)
+	}
+	c.KeepOnSource = 0
+	if got, _, _ := s.getCanMovePath(src, skipOld); got != newest {
+		t.Errorf("with %s skipped: got %q, want %q", old, got, newest)
+	}
+
+	c.FromPathFilter.MaxSize = 50
+	if got, _, err := s.getCanMovePath(src, noSkip); !errors.Is(err, errNoCandidate) {
+		t.Errorf("with maxSize below plot size: got %q, %v; want errNoCandidate", got, err)
+	}
+}
+
+func TestScanRecordsUnreadableSource(t *testing.T) {
+	src := t.TempDir()
+	missing := filepath.Join(src, "missing")
+	writePlot(t, src, "plot-a.plot", 100, time.Time{})
+	s := newTestScheduler(t, newTestConfig(t, src, t.TempDir()), &fakeTransport{})
+
+	found := s.scan([]string{missing, src}, noSkip)
+	if found[0] != nil || found[1] == nil {
+		t.Fatalf("scan = %v, want [nil, executor]", found)
+	}
+	if _, ok := s.stats.scanErrors[missing]; !ok {
+		t.Errorf("scan error for %s not recorded: %v", missing, s.stats.scanErrors)
+	}
+}
+
+func TestAssignDestinations(t *testing.T) {
+	src := t.TempDir()
+	full, d2, d3 := t.TempDir(), t.TempDir(), t.TempDir()
+	c := newTestConfig(t, src, full, d2, d3)
+	reserve := ByteSize(50)
+	c.MinFreeReserve = reserve
+	transport := &fakeTransport{free: map[string]uint64{full: 120, d2: 1000, d3: 1000}}
+	s := newTestScheduler(t, c, transport)
+
+	executors := []*Executor{
+		{fromPath: filepath.Join(src, "a.plot"), size: 100},
+		{fromPath: filepath.Join(src, "b.plot"), size: 100},
+		{fromPath: filepath.Join(src, "c.plot"), size: 100},
+	}
+	// full 放下100字节后低于预留空间，其他目标的 maxConcurrent 默认为1
+	if n := s.assignDestinations(executors, nil); n != 2 {
+		t.Fatalf("assignDestinations = %d, want 2", n)
+	}
+	if executors[0].toPath != d2 || executors[1].toPath != d3 || executors[2].toPath != "" {
+		t.Errorf("assigned to %q, %q, %q; want %q, %q, \"\"", executors[0].toPath, executors[1].toPath, executors[2].toPath, d2, d3)
+	}
+
+	// 正在写入的任务占用 maxConcurrent 的名额
+	s.reservations.Reserve(d2, "other", 100)
+	next := []*Executor{{fromPath: filepath.Join(src, "d.plot"), size: 100}}
+	if n := s.assignDestinations(next, []string{d3}); n != 0 {
+		t.Errorf("assignDestinations with d2 busy and d3 excluded = %d (%s), want 0", n, next[0].toPath)
+	}
+}
+
+func TestAssignDestinationsRoutes(t *testing.T) {
+	src := t.TempDir()
+	d1, d2 := t.TempDir(), t.TempDir()
+	c := newTestConfig(t, src, d1, d2)
+	c.DestinationGroups = map[string][]string{"second": {d2}}
+	c.Routes = []Route{{From: src, Group: "second"}}
+	s := newTestScheduler(t, c, &fakeTransport{})
+
+	executors := []*Executor{{fromPath: filepath.Join(src, "a.plot"), size: 100}}
+	if n := s.assignDestinations(executors, nil); n != 1 || executors[0].toPath != d2 {
+		t.Errorf("assignDestinations = %d, %q; want 1, %q", n, executors[0].toPath, d2)
+	}
+}
+
+func TestLimitExecutors(t *testing.T) {
+	c := newTestConfig(t, t.TempDir(), t.TempDir())
+	s := newTestScheduler(t, c, &fakeTransport{})
+	s.stats.Add(Transfer{Src: "moved.plot", Size: 100})
+	executors := []*Executor{{fromPath: "a", size: 100}, {fromPath: "b", size: 100}, {fromPath: "c", size: 100}}
+
+	c.Limits.MaxPlotsPerRun = 3
+	if got := s.limitExecutors(executors); len(got) != 2 {
+		t.Errorf("maxPlotsPerRun=3 with 1 moved: %d executors, want 2", len(got))
+	}
+	c.Limits.MaxPlotsPerRun = 0
+	c.Limits.MaxBytesPerRun = 250
+	if got := s.limitExecutors(executors); len(got) != 1 {
+		t.Errorf("maxBytesPerRun=250 with 100 moved: %d executors, want 1", len(got))
+	}
+	c.Limits.MaxBytesPerRun = 100
+	if got := s.limitExecutors(executors); len(got) != 0 {
+		t.Errorf("maxBytesPerRun reached: %d executors, want 0", len(got))
+	}
+}
+
+func TestRunSucceeded(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	p := writePlot(t, src, "plot-a.plot", 100, time.Time{})
+	transport := &fakeTransport{}
+	s := newTestScheduler(t, newTestConfig(t, src, dst), transport)
+
+	s.Run(context.Background(), []*Executor{{fromPath: p, toPath: dst, size: 100}})
+	if !s.journal.Completed(p) {
+		t.Errorf("journal entry for %s not done", p)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "plot-a.plot")); err != nil {
+		t.Errorf("plot not copied: %v", err)
+	}
+	if moved, bytes := s.stats.Totals(); moved != 1 || bytes != 100 {
+		t.Errorf("stats = %d, %d; want 1, 100", moved, bytes)
+	}
+	if s.reservations.Outstanding(s.cfg, dst) != 0 || s.queue.Scheduled(p) {
+		t.Error("reservation or queue entry not released after Run")
+	}
+}
+
+func TestRunFailed(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	p := writePlot(t, src, "plot-a.plot", 100, time.Time{})
+	transport := &fakeTransport{copy: func(src, dst string) error { return errors.New("boom") }}
+	s := newTestScheduler(t, newTestConfig(t, src, dst), transport)
+
+	s.Run(context.Background(), []*Executor{{fromPath: p, toPath: dst, size: 100}})
+	if !s.journal.Failed(p) {
+		t.Errorf("journal entry for %s not failed", p)
+	}
+	if !s.ShouldSkip(p) {
+		t.Errorf("failed source %s would be scheduled again", p)
+	}
+	if s.stats.ExitCode(exitOK) != exitPartialFailure {
+		t.Errorf("exit code = %d, want %d", s.stats.ExitCode(exitOK), exitPartialFailure)
+	}
+}
+
+func TestRunCountsOnlyDestinationFaults(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	p := writePlot(t, src, "plot-a.plot", 100, time.Time{})
+	for _, tc := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"source read", &fs.PathError{Op: "read", Path: p, Err: syscall.EIO}, 0},
+		{"preTransfer hook", fmt.Errorf("%w(preTransfer): exit status 1", errHookFailed), 0},
+		{"timeout", fmt.Errorf("%w: %w", errTransferTimeout, context.DeadlineExceeded), 0},
+		{"stalled", fmt.Errorf("%w(1m): signal: killed", errStalled), 0},
+		{"plot check", fmt.Errorf("%w: exit status 1", errPlotCheckFailed), 0},
+		{"destination write", &fs.PathError{Op: "write", Path: filepath.Join(dst, "plot-a.plot"+partialSuffix), Err: syscall.EIO}, 1},
+		{"connection", errors.New("ssh: connect to host farm1 port 22: Connection refused"), 1},
+		{"verify", fmt.Errorf("%w: plot-a.plot", errVerifyFailed), 1},
+	} {
+		transport := &fakeTransport{copy: func(string, string) error { return tc.err }}
+		s := newTestScheduler(t, newTestConfig(t, src, dst), transport)
+		s.Run(context.Background(), []*Executor{{fromPath: p, toPath: dst, size: 100}})
+		if !s.journal.Failed(p) {
+			t.Errorf("%s: journal entry for %s not failed", tc.name, p)
+		}
+		if got := s.health.state(dst).failures; got != tc.want {
+			t.Errorf("%s: destination failures = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRunReroutesOnNoSpace(t *testing.T) {
+	src, full, d2 := t.TempDir(), t.TempDir(), t.TempDir()
+	p := writePlot(t, src, "plot-a.plot", 100, time.Time{})
+	transport := &fakeTransport{copy: func(src, dst string) error {
+		if dst == full {
+			return syscall.ENOSPC
+		}
+		return nil
+	}}
+	s := newTestScheduler(t, newTestConfig(t, src, full, d2), transport)
+
+	s.Run(context.Background(), []*Executor{{fromPath: p, toPath: full, size: 100}})
+	entries := s.journal.Entries(StateDone)
+	if len(entries) != 1 || entries[0].Dst != d2 {
+		t.Fatalf("done entries = %v, want %s -> %s", entries, p, d2)
+	}
+	if !slices.Equal(transport.copied, []string{p + " -> " + d2}) {
+		t.Errorf("copied = %v", transport.copied)
+	}
+	if s.stats.ExitCode(exitOK) != exitOK {
+		t.Error("rerouted transfer counted as failure")
+	}
+}
+
+func TestLoopMovesAllSources(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	a := writePlot(t, src, "plot-a.plot", 100, time.Time{})
+	b := writePlot(t, src, "plot-b.plot", 100, time.Time{})
+	transport := &fakeTransport{}
+	s := newTestScheduler(t, newTestConfig(t, src, dst), transport)
+
+	if code := s.Loop(context.Background(), &Options{}); code != exitOK {
+		t.Fatalf("Loop = %d, want %d", code, exitOK)
+	}
+	slices.Sort(transport.copied)
+	if want := []string{a + " -> " + dst, b + " -> " + dst}; !slices.Equal(transport.copied, want) {
+		t.Errorf("copied = %v, want %v", transport.copied, want)
+	}
+}
+
+func TestResumeJournal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows reports a missing path when the parent is a file")
+	}
+	src, dst := t.TempDir(), t.TempDir()
+	gone := filepath.Join(src, "gone.plot")
+	// 上级不是目录，Stat 返回的错误不是 ErrNotExist，相当于源盘暂时无法访问
+	notDir := writePlot(t, src, "file", 1, time.Time{})
+	unreachable := filepath.Join(notDir, "plot-a.plot")
+	c := newTestConfig(t, src, dst)
+	c.DryRun = true
+	s := newTestScheduler(t, c, &fakeTransport{})
+	s.journal.Set(gone, dst, StateRunning, nil)
+	s.journal.Set(unreachable, dst, StateQueued, nil)
+
+	s.resumeJournal(context.Background())
+	if !s.journal.Completed(gone) {
+		t.Errorf("entry for removed source %s not marked done", gone)
+	}
+	pending := s.journal.Pending()
+	if len(pending) != 1 || pending[0].Src != unreachable {
+		t.Errorf("pending = %v, want only %s", pending, unreachable)
+	}
+}
+
+func TestSchedulerTransportUsesConfig(t *testing.T) {
+	dst := t.TempDir()
+	c := newTestConfig(t, t.TempDir(), dst)
+	c.CopyMethod = "native"
+	s := NewScheduler(c, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if tr, ok := s.transport(dst).(nativeTransport); !ok || tr.cfg != c {
+		t.Errorf("transport = %#v, want native transport using the scheduler config", s.transport(dst))
+	}
+
+	// 重新加载后的配置立即生效，不读取包内共享的配置
+	reloaded := newTestConfig(t, t.TempDir(), dst)
+	reloaded.CopyMethod = "rsync"
+	s.cfg = reloaded
+	if tr, ok := s.transport(dst).(rsyncTransport); !ok || tr.cfg != reloaded {
+		t.Errorf("transport after reload = %#v, want rsync transport using the reloaded config", s.transport(dst))
+	}
+	if tr, ok := s.transport("ssh://user@host:/plots").(sshTransport); !ok || tr.cfg != reloaded {
+		t.Errorf("ssh transport = %#v, want one using the reloaded config", s.transport("ssh://user@host:/plots"))
+	}
+}
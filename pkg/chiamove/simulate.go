@@ -0,0 +1,288 @@
+package chiamove
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SimFixture chiamove simulate 使用的虚拟源和目标
+type SimFixture struct {
+	Sources      []SimSource      `yaml:"sources"`
+	Destinations []SimDestination `yaml:"destinations"`
+}
+
+type SimSource struct {
+	Path  string   `yaml:"path"`  // 对应 fromPaths 中的路径，routes 按该路径匹配
+	Count int      `yaml:"count"` // 生成的plot数量，名称为 plot-k32-sim-<序号>.plot
+	Size  ByteSize `yaml:"size"`  // 每个plot的大小，默认 --plot-size
+	Names []string `yaml:"names"` // 指定名称时忽略 count，用于检查过滤规则
+}
+
+type SimDestination struct {
+	Path  string   `yaml:"path"`
+	Total ByteSize `yaml:"total"` // 默认等于 free
+	Free  ByteSize `yaml:"free"`
+}
+
+// simDest 模拟中的目标，复制只扣减剩余空间
+type simDest struct {
+	total, free uint64
+	names       []string
+}
+
+type simTransfer struct {
+	src, dst string
+	size     uint64
+}
+
+var (
+	simMu        sync.Mutex
+	simulated    map[string]*simDest // 目标路径 -> 模拟的目标，不为空时这些目标不访问磁盘
+	simTransfers []simTransfer
+)
+
+// simTransport 模拟的复制，只检查并扣减目标的剩余空间
+type simTransport struct{ cfg *Config }
+
+func (simTransport) Name() string { return "simulate" }
+
+func (simTransport) Resume(src, dst string, interrupted bool) error { return nil }
+
+func (t simTransport) Copy(ctx context.Context, src, dst string) error {
+	size, err := dirSize(osFS{}, t.cfg.DirSize, src)
+	if err != nil {
+		return err
+	}
+	simMu.Lock()
+	defer simMu.Unlock()
+	d := simulated[dst]
+	if size > d.free {
+		return fmt.Errorf("%s: %w", dst, syscall.ENOSPC)
+	}
+	d.free -= size
+	d.names = append(d.names, filepath.Base(src))
+	simTransfers = append(simTransfers, simTransfer{src: src, dst: dst, size: size})
+	return nil
+}
+
+func (simTransport) Verify(ctx context.Context, src, dst string) error {
+	return nil
+}
+
+func (simTransport) FreeSpace(dst string) (DiskUsage, error) {
+	simMu.Lock()
+	defer simMu.Unlock()
+	d := simulated[dst]
+	return DiskUsage{Total: d.total, Free: d.free}, nil
+}
+
+func isSimulated(dst string) bool {
+	simMu.Lock()
+	defer simMu.Unlock()
+	_, ok := simulated[dst]
+	return ok
+}
+
+// simulatedNames 返回模拟目标上已有的名称，用于重复检查和plot数量限制
+func simulatedNames(dst string) []string {
+	simMu.Lock()
+	defer simMu.Unlock()
+	return append([]string{}, simulated[dst].names...)
+}
+
+// runSimulate 用虚拟的源和目标按配置运行一次完整的调度，不读写真实的磁盘，用于验证过滤规则、目标选择和限额等策略。
+// 源plot是临时目录中的稀疏文件，目标只记录剩余空间
+func runSimulate(args []string) int {
+	fs := flag.NewFlagSet("chiamove simulate", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", T("配置文件路径"))
+	fixturePath := fs.String("fixture", "", T("虚拟源和目标的定义文件，为空时按配置中的 fromPaths 和 toPaths 生成"))
+	plots := fs.Int("plots", 20, T("没有 fixture 时每个源路径生成的plot数量"))
+	plotSize := ByteSize(108_830_000_000)
+	fs.Var(&plotSize, "plot-size", T("生成的plot大小，默认k32"))
+	destFree := ByteSize(18e12)
+	fs.Var(&destFree, "dest-free", T("没有 fixture 时每个目标的剩余空间"))
+	verbose := fs.Bool("verbose", false, T("同时输出调度日志"))
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	c, err := ReadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("读取配置失败: %v\n"), err)
+		return exitConfigError
+	}
+	SetLanguage(c.Language)
+	if err := c.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, T("配置无效: %v\n"), err)
+		return exitConfigError
+	}
+	fixture := SimFixture{}
+	if *fixturePath != "" {
+		buf, err := os.ReadFile(*fixturePath)
+		if err == nil {
+			err = yaml.Unmarshal(buf, &fixture)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, T("读取 fixture 失败: %v\n"), err)
+			return exitConfigError
+		}
+	}
+	if len(fixture.Sources) == 0 {
+		for _, p := range c.FromPaths {
+			fixture.Sources = append(fixture.Sources, SimSource{Path: p, Count: *plots})
+		}
+	}
+	if len(fixture.Destinations) == 0 {
+		for _, p := range c.ToPaths {
+			fixture.Destinations = append(fixture.Destinations, SimDestination{Path: p, Free: destFree})
+		}
+	}
+	if len(fixture.Destinations) == 0 {
+		fmt.Fprintln(os.Stderr, T("没有可模拟的目标，toPathsGlob 和 hotplug 找到的目标需要在 fixture 中列出"))
+		return exitConfigError
+	}
+	tmp, err := os.MkdirTemp("", "chiamove-simulate-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("创建临时目录失败: %v\n"), err)
+		return exitError
+	}
+	defer os.RemoveAll(tmp)
+
+	// 源路径换成临时目录，输出时再换回原来的路径
+	display := map[string]string{}
+	var fromPaths, generated []string
+	for i, s := range fixture.Sources {
+		dir := filepath.Join(tmp, fmt.Sprintf("source%d", i))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, T("创建临时目录失败: %v\n"), err)
+			return exitError
+		}
+		display[dir] = s.Path
+		fromPaths = append(fromPaths, dir)
+		for j := range c.Routes {
+			if filepath.Clean(c.Routes[j].From) == filepath.Clean(s.Path) {
+				c.Routes[j].From = dir
+			}
+		}
+		names := s.Names
+		for n := 1; len(s.Names) == 0 && n <= s.Count; n++ {
+			names = append(names, fmt.Sprintf("plot-k32-sim-%03d.plot", n))
+		}
+		size := uint64(s.Size)
+		if size == 0 {
+			size = uint64(plotSize)
+		}
+		for n, name := range names {
+			if err := createSparse(filepath.Join(dir, name), int64(size), len(names)-n); err != nil {
+				fmt.Fprintf(os.Stderr, T("创建虚拟plot失败: %v\n"), err)
+				return exitError
+			}
+			generated = append(generated, filepath.Join(dir, name))
+		}
+	}
+	simulated = map[string]*simDest{}
+	var toPaths []string
+	for _, d := range fixture.Destinations {
+		total := max(uint64(d.Total), uint64(d.Free))
+		simulated[d.Path] = &simDest{total: total, free: uint64(d.Free)}
+		toPaths = append(toPaths, d.Path)
+	}
+
+	// 只保留影响调度策略的配置，关闭所有会访问真实磁盘、网络或发送通知的功能
+	c.FromPaths, c.ToPaths, c.ToPathsGlob = fromPaths, toPaths, nil
+	c.Hotplug.Pattern = ""
+	c.Daemon, c.DryRun, c.WatchConfig = false, false, false
+	c.Schedule = ScheduleConfig{}
+	c.Lock, c.JSONEvents, c.API.Listen = "off", "", ""
+	c.Notify, c.Hooks = NotifyConfig{}, HooksConfig{}
+	c.Harvester.Refresh, c.Verify, c.PlotCheck.Enabled = "off", "none", false
+	c.Partials.Action, c.Failed.Action = "off", "skip"
+	c.Throttle, c.StallTimeout, c.TransferTimeout = ThrottleConfig{}, 0, 0
+	c.Retry.MaxAttempts = 1
+	c.RequireMount = false
+	c.Staging.QuietPeriod = 0
+	c.JournalFile = filepath.Join(tmp, "journal.json")
+	c.History.File, c.History.CSV = filepath.Join(tmp, "history.jsonl"), ""
+	c.PauseFile = filepath.Join(tmp, "PAUSE")
+	c.Logging.TransferDir = ""
+	config = c
+	var console io.Writer = io.Discard
+	if *verbose {
+		console = os.Stderr
+	}
+	logCloser, err := SetupLogger(LoggingConfig{Level: "info"}, console)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("初始化日志失败: %v\n"), err)
+		return exitError
+	}
+	defer logCloser.Close()
+	applyRuntimeConfig()
+	if journal, err = OpenJournal(c.JournalFile); err != nil {
+		fmt.Fprintf(os.Stderr, T("读取任务日志失败: %v\n"), err)
+		return exitError
+	}
+	code := NewScheduler(c, slog.Default()).Loop(context.Background(), &Options{ConfigPath: *configPath})
+
+	fmt.Printf(T("模拟迁移: %d 个源路径，%d 个plot，%d 个目标\n"), len(fixture.Sources), len(generated), len(toPaths))
+	for i, tr := range simTransfers {
+		fmt.Printf("  %3d  %s -> %s  %s\n", i+1, simDisplay(display, tr.src), tr.dst, formatBytes(tr.size))
+	}
+	fmt.Println(T("目标:"))
+	for _, p := range toPaths {
+		d := simulated[p]
+		fmt.Printf(T("  %s  迁入 %d 个  剩余 %s / %s\n"), p, len(d.names), formatBytes(d.free), formatBytes(d.total))
+	}
+	// deletePolicy 为 never 时已迁移的plot仍在源路径中，按模拟的复制判断
+	moved := map[string]bool{}
+	for _, tr := range simTransfers {
+		moved[tr.src] = true
+	}
+	var left []string
+	for _, p := range generated {
+		if !moved[p] {
+			left = append(left, simDisplay(display, p))
+		}
+	}
+	fmt.Printf(T("未迁移: %d 个\n"), len(left))
+	for _, p := range left {
+		fmt.Println("  " + p)
+	}
+	fmt.Printf(T("退出码: %d\n"), code)
+	return code
+}
+
+// createSparse 创建大小为 size 的稀疏文件，修改时间为 age 分钟前，排在前面的名称更旧
+func createSparse(path string, size int64, age int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(size)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	mtime := time.Now().Add(-time.Duration(age) * time.Minute)
+	return os.Chtimes(path, mtime, mtime)
+}
+
+func simDisplay(display map[string]string, path string) string {
+	for dir, orig := range display {
+		if rel, ok := strings.CutPrefix(path, dir+string(filepath.Separator)); ok {
+			return filepath.Join(orig, rel)
+		}
+	}
+	return path
+}
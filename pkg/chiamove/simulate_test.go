@@ -0,0 +1,76 @@
+package chiamove
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// runSimulateSandbox 以 dir 下的 src 和 dst 为源和目标、加上 extra 中的配置运行 simulate 子命令，
+// 测试结束后恢复 simulate 修改的包内共享状态
+func runSimulateSandbox(t *testing.T, dir, extra string) int {
+	t.Helper()
+	oldConfig, oldJournal, oldLogger := config, journal, slog.Default()
+	t.Cleanup(func() {
+		config, journal = oldConfig, oldJournal
+		slog.SetDefault(oldLogger)
+		simMu.Lock()
+		simulated, simTransfers = nil, nil
+		simMu.Unlock()
+	})
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	configYAML := "fromPaths: [" + filepath.Join(dir, "src") + "]\n" +
+		"toPaths: [" + filepath.Join(dir, "dst") + "]\n" +
+		"fromPathFilter: {minSize: 1, maxSize: 1GiB, extension: .plot}\n" + extra
+	if err := os.WriteFile(path, []byte(configYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return runSimulate([]string{"-config", path, "-plots", "2", "-plot-size", "1MiB", "-dest-free", "1GiB"})
+}
+
+func TestSimulateRunsNoHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks run through sh")
+	}
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "hook-ran")
+	code := runSimulateSandbox(t, dir, `
+hooks:
+  preTransfer: touch `+marker+`
+  postTransfer: touch `+marker+`
+  onAllDone: touch `+marker+`
+`)
+	if code != exitOK {
+		t.Fatalf("simulate = %d, want %d", code, exitOK)
+	}
+	if len(simTransfers) != 2 {
+		t.Errorf("simulated transfers = %d, want 2", len(simTransfers))
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("simulate ran a hook: %v", err)
+	}
+}
+
+func TestSimulateSkipsHistoryCSV(t *testing.T) {
+	dir := t.TempDir()
+	csv := filepath.Join(dir, "history.csv")
+	if code := runSimulateSandbox(t, dir, "history: {csv: "+csv+"}\n"); code != exitOK {
+		t.Fatalf("simulate = %d, want %d", code, exitOK)
+	}
+	if _, err := os.Stat(csv); !os.IsNotExist(err) {
+		t.Errorf("simulate wrote to history.csv: %v", err)
+	}
+}
+
+func TestSimulateSkipsTransferLogs(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "transfers")
+	if code := runSimulateSandbox(t, dir, "logging: {transferDir: "+logs+"}\n"); code != exitOK {
+		t.Fatalf("simulate = %d, want %d", code, exitOK)
+	}
+	if _, err := os.Stat(logs); !os.IsNotExist(err) {
+		t.Errorf("simulate wrote transfer logs: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package chiamove
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+
+// formatBytes 以1024进制格式化字节数，如 101.4GiB
+func formatBytes(n uint64) string {
+	v := float64(n)
+	i := 0
+	for v >= 1024 && i < len(byteUnits)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d%s", n, byteUnits[i])
+	}
+	return fmt.Sprintf("%.1f%s", v, byteUnits[i])
+}
+
+// 单位不区分大小写，KB/MB/GB 为1000进制，KiB/MiB/GiB 为1024进制
+var sizeMultipliers = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"kb":  1e3,
+	"ki":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1e6,
+	"mb":  1e6,
+	"mi":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1e9,
+	"gb":  1e9,
+	"gi":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1e12,
+	"tb":  1e12,
+	"ti":  1 << 40,
+	"tib": 1 << 40,
+	"p":   1e15,
+	"pb":  1e15,
+	"pi":  1 << 50,
+	"pib": 1 << 50,
+}
+
+// ByteSize 配置中的大小，可以写字节数，也可以写 "101GiB"、"108.83GB" 这样带单位的字符串
+type ByteSize uint64
+
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.')
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	number, unit := s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+	if number == "" {
+		return 0, fmt.Errorf(T("大小 %q 缺少数值"), s)
+	}
+	multiplier, ok := sizeMultipliers[unit]
+	if !ok {
+		return 0, fmt.Errorf(T("大小 %q 的单位 %q 无法识别"), s, s[i:])
+	}
+	v, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf(T("大小 %q 的数值无效"), s)
+	}
+	bytes := v * multiplier
+	if bytes >= math.MaxUint64 {
+		return 0, fmt.Errorf(T("大小 %q 超出范围"), s)
+	}
+	return ByteSize(math.Round(bytes)), nil
+}
+
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var n uint64
+	if err := unmarshal(&n); err == nil {
+		*b = ByteSize(n)
+		return nil
+	}
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	v, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// Set 实现 flag.Value，命令行参数也可以带单位
+func (b *ByteSize) Set(s string) error {
+	v, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+func (b ByteSize) String() string {
+	return formatBytes(uint64(b))
+}
@@ -0,0 +1,61 @@
+package chiamove
+
+import (
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// dirSizeEntry 缓存的文件夹大小，以及计算时其中每个文件夹的修改时间
+type dirSizeEntry struct {
+	size   uint64
+	mtimes map[string]time.Time
+}
+
+// dirSizes 源文件夹路径 -> dirSizeEntry，守护模式下每轮扫描不用重新遍历没有变化的大文件夹
+var dirSizes sync.Map
+
+// cachedDirSize 与 getDirSize 相同，但其中的文件夹修改时间都没有变化（没有增删、改名文件）时使用上次的结果，
+// 只用于扫描时选择源；原地改写的文件不会改变文件夹的修改时间，复制后的大小校验仍使用 getDirSize
+func cachedDirSize(fsys FileSystem, c DirSizeConfig, path string) (uint64, error) {
+	if v, ok := dirSizes.Load(path); ok {
+		e := v.(*dirSizeEntry)
+		if unchanged(fsys, e.mtimes) {
+			return e.size, nil
+		}
+	}
+	e := &dirSizeEntry{mtimes: map[string]time.Time{}}
+	err := walkDirSize(fsys, c, path, func(p string, info fs.FileInfo) {
+		if info.IsDir() {
+			e.mtimes[p] = info.ModTime()
+		} else {
+			e.size += uint64(info.Size())
+		}
+	})
+	if err != nil {
+		dirSizes.Delete(path)
+		return 0, err
+	}
+	dirSizes.Store(path, e)
+	return e.size, nil
+}
+
+func unchanged(fsys FileSystem, mtimes map[string]time.Time) bool {
+	for p, mtime := range mtimes {
+		info, err := fsys.Stat(p)
+		if err != nil || !info.ModTime().Equal(mtime) {
+			return false
+		}
+	}
+	return true
+}
+
+// dirSize 按调度的配置返回源的大小，使用缓存
+func (s *Scheduler) dirSize(path string) (uint64, error) {
+	return cachedDirSize(s.fsys, s.cfg.DirSize, path)
+}
+
+// forgetDirSize 源迁移结束后不再需要缓存的大小
+func forgetDirSize(path string) {
+	dirSizes.Delete(path)
+}
@@ -0,0 +1,126 @@
+package chiamove
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// SMARTConfig 通过 smartctl 检查目标硬盘的SMART状态，整体状态失败或坏扇区超过阈值的硬盘不再写入
+type SMARTConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// 默认 smartctl，需要root权限
+	Binary string `yaml:"binary"`
+	// 重映射扇区数（属性5）的上限，默认 100
+	MaxReallocated *int `yaml:"maxReallocated"`
+	// 待映射和无法修复的扇区数（属性197、198）或NVMe介质错误数的上限，默认 0
+	MaxPending *int `yaml:"maxPending"`
+	// 检查结果的有效期，默认 1h
+	Interval time.Duration `yaml:"interval"`
+	// 目标路径对应的设备，如 /mnt/disk1: /dev/sdb；未指定时Linux上按目标所在的磁盘自动确定，其他系统上不检查
+	Devices map[string]string `yaml:"devices"`
+}
+
+const smartTimeout = 30 * time.Second
+
+type smartResult struct {
+	problem string // 为空表示可以写入
+	checked time.Time
+}
+
+var (
+	smartMu      sync.Mutex
+	smartResults = map[string]smartResult{}
+)
+
+// smartHealthy 目标所在硬盘的SMART状态是否允许写入；无法确定设备或 smartctl 执行失败时不阻止写入
+func smartHealthy(c *Config, dst string) bool {
+	cfg := c.SMART
+	if !cfg.Enabled || isRemoteDest(dst) {
+		return true
+	}
+	dev := cfg.Devices[dst]
+	if dev == "" {
+		dev = diskDevice(dst)
+	}
+	if dev == "" {
+		return true
+	}
+	smartMu.Lock()
+	defer smartMu.Unlock()
+	last, ok := smartResults[dev]
+	if ok && time.Since(last.checked) < cfg.Interval {
+		return last.problem == ""
+	}
+	problem, err := querySMART(dev)
+	if err != nil {
+		slog.Debug("读取SMART状态失败", "device", dev, "err", err)
+	}
+	switch {
+	case problem != "" && problem != last.problem:
+		slog.Warn("硬盘SMART状态异常，不再写入该目标", "path", dst, "device", dev, "reason", problem)
+	case problem == "" && last.problem != "":
+		slog.Info("硬盘SMART状态已恢复正常", "path", dst, "device", dev)
+	}
+	smartResults[dev] = smartResult{problem: problem, checked: time.Now()}
+	return problem == ""
+}
+
+// querySMART 执行 smartctl 并按阈值判断，返回不能写入的原因
+func querySMART(dev string) (string, error) {
+	cfg := config.SMART
+	ctx, cancel := context.WithTimeout(context.Background(), smartTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, cfg.Binary, "-j", "-H", "-A", dev).Output()
+	// smartctl 的退出码是位掩码，只有第0、1位表示命令本身执行失败，其余表示检查出的问题
+	var exitErr *exec.ExitError
+	if err != nil && (!errors.As(err, &exitErr) || exitErr.ExitCode()&3 != 0) {
+		return "", err
+	}
+	var report struct {
+		SmartStatus *struct {
+			Passed bool `json:"passed"`
+		} `json:"smart_status"`
+		ATA struct {
+			Table []struct {
+				ID  int `json:"id"`
+				Raw struct {
+					Value int64 `json:"value"`
+				} `json:"raw"`
+			} `json:"table"`
+		} `json:"ata_smart_attributes"`
+		NVMe *struct {
+			MediaErrors int64 `json:"media_errors"`
+		} `json:"nvme_smart_health_information_log"`
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return "", err
+	}
+	if report.SmartStatus != nil && !report.SmartStatus.Passed {
+		return T("SMART整体状态为失败"), nil
+	}
+	var reallocated, pending int64
+	for _, attr := range report.ATA.Table {
+		switch attr.ID {
+		case 5:
+			reallocated = attr.Raw.Value
+		case 197, 198:
+			pending += attr.Raw.Value
+		}
+	}
+	if report.NVMe != nil {
+		pending += report.NVMe.MediaErrors
+	}
+	if reallocated > int64(*cfg.MaxReallocated) {
+		return fmt.Sprintf(T("重映射扇区 %d 个，超过上限 %d"), reallocated, *cfg.MaxReallocated), nil
+	}
+	if pending > int64(*cfg.MaxPending) {
+		return fmt.Sprintf(T("待映射或无法修复的扇区 %d 个，超过上限 %d"), pending, *cfg.MaxPending), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,86 @@
+package chiamove
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// SourceSpaceConfig 监视本地源所在文件系统的剩余空间：低于 minFree 时执行 hooks.onSourceSpaceLow（如暂停plotter）
+// 并发送 source_space_low 通知，迁移走plot、剩余空间恢复到 resumeFree 后执行 hooks.onSourceSpaceRecovered
+type SourceSpaceConfig struct {
+	// 为0时不启用
+	MinFree ByteSize `yaml:"minFree"`
+	// 默认为 minFree 的两倍，避免在阈值附近反复暂停和恢复
+	ResumeFree ByteSize `yaml:"resumeFree"`
+	// 检查间隔，默认 30s
+	Interval time.Duration `yaml:"interval"`
+}
+
+// StartSourceSpaceWatchdog 定时检查源盘的剩余空间，同一个文件系统上的多个源路径只检查第一个；
+// 返回的函数在退出时调用，再检查一次后仍有源盘空间不足时记录警告，不执行恢复的钩子
+func StartSourceSpaceWatchdog(ctx context.Context) func() {
+	low := map[string]bool{}
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			cfg := currentConfig()
+			if cfg.SourceSpace.MinFree > 0 {
+				checkSourceSpace(ctx, cfg, low)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-time.After(cfg.SourceSpace.Interval):
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		if len(low) > 0 {
+			// 非守护模式下迁移结束后可能还没有检查过
+			checkSourceSpace(context.WithoutCancel(ctx), currentConfig(), low)
+		}
+		for p := range low {
+			slog.Warn("退出时源盘剩余空间仍然不足，onSourceSpaceLow 的操作没有恢复", "path", p)
+		}
+	}
+}
+
+// checkSourceSpace 检查一次各源盘的剩余空间，low 记录当前空间不足的源路径
+func checkSourceSpace(ctx context.Context, cfg *Config, low map[string]bool) {
+	var checked []string
+	for _, p := range expandFromPaths(cfg.FromPaths) {
+		if isRemoteSource(p) || slices.ContainsFunc(checked, func(c string) bool { return sameFilesystem(c, p) }) {
+			continue
+		}
+		usage, err := GetDiskUsage(p)
+		if err != nil {
+			slog.Debug("获取源盘容量失败", "path", p, "err", err)
+			continue
+		}
+		checked = append(checked, p)
+		env := map[string]string{"SRC": p, "FREE": strconv.FormatUint(usage.Free, 10)}
+		switch {
+		case !low[p] && usage.Free < uint64(cfg.SourceSpace.MinFree):
+			low[p] = true
+			slog.Warn("源盘剩余空间不足", "path", p, "free", formatBytes(usage.Free), "minFree", formatBytes(uint64(cfg.SourceSpace.MinFree)))
+			Notify(Notification{Event: EventSourceSpaceLow, Message: fmt.Sprintf(T("源盘剩余空间不足: %s (%s)"), p, formatBytes(usage.Free)), Src: p})
+			cfg.Hooks.run(ctx, "onSourceSpaceLow", cfg.Hooks.OnSourceSpaceLow, env)
+			// 空闲等待中的调度立即重新扫描，尽快迁移走plot
+			wake()
+		case low[p] && usage.Free >= uint64(cfg.SourceSpace.ResumeFree):
+			delete(low, p)
+			slog.Info("源盘剩余空间已恢复", "path", p, "free", formatBytes(usage.Free))
+			Notify(Notification{Event: EventSourceSpaceRecovered, Message: fmt.Sprintf(T("源盘剩余空间已恢复: %s (%s)"), p, formatBytes(usage.Free)), Src: p})
+			cfg.Hooks.run(ctx, "onSourceSpaceRecovered", cfg.Hooks.OnSourceSpaceRecovered, env)
+		}
+	}
+}
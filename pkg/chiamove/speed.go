@@ -0,0 +1,96 @@
+package chiamove
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+)
+
+const (
+	// 新的测量值在滚动平均中的权重
+	speedAlpha = 0.3
+	// 短于该时长的任务（如同一文件系统上的rename）不计入速度
+	minSpeedSampleSeconds = 1
+)
+
+// SpeedStats 按目标记录成功任务写入速度的滚动平均，启动时从迁移历史中恢复
+type SpeedStats struct {
+	mu     sync.Mutex
+	speeds map[string]float64
+}
+
+var destSpeeds = &SpeedStats{speeds: map[string]float64{}}
+
+func (s *SpeedStats) Observe(dst string, duration, throughput float64) {
+	if duration < minSpeedSampleSeconds || throughput <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.speeds[dst]; ok {
+		throughput = old*(1-speedAlpha) + throughput*speedAlpha
+	}
+	s.speeds[dst] = throughput
+}
+
+// LoadHistory 用迁移历史中的成功任务初始化各目标的速度
+func (s *SpeedStats) LoadHistory(file string) {
+	records, err := readHistory(file)
+	if err != nil {
+		return
+	}
+	for _, rec := range records {
+		if rec.Error == "" {
+			s.Observe(rec.Dst, rec.Duration, rec.Throughput)
+		}
+	}
+}
+
+// Weight 返回目标相对最快目标的速度比例，还没有测量过的目标为1，优先尝试
+func (s *SpeedStats) Weight(dst string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	speed, ok := s.speeds[dst]
+	if !ok {
+		return 1
+	}
+	var fastest float64
+	for _, v := range s.speeds {
+		fastest = max(fastest, v)
+	}
+	return speed / fastest
+}
+
+func (s *SpeedStats) Speed(dst string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.speeds[dst]
+}
+
+// sortBySpeed 按权重从高到低排序，权重相同时保持配置中的顺序
+func sortBySpeed(speeds *SpeedStats, dests []string) []string {
+	dests = slices.Clone(dests)
+	slices.SortStableFunc(dests, func(a, b string) int {
+		return cmp.Compare(speeds.Weight(b), speeds.Weight(a))
+	})
+	return dests
+}
+
+// DestinationStatus 目标的速度和选择权重，供 chiamove status 查询
+type DestinationStatus struct {
+	Path   string  `json:"path"`
+	Speed  float64 `json:"speed"` // 字节/秒，0 为还没有测量
+	Weight float64 `json:"weight"`
+	// 连续失败后暂停使用
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+func destinationStatuses() []DestinationStatus {
+	var statuses []DestinationStatus
+	for _, dest := range destinations() {
+		statuses = append(statuses, DestinationStatus{
+			Path: dest, Speed: destSpeeds.Speed(dest), Weight: destSpeeds.Weight(dest), Disabled: destHealth.Disabled(dest),
+		})
+	}
+	return statuses
+}
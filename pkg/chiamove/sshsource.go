@@ -0,0 +1,264 @@
+package chiamove
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isSSHSource fromPaths 中 ssh://user@host:/path 形式的源：在harvester上运行，通过ssh列出plotter上的文件，
+// 用rsync拉取到本地目标，完成后按 deletePolicy 在远端删除源。远端需要GNU find，ssh参数与 ssh:// 目标相同
+func isSSHSource(p string) bool {
+	_, ok := parseRemote(p)
+	return ok
+}
+
+// isRemoteSource 判断源是否不在本地文件系统上（HTTP源或 ssh:// 源）
+func isRemoteSource(p string) bool {
+	return isHTTPSource(p) || isSSHSource(p)
+}
+
+// sourcePath 返回远端 path 下名为 name 的源
+func (r remoteTarget) sourcePath(name string) string {
+	return "ssh://" + r.userHost + ":" + path.Join(r.path, name)
+}
+
+// sshEntry 远端源路径下的一个文件或文件夹，文件夹的大小为其中所有文件的总大小
+type sshEntry struct {
+	name    string
+	dir     bool
+	size    int64
+	modTime time.Time
+	staging string // 不为空时为仍在写入的原因
+}
+
+func (e *sshEntry) Name() string               { return e.name }
+func (e *sshEntry) IsDir() bool                { return e.dir }
+func (e *sshEntry) Type() fs.FileMode          { return e.Mode().Type() }
+func (e *sshEntry) Info() (fs.FileInfo, error) { return e, nil }
+func (e *sshEntry) Size() int64                { return e.size }
+func (e *sshEntry) ModTime() time.Time         { return e.modTime }
+func (e *sshEntry) Sys() any                   { return nil }
+
+func (e *sshEntry) Mode() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// listSSHSource 用一次ssh列出远端 dir 下的所有文件，汇总为第一层的文件和文件夹，按名称排序
+func listSSHSource(ctx context.Context, c *Config, r remoteTarget, dir string) ([]*sshEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, agentRequestTimeout)
+	defer cancel()
+	out, err := r.runContext(ctx, "cd -- "+shellQuote(dir)+` && find . -mindepth 1 -printf '%y\t%s\t%T@\t%P\n'`)
+	if err != nil {
+		return nil, err
+	}
+	entries := map[string]*sshEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[1], 10, 64)
+		mtime, _ := strconv.ParseFloat(fields[2], 64)
+		modTime := time.Unix(0, int64(mtime*1e9))
+		rel := fields[3]
+		top, _, nested := strings.Cut(rel, "/")
+		e, ok := entries[top]
+		if !ok {
+			e = &sshEntry{name: top}
+			entries[top] = e
+		}
+		if !nested {
+			e.dir, e.modTime = fields[0] == "d", modTime
+		}
+		if fields[0] == "f" {
+			e.size += size
+		}
+		if e.staging == "" {
+			e.staging = remoteStaging(c, path.Base(rel), modTime)
+		}
+	}
+	list := make([]*sshEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].name < list[b].name })
+	return list, nil
+}
+
+// remoteStaging 与 isStaging 相同的判断，远端不支持 checkOpenFiles
+func remoteStaging(c *Config, name string, modTime time.Time) string {
+	if strings.HasSuffix(name, partialSuffix) {
+		return T("正在被复制 ") + name
+	}
+	for _, suffix := range c.Staging.TempSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return T("存在临时文件 ") + name
+		}
+	}
+	if c.Staging.QuietPeriod > 0 && time.Since(modTime) < c.Staging.QuietPeriod {
+		return T("最近有修改 ") + name
+	}
+	return ""
+}
+
+// getSSHCandidate 与 getCanMovePath 相同，从远端源路径中选择第一个符合过滤条件的文件或文件夹
+func getSSHCandidate(c *Config, fromPath string, skip func(path string, isDir bool) bool) (string, uint64, error) {
+	r, _ := remoteFor(c, fromPath)
+	entries, err := listSSHSource(context.Background(), c, r, r.path)
+	if err != nil {
+		slog.Warn("获取远程源文件列表失败", "path", fromPath, "err", err)
+		return "", 0, err
+	}
+	kept := keptOnSSHSource(c, r, entries)
+	for _, entry := range entries {
+		if isExcluded(c, entry.name) || entry.name == manifestFile {
+			continue
+		}
+		src := r.sourcePath(entry.name)
+		if kept[src] {
+			slog.Debug("按 keepOnSource 保留在源上", "path", src)
+			continue
+		}
+		rules := matchingRules(c, src, entry)
+		if len(rules) == 0 || skip(src, entry.dir) {
+			continue
+		}
+		if entry.staging != "" {
+			slog.Debug("跳过仍在写入的路径", "path", src, "reason", entry.staging)
+			continue
+		}
+		for _, rule := range rules {
+			if rule.matchSize(c.PlotSize, src, entry.dir, uint64(entry.size)) {
+				slog.Debug("符合过滤规则", "path", src, "rule", rule.Name, "size", entry.size)
+				return src, uint64(entry.size), nil
+			}
+		}
+	}
+	return "", 0, errNoCandidate
+}
+
+// sshSourceSize 返回远端文件或文件夹的总大小
+func sshSourceSize(ctx context.Context, c *Config, src string) (uint64, error) {
+	r, _ := remoteFor(c, src)
+	entries, err := listSSHSource(ctx, c, r, path.Dir(r.path))
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if e.name == path.Base(r.path) {
+			return uint64(e.size), nil
+		}
+	}
+	return 0, fmt.Errorf(T("远程源不存在: %s"), src)
+}
+
+// pullSSHSource 用rsync把远端的源拉取到本地目标 dst，先写入 .chiamove.partial，中断后rsync按 --partial 续传；
+// 大小一致后改为最终名称，再按 deletePolicy 删除远端的源
+func pullSSHSource(ctx context.Context, c *Config, src, dst string) error {
+	if isRemoteDest(dst) {
+		return fmt.Errorf(T("ssh源只能拉取到本地目标: %s"), dst)
+	}
+	r, _ := remoteFor(c, src)
+	size, err := sshSourceSize(ctx, c, src)
+	if err != nil {
+		return err
+	}
+	name := path.Base(r.path)
+	final := filepath.Join(dst, name)
+	if _, err := os.Lstat(final); err == nil {
+		return fmt.Errorf(T("目标已存在: %s"), final)
+	}
+	partial := final + partialSuffix
+	from := src
+	if _, err := r.run("test -d " + shellQuote(r.path)); err == nil {
+		// 带斜杠时复制文件夹里的内容
+		from += "/"
+	}
+	copyCtx, cancel := context.WithCancel(ctx)
+	stalled := watchStall(c, src, dst, cancel)
+	err = rsyncCopy(copyCtx, c, from, partial)
+	cancel()
+	if stalled() {
+		return fmt.Errorf("%w(%s): %v", errStalled, c.StallTimeout, err)
+	}
+	if err != nil {
+		return err
+	}
+	got, err := dirSize(osFS{}, c.DirSize, partial)
+	if err != nil {
+		return err
+	}
+	if got != size {
+		return fmt.Errorf(T("%w: %s 为 %d 字节，源为 %d 字节"), errSizeMismatch, partial, got, size)
+	}
+	if err := os.Rename(partial, final); err != nil {
+		return err
+	}
+	verified := false
+	if c.Verify != "none" {
+		if err := verifyPulled(ctx, c, final, r); err != nil {
+			return err
+		}
+		verified = true
+	}
+	if c.PlotCheck.Enabled {
+		if err := checkDestinationPlots(ctx, c, final, dst); err != nil {
+			return err
+		}
+		verified = true
+	}
+	switch {
+	case c.DeletePolicy == "never":
+		slog.Info("按 deletePolicy 保留源", "path", src, "policy", c.DeletePolicy)
+		return nil
+	case c.DeletePolicy == "afterVerify" && !verified:
+		slog.Warn("目标上的副本没有经过校验，按 deletePolicy 保留源", "path", src, "dst", dst, "policy", c.DeletePolicy)
+		return nil
+	}
+	if _, err := r.runContext(context.WithoutCancel(ctx), "rm -rf -- "+shellQuote(r.path)); err != nil {
+		return fmt.Errorf(T("删除源目录出错: %w"), err)
+	}
+	return nil
+}
+
+// verifyPulled 按 verify 比较拉取到本地的 final 和远端的源，不一致时删除本地的副本，远端的源保持不变
+func verifyPulled(ctx context.Context, c *Config, final string, r remoteTarget) error {
+	remote := sshFiles{r}
+	err := filepath.WalkDir(final, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(final, p)
+		if err != nil {
+			return err
+		}
+		src := r.path
+		if rel != "." {
+			src = remote.join(r.path, filepath.ToSlash(rel))
+		}
+		return verifyFile(ctx, c, osFS{}, p, src, remote)
+	})
+	if errors.Is(err, errVerifyFailed) {
+		slog.Error("校验未通过，删除目标上的副本并保留源文件", "src", r.sourcePath(""), "dst", final, "err", err)
+		if err := os.RemoveAll(final); err != nil {
+			slog.Error("删除校验未通过的目标失败", "path", final, "err", err)
+		}
+	}
+	return err
+}
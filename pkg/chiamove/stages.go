@@ -0,0 +1,200 @@
+package chiamove
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Stage 多级迁移中的一级，除 name 外的字段覆盖顶层配置中的同名字段；
+// 上一级的目标作为下一级的源，如 NVMe -> 中转SSD -> 机械硬盘
+type Stage struct {
+	Name      string                 `yaml:"name"`
+	Overrides map[string]interface{} `yaml:",inline"`
+}
+
+// applyStage 把名为 name 的一级的字段覆盖到配置上
+func (c *Config) applyStage(name string) error {
+	i := slices.IndexFunc(c.Stages, func(s Stage) bool { return s.Name == name })
+	if i < 0 {
+		return fmt.Errorf(T("stages 中没有名为 %q 的一级"), name)
+	}
+	if err := c.applyOverrides(name, c.Stages[i].Overrides); err != nil {
+		return fmt.Errorf(T("stages 中 %s 无效: %w"), name, err)
+	}
+	// 配置文件已由启动各级的进程锁定
+	if c.Lock == "" || c.Lock == "config" {
+		c.Lock = "off"
+	}
+	c.Stages = nil
+	return nil
+}
+
+// applyOverrides 把 overrides 覆盖到配置上，任务日志默认加上 -<name> 区分，
+// 监听地址和Unix socket不能被多个进程共用，没有单独配置时不启用
+func (c *Config) applyOverrides(name string, overrides map[string]interface{}) error {
+	buf, err := yaml.Marshal(overrides)
+	if err != nil {
+		return err
+	}
+	journalFile, listen, events := c.JournalFile, c.API.Listen, c.JSONEvents
+	if err := yaml.Unmarshal(buf, c); err != nil {
+		return err
+	}
+	if c.JournalFile == journalFile {
+		if journalFile == "" {
+			journalFile = "chiamove-journal.json"
+		}
+		ext := filepath.Ext(journalFile)
+		c.JournalFile = strings.TrimSuffix(journalFile, ext) + "-" + name + ext
+	}
+	if c.API.Listen == listen {
+		c.API.Listen = ""
+	}
+	if c.JSONEvents == events && strings.HasPrefix(events, "unix:") {
+		c.JSONEvents = ""
+	}
+	return nil
+}
+
+func validateStages(stages []Stage) error {
+	seen := make(map[string]bool)
+	for _, s := range stages {
+		if s.Name == "" {
+			return errors.New(T("stages 中每一级都需要 name"))
+		}
+		if seen[s.Name] {
+			return fmt.Errorf(T("stages 中的名称 %q 重复"), s.Name)
+		}
+		seen[s.Name] = true
+	}
+	return nil
+}
+
+// runStages 为每一级启动一个子进程，各级使用独立的过滤条件、并发数和任务日志；
+// 非守护模式下上一级还在运行时，下一级源盘已空也会定时重新扫描，直到上一级退出后再扫描一次
+func runStages(opts *Options, args []string) int {
+	if err := validateStages(config.Stages); err != nil {
+		slog.Error("配置无效", "err", err)
+		return exitConfigError
+	}
+	if len(opts.From) > 0 || len(opts.To) > 0 || opts.TUI {
+		slog.Error("配置无效", "err", T("配置了 stages 时不能使用 --from、--to 和 --tui"))
+		return exitConfigError
+	}
+	for _, s := range config.Stages {
+		c, err := readConfig(opts.ConfigPath, opts.Profile, s.Name)
+		if err == nil {
+			opts.Apply(c)
+			err = c.Validate()
+		}
+		if err != nil {
+			slog.Error("配置无效", "stage", s.Name, "err", err)
+			return exitConfigError
+		}
+	}
+	logCloser, err := SetupLogger(config.Logging, os.Stderr)
+	if err != nil {
+		slog.Error("初始化日志失败", "err", err)
+		return exitError
+	}
+	defer logCloser.Close()
+	if config.Lock != "source" {
+		unlock, err := acquireLocks(opts.ConfigPath)
+		if err != nil {
+			slog.Error("无法启动", "err", err)
+			return exitError
+		}
+		defer unlock()
+	}
+	self, err := os.Executable()
+	if err != nil {
+		slog.Error("无法启动", "err", err)
+		return exitError
+	}
+	ctx := shutdownContext()
+	codes := make([]int, len(config.Stages))
+	done := make([]chan struct{}, len(config.Stages))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	for i, s := range config.Stages {
+		var upstream chan struct{}
+		if i > 0 {
+			upstream = done[i-1]
+		}
+		go func(i int, name string) {
+			defer close(done[i])
+			for {
+				upstreamRunning := upstream != nil && !isClosed(upstream)
+				codes[i] = runStageProcess(ctx, self, args, name)
+				if codes[i] != exitOK || !upstreamRunning || ctx.Err() != nil {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-upstream:
+				case <-time.After(daemonPollInterval):
+				}
+			}
+		}(i, s.Name)
+	}
+	for _, d := range done {
+		<-d
+	}
+	code := exitOK
+	for i, c := range codes {
+		if c != exitOK {
+			slog.Warn("迁移阶段异常退出", "stage", config.Stages[i].Name, "code", c)
+		}
+		if c == exitPartialFailure || code == exitOK {
+			code = c
+		}
+	}
+	return code
+}
+
+func runStageProcess(ctx context.Context, self string, args []string, name string) int {
+	cmd := childCommand(ctx, self, append([]string{"move", "-stage", name}, args...))
+	slog.Info("启动迁移阶段", "stage", name)
+	// 退出时收到的是context取消的错误，以子进程的退出码为准
+	if err := cmd.Run(); cmd.ProcessState == nil || cmd.ProcessState.ExitCode() < 0 {
+		slog.Error("迁移阶段运行失败", "stage", name, "err", err)
+		return exitError
+	}
+	return cmd.ProcessState.ExitCode()
+}
+
+// childCommand 创建运行本程序的子进程，ctx 取消时先发送中断信号让其正常停止
+func childCommand(ctx context.Context, self string, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, self, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// 子进程在单独的进程组中，终端的Ctrl-C只发给本进程，再由本进程通知子进程正常停止
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		if err := cmd.Process.Signal(os.Interrupt); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	return cmd
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
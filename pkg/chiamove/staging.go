@@ -0,0 +1,59 @@
+package chiamove
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+type StagingConfig struct {
+	// 最近一次修改距今不足该时长，认为plotter还在写入
+	QuietPeriod time.Duration `yaml:"quietPeriod"`
+	// 存在这些后缀的文件时认为plotter还在写入
+	TempSuffixes []string `yaml:"tempSuffixes"`
+	// 检查是否有进程打开了其中的文件，仅支持Linux（读取 /proc/*/fd）
+	CheckOpenFiles bool `yaml:"checkOpenFiles"`
+}
+
+var errStaging = errors.New("staging")
+
+// isStaging 判断路径是否还在被plotter写入，返回原因
+func (s *Scheduler) isStaging(path string) (bool, string) {
+	staging := s.cfg.Staging
+	var reason string
+	err := walkDir(s.fsys, path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// 多级迁移时上一级正在写入的未完成文件
+		if strings.HasSuffix(d.Name(), partialSuffix) {
+			reason = T("正在被复制 ") + p
+			return errStaging
+		}
+		for _, suffix := range staging.TempSuffixes {
+			if strings.HasSuffix(d.Name(), suffix) {
+				reason = T("存在临时文件 ") + p
+				return errStaging
+			}
+		}
+		if staging.QuietPeriod > 0 {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if time.Since(info.ModTime()) < staging.QuietPeriod {
+				reason = T("最近有修改 ") + p
+				return errStaging
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errStaging) {
+		return true, reason
+	}
+	if staging.CheckOpenFiles && hasOpenFiles(path) {
+		return true, T("有进程正在打开其中的文件")
+	}
+	return false, ""
+}
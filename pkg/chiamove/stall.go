@@ -0,0 +1,50 @@
+package chiamove
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+var errStalled = sentinelError("迁移长时间没有进展")
+
+// watchStall 定时统计目标上已写入的字节数，超过 c.StallTimeout 没有增长时调用 cancel 终止复制；
+// 返回的函数在复制结束后调用，停止检测并返回是否因为卡住而被终止。远程目标无法统计，不检测
+func watchStall(c *Config, src, dst string, cancel context.CancelFunc) func() bool {
+	timeout := c.StallTimeout
+	if timeout <= 0 || isRemoteDest(dst) {
+		return func() bool { return false }
+	}
+	if _, ok := networkDest(dst); ok {
+		timeout = max(timeout, c.NetworkFS.Timeout)
+	}
+	done := make(chan struct{})
+	var stalled atomic.Bool
+	go func() {
+		ticker := time.NewTicker(max(min(timeout/4, 30*time.Second), time.Second))
+		defer ticker.Stop()
+		last, lastChange := transferredBytes(c, src, dst), time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if n := transferredBytes(c, src, dst); n != last {
+				last, lastChange = n, time.Now()
+				continue
+			}
+			if time.Since(lastChange) >= timeout {
+				slog.Error("迁移长时间没有进展，终止后重试", "from", src, "to", dst, "timeout", timeout, "copied", formatBytes(last))
+				stalled.Store(true)
+				cancel()
+				return
+			}
+		}
+	}()
+	return func() bool {
+		close(done)
+		return stalled.Load()
+	}
+}
@@ -0,0 +1,233 @@
+package chiamove
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const maxHistory = 200
+
+type Transfer struct {
+	Src        string       `json:"src"`
+	Dst        string       `json:"dst"`
+	Size       uint64       `json:"size"`
+	Copied     uint64       `json:"copied"`
+	State      JournalState `json:"state"`
+	QueuedAt   time.Time    `json:"queuedAt"`
+	StartedAt  time.Time    `json:"startedAt"`
+	FinishedAt time.Time    `json:"finishedAt"`
+	Retries    int          `json:"retries,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// Elapsed 开始复制到结束的时长，没有开始复制时为0
+func (t Transfer) Elapsed() time.Duration {
+	if t.StartedAt.IsZero() {
+		return 0
+	}
+	return t.FinishedAt.Sub(t.StartedAt)
+}
+
+// Tracker 保存排队、进行中和已结束的迁移任务，以及调度器的暂停状态，供API查询
+type Tracker struct {
+	mu       sync.Mutex
+	cancels  map[string]context.CancelCauseFunc
+	queued   map[string]*Transfer
+	active   map[string]*Transfer
+	history  []*Transfer
+	paused   bool
+	resumeCh chan struct{}
+}
+
+var tracker = NewTracker()
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		cancels: map[string]context.CancelCauseFunc{},
+		queued:  map[string]*Transfer{},
+		active:  map[string]*Transfer{},
+	}
+}
+
+// Queue 登记排队的任务，cancel 用于通过API取消
+func (t *Tracker) Queue(src, dst string, cancel context.CancelCauseFunc) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.queued[src] = &Transfer{Src: src, Dst: dst, State: StateQueued, QueuedAt: time.Now()}
+	t.cancels[src] = cancel
+}
+
+// Cancel 取消排队或进行中的任务，任务不存在时返回false
+func (t *Tracker) Cancel(src string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cancel, ok := t.cancels[src]
+	if ok {
+		cancel(errCanceledByUser)
+	}
+	return ok
+}
+
+func (t *Tracker) Start(src string, size uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tr, ok := t.queued[src]
+	if !ok {
+		return
+	}
+	delete(t.queued, src)
+	tr.State, tr.Size, tr.StartedAt = StateRunning, size, time.Now()
+	t.active[src] = tr
+}
+
+// Retry 记录任务的一次重试
+func (t *Tracker) Retry(src string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tr, ok := t.active[src]; ok {
+		tr.Retries++
+	}
+}
+
+// Reroute 任务换到新的目标
+func (t *Tracker) Reroute(src, dst string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tr, ok := t.active[src]; ok {
+		tr.Dst = dst
+	}
+}
+
+// Finish 把任务移到历史记录，返回结束时的任务信息
+func (t *Tracker) Finish(src string, err error) Transfer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.cancels, src)
+	tr, ok := t.active[src]
+	if ok {
+		delete(t.active, src)
+	} else if tr, ok = t.queued[src]; ok {
+		// 还没有开始就被取消
+		delete(t.queued, src)
+	} else {
+		return Transfer{Src: src}
+	}
+	tr.FinishedAt = time.Now()
+	if err != nil {
+		tr.State, tr.Error = StateFailed, err.Error()
+	} else {
+		tr.State, tr.Copied = StateDone, tr.Size
+	}
+	t.history = append(t.history, tr)
+	if len(t.history) > maxHistory {
+		t.history = t.history[len(t.history)-maxHistory:]
+	}
+	return *tr
+}
+
+// Running 返回已排队和进行中的任务数
+func (t *Tracker) Running() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.queued) + len(t.active)
+}
+
+func (t *Tracker) Queued() []Transfer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return sortedTransfers(t.queued)
+}
+
+// Active 返回进行中的任务，已复制的字节数通过统计目标路径的大小得到
+func (t *Tracker) Active() []Transfer {
+	t.mu.Lock()
+	transfers := sortedTransfers(t.active)
+	t.mu.Unlock()
+	for i := range transfers {
+		transfers[i].Copied = min(transferredBytes(config, transfers[i].Src, transfers[i].Dst), transfers[i].Size)
+	}
+	return transfers
+}
+
+func (t *Tracker) History() []Transfer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	history := make([]Transfer, len(t.history))
+	for i, tr := range t.history {
+		history[i] = *tr
+	}
+	return history
+}
+
+func (t *Tracker) Pause() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.paused {
+		t.paused = true
+		t.resumeCh = make(chan struct{})
+	}
+}
+
+func (t *Tracker) Resume() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.paused {
+		t.paused = false
+		close(t.resumeCh)
+	}
+}
+
+func (t *Tracker) Paused() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.paused
+}
+
+// WaitIfPaused 暂停期间阻塞调度器，已经开始的任务不受影响
+func (t *Tracker) WaitIfPaused(ctx context.Context) {
+	t.mu.Lock()
+	paused, ch := t.paused, t.resumeCh
+	t.mu.Unlock()
+	if paused {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func sortedTransfers(m map[string]*Transfer) []Transfer {
+	transfers := make([]Transfer, 0, len(m))
+	for _, tr := range m {
+		transfers = append(transfers, *tr)
+	}
+	sort.Slice(transfers, func(a, b int) bool { return transfers[a].Src < transfers[b].Src })
+	return transfers
+}
+
+// transferredBytes 统计目标上已写入的字节数，包括 .chiamove.partial 和rsync正在写入的 .<name>.XXXXXX 临时文件
+func transferredBytes(c *Config, src, dst string) uint64 {
+	if copied, ok := nativeProgress.Load(src); ok {
+		return copied.(*atomic.Uint64).Load()
+	}
+	if isRemoteDest(dst) {
+		return 0
+	}
+	final := copiedPath(src, dst)
+	dst, name := filepath.Dir(final), filepath.Base(final)
+	size, _ := dirSize(osFS{}, c.DirSize, final)
+	partial, _ := dirSize(osFS{}, c.DirSize, final+partialSuffix)
+	size += partial
+	temps, _ := filepath.Glob(filepath.Join(dst, "."+name+".*"))
+	for _, tmp := range temps {
+		if info, err := os.Stat(tmp); err == nil && !info.IsDir() {
+			size += uint64(info.Size())
+		}
+	}
+	return size
+}
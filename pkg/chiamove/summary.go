@@ -0,0 +1,139 @@
+package chiamove
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RunStats 本次运行结束的所有任务，退出时和守护模式下每隔 summaryInterval 输出汇总
+type RunStats struct {
+	mu       sync.Mutex
+	start    time.Time
+	moved    int
+	bytes    uint64
+	seconds  float64
+	perDest  map[string]*destStats
+	failures []Transfer
+	// 扫描时无法读取的源路径或其中的条目 -> 错误，恢复后移除
+	scanErrors map[string]string
+}
+
+type destStats struct {
+	moved int
+	bytes uint64
+}
+
+var runStats = &RunStats{start: time.Now(), perDest: map[string]*destStats{}, scanErrors: map[string]string{}}
+
+func (s *RunStats) Add(tr Transfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tr.Error != "" {
+		s.failures = append(s.failures, tr)
+		return
+	}
+	s.moved++
+	s.bytes += tr.Size
+	s.seconds += tr.FinishedAt.Sub(tr.StartedAt).Seconds()
+	d := s.perDest[tr.Dst]
+	if d == nil {
+		d = &destStats{}
+		s.perDest[tr.Dst] = d
+	}
+	d.moved++
+	d.bytes += tr.Size
+}
+
+// ScanFailed 记录扫描时无法读取的路径，跳过该路径继续迁移其他源；每个路径在恢复前只记录日志和通知一次
+func (s *RunStats) ScanFailed(path string, err error) {
+	s.mu.Lock()
+	_, reported := s.scanErrors[path]
+	s.scanErrors[path] = err.Error()
+	s.mu.Unlock()
+	if reported {
+		return
+	}
+	slog.Error("扫描时读取失败，跳过", "path", path, "err", err)
+	Notify(Notification{
+		Event:   EventScanError,
+		Message: fmt.Sprintf(T("扫描时读取失败，已跳过 %s: %v"), path, err),
+		Src:     path, Error: err.Error(),
+	})
+}
+
+// ScanSucceeded 之前扫描出错的路径已经可以读取
+func (s *RunStats) ScanSucceeded(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.scanErrors[path]; ok {
+		delete(s.scanErrors, path)
+		slog.Info("扫描时读取恢复正常", "path", path)
+	}
+}
+
+// Totals 返回已完成的任务数和大小
+func (s *RunStats) Totals() (int, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.moved, s.bytes
+}
+
+// ExitCode 有失败的任务时返回 exitPartialFailure，否则返回 code
+func (s *RunStats) ExitCode(code int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.failures) > 0 {
+		return exitPartialFailure
+	}
+	return code
+}
+
+// Log 输出汇总：迁移数量、大小、平均速度、各目标的数量和失败的任务
+func (s *RunStats) Log() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var throughput uint64
+	if s.seconds > 0 {
+		throughput = uint64(float64(s.bytes) / s.seconds)
+	}
+	slog.Info("运行汇总",
+		"elapsed", time.Since(s.start).Round(time.Second),
+		"moved", s.moved,
+		"bytes", formatBytes(s.bytes),
+		"avgThroughput", formatBytes(throughput)+"/s",
+		"failed", len(s.failures),
+		"scanErrors", len(s.scanErrors),
+	)
+	dests := make([]string, 0, len(s.perDest))
+	for dst := range s.perDest {
+		dests = append(dests, dst)
+	}
+	slices.Sort(dests)
+	for _, dst := range dests {
+		d := s.perDest[dst]
+		slog.Info("目标汇总", "dst", dst, "moved", d.moved, "bytes", formatBytes(d.bytes))
+	}
+	for _, tr := range s.failures {
+		slog.Warn("迁移失败", "src", tr.Src, "dst", tr.Dst, "err", tr.Error)
+	}
+	paths := make([]string, 0, len(s.scanErrors))
+	for p := range s.scanErrors {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+	for _, p := range paths {
+		slog.Warn("扫描时读取失败", "path", p, "err", s.scanErrors[p])
+	}
+}
+
+// StartSummaryReporter 守护模式下定期输出汇总
+func StartSummaryReporter(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			runStats.Log()
+		}
+	}()
+}
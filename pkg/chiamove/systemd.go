@@ -0,0 +1,136 @@
+package chiamove
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// sdNotify 向systemd发送状态（Type=notify），不是由systemd启动时什么也不做
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	if strings.HasPrefix(socket, "@") {
+		// 抽象命名空间的socket
+		addr.Name = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		slog.Debug("连接systemd通知socket失败", "socket", socket, "err", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Debug("发送systemd通知失败", "state", state, "err", err)
+	}
+}
+
+// StartWatchdog 配置了 WatchdogSec 时按一半的间隔发送保活消息；stuck 报告调度超过 WatchdogSec 没有进展时停止发送，
+// 由systemd重启进程
+func StartWatchdog(ctx context.Context, stuck func(timeout time.Duration) bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	timeout := time.Duration(usec) * time.Microsecond
+	go func() {
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+		logged := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if stuck(timeout) {
+				if !logged {
+					slog.Error("调度长时间没有进展，停止发送watchdog保活消息", "timeout", timeout)
+					logged = true
+				}
+				continue
+			}
+			logged = false
+			sdNotify("WATCHDOG=1")
+		}
+	}()
+}
+
+var unitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=chiaMove plot mover
+After=local-fs.target network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+ExecStart={{.Exe}} move --config {{.Config}} --daemon
+ExecReload=/bin/kill -HUP $MAINPID
+WorkingDirectory={{.WorkDir}}
+{{- if .User}}
+User={{.User}}
+{{- end}}
+Restart=on-failure
+RestartSec=30
+WatchdogSec=120
+# 收到SIGTERM后终止正在进行的rsync，未完成的任务下次启动时续传
+TimeoutStopSec=60
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// runSystemdInstall 实现 systemd-install 子命令，生成systemd服务文件
+func runSystemdInstall(args []string) int {
+	fs := flag.NewFlagSet("chiamove systemd-install", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", T("服务使用的配置文件路径"))
+	output := fs.String("output", "/etc/systemd/system/chiamove.service", T("服务文件的写入位置，为 - 时输出到标准输出"))
+	user := fs.String("user", "", T("运行服务的用户，默认root"))
+	if err := fs.Parse(args); err != nil {
+		return exitConfigError
+	}
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("获取程序路径失败: %v\n"), err)
+		return exitError
+	}
+	conf, err := filepath.Abs(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("获取配置文件路径失败: %v\n"), err)
+		return exitError
+	}
+	var unit strings.Builder
+	if err := unitTemplate.Execute(&unit, map[string]string{
+		"Exe": exe, "Config": conf, "WorkDir": filepath.Dir(conf), "User": *user,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, T("生成服务文件失败: %v\n"), err)
+		return exitError
+	}
+	if *output == "-" {
+		fmt.Print(unit.String())
+		return exitOK
+	}
+	if err := os.WriteFile(*output, []byte(unit.String()), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, T("写入服务文件失败: %v\n"), err)
+		return exitError
+	}
+	name := strings.TrimSuffix(filepath.Base(*output), ".service")
+	fmt.Printf(T("已写入 %s，执行以下命令启用:\n  systemctl daemon-reload\n  systemctl enable --now %s\n"), *output, name)
+	return exitOK
+}
@@ -0,0 +1,69 @@
+package chiamove
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerStuck(t *testing.T) {
+	s := newTestScheduler(t, newTestConfig(t, t.TempDir(), t.TempDir()), &fakeTransport{})
+	if s.Stuck(time.Minute) {
+		t.Error("idle scheduler reported as stuck")
+	}
+	s.setBusy(true)
+	if s.Stuck(time.Minute) {
+		t.Error("scheduler reported as stuck right after starting a scan")
+	}
+	s.busySince.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	s.setBusy(true)
+	if !s.Stuck(time.Minute) {
+		t.Error("scan running longer than the timeout not reported as stuck")
+	}
+	s.setBusy(false)
+	if s.Stuck(time.Minute) {
+		t.Error("scheduler still reported as stuck after the scan finished")
+	}
+}
+
+func TestWatchdogPingsOnlyWhileNotStuck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not available")
+	}
+	sock := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", sock)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stuck atomic.Bool
+	StartWatchdog(ctx, func(time.Duration) bool { return stuck.Load() })
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "WATCHDOG=1" {
+		t.Fatalf("expected a keep-alive, got %q, %v", buf[:n], err)
+	}
+	stuck.Store(true)
+	// 丢弃设置 stuck 之前已经发出的消息
+	time.Sleep(50 * time.Millisecond)
+	for conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); ; {
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, err := conn.Read(buf); err == nil {
+		t.Errorf("keep-alive %q sent while the scheduler is stuck", buf[:n])
+	}
+}
@@ -0,0 +1,97 @@
+package chiamove
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ThrottleConfig struct {
+	PerTransfer ByteSize `yaml:"perTransfer"` // 单个任务的带宽上限，每秒字节数，可带单位如 100MiB，0 为不限制
+	Global      ByteSize `yaml:"global"`      // 所有任务合计的带宽上限，每秒字节数，可带单位如 100MiB，0 为不限制
+}
+
+var globalLimiter *rateLimiter
+
+// rateLimiter 令牌桶限速，最多积攒1秒的令牌；nil 表示不限速
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSecond uint64) *rateLimiter {
+	if bytesPerSecond == 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(bytesPerSecond), last: time.Now()}
+}
+
+func (l *rateLimiter) Wait(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.rate)
+	l.last = now
+	// 令牌不够时先透支，后来的调用者要等待更久
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+type throttledWriter struct {
+	ctx      context.Context
+	w        io.Writer
+	limiters []*rateLimiter
+	copied   *atomic.Uint64 // 不为nil时累加写入的字节数
+	// 不为nil时每次写入后调用，如丢弃已复制部分的页缓存
+	onWrite func(n int64)
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	if err := t.ctx.Err(); err != nil {
+		return 0, err
+	}
+	for _, l := range t.limiters {
+		l.Wait(len(p))
+	}
+	n, err := t.w.Write(p)
+	t.advance(n)
+	return n, err
+}
+
+// advance 记录已写入 n 字节，零拷贝复制不经过 Write 时直接调用
+func (t *throttledWriter) advance(n int) {
+	if t.copied != nil {
+		t.copied.Add(uint64(n))
+	}
+	if t.onWrite != nil {
+		t.onWrite(int64(n))
+	}
+}
+
+// rsyncBwlimit 计算传给rsync的 --bwlimit（KiB/s），全局上限按当前任务数平分；返回空字符串表示不限速
+func rsyncBwlimit(c *Config) string {
+	throttle := currentThrottle(c)
+	limit := uint64(throttle.PerTransfer)
+	if throttle.Global > 0 {
+		share := uint64(throttle.Global) / uint64(max(tracker.Running(), 1))
+		if limit == 0 || share < limit {
+			limit = share
+		}
+	}
+	if limit == 0 {
+		return ""
+	}
+	return strconv.FormatUint(max(limit/1024, 1), 10)
+}
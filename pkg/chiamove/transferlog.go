@@ -0,0 +1,118 @@
+package chiamove
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// transferLogs 源路径 -> 进行中任务的日志文件，带有该源的 src 或 from 属性的日志同时写入其中
+var (
+	transferLogs     sync.Map
+	openTransferLogs atomic.Int32
+)
+
+type transferLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	handler slog.Handler
+}
+
+// openTransferLog logging.transferDir 不为空时在其中为任务创建单独的日志文件，包括debug级别的rsync输出、
+// 重试和校验结果，排查失败时不用在交错的日志中查找；返回的函数记录耗时和结果后关闭文件
+func openTransferLog(c *Config, src, dst string) func(tr Transfer, err error) {
+	dir := c.Logging.TransferDir
+	if dir == "" {
+		return func(Transfer, error) {}
+	}
+	name := fmt.Sprintf("%s-%s.log", time.Now().Format("20060102-150405"), sourceName(src))
+	err := os.MkdirAll(dir, 0755)
+	var f *os.File
+	if err == nil {
+		f, err = os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	}
+	if err != nil {
+		slog.Warn("创建任务日志文件失败", "src", src, "err", err)
+		return func(Transfer, error) {}
+	}
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	tl := &transferLog{file: f, handler: slog.NewTextHandler(f, opts)}
+	if c.Logging.Format == "json" {
+		tl.handler = slog.NewJSONHandler(f, opts)
+	}
+	transferLogs.Store(src, tl)
+	openTransferLogs.Add(1)
+	slog.Debug("任务开始", "src", src, "dst", dst)
+	return func(tr Transfer, err error) {
+		var speed uint64
+		if s := tr.Elapsed().Seconds(); s > 0 {
+			speed = uint64(float64(tr.Copied) / s)
+		}
+		slog.Debug("任务结束", "src", src, "dst", dst, "elapsed", tr.Elapsed().Round(time.Second), "copied", formatBytes(tr.Copied), "speed", formatBytes(speed)+"/s", "err", err)
+		transferLogs.Delete(src)
+		openTransferLogs.Add(-1)
+		tl.mu.Lock()
+		defer tl.mu.Unlock()
+		tl.file.Close()
+	}
+}
+
+// transferLogHandler 把属于进行中任务的日志同时写入任务的日志文件；
+// 有任务日志时debug级别也要处理，只是不写入主日志
+type transferLogHandler struct {
+	slog.Handler
+	attrs []slog.Attr
+}
+
+func (h *transferLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.Handler.Enabled(ctx, level) || openTransferLogs.Load() > 0
+}
+
+func (h *transferLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if openTransferLogs.Load() > 0 {
+		if tl := h.transferLog(r); tl != nil {
+			rec := r.Clone()
+			rec.AddAttrs(h.attrs...)
+			tl.mu.Lock()
+			tl.handler.Handle(ctx, rec)
+			tl.mu.Unlock()
+		}
+	}
+	if !h.Handler.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *transferLogHandler) transferLog(r slog.Record) *transferLog {
+	var tl *transferLog
+	match := func(a slog.Attr) bool {
+		if a.Key == "src" || a.Key == "from" {
+			if v, ok := transferLogs.Load(a.Value.String()); ok {
+				tl = v.(*transferLog)
+				return false
+			}
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		if !match(a) {
+			return tl
+		}
+	}
+	r.Attrs(match)
+	return tl
+}
+
+func (h *transferLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &transferLogHandler{Handler: h.Handler.WithAttrs(attrs), attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *transferLogHandler) WithGroup(name string) slog.Handler {
+	return &transferLogHandler{Handler: h.Handler.WithGroup(name), attrs: h.attrs}
+}
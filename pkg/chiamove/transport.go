@@ -0,0 +1,87 @@
+package chiamove
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+)
+
+// Transport 一种复制后端，调度只通过该接口复制、续传、校验和查询容量，
+// 新增后端只需实现该接口并在 transportFor 中注册
+type Transport interface {
+	Name() string
+	// Resume 复制前整理目标上次中断留下的部分，使 Copy 能从已写入的位置继续；interrupted 为任务日志记录的
+	// 上次运行中没有完成、迁移到该目标的任务。目标上已有不需要续传的完整副本时返回 errDuplicate
+	Resume(src, dst string, interrupted bool) error
+	// Copy 把 src（文件或文件夹）复制到目标 dst 下，完成后为最终名称
+	Copy(ctx context.Context, src, dst string) error
+	// Verify 删除源之前按 verify 配置比较源和目标上的副本
+	Verify(ctx context.Context, src, dst string) error
+	FreeSpace(dst string) (DiskUsage, error)
+}
+
+// transportFor 按目标路径的形式选择按 c 工作的后端，本地目标按 copyMethod 选择，auto 时有rsync就用rsync，否则（如Windows）使用内置复制
+func transportFor(c *Config, dst string) Transport {
+	if isSimulated(dst) {
+		return simTransport{c}
+	}
+	if _, ok := parseAgent(dst); ok {
+		return agentTransport{c}
+	}
+	if _, ok := parseS3(dst); ok {
+		return s3Transport{c}
+	}
+	if _, ok := parseRsyncDaemon(dst); ok {
+		return rsyncDaemonTransport{c}
+	}
+	if _, ok := parseRemote(dst); ok {
+		return sshTransport{c}
+	}
+	switch c.CopyMethod {
+	case "rsync":
+		return rsyncTransport{localTransport{c}}
+	case "native":
+		return nativeTransport{localTransport{c}}
+	}
+	if _, err := exec.LookPath(c.Rsync.Binary); err != nil {
+		return nativeTransport{localTransport{c}}
+	}
+	return rsyncTransport{localTransport{c}}
+}
+
+// localTransport 本地目标共用的续传、校验和容量查询，复制时先写入 <名称>.chiamove.partial
+type localTransport struct{ cfg *Config }
+
+func (t localTransport) Resume(src, dst string, interrupted bool) error {
+	return preparePartial(t.cfg, src, dst, interrupted)
+}
+
+func (t localTransport) Verify(ctx context.Context, src, dst string) error {
+	return verifyCopy(ctx, t.cfg, osFS{}, src, filepath.Join(dst, filepath.Base(src)), localFiles{osFS{}})
+}
+
+func (localTransport) FreeSpace(dst string) (DiskUsage, error) {
+	return GetDiskUsage(dst)
+}
+
+type rsyncTransport struct{ localTransport }
+
+func (rsyncTransport) Name() string { return "rsync" }
+
+func (t rsyncTransport) Copy(ctx context.Context, src, dst string) error {
+	if err := rsyncCopy(ctx, t.cfg, src, filepath.Join(dst, filepath.Base(src)+partialSuffix)); err != nil {
+		return err
+	}
+	return finishPartial(src, dst)
+}
+
+type nativeTransport struct{ localTransport }
+
+func (nativeTransport) Name() string { return "native" }
+
+func (t nativeTransport) Copy(ctx context.Context, src, dst string) error {
+	if err := nativeCopy(ctx, t.cfg, src, filepath.Join(dst, filepath.Base(src)+partialSuffix)); err != nil {
+		return err
+	}
+	return finishPartial(src, dst)
+}
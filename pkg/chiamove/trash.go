@@ -0,0 +1,260 @@
+package chiamove
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// TrashConfig 迁移完成的源先移到回收站，保留一段时间（或目标上的plot已被harvester加载）后再删除，
+// 目标上的plot之后才发现损坏时还能从回收站恢复
+type TrashConfig struct {
+	// 回收站目录，为空时迁移完成后直接删除源；相对路径在每个源路径下创建，移动只是rename
+	Dir string `yaml:"dir"`
+	// 在回收站中保留的最短时间，默认24h
+	Retention time.Duration `yaml:"retention"`
+	// 还要等目标上的plot出现在harvester的plot列表中才删除，需要 harvester.refresh 为 rpc 或 command
+	UntilFarmed bool `yaml:"untilFarmed"`
+	// 删除时每秒最多释放的字节数，大文件逐步截断后再删除，避免源盘IO卡顿影响P图；0 为不限制
+	DeleteRate ByteSize `yaml:"deleteRate"`
+}
+
+// 回收站目录中记录各条目来源和移入时间的文件
+const trashIndexName = ".chiamove-trash.json"
+
+// 检查回收站中是否有可以删除的条目的间隔
+const trashPurgeInterval = 10 * time.Minute
+
+type trashEntry struct {
+	Name      string    `json:"name"`
+	Src       string    `json:"src"`
+	Dst       string    `json:"dst"`
+	TrashedAt time.Time `json:"trashedAt"`
+}
+
+var trashMu sync.Mutex
+
+// trashDir 返回源路径 fromPath 使用的回收站目录
+func trashDir(c *Config, fromPath string) string {
+	if filepath.IsAbs(c.Trash.Dir) {
+		return c.Trash.Dir
+	}
+	return filepath.Join(fromPath, c.Trash.Dir)
+}
+
+// isTrashDir 判断源路径下的条目是否为回收站本身，扫描时跳过
+func isTrashDir(c *Config, fromPath, path string) bool {
+	return c.Trash.Dir != "" && filepath.Clean(path) == filepath.Clean(trashDir(c, fromPath))
+}
+
+// removeSource 迁移完成后移走源：配置了回收站时移入回收站，否则按 deleteRate 删除
+func removeSource(c *Config, src, dst string) error {
+	if c.Trash.Dir == "" {
+		return removeSlowly(src, c.Trash.DeleteRate)
+	}
+	dir := trashDir(c, filepath.Dir(src))
+	name := filepath.Base(src)
+	if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+		name = fmt.Sprintf("%s.%d", name, time.Now().Unix())
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = os.Rename(src, filepath.Join(dir, name))
+	}
+	if err != nil {
+		slog.Warn("移到回收站失败，直接删除源", "path", src, "trash", dir, "err", err)
+		return removeSlowly(src, c.Trash.DeleteRate)
+	}
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	entries, err := readTrashIndex(dir)
+	if err == nil {
+		entries = append(entries, trashEntry{Name: name, Src: src, Dst: dst, TrashedAt: time.Now()})
+		err = writeTrashIndex(dir, entries)
+	}
+	if err != nil {
+		slog.Error("写入回收站记录失败", "path", dir, "err", err)
+	}
+	slog.Info("源已移到回收站", "path", src, "trash", dir, "retention", c.Trash.Retention)
+	return nil
+}
+
+func readTrashIndex(dir string) ([]trashEntry, error) {
+	buf, err := os.ReadFile(filepath.Join(dir, trashIndexName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []trashEntry
+	if err := json.Unmarshal(buf, &entries); err != nil {
+		return nil, fmt.Errorf(T("解析回收站记录 %s 失败: %w"), dir, err)
+	}
+	return entries, nil
+}
+
+func writeTrashIndex(dir string, entries []trashEntry) error {
+	buf, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, trashIndexName+".tmp")
+	if err := os.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, trashIndexName))
+}
+
+// StartTrashPurger 启动时和之后每隔 trashPurgeInterval 删除回收站中已过保留期的条目；
+// 返回的函数停止定时清理，等待进行中的清理结束后再清理一次，非守护模式退出前也能删除到期的条目
+func StartTrashPurger(ctx context.Context) func() {
+	if config.Trash.Dir == "" {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		for {
+			purgeTrash(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-time.After(trashPurgeInterval):
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		purgeTrash(ctx)
+	}
+}
+
+var purgeMu sync.Mutex
+
+func purgeTrash(ctx context.Context) {
+	purgeMu.Lock()
+	defer purgeMu.Unlock()
+	dirs := map[string]bool{}
+	for _, p := range expandFromPaths(config.FromPaths) {
+		if !isRemoteSource(p) {
+			dirs[trashDir(config, p)] = true
+		}
+	}
+	farmed := map[string][]string{}
+	for dir := range dirs {
+		trashMu.Lock()
+		entries, err := readTrashIndex(dir)
+		trashMu.Unlock()
+		if err != nil {
+			slog.Error("读取回收站记录失败", "path", dir, "err", err)
+			continue
+		}
+		var purged []string
+		for _, e := range entries {
+			if ctx.Err() != nil {
+				return
+			}
+			if time.Since(e.TrashedAt) < config.Trash.Retention {
+				continue
+			}
+			path := filepath.Join(dir, e.Name)
+			if config.Trash.UntilFarmed && !isFarmed(ctx, path, e, farmed) {
+				continue
+			}
+			if err := removeSlowly(path, config.Trash.DeleteRate); err != nil {
+				slog.Error("删除回收站中的源失败", "path", path, "err", err)
+				continue
+			}
+			slog.Info("已删除回收站中的源", "path", path, "src", e.Src, "dst", e.Dst)
+			purged = append(purged, e.Name)
+		}
+		if len(purged) == 0 {
+			continue
+		}
+		// 删除期间可能有新的条目移入，重新读取后再去掉已删除的
+		trashMu.Lock()
+		if entries, err = readTrashIndex(dir); err == nil {
+			entries = slices.DeleteFunc(entries, func(e trashEntry) bool { return slices.Contains(purged, e.Name) })
+			err = writeTrashIndex(dir, entries)
+		}
+		trashMu.Unlock()
+		if err != nil {
+			slog.Error("写入回收站记录失败", "path", dir, "err", err)
+		}
+	}
+}
+
+// isFarmed 判断回收站中的条目 path 包含的plot是否都已出现在其目标所在harvester的plot列表中，
+// farmed 缓存本轮已经获取过的列表
+func isFarmed(ctx context.Context, path string, e trashEntry, farmed map[string][]string) bool {
+	dst := e.Dst
+	names, ok := farmed[dst]
+	if !ok {
+		ctx, cancel := context.WithTimeout(ctx, harvesterRefreshTimeout)
+		defer cancel()
+		var result struct {
+			Plots []struct {
+				Filename string `json:"filename"`
+			} `json:"plots"`
+		}
+		if err := harvesterCall(ctx, dst, "get_plots", &result); err != nil {
+			slog.Warn("获取harvester的plot列表失败", "dst", dst, "err", err)
+			return false
+		}
+		for _, p := range result.Plots {
+			names = append(names, filepath.Base(p.Filename))
+		}
+		farmed[dst] = names
+	}
+	// 同名条目移入回收站时加了时间后缀，按原来的名称查找
+	plots := []string{filepath.Base(e.Src)}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		plots = plotFiles(path)
+	}
+	for _, p := range plots {
+		if !slices.Contains(names, p) {
+			return false
+		}
+	}
+	return len(plots) > 0
+}
+
+// removeSlowly 删除 path（文件或文件夹），rate 大于0时先把每个文件按 rate 逐步截断，
+// 避免一次释放大量空间时文件系统长时间阻塞其他IO
+func removeSlowly(path string, rate ByteSize) error {
+	if rate > 0 {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			for size := info.Size(); size > 0; {
+				size -= min(size, int64(rate))
+				if err := os.Truncate(p, size); err != nil {
+					return err
+				}
+				if size > 0 {
+					time.Sleep(time.Second)
+				}
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.RemoveAll(path)
+}
@@ -0,0 +1,119 @@
+package chiamove
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const tuiBarWidth = 30
+
+// StartTUI 每隔 interval 重绘一次终端界面，返回的函数停止刷新并画出最后一帧
+func StartTUI(interval time.Duration, skip func(path string) bool) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			renderTUI(os.Stdout, skip)
+			select {
+			case <-ticker.C:
+			case <-done:
+				renderTUI(os.Stdout, skip)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func renderTUI(w io.Writer, skip func(path string) bool) {
+	var b bytes.Buffer
+	// 光标移到左上角并清屏
+	b.WriteString("\033[H\033[2J")
+	state := T("运行中")
+	if tracker.Paused() {
+		state = T("已暂停")
+	}
+	fmt.Fprintf(&b, "chiaMove  %s  %s\n\n", time.Now().Format("2006-01-02 15:04:05"), state)
+
+	// 配置可能被重新加载，取当前的快照
+	cfg := currentConfig()
+	b.WriteString(T("\033[1m源路径\033[0m\n"))
+	for _, from := range expandFromPaths(cfg.FromPaths) {
+		fmt.Fprintf(&b, T("  %-50s 待迁移 %d\n"), from, countCandidates(cfg, from, skip))
+	}
+
+	b.WriteString(T("\n\033[1m进行中\033[0m\n"))
+	active := tracker.Active()
+	if len(active) == 0 {
+		b.WriteString(T("  无\n"))
+	}
+	for _, tr := range active {
+		var ratio float64
+		if tr.Size > 0 {
+			ratio = float64(tr.Copied) / float64(tr.Size)
+		}
+		var speed float64
+		if elapsed := time.Since(tr.StartedAt).Seconds(); elapsed > 0 {
+			speed = float64(tr.Copied) / elapsed
+		}
+		fmt.Fprintf(&b, "  %s -> %s\n    %s %s/%s %s/s\n", filepath.Base(tr.Src), tr.Dst,
+			progressBar(ratio, tuiBarWidth), formatBytes(tr.Copied), formatBytes(tr.Size), formatBytes(uint64(speed)))
+	}
+	for _, tr := range tracker.Queued() {
+		fmt.Fprintf(&b, T("  %s -> %s  排队中\n"), filepath.Base(tr.Src), tr.Dst)
+	}
+
+	b.WriteString(T("\n\033[1m目标路径\033[0m\n"))
+	for _, dest := range destinations() {
+		usage, err := GetDestinationUsage(dest)
+		if err != nil || usage.Total == 0 {
+			fmt.Fprintf(&b, T("  %-40s 无法获取容量\n"), dest)
+			continue
+		}
+		used := float64(usage.Total-usage.Free) / float64(usage.Total)
+		fmt.Fprintf(&b, T("  %-40s %s 剩余 %s\n"), dest, progressBar(used, tuiBarWidth), formatBytes(usage.Free))
+	}
+
+	b.WriteString(T("\n\033[1m最近的错误\033[0m\n"))
+	errs := RecentErrors()
+	if len(errs) == 0 {
+		b.WriteString(T("  无\n"))
+	}
+	for _, e := range errs[max(len(errs)-8, 0):] {
+		b.WriteString("  " + e + "\n")
+	}
+	w.Write(b.Bytes())
+}
+
+// countCandidates 统计源路径下名称和类型符合任一过滤规则的条目数，不计算大小，只用于展示
+func countCandidates(cfg *Config, fromPath string, skip func(path string) bool) int {
+	entries, err := os.ReadDir(fromPath)
+	if err != nil {
+		return 0
+	}
+	rules := cfg.filterRules(fromPath)
+	n := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if isExcluded(cfg, name) || skip(filepath.Join(fromPath, name)) {
+			continue
+		}
+		for i := range rules {
+			if rules[i].matchEntry(entry) {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,248 @@
+package chiamove
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// diagnostic validate 发现的一个问题，hint 为建议的处理方法；warning 不影响退出码
+type diagnostic struct {
+	warning bool
+	msg     string
+	hint    string
+}
+
+// runValidate 实现 validate 子命令，检查配置格式和取值、路径是否存在、源和目标是否重叠或在同一块磁盘上
+func runValidate(args []string) int {
+	opts, err := ParseOptions(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		return exitConfigError
+	}
+	buf, err := loadConfigFile(opts.ConfigPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, T("读取配置失败: %v\n"), err)
+		return exitConfigError
+	}
+	diags := checkSchema(buf)
+	c, err := readConfig(opts.ConfigPath, opts.Profile, "")
+	if err != nil {
+		printDiagnostics(diags)
+		fmt.Fprintf(os.Stderr, T("读取配置失败: %v\n"), err)
+		return exitConfigError
+	}
+	SetLanguage(c.Language)
+	// 配置了 profiles 或 stages 时分别检查每一个
+	configs := map[string]*Config{"": c}
+	names := []string{""}
+	if len(c.Profiles) > 0 {
+		if err := validateProfiles(c.Profiles); err != nil {
+			printDiagnostics(append(diags, diagnostic{msg: err.Error()}))
+			return exitConfigError
+		}
+		names = nil
+		for _, p := range c.Profiles {
+			pc, err := readConfig(opts.ConfigPath, p.Name, "")
+			if err != nil {
+				printDiagnostics(append(diags, diagnostic{msg: err.Error()}))
+				return exitConfigError
+			}
+			configs[p.Name] = pc
+			names = append(names, p.Name)
+		}
+	} else if len(c.Stages) > 0 {
+		if err := validateStages(c.Stages); err != nil {
+			printDiagnostics(append(diags, diagnostic{msg: err.Error()}))
+			return exitConfigError
+		}
+		names = nil
+		for _, s := range c.Stages {
+			sc, err := readConfig(opts.ConfigPath, opts.Profile, s.Name)
+			if err != nil {
+				printDiagnostics(append(diags, diagnostic{msg: err.Error()}))
+				return exitConfigError
+			}
+			configs[s.Name] = sc
+			names = append(names, s.Name)
+		}
+	}
+	for _, name := range names {
+		sc := configs[name]
+		opts.Apply(sc)
+		var stageDiags []diagnostic
+		if err := sc.Validate(); err != nil {
+			stageDiags = append(stageDiags, diagnostic{msg: err.Error()})
+		}
+		stageDiags = append(stageDiags, diagnose(sc)...)
+		for _, d := range stageDiags {
+			if name != "" {
+				d.msg = "[" + name + "] " + d.msg
+			}
+			diags = append(diags, d)
+		}
+	}
+	if printDiagnostics(diags) > 0 {
+		return exitConfigError
+	}
+	if len(c.Profiles) > 0 {
+		fmt.Printf(T("配置有效: %d 个profile\n"), len(c.Profiles))
+		return exitOK
+	}
+	if len(c.Stages) > 0 {
+		fmt.Printf(T("配置有效: %d 级迁移\n"), len(c.Stages))
+		return exitOK
+	}
+	fmt.Printf(T("配置有效: %d 个源路径，%d 个目标路径，%d 个目标通配符\n"), len(c.FromPaths), len(c.ToPaths), len(c.ToPathsGlob))
+	return exitOK
+}
+
+// checkSchema 严格解析配置，找出拼错的字段名和类型不对的值
+func checkSchema(buf []byte) []diagnostic {
+	hint := T("检查字段名的拼写、缩进和取值类型，可以参考示例 config.yaml")
+	var c Config
+	if err := yaml.UnmarshalStrict(buf, &c); err != nil {
+		return []diagnostic{{msg: fmt.Sprintf(T("配置格式有误: %v"), err), hint: hint}}
+	}
+	var diags []diagnostic
+	for _, s := range c.Stages {
+		stageBuf, err := yaml.Marshal(s.Overrides)
+		if err == nil {
+			err = yaml.UnmarshalStrict(stageBuf, &Config{})
+		}
+		if err != nil {
+			diags = append(diags, diagnostic{msg: fmt.Sprintf(T("stages 中 %s 格式有误: %v"), s.Name, err), hint: hint})
+		}
+	}
+	for _, p := range c.Profiles {
+		profileBuf, err := yaml.Marshal(p.Overrides)
+		if err == nil {
+			err = yaml.UnmarshalStrict(profileBuf, &Config{})
+		}
+		if err != nil {
+			diags = append(diags, diagnostic{msg: fmt.Sprintf(T("profiles 中 %s 格式有误: %v"), p.Name, err), hint: hint})
+		}
+	}
+	return diags
+}
+
+// diagnose 检查路径：是否存在，源和目标是否重叠，是否在同一块磁盘上
+func diagnose(c *Config) []diagnostic {
+	var diags []diagnostic
+	for _, p := range c.FromPaths {
+		if hasGlob(p) && !isRemoteSource(p) && len(expandFromPaths([]string{p})) == 0 {
+			diags = append(diags, diagnostic{
+				warning: true,
+				msg:     fmt.Sprintf(T("源路径通配符没有匹配到目录: %s"), p),
+				hint:    T("每轮调度会重新查找，临时盘挂载后自动加入"),
+			})
+		}
+	}
+	fromPaths := expandFromPaths(c.FromPaths)
+	for _, p := range fromPaths {
+		if isRemoteSource(p) {
+			continue
+		}
+		if info, err := os.Stat(p); err != nil || !info.IsDir() {
+			diags = append(diags, diagnostic{
+				msg:  fmt.Sprintf(T("源路径不存在或不是目录: %s"), p),
+				hint: T("确认硬盘已挂载，或从 fromPaths 中删除该路径"),
+			})
+		}
+	}
+	for _, p := range c.ToPaths {
+		if isRemoteDest(p) {
+			continue
+		}
+		if info, err := os.Stat(p); err != nil || !info.IsDir() {
+			diags = append(diags, diagnostic{
+				msg:  fmt.Sprintf(T("目标路径不存在或不是目录: %s"), p),
+				hint: T("确认硬盘已挂载并创建该目录，或从 toPaths 中删除该路径"),
+			})
+		}
+	}
+	for _, from := range fromPaths {
+		for _, to := range c.ToPaths {
+			if isRemoteDest(to) || isRemoteSource(from) {
+				continue
+			}
+			if overlaps(from, to) {
+				diags = append(diags, diagnostic{
+					msg:  fmt.Sprintf(T("源路径 %s 和目标路径 %s 重叠"), from, to),
+					hint: T("迁移过去的plot会被再次当作源，请使用互不包含的目录"),
+				})
+				continue
+			}
+			fromDev, err1 := deviceID(from)
+			toDev, err2 := deviceID(to)
+			if err1 == nil && err2 == nil && fromDev == toDev {
+				diags = append(diags, diagnostic{
+					warning: true,
+					msg:     fmt.Sprintf(T("源路径 %s 和目标路径 %s 在同一块磁盘 %s 上"), from, to, fromDev),
+					hint:    T("迁移不会释放这块磁盘的空间，确认是否配置错了路径"),
+				})
+			}
+		}
+	}
+	return diags
+}
+
+// isWithin 判断 child 是否为 parent 或在其下
+func isWithin(parent, child string) bool {
+	parent, err1 := filepath.Abs(parent)
+	child, err2 := filepath.Abs(child)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	rel, err := filepath.Rel(parent, child)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+var errOverlap = sentinelError("源和目标重叠")
+
+// overlaps 判断两个路径是否相同或互相包含，解析符号链接前后任一情况重叠都算
+func overlaps(a, b string) bool {
+	if isWithin(a, b) || isWithin(b, a) {
+		return true
+	}
+	ra, err1 := filepath.EvalSymlinks(a)
+	rb, err2 := filepath.EvalSymlinks(b)
+	return err1 == nil && err2 == nil && (isWithin(ra, rb) || isWithin(rb, ra))
+}
+
+// overlappingDestination 返回 dests 中与源 src 重叠的本地目标，迁移这样的源会在复制后删掉目标上的数据
+func overlappingDestination(src string, dests []string) (string, bool) {
+	if isRemoteSource(src) {
+		return "", false
+	}
+	for _, to := range dests {
+		if !isRemoteDest(to) && overlaps(src, to) {
+			return to, true
+		}
+	}
+	return "", false
+}
+
+// printDiagnostics 输出问题和建议，返回错误的数量
+func printDiagnostics(diags []diagnostic) int {
+	errs := 0
+	for _, d := range diags {
+		label := T("警告")
+		if !d.warning {
+			label = T("错误")
+			errs++
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", label, d.msg)
+		if d.hint != "" {
+			fmt.Fprintf(os.Stderr, "  %s\n", d.hint)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,225 @@
+package chiamove
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// VerifySampleConfig verify 为 sample 时抽样校验的范围
+type VerifySampleConfig struct {
+	HeadTail  ByteSize `yaml:"headTail"`  // 比较开头和结尾各多少字节，默认 16MiB
+	Blocks    int      `yaml:"blocks"`    // 另外随机抽取的块数，默认 16
+	BlockSize ByteSize `yaml:"blockSize"` // 随机块的大小，默认 1MiB
+}
+
+var errVerifyFailed = sentinelError("校验未通过")
+
+var errSizeMismatch = sentinelError("目标大小与源不一致")
+
+// verifiable 判断目标上的副本能否校验，agent和s3目标的校验会被跳过
+func verifiable(dst string) bool {
+	_, agent := parseAgent(dst)
+	_, s3 := parseS3(dst)
+	return !agent && !s3 && !isSimulated(dst)
+}
+
+// verifyFiles 读取目标上的文件，与源文件比较
+type verifyFiles interface {
+	size(ctx context.Context, file string) (int64, error)
+	// hash 计算 [offset, offset+length) 的SHA-256，length 为 -1 时到文件结尾
+	hash(ctx context.Context, file string, offset, length int64) (string, error)
+	join(dst, rel string) string
+}
+
+// verifyCopy 删除源之前按 c.Verify 比较 fsys 上的源和目标上的副本 final，不一致时删除该副本，重试时重新复制
+func verifyCopy(ctx context.Context, c *Config, fsys FileSystem, src, final string, target verifyFiles) error {
+	if c.Verify == "none" {
+		return nil
+	}
+	err := walkDir(fsys, src, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && otherFilesystem(c.DirSize, src, p) {
+			return filepath.SkipDir
+		}
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		out := final
+		if rel != "." {
+			out = target.join(final, filepath.ToSlash(rel))
+		}
+		return verifyFile(ctx, c, fsys, p, out, target)
+	})
+	if errors.Is(err, errVerifyFailed) {
+		slog.Error("校验未通过，删除目标上的副本并保留源文件", "src", src, "dst", final, "err", err)
+		removeVerifyFailed(final, target)
+	}
+	return err
+}
+
+// checkCopiedSize 删除源之前比较源和本地目标上副本的总大小，与 verify 无关，防止复制工具报告成功但文件被截断；
+// 不一致时保留源和目标供人工检查
+func (s *Scheduler) checkCopiedSize(src, dst string) error {
+	if isRemoteDest(dst) {
+		return nil
+	}
+	final := filepath.Join(dst, filepath.Base(src))
+	want, err := dirSize(s.fsys, s.cfg.DirSize, src)
+	if err != nil {
+		return err
+	}
+	got, err := dirSize(s.fsys, s.cfg.DirSize, final)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		slog.Error("目标大小与源不一致，保留源文件", "src", src, "srcSize", want, "dst", final, "dstSize", got)
+		return fmt.Errorf(T("%w: %s 为 %d 字节，源为 %d 字节"), errSizeMismatch, final, got, want)
+	}
+	return nil
+}
+
+func removeVerifyFailed(final string, target verifyFiles) {
+	var err error
+	switch t := target.(type) {
+	case sshFiles:
+		_, err = t.r.run("rm -rf -- " + shellQuote(final))
+	default:
+		err = os.RemoveAll(final)
+	}
+	if err != nil {
+		slog.Error("删除校验未通过的目标失败", "path", final, "err", err)
+	}
+}
+
+func verifyFile(ctx context.Context, c *Config, fsys FileSystem, src, dst string, target verifyFiles) error {
+	info, err := fsys.Stat(src)
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	dstSize, err := target.size(ctx, dst)
+	if err != nil {
+		return err
+	}
+	if dstSize != size {
+		return fmt.Errorf(T("%w: %s 大小 %d 与源文件 %d 不一致"), errVerifyFailed, dst, dstSize, size)
+	}
+	type span struct{ offset, length int64 }
+	var spans []span
+	if c.Verify == "full" {
+		spans = []span{{0, -1}}
+	} else {
+		cfg := c.VerifySample
+		headTail := min(int64(cfg.HeadTail), size)
+		spans = append(spans, span{0, headTail}, span{size - headTail, headTail})
+		if block := int64(cfg.BlockSize); size > block {
+			for i := 0; i < cfg.Blocks; i++ {
+				spans = append(spans, span{rand.Int63n(size - block), block})
+			}
+		}
+	}
+	for _, s := range spans {
+		want, err := localFiles{fsys}.hash(ctx, src, s.offset, s.length)
+		if err != nil {
+			return err
+		}
+		got, err := target.hash(ctx, dst, s.offset, s.length)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return fmt.Errorf(T("%w: %s 在偏移 %d 处的内容与源文件不一致"), errVerifyFailed, dst, s.offset)
+		}
+	}
+	return nil
+}
+
+type localFiles struct{ fsys FileSystem }
+
+func (l localFiles) size(_ context.Context, file string) (int64, error) {
+	info, err := l.fsys.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (l localFiles) hash(ctx context.Context, file string, offset, length int64) (string, error) {
+	f, err := l.fsys.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var r io.Reader = io.NewSectionReader(f, offset, 1<<62)
+	if length >= 0 {
+		r = io.NewSectionReader(f, offset, length)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, ctxReader{ctx, r}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (localFiles) join(dst, rel string) string {
+	return filepath.Join(dst, filepath.FromSlash(rel))
+}
+
+// sshFiles 通过ssh在远端读取，需要远端有 sha256sum
+type sshFiles struct {
+	r remoteTarget
+}
+
+func (s sshFiles) size(ctx context.Context, file string) (int64, error) {
+	out, err := s.r.runContext(ctx, "wc -c < "+shellQuote(file))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+}
+
+func (s sshFiles) hash(ctx context.Context, file string, offset, length int64) (string, error) {
+	cmd := fmt.Sprintf("tail -c +%d -- %s", offset+1, shellQuote(file))
+	if length >= 0 {
+		cmd += fmt.Sprintf(" | head -c %d", length)
+	}
+	out, err := s.r.runContext(ctx, cmd+" | sha256sum")
+	if err != nil {
+		return "", err
+	}
+	sum, _, _ := strings.Cut(strings.TrimSpace(string(out)), " ")
+	return sum, nil
+}
+
+func (sshFiles) join(dst, rel string) string {
+	return path.Join(dst, rel)
+}
+
+// ctxReader ctx 取消后停止读取，避免关闭进程时还要等大文件校验完
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,73 @@
+//go:build linux
+
+package chiamove
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// zeroCopyUnsupported 文件系统或内核不支持该系统调用，换下一种方式复制
+func zeroCopyUnsupported(err error) bool {
+	return errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EINVAL) ||
+		errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EPERM)
+}
+
+// copyFileRange 每次系统调用最多复制 chunk（native.bufferSize）字节，限速、取消和进度按这个粒度生效。
+// 用 copy_file_range 把 in 的 [offset, offset+length) 复制到 out 的相同位置，数据不经过用户态；
+// 第一次调用就不支持时返回 errors.ErrUnsupported，此时没有写入任何数据
+func copyFileRange(w *throttledWriter, out, in *os.File, offset, length, chunk int64) error {
+	for done := int64(0); done < length; {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		n := int(min(chunk, length-done))
+		for _, l := range w.limiters {
+			l.Wait(n)
+		}
+		roff, woff := offset+done, offset+done
+		written, err := unix.CopyFileRange(int(in.Fd()), &roff, int(out.Fd()), &woff, n, 0)
+		if err != nil {
+			if done == 0 && zeroCopyUnsupported(err) {
+				return errors.ErrUnsupported
+			}
+			return err
+		}
+		if written == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		done += int64(written)
+		w.advance(written)
+	}
+	return nil
+}
+
+// sendFile 用 sendfile 把 in 从 offset 开始的 length 字节写到 out 的当前位置，不支持时返回 errors.ErrUnsupported
+func sendFile(w *throttledWriter, out, in *os.File, offset, length, chunk int64) error {
+	for done := int64(0); done < length; {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		n := int(min(chunk, length-done))
+		for _, l := range w.limiters {
+			l.Wait(n)
+		}
+		roff := offset + done
+		written, err := unix.Sendfile(int(out.Fd()), int(in.Fd()), &roff, n)
+		if err != nil {
+			if done == 0 && zeroCopyUnsupported(err) {
+				return errors.ErrUnsupported
+			}
+			return err
+		}
+		if written == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		done += int64(written)
+		w.advance(written)
+	}
+	return nil
+}
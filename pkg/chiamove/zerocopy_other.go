@@ -0,0 +1,16 @@
+//go:build !linux
+
+package chiamove
+
+import (
+	"errors"
+	"os"
+)
+
+func copyFileRange(w *throttledWriter, out, in *os.File, offset, length, chunk int64) error {
+	return errors.ErrUnsupported
+}
+
+func sendFile(w *throttledWriter, out, in *os.File, offset, length, chunk int64) error {
+	return errors.ErrUnsupported
+}